@@ -4,12 +4,17 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"html"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
-	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
 
 // Config — настройки bridge, читаемые из env.
@@ -20,6 +25,7 @@ type Config struct {
 	WebhookURL   string  // базовый URL для webhook (если пусто — long polling)
 	WebhookPort  string  // порт для webhook сервера
 	TgAPIURL         string  // custom TG Bot API URL (если пусто — api.telegram.org)
+	MaxAPIURL        string  // custom MAX API URL (если пусто — platform-api.max.ru)
 	AllowedUsers     []int64 // whitelist TG user IDs (empty = allow all)
 	TgMaxFileSizeMB  int     // max file size TG->MAX in MB (0 = unlimited)
 	MaxMaxFileSizeMB int     // max file size MAX->TG in MB (0 = unlimited)
@@ -29,6 +35,33 @@ type Config struct {
 	// MessageNewline — если true, текст идёт с новой строки после имени отправителя:
 	// "Имя:\nтекст" вместо "Имя: текст". Задаётся через env MESSAGE_FORMAT=newline.
 	MessageNewline bool
+	// Лимиты исходящих отправок: *RateGlobal — сообщений в секунду на бота,
+	// *RateChat — сообщений в минуту на один чат (0 = без ограничения).
+	TgRateGlobal  float64
+	TgRateChat    float64
+	MaxRateGlobal float64
+	MaxRateChat   float64
+	// MetricsPort — порт отдельного сервера /metrics, /healthz, /readyz. Если пуст, они
+	// отдаются webhook-сервером (в режиме polling тогда выключены).
+	MetricsPort string
+	// Чаты операторов, куда приходят предупреждения о простое listener'ов
+	// (OPERATOR_TG_CHATS / OPERATOR_MAX_CHATS) и через сколько простоя предупреждать
+	// (LISTENER_ALERT_AFTER, 0 = 5 минут).
+	OperatorTgChats    []int64
+	OperatorMaxChats   []int64
+	ListenerAlertAfter time.Duration
+	// Другие боты-мосты в связанных чатах (BRIDGE_TG_BOTS / BRIDGE_MAX_BOTS, user ID):
+	// их сообщения не пересылаются, чтобы два моста не гоняли сообщения по кругу.
+	BridgeTgBots  []int64
+	BridgeMaxBots []int64
+	// Tenants — пары ботов мультитенантного режима (tenants в CONFIG_FILE или
+	// TENANTS_FILE). Пустой список — единственная пара из TG_TOKEN / MAX_TOKEN.
+	Tenants []tenantConfig
+	// TenantID — арендатор в мультитенантном режиме: пространство имён
+	// в общей БД и метка tenant в метриках. Пустой — единственный мост процесса.
+	TenantID string
+	// WebhookSecret — секрет в пути webhook'ов; если пуст, выводится из токенов.
+	WebhookSecret string
 }
 
 // chatBreaker хранит состояние circuit breaker для одного чата.
@@ -45,12 +78,13 @@ const (
 // Bridge — основная структура, объединяющая зависимости.
 type Bridge struct {
 	cfg        Config
+	cfgMu      sync.RWMutex // защищает cfg при перезагрузке (SIGHUP)
 	repo       Repository
 	tg          TGSender
-	maxApi      *maxbot.Api
+	max         MAXSender
+	limiters    []*rateLimiter // лимитеры tg и max — для очистки простаивающих корзин чатов
 	maxBotUID   int64 // MAX bot user ID (для фильтрации своих сообщений)
 	httpClient *http.Client // для скачивания/загрузки файлов (большой таймаут)
-	apiClient  *http.Client // для коротких API-запросов (малый таймаут)
 	whSecret   string // random path segment for webhook URLs
 
 	cpWaitMu sync.Mutex
@@ -62,34 +96,73 @@ type Bridge struct {
 	cbMu       sync.Mutex
 	breakers   map[int64]*chatBreaker // destination chatID → breaker
 
+	// Уведомления об отказе пересылки, уже отправленные в исходный TG-чат (noticeTgSource)
+	noticeMu sync.Mutex
+	notices  map[tgMsgRef]time.Time
+
 	// Буферизация TG media groups (альбомы)
 	mgMu      sync.Mutex
 	mgBuffers map[string]*mediaGroupBuffer // MediaGroupID → buffer
+
+	// Упорядоченная доставка: один воркер на чат назначения
+	deliver *deliveryQueue
+	// Доставки, поставленные listener'ами TG и MAX с последнего checkpoint'а поллинга
+	tgBatch  updateBatch
+	maxBatch updateBatch
+	// Апдейты, которые обрабатываются сейчас и ещё не отмечены в processed_updates
+	dedupMu  sync.Mutex
+	inflight map[UpdateKey]struct{}
+
+	// Состояние потоков апдейтов для /healthz и /readyz
+	health *healthState
+
+	// Выбор лидера среди реплик; по умолчанию — единственный экземпляр
+	elector Elector
+	// Сигнал «в inbox появился webhook» для лидера на этой же реплике: "tg" / "max"
+	inboxNotify map[string]chan struct{}
+
+	// Опросы, ожидающие обновления итогов (flushPolls): mid сообщения MAX → что обновить
+	pollMu    sync.Mutex
+	pollDirty map[string]pollSync
 }
 
 // NewBridge создаёт экземпляр Bridge.
-func NewBridge(cfg Config, repo Repository, tg TGSender, maxApi *maxbot.Api, maxBotUID int64) *Bridge {
+func NewBridge(cfg Config, repo Repository, tg TGSender, mx MAXSender) *Bridge {
 	// Derive webhook secret from tokens (stable across restarts)
-	h := sha256.Sum256([]byte(cfg.MaxToken + tg.BotToken()))
-	secret := hex.EncodeToString(h[:8])
+	secret := cfg.WebhookSecret
+	if secret == "" {
+		h := sha256.Sum256([]byte(cfg.MaxToken + tg.BotToken()))
+		secret = hex.EncodeToString(h[:8])
+	}
+	tgLim := newRateLimiter("tg", cfg.TgRateGlobal, cfg.TgRateChat)
+	maxLim := newRateLimiter("max", cfg.MaxRateGlobal, cfg.MaxRateChat)
+	tgLim.tenant, maxLim.tenant = cfg.TenantID, cfg.TenantID
 
 	return &Bridge{
 		cfg:    cfg,
 		repo:   repo,
-		tg:        tg,
-		maxApi:    maxApi,
-		maxBotUID: maxBotUID,
+		tg:        &rateLimitedTGSender{TGSender: &provenanceTGSender{TGSender: tg, repo: repo}, lim: tgLim},
+		max:       &rateLimitedMAXSender{MAXSender: &provenanceMAXSender{MAXSender: mx, repo: repo}, lim: maxLim},
+		limiters:  []*rateLimiter{tgLim, maxLim},
+		maxBotUID: mx.BotUserID(),
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute, // для download/upload больших файлов
 		},
-		apiClient: &http.Client{
-			Timeout: 15 * time.Second, // для коротких API-запросов
-		},
 		whSecret:  secret,
 		cpWait:    make(map[int64]int64),
 		cpTgOwner: make(map[int64]int64),
 		breakers:  make(map[int64]*chatBreaker),
+		notices:   make(map[tgMsgRef]time.Time),
 		mgBuffers: make(map[string]*mediaGroupBuffer),
+		deliver:   newDeliveryQueue(),
+		inflight:  make(map[UpdateKey]struct{}),
+		health:    newHealthState(),
+		elector:   localElector{},
+		inboxNotify: map[string]chan struct{}{
+			"tg":  make(chan struct{}, 1),
+			"max": make(chan struct{}, 1),
+		},
+		pollDirty: make(map[string]pollSync),
 	}
 }
 
@@ -112,7 +185,12 @@ func (b *Bridge) cbBlocked(chatID int64) bool {
 }
 
 // cbFail регистрирует ошибку. Возвращает true если чат только что заблокировался.
-func (b *Bridge) cbFail(chatID int64) bool {
+// Лимиты (429) и чинимые ошибки связки (миграция, топики) чат не блокируют.
+func (b *Bridge) cbFail(chatID int64, err error) bool {
+	switch errKind(err) {
+	case ErrRateLimited, ErrChatMigrated, ErrTopicGone:
+		return false
+	}
 	b.cbMu.Lock()
 	defer b.cbMu.Unlock()
 	cb, ok := b.breakers[chatID]
@@ -129,6 +207,19 @@ func (b *Bridge) cbFail(chatID int64) bool {
 	return false
 }
 
+// cbOpenCount возвращает число чатов, заблокированных circuit breaker'ом прямо сейчас.
+func (b *Bridge) cbOpenCount() int {
+	b.cbMu.Lock()
+	defer b.cbMu.Unlock()
+	n := 0
+	for _, cb := range b.breakers {
+		if cb.fails >= cbMaxFails && time.Since(cb.blockedAt) < cbCooldown {
+			n++
+		}
+	}
+	return n
+}
+
 // cbSuccess сбрасывает счётчик ошибок для чата.
 func (b *Bridge) cbSuccess(chatID int64) {
 	b.cbMu.Lock()
@@ -137,20 +228,47 @@ func (b *Bridge) cbSuccess(chatID int64) {
 }
 
 // maxMaxFileBytes returns the MAX-to-TG file size limit in bytes (0 = unlimited).
-func (c *Config) maxMaxFileBytes() int64 {
+func (c Config) maxMaxFileBytes() int64 {
 	if c.MaxMaxFileSizeMB <= 0 {
 		return 0
 	}
 	return int64(c.MaxMaxFileSizeMB) * 1024 * 1024
 }
 
+// conf возвращает текущую конфигурацию. Поля, которые меняет reload, читаются только
+// через неё: конфигурация может перезагрузиться во время обработки апдейта.
+func (b *Bridge) conf() Config {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	return b.cfg
+}
+
+// reload применяет перезагруженную конфигурацию: whitelist'ы, лимиты размера файлов,
+// формат сообщений, оповещения операторов и список других ботов-мостов. Токены, адреса и порты, лимиты отправок
+// меняются только перезапуском.
+func (b *Bridge) reload(cfg Config) {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+	b.cfg.AllowedUsers = cfg.AllowedUsers
+	b.cfg.TgMaxFileSizeMB = cfg.TgMaxFileSizeMB
+	b.cfg.MaxMaxFileSizeMB = cfg.MaxMaxFileSizeMB
+	b.cfg.MaxAllowedExts = cfg.MaxAllowedExts
+	b.cfg.MessageNewline = cfg.MessageNewline
+	b.cfg.OperatorTgChats = cfg.OperatorTgChats
+	b.cfg.OperatorMaxChats = cfg.OperatorMaxChats
+	b.cfg.ListenerAlertAfter = cfg.ListenerAlertAfter
+	b.cfg.BridgeTgBots = cfg.BridgeTgBots
+	b.cfg.BridgeMaxBots = cfg.BridgeMaxBots
+}
+
 // isUserAllowed проверяет, есть ли tgUserID в белом списке.
 // Если AllowedUsers пуст — доступ разрешён всем.
 func (b *Bridge) isUserAllowed(tgUserID int64) bool {
-	if len(b.cfg.AllowedUsers) == 0 {
+	allowed := b.conf().AllowedUsers
+	if len(allowed) == 0 {
 		return true
 	}
-	for _, id := range b.cfg.AllowedUsers {
+	for _, id := range allowed {
 		if id == tgUserID {
 			return true
 		}
@@ -159,6 +277,7 @@ func (b *Bridge) isUserAllowed(tgUserID int64) bool {
 }
 
 // checkUserAllowed проверяет доступ пользователя и отправляет сообщение об отказе если нужно.
+// Вызывается из listener'а TG: ответ уходит через очередь чата (replyTg).
 // Возвращает true если доступ разрешён, false — если запрещён (и уже отправил ответ).
 // userID == 0 трактуется как «нет отправителя» — доступ запрещается.
 func (b *Bridge) checkUserAllowed(ctx context.Context, chatID, userID int64, threadID int) bool {
@@ -166,7 +285,7 @@ func (b *Bridge) checkUserAllowed(ctx context.Context, chatID, userID int64, thr
 		return true
 	}
 	slog.Debug("TG user not allowed", "uid", userID)
-	b.tg.SendMessage(ctx, chatID, "У вас нет прав доступа к боту.", &SendOpts{ThreadID: threadID})
+	b.replyTg(ctx, chatID, "У вас нет прав доступа к боту.", &SendOpts{ThreadID: threadID})
 	return false
 }
 
@@ -198,6 +317,176 @@ func (b *Bridge) tgChatTitle(ctx context.Context, chatID int64) string {
 	return title
 }
 
+// pairAllows проверяет, разрешает ли direction связки пересылку flow ("tg>max" или "max>tg").
+func (b *Bridge) pairAllows(tgChatID, maxChatID int64, flow string) bool {
+	dir := b.repo.GetPairDirection(tgChatID, maxChatID)
+	return dir == "both" || dir == flow
+}
+
+// commandPair выбирает связку, которую настраивает команда cmd из чата chatID: в TG-топике
+// со своей связкой — связку топика, иначе — связку всего чата. Если у чата несколько пиров
+// (fan-out), первым аргументом args указывается ID чата-пира. Возвращает связку и
+// оставшиеся аргументы; reply != "" — ответ в чат вместо выполнения команды.
+func (b *Bridge) commandPair(platform string, chatID int64, threadID int, cmd, args string) (tgChatID, maxChatID int64, rest, reply string) {
+	var peers []int64
+	if platform == "tg" {
+		peers = b.repo.GetMaxChats(chatID, threadID)
+	} else {
+		peers = b.repo.GetTgChats(chatID)
+	}
+	if len(peers) == 0 {
+		return 0, 0, "", "Чат не связан. Сначала выполните /bridge."
+	}
+	peer, rest := peers[0], args
+	first, tail := args, ""
+	if i := strings.IndexFunc(args, unicode.IsSpace); i >= 0 {
+		first, tail = args[:i], args[i:]
+	}
+	if id, err := strconv.ParseInt(first, 10, 64); err == nil && slices.Contains(peers, id) {
+		peer, rest = id, strings.TrimSpace(tail)
+	} else if len(peers) > 1 {
+		ids := make([]string, len(peers))
+		for i, id := range peers {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		return 0, 0, "", "Чат связан с несколькими чатами: " + strings.Join(ids, ", ") + ".\nУкажите нужный: " + cmd + " <ID чата> …"
+	}
+	if platform == "tg" {
+		return chatID, peer, rest, ""
+	}
+	return peer, chatID, rest, ""
+}
+
+// setPairPrefix обрабатывает /bridge prefix [<ID чата>] on|off и возвращает ответ для чата.
+func (b *Bridge) setPairPrefix(platform string, chatID int64, threadID int, args string) string {
+	tgChatID, maxChatID, arg, reply := b.commandPair(platform, chatID, threadID, "/bridge prefix", args)
+	if reply != "" {
+		return reply
+	}
+	if arg != "on" && arg != "off" {
+		return "Используйте: /bridge prefix on | off"
+	}
+	if !b.repo.SetPrefix(tgChatID, maxChatID, arg == "on") {
+		return "Чат не связан. Сначала выполните /bridge."
+	}
+	if arg == "on" {
+		return "Префикс [TG]/[MAX] включён."
+	}
+	return "Префикс [TG]/[MAX] выключен."
+}
+
+// setPairDirection обрабатывает /bridge direction [<ID чата>] <dir> и возвращает ответ для чата.
+func (b *Bridge) setPairDirection(platform string, chatID int64, threadID int, args string) string {
+	tgChatID, maxChatID, dir, reply := b.commandPair(platform, chatID, threadID, "/bridge direction", args)
+	if reply != "" {
+		return reply
+	}
+	switch dir {
+	case "tg>max", "max>tg", "both":
+	default:
+		return "Используйте: /bridge direction tg>max | max>tg | both"
+	}
+	if !b.repo.SetPairDirection(tgChatID, maxChatID, dir) {
+		return "Чат не связан. Сначала выполните /bridge."
+	}
+	return "Направление связки: " + pairDirectionLabel(dir)
+}
+
+// setPairFormat обрабатывает /bridge format [<ID чата>]: задаёт шаблон подписи связки
+// или сбрасывает его (reset).
+func (b *Bridge) setPairFormat(platform string, chatID int64, threadID int, args string) string {
+	usage := "Используйте: /bridge format <шаблон> или /bridge format reset\n\n" +
+		"Поля: {{.Name}}, {{.Username}}, {{.Platform}}, {{.Text}}, {{.ReplyQuote}}\n" +
+		"Оформление: {{bold .Name}}, {{italic .Text}}, {{code .Username}}\n\n" +
+		"Пример: /bridge format {{if eq .Platform \"TG\"}}✈️{{else}}💬{{end}} {{bold .Name}}: {{.Text}}"
+	if args == "" {
+		return usage
+	}
+	tgChatID, maxChatID, format, reply := b.commandPair(platform, chatID, threadID, "/bridge format", args)
+	if reply != "" {
+		return reply
+	}
+	switch format {
+	case "":
+		return usage
+	case "reset":
+		format = ""
+	default:
+		if err := validateAttributionFormat(format); err != nil {
+			return "Ошибка в шаблоне: " + err.Error()
+		}
+	}
+	if !b.repo.SetPairFormat(tgChatID, maxChatID, format) {
+		return "Чат не связан. Сначала выполните /bridge."
+	}
+	if format == "" {
+		return "Шаблон подписи сброшен: «Имя: текст»."
+	}
+	return "Шаблон подписи сохранён."
+}
+
+// attribute строит подпись пересланного сообщения для связки tgChatID ↔ maxChatID по её
+// шаблону (/bridge format), а без шаблона — "Имя: текст" с префиксом [TG]/[MAX], если он
+// включён в чате-источнике. Получатель — платформа, отличная от a.Platform; markup —
+// a.Text уже в его разметке (HTML для TG, markdown для MAX). formatted — подпись нужно
+// отправить с разметкой.
+func (b *Bridge) attribute(a attribution, tgChatID, maxChatID int64, markup bool) (text string, formatted bool) {
+	toHTML := a.Platform == "MAX"
+	if format := b.repo.GetPairFormat(tgChatID, maxChatID); format != "" {
+		text, formatted, err := renderAttribution(format, a, toHTML, markup)
+		if err == nil {
+			return text, formatted
+		}
+		slog.Warn("attribution template failed, using default", "err", err, "tgChat", tgChatID, "maxChat", maxChatID)
+	}
+	name := a.Name
+	if b.repo.HasPrefix(tgChatID, maxChatID) {
+		if toHTML {
+			name = "[MAX] " + name
+		} else {
+			name = "[TG] " + name
+		}
+	}
+	if toHTML && markup {
+		name = html.EscapeString(name)
+		a.Forward = html.EscapeString(a.Forward)
+	}
+	return formatAttribution(name, withForward(a.Forward, a.Text), b.conf().MessageNewline), markup
+}
+
+// tgCaption — подпись TG-сообщения (текст или caption без разметки) для MAX-чата.
+func (b *Bridge) tgCaption(msg *TGMessage, maxChatID int64) string {
+	if b.repo.GetPairFormat(msg.Chat.ID, maxChatID) == "" {
+		return formatTgCaption(msg, b.repo.HasPrefix(msg.Chat.ID, maxChatID), b.conf().MessageNewline)
+	}
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	caption, _ := b.attribute(tgAttribution(msg, text), msg.Chat.ID, maxChatID, false)
+	return caption
+}
+
+// maxCaption — подпись MAX-сообщения для TG-чата.
+func (b *Bridge) maxCaption(upd *maxschemes.MessageCreatedUpdate, tgChatID int64) string {
+	maxChatID := upd.Message.Recipient.ChatId
+	if b.repo.GetPairFormat(tgChatID, maxChatID) == "" {
+		return formatMaxCaption(upd, b.repo.HasPrefix(tgChatID, maxChatID), b.conf().MessageNewline)
+	}
+	caption, _ := b.attribute(maxAttribution(&upd.Message, upd.Message.Body.Text), tgChatID, maxChatID, false)
+	return caption
+}
+
+func pairDirectionLabel(dir string) string {
+	switch dir {
+	case "tg>max":
+		return "TG → MAX"
+	case "max>tg":
+		return "MAX → TG"
+	}
+	return "⟷ оба"
+}
+
 // isSelfTgBot проверяет, является ли отправитель нашим ботом (а не чужим).
 func (b *Bridge) isSelfTgBot(from *UserInfo) bool {
 	return from != nil && from.IsBot && from.UserName == b.tg.BotUsername()
@@ -218,6 +507,8 @@ func (b *Bridge) registerCommands(ctx context.Context) {
 		{Command: "unbridge", Description: "Удалить связку чатов"},
 		{Command: "thread", Description: "Установить топик для сообщений из MAX"},
 		{Command: "crosspost", Description: "Список связок кросспостинга"},
+		{Command: "del", Description: "Удалить сообщение (ответом) и его копии в MAX"},
+		{Command: "queue", Description: "Недоставленные сообщения"},
 		{Command: "help", Description: "Инструкция"},
 	}
 	if err := b.tg.SetMyCommands(ctx, cmds, nil); err != nil {
@@ -228,10 +519,26 @@ func (b *Bridge) registerCommands(ctx context.Context) {
 	}
 }
 
-// Run запускает TG и MAX listener'ы + периодическую очистку.
+// Run участвует в выборах лидера: на лидере работают listener'ы, очередь и очистка
+// (lead), остальные реплики только принимают webhook'и. HTTP-серверы общие для всех
+// мостов процесса и поднимаются в bridgeSet.Run.
 func (b *Bridge) Run(ctx context.Context) {
+	b.health.setLeader(false)
+	b.elector.Lead(ctx, b.lead)
+}
+
+// lead — работа лидера: чтение апдейтов, очередь, очистка БД и наблюдение за
+// listener'ами. Останавливается при отмене ctx (потеря лидерства или завершение).
+func (b *Bridge) lead(ctx context.Context) {
+	b.health.setLeader(true)
+	defer b.health.setLeader(false)
+
 	b.registerCommands(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(6)
 	go func() {
+		defer wg.Done()
 		t := time.NewTicker(10 * time.Minute)
 		defer t.Stop()
 		for {
@@ -240,12 +547,17 @@ func (b *Bridge) Run(ctx context.Context) {
 				return
 			case <-t.C:
 				b.repo.CleanOldMessages()
+				for _, lim := range b.limiters {
+					lim.evictIdle()
+				}
+				b.expireNotices(time.Now())
 			}
 		}
 	}()
 
 	// Воркер очереди — проверяет каждые 10 секунд
 	go func() {
+		defer wg.Done()
 		t := time.NewTicker(10 * time.Second)
 		defer t.Stop()
 		for {
@@ -258,25 +570,25 @@ func (b *Bridge) Run(ctx context.Context) {
 		}
 	}()
 
-	if b.cfg.WebhookURL != "" {
-		go func() {
-			addr := ":" + b.cfg.WebhookPort
-			srv := &http.Server{
-				Addr:         addr,
-				ReadTimeout:  10 * time.Second,
-				WriteTimeout: 10 * time.Second,
-				IdleTimeout:  60 * time.Second,
-			}
-			slog.Info("Webhook server starting", "addr", addr)
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				slog.Error("Webhook server failed", "err", err)
+	// Итоги опросов: сообщения в MAX и сводки голосов MAX в TG
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(pollFlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				b.flushPolls(ctx)
 			}
-		}()
-	}
+		}
+	}()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() { defer wg.Done(); b.listenTelegram(ctx) }()
-	go func() { defer wg.Done(); b.listenMax(ctx) }()
+	go func() { defer wg.Done(); b.watchListeners(ctx) }()
+
+	// Listener'ы работают под супервизором: упавший поток апдейтов перезапускается с backoff
+	go func() { defer wg.Done(); b.superviseListener(ctx, "tg", b.listenTelegram) }()
+	go func() { defer wg.Done(); b.superviseListener(ctx, "max", b.listenMax) }()
 	wg.Wait()
 }
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+func maxTextUpdate(chatID, userID int64, name, mid, text string) *maxschemes.MessageCreatedUpdate {
+	upd := &maxschemes.MessageCreatedUpdate{}
+	upd.Message.Sender = maxschemes.User{UserId: userID, Name: name}
+	upd.Message.Recipient = maxschemes.Recipient{ChatId: chatID, ChatType: maxschemes.CHAT}
+	upd.Message.Body = maxschemes.MessageBody{Mid: mid, Text: text}
+	return upd
+}
+
+// runMaxUpdates прогоняет апдейты через listenMax (polling-режим фейка)
+// и дожидается завершения всех доставок.
+func runMaxUpdates(b *Bridge, mx *fakeMAXSender, updates ...maxschemes.UpdateInterface) {
+	for _, u := range updates {
+		mx.Updates <- u
+	}
+	close(mx.Updates)
+	b.listenMax(context.Background())
+	b.deliver.Wait()
+	b.maxBatch.wg.Wait()
+}
+
+func TestForwardTgToMax_Text(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	msg := &TGMessage{
+		MessageID: 7,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Text:      "hello",
+	}
+	b.forwardTgToMax(context.Background(), msg, 200, formatTgCaption(msg, false, false))
+
+	sent := mx.sent()
+	if len(sent) != 1 {
+		t.Fatalf("MAX sent %d messages, want 1", len(sent))
+	}
+	if sent[0].ChatID != 200 || sent[0].Text != "[TG] Ivan: hello" {
+		t.Errorf("MAX message = %+v, want chat 200 text %q", sent[0], "[TG] Ivan: hello")
+	}
+	if mid, ok := b.repo.LookupMaxMsgID(-100, 7, 200); !ok || mid != "mid.1" {
+		t.Errorf("LookupMaxMsgID = %q, %v; want mid.1, true", mid, ok)
+	}
+}
+
+func TestForwardMaxToTg_Text(t *testing.T) {
+	b, tg, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	upd := maxTextUpdate(200, 5, "Olga", "mid.src", "привет")
+	b.forwardMaxToTg(context.Background(), upd, -100, formatMaxCaption(upd, false, false))
+
+	sent := tg.sent()
+	if len(sent) != 1 {
+		t.Fatalf("TG sent %d messages, want 1", len(sent))
+	}
+	if sent[0].ChatID != -100 || sent[0].Text != "Olga: привет" {
+		t.Errorf("TG message = %+v, want chat -100 text %q", sent[0], "Olga: привет")
+	}
+	if id, ok := b.repo.LookupTgMsgID("mid.src", -100); !ok || id != 1 {
+		t.Errorf("LookupTgMsgID = %d, %v; want 1, true", id, ok)
+	}
+}
+
+func TestForwardedFromHeader(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	runTgUpdates(b, tg, TGUpdate{Message: &TGMessage{
+		MessageID:   7,
+		Chat:        ChatInfo{ID: -100, Type: "supergroup"},
+		From:        &UserInfo{ID: 1, FirstName: "Ivan"},
+		Text:        "новость",
+		ForwardFrom: "News",
+	}})
+	if sent := mx.sent(); len(sent) != 1 || sent[0].Text != "[TG] Ivan: ↪ Переслано от News\nновость" {
+		t.Errorf("MAX sent %+v, want the forward header", sent)
+	}
+
+	// MAX присылает пересылку с пустым телом, содержимое — в ссылке
+	upd := maxTextUpdate(200, 5, "Olga", "mid.fwd", "")
+	upd.Message.Link = &maxschemes.LinkedMessage{
+		Type:    maxschemes.FORWARD,
+		Sender:  maxschemes.User{UserId: 9, Name: "Вася"},
+		Message: maxschemes.MessageBody{Mid: "mid.orig", Text: "привет"},
+	}
+	runMaxUpdates(b, mx, upd)
+	if sent := tg.sent(); len(sent) != 1 || sent[0].Text != "[MAX] Olga: ↪ Переслано от Вася\nпривет" {
+		t.Errorf("TG sent %+v, want the forwarded text with header", sent)
+	}
+}
+
+func TestListenMax_BridgeCommand(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	mx.Admins[200] = []maxschemes.ChatMember{{UserId: 5}}
+
+	runMaxUpdates(b, mx,
+		maxTextUpdate(200, 6, "Guest", "mid.1", "/bridge"),
+		maxTextUpdate(200, 5, "Admin", "mid.2", "/bridge"),
+	)
+
+	sent := mx.sent()
+	if len(sent) != 2 {
+		t.Fatalf("MAX sent %d messages, want 2", len(sent))
+	}
+	if !strings.Contains(sent[0].Text, "только админам") {
+		t.Errorf("non-admin reply = %q, want admin-only warning", sent[0].Text)
+	}
+	if !strings.HasPrefix(sent[1].Text, "Ключ для связки: ") {
+		t.Errorf("admin reply = %q, want generated key", sent[1].Text)
+	}
+}
+
+func TestListenMax_DeleteSync(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.SaveMsg(-100, 42, 200, "mid.src")
+
+	runMaxUpdates(b, mx,
+		&maxschemes.MessageRemovedUpdate{MessageId: "mid.src"},
+		&maxschemes.MessageRemovedUpdate{MessageId: "mid.unknown"},
+	)
+
+	if len(tg.Deleted) != 1 || tg.Deleted[0] != (fakeTgDelete{ChatID: -100, MsgID: 42}) {
+		t.Errorf("TG deleted = %+v, want [{-100 42}]", tg.Deleted)
+	}
+}
+
+func TestListenMax_SkipsOwnMessages(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	runMaxUpdates(b, mx, maxTextUpdate(200, testMaxBotUID, "Bot", "mid.1", "echo"))
+
+	if sent := tg.sent(); len(sent) != 0 {
+		t.Errorf("TG sent %d messages for own MAX message, want 0", len(sent))
+	}
+}
+
+// runTgUpdates прогоняет апдейты через listenTelegram (polling-режим фейка)
+// и дожидается завершения всех доставок.
+func runTgUpdates(b *Bridge, tg *fakeTGSender, updates ...TGUpdate) {
+	for _, u := range updates {
+		tg.Updates <- u
+	}
+	close(tg.Updates)
+	b.listenTelegram(context.Background())
+	b.deliver.Wait()
+	b.tgBatch.wg.Wait()
+}
+
+func TestListenTelegram_EditFanOut(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -100, 300)
+	b.repo.SaveMsg(-100, 7, 200, "mid.a")
+	b.repo.SaveMsg(-100, 7, 300, "mid.b")
+
+	runTgUpdates(b, tg, TGUpdate{EditedMessage: &TGMessage{
+		MessageID: 7,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Text:      "fixed",
+	}})
+
+	got := map[string]int64{}
+	for _, e := range mx.Edited {
+		got[e.Mid] = e.Msg.ChatID
+	}
+	if len(mx.Edited) != 2 || got["mid.a"] != 200 || got["mid.b"] != 300 {
+		t.Errorf("MAX edited = %+v, want mid.a in 200 and mid.b in 300", mx.Edited)
+	}
+}
+
+func TestListenMax_DeleteFanOut(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -101, 200)
+	b.repo.SaveMsg(-100, 42, 200, "mid.src")
+	b.repo.SaveMsg(-101, 17, 200, "mid.src")
+
+	runMaxUpdates(b, mx, &maxschemes.MessageRemovedUpdate{MessageId: "mid.src"})
+
+	// Разные TG-чаты обслуживаются параллельно — порядок между ними не гарантирован.
+	want := map[fakeTgDelete]bool{{ChatID: -101, MsgID: 17}: true, {ChatID: -100, MsgID: 42}: true}
+	if len(tg.Deleted) != len(want) {
+		t.Fatalf("TG deleted = %+v, want %v", tg.Deleted, want)
+	}
+	for _, d := range tg.Deleted {
+		if !want[d] {
+			t.Errorf("TG deleted unexpected %+v", d)
+		}
+	}
+}
+
+func TestForwardMaxToTg_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantQueued int
+		wantNotify string
+	}{
+		{"transient", errors.New("connection reset"), 1, "Попробуем ещё раз"},
+		{"rate limited", &TGError{Code: 429, Kind: ErrRateLimited, RetryAfter: time.Second}, 1, "Попробуем ещё раз"},
+		{"permanent", &TGError{Code: 403, Description: "Forbidden: bot was kicked", Kind: ErrPermanent}, 0, "Не удалось переслать сообщение в Telegram."},
+		{"topic closed", &TGError{Code: 400, Description: "Bad Request: TOPIC_CLOSED", Kind: ErrTopicClosed}, 0, "General"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+			tg.SendErr = tt.err
+
+			upd := maxTextUpdate(200, 5, "Olga", "mid.src", "привет")
+			b.forwardMaxToTg(context.Background(), upd, -100, formatMaxCaption(upd, false, false))
+
+			var queued int
+			b.repo.(*sqliteRepo).db.QueryRow("SELECT COUNT(*) FROM send_queue").Scan(&queued)
+			if queued != tt.wantQueued {
+				t.Errorf("queued %d items, want %d", queued, tt.wantQueued)
+			}
+			sent := mx.sent()
+			if len(sent) != 1 || !strings.Contains(sent[0].Text, tt.wantNotify) {
+				t.Errorf("MAX notifications = %+v, want one containing %q", sent, tt.wantNotify)
+			}
+		})
+	}
+}
+
+func TestForwardMaxToTg_TopicPair(t *testing.T) {
+	b, tg, _ := newTestBridge(t)
+	pairTopic(t, b.repo, -100, 5, 300)
+
+	upd := maxTextUpdate(300, 5, "Olga", "mid.src", "в топик")
+	b.forwardMaxToTg(context.Background(), upd, -100, formatMaxCaption(upd, false, false))
+
+	sent := tg.sent()
+	if len(sent) != 1 || sent[0].Opts == nil || sent[0].Opts.ThreadID != 5 {
+		t.Fatalf("TG sent = %+v, want one message into thread 5", sent)
+	}
+}
+
+func TestListenTelegram_AlbumKeepsOrder(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	photo := func(id int, fileID string) TGUpdate {
+		return TGUpdate{Message: &TGMessage{
+			MessageID:    id,
+			Chat:         ChatInfo{ID: -100, Type: "group"},
+			From:         &UserInfo{ID: 1, FirstName: "Ivan"},
+			Photo:        []PhotoSize{{FileID: fileID}},
+			MediaGroupID: "album1",
+		}}
+	}
+	// Текст приходит сразу за альбомом, пока тот ещё собирается, — но не должен его обогнать.
+	runTgUpdates(b, tg, photo(1, "p1"), photo(2, "p2"), TGUpdate{Message: &TGMessage{
+		MessageID: 3,
+		Chat:      ChatInfo{ID: -100, Type: "group"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Text:      "после альбома",
+	}})
+
+	if len(mx.Sent) != 2 {
+		t.Fatalf("MAX sent %d messages, want 2", len(mx.Sent))
+	}
+	if len(mx.Sent[0].Attachments) != 2 {
+		t.Errorf("first message has %d attachments, want album of 2", len(mx.Sent[0].Attachments))
+	}
+	if !strings.Contains(mx.Sent[1].Text, "после альбома") {
+		t.Errorf("second message = %q, want text after album", mx.Sent[1].Text)
+	}
+}
+
+func TestListenTelegram_AlbumCaptionPerPair(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -100, 300)
+	b.repo.SetPrefix(-100, 200, false)
+
+	photo := func(id int, fileID, caption string) TGUpdate {
+		return TGUpdate{Message: &TGMessage{
+			MessageID:    id,
+			Chat:         ChatInfo{ID: -100, Type: "group"},
+			From:         &UserInfo{ID: 1, FirstName: "Ivan"},
+			Photo:        []PhotoSize{{FileID: fileID}},
+			Caption:      caption,
+			MediaGroupID: "album1",
+		}}
+	}
+	runTgUpdates(b, tg, photo(1, "p1", "отпуск"), photo(2, "p2", ""))
+
+	captions := map[int64]string{}
+	for _, m := range mx.sent() {
+		captions[m.ChatID] = m.Text
+	}
+	if got := captions[200]; strings.Contains(got, "[TG]") || !strings.Contains(got, "отпуск") {
+		t.Errorf("caption in 200 = %q, want no prefix", got)
+	}
+	if got := captions[300]; !strings.Contains(got, "[TG] Ivan") || !strings.Contains(got, "отпуск") {
+		t.Errorf("caption in 300 = %q, want the [TG] prefix", got)
+	}
+}
+
+func TestListenTelegram_BridgeInTopic(t *testing.T) {
+	b, tg, _ := newTestBridge(t)
+	tg.Members[-100] = map[int64]string{1: "administrator"}
+
+	runTgUpdates(b, tg, TGUpdate{Message: &TGMessage{
+		MessageID:       10,
+		MessageThreadID: 5,
+		IsTopicMessage:  true,
+		Chat:            ChatInfo{ID: -100, Type: "supergroup"},
+		From:            &UserInfo{ID: 1, FirstName: "Ivan"},
+		Text:            "/bridge",
+	}})
+
+	sent := tg.sent()
+	if len(sent) != 1 {
+		t.Fatalf("TG sent %d messages, want 1", len(sent))
+	}
+	m := keyRe.FindStringSubmatch(sent[0].Text)
+	if m == nil {
+		t.Fatalf("no key in %q", sent[0].Text)
+	}
+	if paired, _, err := b.repo.Register(m[1], "max", 300, 0); err != nil || !paired {
+		t.Fatalf("Register max: paired=%v err=%v", paired, err)
+	}
+
+	if got := b.repo.GetMaxChats(-100, 5); len(got) != 1 || got[0] != 300 {
+		t.Errorf("GetMaxChats(-100, 5) = %v, want [300]", got)
+	}
+	if got := b.repo.GetMaxChats(-100, 0); len(got) != 0 {
+		t.Errorf("GetMaxChats(-100, 0) = %v, want none", got)
+	}
+}
+
+func TestListenMax_BridgeDirectionCommand(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	mx.Admins[200] = []maxschemes.ChatMember{{UserId: 5}}
+
+	runMaxUpdates(b, mx,
+		maxTextUpdate(200, 5, "Admin", "mid.1", "/bridge direction sideways"),
+		maxTextUpdate(200, 5, "Admin", "mid.2", "/bridge direction tg>max"),
+	)
+
+	sent := mx.sent()
+	if len(sent) != 2 {
+		t.Fatalf("MAX sent %d messages, want 2", len(sent))
+	}
+	if !strings.HasPrefix(sent[0].Text, "Используйте:") {
+		t.Errorf("invalid direction reply = %q, want usage", sent[0].Text)
+	}
+	if sent[1].Text != "Направление связки: TG → MAX" {
+		t.Errorf("direction reply = %q", sent[1].Text)
+	}
+	if got := b.repo.GetPairDirection(-100, 200); got != "tg>max" {
+		t.Errorf("GetPairDirection = %q, want tg>max", got)
+	}
+}
+
+func TestBridgeCommand_FanOutNeedsPeer(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -100, 300)
+	pairTopic(t, b.repo, -100, 5, 400)
+
+	tests := []struct {
+		name     string
+		platform string
+		chatID   int64
+		threadID int
+		args     string
+		want     string
+	}{
+		{"fan-out without peer", "tg", -100, 0, "max>tg", "Чат связан с несколькими чатами: 200, 300."},
+		{"fan-out with peer", "tg", -100, 0, "300 max>tg", "Направление связки: MAX → TG"},
+		{"topic pair", "tg", -100, 5, "tg>max", "Направление связки: TG → MAX"},
+		{"single peer from MAX", "max", 200, 0, "tg>max", "Направление связки: TG → MAX"},
+	}
+	for _, tt := range tests {
+		if got := b.setPairDirection(tt.platform, tt.chatID, tt.threadID, tt.args); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: setPairDirection() = %q, want prefix %q", tt.name, got, tt.want)
+		}
+	}
+	for peer, want := range map[int64]string{200: "tg>max", 300: "max>tg", 400: "tg>max"} {
+		if got := b.repo.GetPairDirection(-100, peer); got != want {
+			t.Errorf("GetPairDirection(-100, %d) = %q, want %q", peer, got, want)
+		}
+	}
+}
+
+func TestDirection_EditDeleteSync(t *testing.T) {
+	tests := []struct {
+		dir        string
+		wantTgEdit bool // TG edit → MAX
+		wantMaxDel bool // MAX delete → TG
+	}{
+		{"both", true, true},
+		{"tg>max", true, false},
+		{"max>tg", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+			b.repo.SetPairDirection(-100, 200, tt.dir)
+			b.repo.SaveMsg(-100, 7, 200, "mid.a")
+			b.repo.SaveMsg(-100, 8, 200, "mid.b")
+
+			runTgUpdates(b, tg, TGUpdate{EditedMessage: &TGMessage{
+				MessageID: 7,
+				Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+				From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+				Text:      "fixed",
+			}})
+			runMaxUpdates(b, mx, &maxschemes.MessageRemovedUpdate{MessageId: "mid.b"})
+
+			if got := len(mx.Edited) == 1; got != tt.wantTgEdit {
+				t.Errorf("MAX edited = %+v, want edit %v", mx.Edited, tt.wantTgEdit)
+			}
+			if got := len(tg.Deleted) == 1; got != tt.wantMaxDel {
+				t.Errorf("TG deleted = %+v, want delete %v", tg.Deleted, tt.wantMaxDel)
+			}
+		})
+	}
+}
+
+func TestAttributionTemplate_PerPair(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -101, 300)
+	if reply := b.setPairFormat("max", 200, 0, "{{bold .Name}} ({{.Platform}}): {{.Text}}"); reply != "Шаблон подписи сохранён." {
+		t.Fatalf("setPairFormat = %q", reply)
+	}
+
+	tgMsg := func(chat int64) TGUpdate {
+		return TGUpdate{Message: &TGMessage{
+			MessageID: 7,
+			Chat:      ChatInfo{ID: chat, Type: "supergroup"},
+			From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+			Text:      "hello",
+		}}
+	}
+	runTgUpdates(b, tg, tgMsg(-100), tgMsg(-101))
+
+	got := map[int64]*MaxMessage{}
+	for _, m := range mx.sent() {
+		got[m.ChatID] = m
+	}
+	if m := got[200]; m == nil || m.Text != "**Ivan** (TG): hello" || m.Format != "markdown" {
+		t.Errorf("templated pair got %+v, want bold markdown attribution", m)
+	}
+	if m := got[300]; m == nil || m.Text != "[TG] Ivan: hello" || m.Format != "" {
+		t.Errorf("default pair got %+v, want unchanged attribution", m)
+	}
+
+	runMaxUpdates(b, mx, maxTextUpdate(200, 6, "Olga <3", "mid.src", "a < b"))
+	sent := tg.sent()
+	if len(sent) != 1 || sent[0].Text != "<b>Olga &lt;3</b> (MAX): a &lt; b" || sent[0].Opts == nil || sent[0].Opts.ParseMode != "HTML" {
+		t.Errorf("TG message = %+v, want escaped HTML attribution", sent)
+	}
+}
+
+func TestSetPairFormat(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	tests := []struct {
+		name     string
+		platform string
+		chatID   int64
+		format   string
+		want     string
+		stored   string
+	}{
+		{"save", "tg", -100, "{{italic .Name}}: {{.Text}}", "Шаблон подписи сохранён.", "{{italic .Name}}: {{.Text}}"},
+		{"bad template keeps old", "max", 200, "{{.Nick}}: {{.Text}}", "Ошибка в шаблоне", "{{italic .Name}}: {{.Text}}"},
+		{"reset", "max", 200, "reset", "Шаблон подписи сброшен", ""},
+		{"unlinked chat", "tg", -999, "{{.Text}}", "Чат не связан", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.setPairFormat(tt.platform, tt.chatID, 0, tt.format); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("setPairFormat() = %q, want prefix %q", got, tt.want)
+			}
+			if got := b.repo.GetPairFormat(-100, 200); got != tt.stored {
+				t.Errorf("stored format = %q, want %q", got, tt.stored)
+			}
+		})
+	}
+}
+
+func TestLoopPrevention_ByOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(b *Bridge)
+		tgFrom  *UserInfo
+		maxUID  int64
+		text    string
+		wantFwd bool
+	}{
+		{"user text looks like a prefix", nil, &UserInfo{ID: 1, FirstName: "Ivan"}, 6, "[TG] цитата", true},
+		{"known bridge bot", func(b *Bridge) {
+			b.reload(Config{BridgeTgBots: []int64{777}, BridgeMaxBots: []int64{888}})
+		}, &UserInfo{ID: 777, IsBot: true, FirstName: "Other"}, 888, "Ivan: hello", false},
+		{"message sent by the bridge", func(b *Bridge) {
+			b.repo.SaveSent("tg", -100, "7")
+			b.repo.SaveSent("max", 200, "mid.src")
+		}, &UserInfo{ID: 1, FirstName: "Ivan"}, 6, "hello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+			b.repo.SetPrefix(-100, 200, false)
+			if tt.setup != nil {
+				tt.setup(b)
+			}
+
+			runTgUpdates(b, tg, TGUpdate{Message: &TGMessage{
+				MessageID: 7,
+				Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+				From:      tt.tgFrom,
+				Text:      tt.text,
+			}})
+			runMaxUpdates(b, mx, maxTextUpdate(200, tt.maxUID, "Olga", "mid.src", tt.text))
+
+			if got := len(mx.sent()) == 1; got != tt.wantFwd {
+				t.Errorf("TG→MAX forwarded = %v, want %v", got, tt.wantFwd)
+			}
+			if got := len(tg.sent()) == 1; got != tt.wantFwd {
+				t.Errorf("MAX→TG forwarded = %v, want %v", got, tt.wantFwd)
+			}
+		})
+	}
+}
+
+func TestLoopPrevention_RecordsSentMessages(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	runMaxUpdates(b, mx, maxTextUpdate(200, 6, "Olga", "mid.src", "hello"))
+	sent := tg.sent()
+	if len(sent) != 1 {
+		t.Fatalf("TG sent %d messages, want 1", len(sent))
+	}
+	// Копия, которую мост отправил в TG, распознаётся по ID — даже без префикса в тексте
+	if !b.repo.IsSent("tg", -100, "1") {
+		t.Error("forwarded TG message not recorded as sent by the bridge")
+	}
+	if !b.tgFromBridge(&TGMessage{MessageID: 1, Chat: ChatInfo{ID: -100}, Text: "hello"}) {
+		t.Error("tgFromBridge = false for the bridge's own copy")
+	}
+}
+
+func TestTgMediaRejection_OncePerMessage(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -100, 300)
+	b.cfg.TgMaxFileSizeMB = 1
+
+	runTgUpdates(b, tg, TGUpdate{Message: &TGMessage{
+		MessageID: 7,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Document:  &DocInfo{FileID: "doc", FileName: "big.zip", FileSize: 5 * 1024 * 1024},
+	}})
+
+	if sent := tg.sent(); len(sent) != 1 || !strings.Contains(sent[0].Text, "big.zip") {
+		t.Errorf("TG warnings = %+v, want one about big.zip", sent)
+	}
+	if len(mx.sent()) != 0 {
+		t.Errorf("MAX sent %+v, want nothing", mx.sent())
+	}
+}
+
+func TestTgUploadFailure_NoticeOnce(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -100, 300)
+	photo := func(id int) *TGMessage {
+		return &TGMessage{
+			MessageID: id,
+			Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+			From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+			Photo:     []PhotoSize{{FileID: "p"}},
+		}
+	}
+
+	// Фото не загрузилось ни в один из двух MAX-чатов — уведомление одно
+	mx.UploadErr = errors.New("upload failed")
+	runTgUpdates(b, tg, TGUpdate{Message: photo(7)})
+	if sent := tg.sent(); len(sent) != 1 || sent[0].Text != "Не удалось отправить фото в MAX." {
+		t.Fatalf("TG notices = %+v, want one", sent)
+	}
+
+	// Ретрай из очереди не уведомляет повторно, сообщение уходит в dead letters
+	mx.UploadErr, mx.SendErr = nil, errors.New("connection reset")
+	b.forwardTgToMax(context.Background(), photo(8), 200, "")
+	mx.UploadErr, mx.SendErr = errors.New("upload failed"), nil
+	retryQueueNow(t, b)
+	if sent := tg.sent(); len(sent) != 1 {
+		t.Errorf("TG notices after retry = %+v, want none new", sent[1:])
+	}
+	dead, _ := b.repo.ListDeadLetters("", 0, 0)
+	if n := queueLen(b); n != 0 || len(dead) != 1 {
+		t.Errorf("queue = %d, dead letters = %d; want 0, 1", n, len(dead))
+	}
+}
+
+func TestTgStickerAsPhoto_UsesPairFormat(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.SetPairFormat(-100, 200, "{{bold .Name}} ({{.Platform}})")
+
+	runTgUpdates(b, tg, TGUpdate{Message: &TGMessage{
+		MessageID: 7,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Sticker:   &StickerInfo{FileID: "s1"},
+	}})
+
+	sent := mx.sent()
+	if len(sent) != 1 || sent[0].Text != "**Ivan** (TG)" || sent[0].Format != "markdown" || len(sent[0].Attachments) != 1 {
+		t.Errorf("MAX sent %+v, want the sticker photo with the pair's attribution", sent)
+	}
+}
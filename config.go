@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Конфигурация: значения по умолчанию, поверх них файл CONFIG_FILE (YAML), поверх
+// него переменные окружения. Токены и БД файлом не задаются, кроме токенов арендаторов
+// в списке tenants.
+
+// fileConfig — структура CONFIG_FILE. Незаданные поля не меняют значения по умолчанию.
+type fileConfig struct {
+	TgBotURL    string `yaml:"tg_bot_url"`
+	MaxBotURL   string `yaml:"max_bot_url"`
+	WebhookURL  string `yaml:"webhook_url"`
+	WebhookPort string `yaml:"webhook_port"`
+	MetricsPort string `yaml:"metrics_port"`
+	TgAPIURL    string `yaml:"tg_api_url"`
+	MaxAPIURL   string `yaml:"max_api_url"`
+
+	AllowedUsers         []int64  `yaml:"allowed_users"`
+	TgMaxFileSizeMB      *int     `yaml:"tg_max_file_size_mb"`
+	MaxMaxFileSizeMB     *int     `yaml:"max_max_file_size_mb"`
+	MaxAllowedExtensions []string `yaml:"max_allowed_extensions"`
+	MessageFormat        string   `yaml:"message_format"` // "inline" / "newline"
+
+	RateLimits struct {
+		TgGlobal  *float64 `yaml:"tg_global"`
+		TgChat    *float64 `yaml:"tg_chat"`
+		MaxGlobal *float64 `yaml:"max_global"`
+		MaxChat   *float64 `yaml:"max_chat"`
+	} `yaml:"rate_limits"`
+
+	OperatorTgChats    []int64 `yaml:"operator_tg_chats"`
+	OperatorMaxChats   []int64 `yaml:"operator_max_chats"`
+	ListenerAlertAfter string  `yaml:"listener_alert_after"`
+
+	BridgeTgBots  []int64 `yaml:"bridge_tg_bots"`
+	BridgeMaxBots []int64 `yaml:"bridge_max_bots"`
+
+	Tenants []tenantConfig `yaml:"tenants"`
+}
+
+// defaultConfig — значения по умолчанию. Лимиты — лимиты Telegram для групп
+// (20 сообщений в минуту на чат, 30 в секунду на бота).
+func defaultConfig() Config {
+	return Config{
+		TgBotURL:      "https://t.me/MaxTelegramBridgeBot",
+		MaxBotURL:     "https://max.ru/id710708943262_bot",
+		WebhookPort:   "8443",
+		TgRateGlobal:  30,
+		TgRateChat:    20,
+		MaxRateGlobal: 30,
+		MaxRateChat:   60,
+	}
+}
+
+// loadConfig собирает Config из файла path (если задан) и окружения getenv.
+// Ошибка называет файл и поле или переменную окружения с неверным значением.
+func loadConfig(path string, getenv func(string) string) (Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		var fc fileConfig
+		if err := yaml.UnmarshalStrict(data, &fc); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fc.apply(&cfg); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, getenv); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (fc *fileConfig) apply(cfg *Config) error {
+	for _, s := range []struct {
+		src string
+		dst *string
+	}{
+		{fc.TgBotURL, &cfg.TgBotURL},
+		{fc.MaxBotURL, &cfg.MaxBotURL},
+		{fc.WebhookURL, &cfg.WebhookURL},
+		{fc.WebhookPort, &cfg.WebhookPort},
+		{fc.MetricsPort, &cfg.MetricsPort},
+		{fc.TgAPIURL, &cfg.TgAPIURL},
+		{fc.MaxAPIURL, &cfg.MaxAPIURL},
+	} {
+		if s.src != "" {
+			*s.dst = s.src
+		}
+	}
+
+	if fc.AllowedUsers != nil {
+		cfg.AllowedUsers = fc.AllowedUsers
+	}
+	for _, n := range []struct {
+		field string
+		src   *int
+		dst   *int
+	}{
+		{"tg_max_file_size_mb", fc.TgMaxFileSizeMB, &cfg.TgMaxFileSizeMB},
+		{"max_max_file_size_mb", fc.MaxMaxFileSizeMB, &cfg.MaxMaxFileSizeMB},
+	} {
+		if n.src == nil {
+			continue
+		}
+		if *n.src < 0 {
+			return fmt.Errorf("%s: must be >= 0, got %d", n.field, *n.src)
+		}
+		*n.dst = *n.src
+	}
+	if fc.MaxAllowedExtensions != nil {
+		cfg.MaxAllowedExts = parseExtensions(fc.MaxAllowedExtensions)
+	}
+	switch fc.MessageFormat {
+	case "":
+	case "inline":
+		cfg.MessageNewline = false
+	case "newline":
+		cfg.MessageNewline = true
+	default:
+		return fmt.Errorf("message_format: want inline or newline, got %q", fc.MessageFormat)
+	}
+
+	for _, r := range []struct {
+		field string
+		src   *float64
+		dst   *float64
+	}{
+		{"rate_limits.tg_global", fc.RateLimits.TgGlobal, &cfg.TgRateGlobal},
+		{"rate_limits.tg_chat", fc.RateLimits.TgChat, &cfg.TgRateChat},
+		{"rate_limits.max_global", fc.RateLimits.MaxGlobal, &cfg.MaxRateGlobal},
+		{"rate_limits.max_chat", fc.RateLimits.MaxChat, &cfg.MaxRateChat},
+	} {
+		if r.src == nil {
+			continue
+		}
+		if *r.src < 0 {
+			return fmt.Errorf("%s: must be >= 0, got %v", r.field, *r.src)
+		}
+		*r.dst = *r.src
+	}
+
+	if fc.OperatorTgChats != nil {
+		cfg.OperatorTgChats = fc.OperatorTgChats
+	}
+	if fc.OperatorMaxChats != nil {
+		cfg.OperatorMaxChats = fc.OperatorMaxChats
+	}
+	if fc.ListenerAlertAfter != "" {
+		d, err := time.ParseDuration(fc.ListenerAlertAfter)
+		if err != nil || d < 0 {
+			return fmt.Errorf("listener_alert_after: want a duration like 5m, got %q", fc.ListenerAlertAfter)
+		}
+		cfg.ListenerAlertAfter = d
+	}
+	if fc.BridgeTgBots != nil {
+		cfg.BridgeTgBots = fc.BridgeTgBots
+	}
+	if fc.BridgeMaxBots != nil {
+		cfg.BridgeMaxBots = fc.BridgeMaxBots
+	}
+	if fc.Tenants != nil {
+		if err := validateTenants(fc.Tenants); err != nil {
+			return fmt.Errorf("tenants: %w", err)
+		}
+		cfg.Tenants = fc.Tenants
+	}
+	return nil
+}
+
+// applyEnv накладывает заданные переменные окружения поверх cfg.
+func applyEnv(cfg *Config, getenv func(string) string) error {
+	for _, s := range []struct {
+		env string
+		dst *string
+	}{
+		{"TG_BOT_URL", &cfg.TgBotURL},
+		{"MAX_BOT_URL", &cfg.MaxBotURL},
+		{"WEBHOOK_URL", &cfg.WebhookURL},
+		{"WEBHOOK_PORT", &cfg.WebhookPort},
+		{"METRICS_PORT", &cfg.MetricsPort},
+		{"TG_API_URL", &cfg.TgAPIURL},
+		{"MAX_API_URL", &cfg.MaxAPIURL},
+	} {
+		if v := getenv(s.env); v != "" {
+			*s.dst = v
+		}
+	}
+
+	// Списки ID через запятую: ALLOWED_USERS — whitelist TG user ID,
+	// OPERATOR_* — чаты для предупреждений о простое listener'ов,
+	// BRIDGE_*_BOTS — user ID других ботов-мостов
+	for _, l := range []struct {
+		env string
+		dst *[]int64
+	}{
+		{"ALLOWED_USERS", &cfg.AllowedUsers},
+		{"OPERATOR_TG_CHATS", &cfg.OperatorTgChats},
+		{"OPERATOR_MAX_CHATS", &cfg.OperatorMaxChats},
+		{"BRIDGE_TG_BOTS", &cfg.BridgeTgBots},
+		{"BRIDGE_MAX_BOTS", &cfg.BridgeMaxBots},
+	} {
+		v := getenv(l.env)
+		if v == "" {
+			continue
+		}
+		ids, err := parseIDList(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.env, err)
+		}
+		*l.dst = ids
+	}
+
+	for _, n := range []struct {
+		env string
+		dst *int
+	}{
+		{"TG_MAX_FILE_SIZE_MB", &cfg.TgMaxFileSizeMB},
+		{"MAX_MAX_FILE_SIZE_MB", &cfg.MaxMaxFileSizeMB},
+	} {
+		if v := getenv(n.env); v != "" {
+			x, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || x < 0 {
+				return fmt.Errorf("%s: want a non-negative integer, got %q", n.env, v)
+			}
+			*n.dst = x
+		}
+	}
+
+	// MAX_ALLOWED_EXTENSIONS — whitelist расширений (например, "pdf,docx,zip").
+	// Если не задан — расширения не проверяются локально (ошибка придёт от CDN).
+	if v := getenv("MAX_ALLOWED_EXTENSIONS"); v != "" {
+		cfg.MaxAllowedExts = parseExtensions(strings.Split(v, ","))
+	}
+
+	// MESSAGE_FORMAT=newline — текст с новой строки после имени: "Имя:\nтекст"
+	// MESSAGE_FORMAT=inline — "Имя: текст"
+	if v := getenv("MESSAGE_FORMAT"); v != "" {
+		cfg.MessageNewline = strings.ToLower(v) == "newline"
+	}
+
+	// Лимиты исходящих отправок; 0 отключает ограничение
+	for _, r := range []struct {
+		env string
+		dst *float64
+	}{
+		{"TG_RATE_GLOBAL", &cfg.TgRateGlobal},
+		{"TG_RATE_CHAT", &cfg.TgRateChat},
+		{"MAX_RATE_GLOBAL", &cfg.MaxRateGlobal},
+		{"MAX_RATE_CHAT", &cfg.MaxRateChat},
+	} {
+		if v := getenv(r.env); v != "" {
+			x, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || x < 0 {
+				return fmt.Errorf("%s: want a non-negative number, got %q", r.env, v)
+			}
+			*r.dst = x
+		}
+	}
+
+	if v := getenv("LISTENER_ALERT_AFTER"); v != "" {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d < 0 {
+			return fmt.Errorf("LISTENER_ALERT_AFTER: want a duration like 5m, got %q", v)
+		}
+		cfg.ListenerAlertAfter = d
+	}
+
+	// TENANTS_FILE — список арендаторов отдельным файлом, заменяет tenants из CONFIG_FILE
+	if v := getenv("TENANTS_FILE"); v != "" {
+		tenants, err := loadTenants(v)
+		if err != nil {
+			return fmt.Errorf("TENANTS_FILE: %w", err)
+		}
+		cfg.Tenants = tenants
+	}
+	return nil
+}
+
+// parseIDList разбирает список ID через запятую, пустые элементы пропускаются.
+func parseIDList(v string) ([]int64, error) {
+	var ids []int64
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseExtensions нормализует расширения: нижний регистр, без точки.
+func parseExtensions(list []string) map[string]struct{} {
+	exts := make(map[string]struct{})
+	for _, ext := range list {
+		ext = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ext), ".")))
+		if ext != "" {
+			exts[ext] = struct{}{}
+		}
+	}
+	return exts
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	const file = `
+webhook_port: 9000
+allowed_users: [1, 2]
+tg_max_file_size_mb: 20
+max_allowed_extensions: [".PDF", zip]
+message_format: newline
+rate_limits:
+  tg_chat: 0
+listener_alert_after: 90s
+`
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		check func(t *testing.T, cfg Config)
+	}{
+		{"defaults", "", nil, func(t *testing.T, cfg Config) {
+			if cfg.WebhookPort != "8443" || cfg.TgRateChat != 20 || cfg.MessageNewline || cfg.AllowedUsers != nil {
+				t.Errorf("unexpected defaults: %+v", cfg)
+			}
+		}},
+		{"file", file, nil, func(t *testing.T, cfg Config) {
+			if cfg.WebhookPort != "9000" || len(cfg.AllowedUsers) != 2 || cfg.TgMaxFileSizeMB != 20 || !cfg.MessageNewline {
+				t.Errorf("file values not applied: %+v", cfg)
+			}
+			if _, ok := cfg.MaxAllowedExts["pdf"]; !ok || len(cfg.MaxAllowedExts) != 2 {
+				t.Errorf("extensions = %v, want pdf and zip", cfg.MaxAllowedExts)
+			}
+			if cfg.TgRateChat != 0 || cfg.TgRateGlobal != 30 {
+				t.Errorf("rates = %v/%v, want explicit 0 and default 30", cfg.TgRateChat, cfg.TgRateGlobal)
+			}
+			if cfg.ListenerAlertAfter != 90*time.Second {
+				t.Errorf("listener_alert_after = %v", cfg.ListenerAlertAfter)
+			}
+		}},
+		{"tenants", file + "tenants:\n  - {id: acme, tg_token: t1, max_token: m1, allowed_users: [9]}\n", nil, func(t *testing.T, cfg Config) {
+			if len(cfg.Tenants) != 1 || cfg.Tenants[0].ID != "acme" || cfg.Tenants[0].MaxToken != "m1" || len(cfg.Tenants[0].AllowedUsers) != 1 {
+				t.Errorf("tenants = %+v, want acme", cfg.Tenants)
+			}
+		}},
+		{"env overrides file", file, map[string]string{
+			"ALLOWED_USERS":  "7",
+			"MESSAGE_FORMAT": "inline",
+			"WEBHOOK_PORT":   "8080",
+		}, func(t *testing.T, cfg Config) {
+			if len(cfg.AllowedUsers) != 1 || cfg.AllowedUsers[0] != 7 || cfg.MessageNewline || cfg.WebhookPort != "8080" {
+				t.Errorf("env did not override file: %+v", cfg)
+			}
+			if cfg.TgMaxFileSizeMB != 20 {
+				t.Errorf("file value lost: tg_max_file_size_mb = %d", cfg.TgMaxFileSizeMB)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			cfg, err := loadConfig(path, envMap(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"unknown field", "allowed_user: [1]", nil, "allowed_user"},
+		{"bad format", "message_format: compact", nil, "message_format"},
+		{"negative size", "max_max_file_size_mb: -1", nil, "max_max_file_size_mb"},
+		{"negative rate", "rate_limits: {max_chat: -5}", nil, "rate_limits.max_chat"},
+		{"bad duration", "listener_alert_after: soon", nil, "listener_alert_after"},
+		{"bad user id", "allowed_users: [abc]", nil, "config.yaml"},
+		{"bad env id", "", map[string]string{"ALLOWED_USERS": "1,x"}, `ALLOWED_USERS: invalid ID "x"`},
+		{"bad env size", "", map[string]string{"TG_MAX_FILE_SIZE_MB": "big"}, "TG_MAX_FILE_SIZE_MB"},
+		{"tenant without token", "tenants: [{id: acme, tg_token: t1}]", nil, "tenants: tenant \"acme\": tg_token and max_token are required"},
+		{"missing tenants file", "", map[string]string{"TENANTS_FILE": "/nonexistent/tenants.yaml"}, "TENANTS_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			_, err := loadConfig(path, envMap(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBridge_ReloadAppliesLive(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	cfg, err := loadConfig(writeConfig(t, "allowed_users: [42]\nmessage_format: newline\n"), envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.reload(cfg)
+	if b.isUserAllowed(1) || !b.isUserAllowed(42) {
+		t.Error("whitelist not applied after reload")
+	}
+
+	runMaxUpdates(b, mx, maxTextUpdate(200, 5, "Ivan", "mid.1", "привет"))
+	if sent := tg.sent(); len(sent) != 1 || !strings.Contains(sent[0].Text, "Ivan:\nпривет") {
+		t.Errorf("sent = %+v, want newline attribution", sent)
+	}
+}
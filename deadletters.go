@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const deadLettersChatLimit = 10 // сколько недоставленных сообщений показывает /queue
+
+// queueCommand обрабатывает /queue, /queue retry <id|all>, /queue purge и возвращает ответ для чата.
+// Видны и доступны только элементы, относящиеся к чату chatID платформы platform.
+func (b *Bridge) queueCommand(platform string, chatID int64, args string) string {
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		return b.queueStatus(platform, chatID)
+	case fields[0] == "retry" && len(fields) == 2 && fields[1] == "all":
+		items, err := b.repo.ListDeadLetters(platform, chatID, 0)
+		if err != nil {
+			return "Не удалось прочитать очередь."
+		}
+		n := 0
+		for _, d := range items {
+			if ok, err := b.repo.RetryDeadLetter(d.ID); err == nil && ok {
+				n++
+			}
+		}
+		return fmt.Sprintf("Возвращено в очередь: %d.", n)
+	case fields[0] == "retry" && len(fields) == 2:
+		id, err := strconv.ParseInt(strings.TrimPrefix(fields[1], "#"), 10, 64)
+		if err != nil {
+			break
+		}
+		if d, ok := b.repo.GetDeadLetter(id); !ok || !d.InChat(platform, chatID) {
+			return fmt.Sprintf("Сообщение #%d не найдено.", id)
+		}
+		if ok, err := b.repo.RetryDeadLetter(id); err != nil || !ok {
+			return "Не удалось вернуть сообщение в очередь."
+		}
+		return fmt.Sprintf("Сообщение #%d возвращено в очередь.", id)
+	case fields[0] == "purge" && len(fields) == 1:
+		n, err := b.repo.PurgeDeadLetters(platform, chatID)
+		if err != nil {
+			return "Не удалось очистить очередь."
+		}
+		return fmt.Sprintf("Удалено недоставленных сообщений: %d.", n)
+	}
+	return "Используйте: /queue | /queue retry <id> | /queue retry all | /queue purge"
+}
+
+// queueStatus — ответ на /queue: сколько сообщений ждут ретрая и список недоставленных.
+func (b *Bridge) queueStatus(platform string, chatID int64) string {
+	items, err := b.repo.ListDeadLetters(platform, chatID, deadLettersChatLimit+1)
+	if err != nil {
+		return "Не удалось прочитать очередь."
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Ожидают повторной отправки: %d.\n", b.repo.CountQueue(platform, chatID))
+	if len(items) == 0 {
+		sb.WriteString("Недоставленных сообщений нет.")
+		return sb.String()
+	}
+	sb.WriteString("\nНедоставленные:\n")
+	for i, d := range items {
+		if i == deadLettersChatLimit {
+			sb.WriteString("…\n")
+			break
+		}
+		fmt.Fprintf(&sb, "#%d %s, %s, %s", d.ID, queueDirectionLabel(d.Direction),
+			time.Unix(d.CreatedAt, 0).Format("02.01 15:04"), d.Reason)
+		if d.Text != "" {
+			fmt.Fprintf(&sb, " — %s", truncateRunes(d.Text, 40))
+		}
+		if d.LastError != "" {
+			fmt.Fprintf(&sb, "\n   %s", truncateRunes(d.LastError, 80))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n/queue retry <id> — отправить ещё раз, /queue retry all — все, /queue purge — удалить все")
+	return sb.String()
+}
+
+func queueDirectionLabel(direction string) string {
+	if direction == "max2tg" {
+		return "MAX → TG"
+	}
+	return "TG → MAX"
+}
+
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// runDeadLettersCLI выполняет подкоманду "deadletters" для оператора:
+//
+//	deadletters list [tg|max <chat_id>]
+//	deadletters show <id>
+//	deadletters retry <id>|all
+//	deadletters purge [tg|max <chat_id>]
+//
+// Возвращённые в очередь элементы отправит работающий мост на ближайшем проходе очереди.
+func runDeadLettersCLI(repo Repository, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: deadletters list|show|retry|purge")
+	}
+	cmd, args := args[0], args[1:]
+
+	// Необязательный фильтр по чату: tg|max <chat_id>
+	chatFilter := func() (string, int64, error) {
+		if len(args) == 0 {
+			return "", 0, nil
+		}
+		if len(args) != 2 || (args[0] != "tg" && args[0] != "max") {
+			return "", 0, fmt.Errorf("chat filter: tg|max <chat_id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid chat id %q", args[1])
+		}
+		return args[0], id, nil
+	}
+	parseID := func() (int64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("usage: deadletters %s <id>", cmd)
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid id %q", args[0])
+		}
+		return id, nil
+	}
+
+	switch cmd {
+	case "list":
+		platform, chatID, err := chatFilter()
+		if err != nil {
+			return err
+		}
+		items, err := repo.ListDeadLetters(platform, chatID, 0)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDIR\tSRC\tDST\tATTEMPTS\tCREATED\tREASON\tLAST ERROR")
+		for _, d := range items {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n", d.ID, d.Direction, d.SrcChatID, d.DstChatID, d.Attempts,
+				time.Unix(d.CreatedAt, 0).Format(time.DateTime), d.Reason, truncateRunes(d.LastError, 80))
+		}
+		return w.Flush()
+
+	case "show":
+		id, err := parseID()
+		if err != nil {
+			return err
+		}
+		d, ok := repo.GetDeadLetter(id)
+		if !ok {
+			return fmt.Errorf("dead letter %d not found", id)
+		}
+		fmt.Fprintf(out, "id:         %d\ndirection:  %s\nsrc:        %d (msg %s)\ndst:        %d\nattempts:   %d\ncreated:    %s\ndead:       %s\nreason:     %s\nlast error: %s\ntext:       %s\nhistory:\n%s",
+			d.ID, d.Direction, d.SrcChatID, d.SrcMsgID, d.DstChatID, d.Attempts,
+			time.Unix(d.CreatedAt, 0).Format(time.DateTime), time.Unix(d.DeadAt, 0).Format(time.DateTime),
+			d.Reason, d.LastError, d.Text, d.History)
+		return nil
+
+	case "retry":
+		if len(args) == 1 && args[0] == "all" {
+			items, err := repo.ListDeadLetters("", 0, 0)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for _, d := range items {
+				ok, err := repo.RetryDeadLetter(d.ID)
+				if err != nil {
+					return err
+				}
+				if ok {
+					n++
+				}
+			}
+			fmt.Fprintf(out, "requeued %d\n", n)
+			return nil
+		}
+		id, err := parseID()
+		if err != nil {
+			return err
+		}
+		ok, err := repo.RetryDeadLetter(id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("dead letter %d not found", id)
+		}
+		fmt.Fprintf(out, "requeued %d\n", id)
+		return nil
+
+	case "purge":
+		platform, chatID, err := chatFilter()
+		if err != nil {
+			return err
+		}
+		n, err := repo.PurgeDeadLetters(platform, chatID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "purged %d\n", n)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q: use list|show|retry|purge", cmd)
+}
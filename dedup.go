@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// Один и тот же апдейт может прийти дважды: Telegram и MAX повторяют webhook, если не
+// дождались ответа, а после рестарта polling перечитывает недоставленную пачку.
+// Listener пропускает апдейты, уже отмеченные в processed_updates или обрабатываемые
+// сейчас (inflight), а отмечает апдейт только после обработки: когда listener с ним
+// закончил и все его доставки отправили сообщения или поставили их в send_queue.
+// Если процесс упал или остановился раньше, отметки нет и повтор будет обработан —
+// уже пересланные сообщения отсекает маппинг (см. alreadyForwarded*).
+
+// pendingUpdate — апдейт в обработке и его незавершённые доставки. dedup — у апдейта
+// есть ключ key, и он отмечается в processed_updates; inboxID — его запись в inbox
+// (webhook-режим), которая удаляется после обработки.
+type pendingUpdate struct {
+	key     UpdateKey
+	dedup   bool
+	inboxID int64
+	wg      sync.WaitGroup
+}
+
+// beginUpdate сообщает, нужно ли обрабатывать апдейт, и делает его текущим апдейтом
+// listener'а batch. Повтор — апдейт, отмеченный в processed_updates или ещё
+// обрабатываемый; его запись в inbox удаляется сразу. Апдейты без ключа (ok = false)
+// не дедуплицируются. Если БД недоступна, апдейт считается новым: лучше возможный
+// дубль, чем потерянное сообщение.
+func (b *Bridge) beginUpdate(batch *updateBatch, key UpdateKey, ok bool) bool {
+	inboxID := batch.inboxID
+	batch.inboxID = 0
+	if !ok {
+		if inboxID != 0 {
+			batch.cur = &pendingUpdate{inboxID: inboxID}
+		}
+		return true
+	}
+	b.dedupMu.Lock()
+	_, busy := b.inflight[key]
+	if !busy {
+		b.inflight[key] = struct{}{}
+	}
+	b.dedupMu.Unlock()
+	if !busy {
+		done, err := b.repo.UpdateProcessed(key)
+		if err != nil {
+			slog.Error("UpdateProcessed failed, handling update as new", "err", err, "platform", key.Platform)
+		}
+		if !done {
+			batch.cur = &pendingUpdate{key: key, dedup: true, inboxID: inboxID}
+			return true
+		}
+		b.releaseUpdate(key)
+	}
+	slog.Info("duplicate update skipped", "platform", key.Platform, "chat", key.ChatID, "msg", key.MsgID, "kind", key.Kind)
+	if inboxID != 0 {
+		b.repo.DeleteInbox(inboxID)
+	}
+	return false
+}
+
+// endUpdate завершает текущий апдейт listener'а batch: когда его доставки выполнятся,
+// апдейт отмечается в processed_updates, а его запись в inbox удаляется. При остановке
+// (ctx отменён) ни то ни другое не делается — прерванные доставки могли ничего не
+// отправить, и апдейт обработается заново.
+func (b *Bridge) endUpdate(ctx context.Context, batch *updateBatch) {
+	u := batch.cur
+	if u == nil {
+		return
+	}
+	batch.cur = nil
+	batch.wg.Add(1)
+	go func() {
+		defer batch.wg.Done()
+		if u.dedup {
+			defer b.releaseUpdate(u.key)
+		}
+		u.wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		if u.dedup {
+			if _, err := b.repo.MarkUpdateProcessed(u.key); err != nil {
+				slog.Error("MarkUpdateProcessed failed", "err", err, "platform", u.key.Platform)
+			}
+		}
+		if u.inboxID != 0 {
+			if err := b.repo.DeleteInbox(u.inboxID); err != nil {
+				slog.Error("DeleteInbox failed", "err", err, "id", u.inboxID)
+			}
+		}
+	}()
+}
+
+// releaseUpdate убирает апдейт из обрабатываемых.
+func (b *Bridge) releaseUpdate(key UpdateKey) {
+	b.dedupMu.Lock()
+	delete(b.inflight, key)
+	b.dedupMu.Unlock()
+}
+
+// editKind — вид апдейта правки: у каждой правки своё время, поэтому повторная
+// правка того же сообщения не считается дублем. ok = false, если время неизвестно.
+func editKind(at int64) (string, bool) {
+	if at == 0 {
+		return "", false
+	}
+	return "edit:" + strconv.FormatInt(at, 10), true
+}
+
+// tgUpdateKey — ключ TG-апдейта для дедупликации.
+func tgUpdateKey(u TGUpdate) (UpdateKey, bool) {
+	msgKey := func(m *TGMessage, kind string) UpdateKey {
+		return UpdateKey{Platform: "tg", ChatID: m.Chat.ID, MsgID: strconv.Itoa(m.MessageID), Kind: kind}
+	}
+	switch {
+	case u.Message != nil:
+		return msgKey(u.Message, "message"), true
+	case u.ChannelPost != nil:
+		return msgKey(u.ChannelPost, "message"), true
+	case u.EditedMessage != nil:
+		kind, ok := editKind(u.EditedMessage.EditDate)
+		return msgKey(u.EditedMessage, kind), ok
+	case u.EditedChannelPost != nil:
+		kind, ok := editKind(u.EditedChannelPost.EditDate)
+		return msgKey(u.EditedChannelPost, kind), ok
+	case u.CallbackQuery != nil:
+		return UpdateKey{Platform: "tg", MsgID: u.CallbackQuery.ID, Kind: "callback"}, true
+	}
+	return UpdateKey{}, false
+}
+
+// maxUpdateKey — ключ MAX-апдейта для дедупликации.
+func maxUpdateKey(upd maxschemes.UpdateInterface) (UpdateKey, bool) {
+	switch u := upd.(type) {
+	case *maxschemes.MessageCreatedUpdate:
+		return UpdateKey{Platform: "max", ChatID: u.Message.Recipient.ChatId, MsgID: u.Message.Body.Mid, Kind: "message"}, u.Message.Body.Mid != ""
+	case *maxschemes.MessageEditedUpdate:
+		kind, ok := editKind(int64(u.Timestamp))
+		return UpdateKey{Platform: "max", ChatID: u.Message.Recipient.ChatId, MsgID: u.Message.Body.Mid, Kind: kind}, ok && u.Message.Body.Mid != ""
+	case *maxschemes.MessageRemovedUpdate:
+		return maxRemoveKey(u.MessageId), u.MessageId != ""
+	case *maxschemes.MessageCallbackUpdate:
+		return UpdateKey{Platform: "max", MsgID: u.Callback.CallbackID, Kind: "callback"}, u.Callback.CallbackID != ""
+	}
+	return UpdateKey{}, false
+}
+
+// maxRemoveKey — ключ апдейта удаления сообщения mid в MAX.
+func maxRemoveKey(mid string) UpdateKey {
+	return UpdateKey{Platform: "max", MsgID: mid, Kind: "remove"}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+func TestTgUpdateKey(t *testing.T) {
+	msg := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100}}
+	edited := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100}, EditDate: 1700000000}
+	tests := []struct {
+		name   string
+		update TGUpdate
+		want   UpdateKey
+		wantOK bool
+	}{
+		{"message", TGUpdate{Message: msg}, UpdateKey{"tg", -100, "7", "message"}, true},
+		{"channel post", TGUpdate{ChannelPost: msg}, UpdateKey{"tg", -100, "7", "message"}, true},
+		{"edit", TGUpdate{EditedMessage: edited}, UpdateKey{"tg", -100, "7", "edit:1700000000"}, true},
+		{"edit without date", TGUpdate{EditedMessage: msg}, UpdateKey{}, false},
+		{"callback", TGUpdate{CallbackQuery: &TGCallback{ID: "cb1"}}, UpdateKey{"tg", 0, "cb1", "callback"}, true},
+		{"empty", TGUpdate{}, UpdateKey{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tgUpdateKey(tt.update)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("tgUpdateKey = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMaxUpdateKey(t *testing.T) {
+	edit := &maxschemes.MessageEditedUpdate{}
+	edit.Timestamp = 1700000000
+	edit.Message.Recipient.ChatId = 200
+	edit.Message.Body.Mid = "mid.1"
+	tests := []struct {
+		name   string
+		update maxschemes.UpdateInterface
+		want   UpdateKey
+		wantOK bool
+	}{
+		{"message", maxTextUpdate(200, 5, "Olga", "mid.1", "hi"), UpdateKey{"max", 200, "mid.1", "message"}, true},
+		{"edit", edit, UpdateKey{"max", 200, "mid.1", "edit:1700000000"}, true},
+		{"remove", &maxschemes.MessageRemovedUpdate{MessageId: "mid.1"}, UpdateKey{"max", 0, "mid.1", "remove"}, true},
+		{"callback", &maxschemes.MessageCallbackUpdate{Callback: maxschemes.Callback{CallbackID: "cb1"}}, UpdateKey{"max", 0, "cb1", "callback"}, true},
+		{"bot added", &maxschemes.BotAddedToChatUpdate{}, UpdateKey{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := maxUpdateKey(tt.update)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("maxUpdateKey = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestListeners_DuplicateUpdatesProcessedOnce(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.SaveMsg(-100, 7, 200, "mid.a")
+	b.repo.SaveMsg(-100, 42, 200, "mid.src")
+
+	edit := func(at int64, text string) TGUpdate {
+		return TGUpdate{EditedMessage: &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "supergroup"},
+			From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: text, EditDate: at}}
+	}
+	// Повтор webhook'а с той же правкой и следующая правка того же сообщения
+	runTgUpdates(b, tg, edit(1000, "fixed"), edit(1000, "fixed"), edit(1001, "fixed again"))
+	remove := &maxschemes.MessageRemovedUpdate{MessageId: "mid.src"}
+	runMaxUpdates(b, mx, remove, remove)
+
+	if len(mx.Edited) != 2 {
+		t.Errorf("MAX edited %d times, want 2: %+v", len(mx.Edited), mx.Edited)
+	}
+	if len(tg.Deleted) != 1 {
+		t.Errorf("TG deleted %d times, want 1: %+v", len(tg.Deleted), tg.Deleted)
+	}
+}
+
+func TestDedup_MarksAfterDelivery(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	key := UpdateKey{Platform: "tg", ChatID: -100, MsgID: "7", Kind: "message"}
+
+	if !b.beginUpdate(&b.tgBatch, key, true) {
+		t.Fatal("new update reported as duplicate")
+	}
+	release := make(chan struct{})
+	b.deliverToMax(200, func() { <-release })
+	b.endUpdate(context.Background(), &b.tgBatch)
+
+	if b.beginUpdate(&b.tgBatch, key, true) {
+		t.Error("update in flight was not treated as duplicate")
+	}
+	if done, _ := b.repo.UpdateProcessed(key); done {
+		t.Error("update marked processed before its delivery finished")
+	}
+	close(release)
+	b.tgBatch.wg.Wait()
+	if done, _ := b.repo.UpdateProcessed(key); !done {
+		t.Error("update not marked processed after delivery")
+	}
+	if b.beginUpdate(&b.tgBatch, key, true) {
+		t.Error("processed update handled again")
+	}
+}
+
+func TestDedup_StoppedUpdateNotMarked(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	key := UpdateKey{Platform: "max", ChatID: 200, MsgID: "mid.a", Kind: "message"}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b.beginUpdate(&b.maxBatch, key, true)
+	b.deliverToTg(-100, func() { cancel() })
+	b.endUpdate(ctx, &b.maxBatch)
+	b.maxBatch.wg.Wait()
+
+	if done, _ := b.repo.UpdateProcessed(key); done {
+		t.Error("update interrupted by shutdown marked processed")
+	}
+	if !b.beginUpdate(&b.maxBatch, key, true) {
+		t.Error("redelivered update skipped after shutdown")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// /del — удаление сообщения ответом на него. Bot API не присылает событий удаления
+// из TG, поэтому убрать копию в MAX можно только явной командой. Удаляются само
+// сообщение и его копии в чатах, связанных с чатом команды.
+
+// tgMsgRef — сообщение в TG-чате.
+type tgMsgRef struct {
+	chatID int64
+	msgID  int
+}
+
+// msgCopies собирает TG-сообщение или сообщение MAX и его копии по таблице messages:
+// записи, в которых оно само — оригинал или копия. Копии копий в других связках не
+// собираются: права на /del проверены только в чате команды. Сообщение из MAX,
+// разошедшееся в несколько TG-чатов, удаляется везде командой /del на оригинал в MAX,
+// а по ответу на копию — только эта копия и оригинал.
+func (b *Bridge) msgCopies(tg []tgMsgRef, mids []string) ([]tgMsgRef, []string) {
+	seenTg := make(map[tgMsgRef]bool)
+	seenMax := make(map[string]bool)
+	var outTg []tgMsgRef
+	var outMax []string
+	addTg := func(ref tgMsgRef) {
+		if !seenTg[ref] {
+			seenTg[ref] = true
+			outTg = append(outTg, ref)
+		}
+	}
+	addMax := func(mid string) {
+		if !seenMax[mid] {
+			seenMax[mid] = true
+			outMax = append(outMax, mid)
+		}
+	}
+	for _, ref := range tg {
+		addTg(ref)
+		for _, l := range b.repo.LookupMaxMsgIDs(ref.chatID, ref.msgID) {
+			addMax(l.MaxMsgID)
+		}
+	}
+	for _, mid := range mids {
+		addMax(mid)
+		for _, l := range b.repo.LookupTgMsgIDs(mid) {
+			addTg(tgMsgRef{chatID: l.TgChatID, msgID: l.TgMsgID})
+		}
+	}
+	return outTg, outMax
+}
+
+// delDenied — отказ в /del участнику, который не админ и не автор сообщения. Автора
+// копии, пересланной мостом, проверить нельзя: её отправил бот, а аккаунты TG и MAX
+// мост между собой не связывает. Поэтому копию удаляет админ, а автор — командой /del
+// на оригинал в мессенджере origin: копии удалятся вместе с ним.
+func delDenied(bridged bool, origin string) string {
+	if bridged {
+		return "Это копия сообщения из " + origin + ". Удалить её может только админ группы, а автор — командой /del на оригинал в " + origin + "."
+	}
+	return "Удалить чужое сообщение может только админ группы."
+}
+
+// beginDelete собирает сообщение и его копии для /del и отмечает их удаление в MAX как
+// обрабатываемое (inflight): событие удаления, которое MAX пришлёт в ответ, не должно
+// второй раз удалять копии в TG, даже если придёт раньше, чем /del закончит. Вызывается
+// из listener'а; само удаление (deleteWithCopies) идёт в очереди чата команды.
+func (b *Bridge) beginDelete(tg []tgMsgRef, mids []string) ([]tgMsgRef, []string) {
+	tg, mids = b.msgCopies(tg, mids)
+	b.dedupMu.Lock()
+	for _, mid := range mids {
+		b.inflight[maxRemoveKey(mid)] = struct{}{}
+	}
+	b.dedupMu.Unlock()
+	return tg, mids
+}
+
+// deleteWithCopies удаляет сообщения, собранные beginDelete, и снимает их отметки.
+// Возвращает ответ пользователю, если что-то удалить не удалось, и "" — если удалено всё.
+func (b *Bridge) deleteWithCopies(ctx context.Context, tg []tgMsgRef, mids []string) string {
+	failed := 0
+	for _, ref := range tg {
+		if err := b.tg.DeleteMessage(ctx, ref.chatID, ref.msgID); err != nil {
+			slog.Error("/del: TG delete failed", "err", err, "tgChat", ref.chatID, "tgMsg", ref.msgID)
+			failed++
+			continue
+		}
+		slog.Info("/del: TG deleted", "tgChat", ref.chatID, "tgMsg", ref.msgID)
+	}
+	for _, mid := range mids {
+		key := maxRemoveKey(mid)
+		if err := b.max.DeleteMessage(ctx, mid); err != nil {
+			slog.Error("/del: MAX delete failed", "err", err, "maxMid", mid)
+			b.releaseUpdate(key)
+			failed++
+			continue
+		}
+		// Событие удаления, которое пришлёт MAX, уже обработано здесь
+		b.repo.MarkUpdateProcessed(key)
+		b.releaseUpdate(key)
+		slog.Info("/del: MAX deleted", "maxMid", mid)
+	}
+	if failed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Не удалось удалить %d из %d сообщений. Проверьте, что у бота есть право удалять сообщения в обоих чатах.", failed, len(tg)+len(mids))
+}
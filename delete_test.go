@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// tgDelCommand — /del от userID ответом на сообщение replyTo автора authorID.
+func tgDelCommand(userID int64, replyTo int, authorID int64) TGUpdate {
+	return TGUpdate{Message: &TGMessage{
+		MessageID: 50,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: userID, FirstName: "Ivan"},
+		Text:      "/del",
+		ReplyToMessage: &TGMessage{
+			MessageID: replyTo,
+			Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+			From:      &UserInfo{ID: authorID},
+		},
+	}}
+}
+
+func TestTgDel(t *testing.T) {
+	tests := []struct {
+		name      string
+		upd       TGUpdate
+		wantTg    []fakeTgDelete
+		wantMax   []string
+		wantReply string
+	}{
+		{
+			name:    "author deletes own message and its MAX copies",
+			upd:     tgDelCommand(1, 7, 1),
+			wantTg:  []fakeTgDelete{{ChatID: -100, MsgID: 7}, {ChatID: -100, MsgID: 50}},
+			wantMax: []string{"mid.a", "mid.b"},
+		},
+		{
+			name:    "admin deletes bridged MAX message and its original, not copies in other chats",
+			upd:     tgDelCommand(2, 9, testMaxBotUID),
+			wantTg:  []fakeTgDelete{{ChatID: -100, MsgID: 9}, {ChatID: -100, MsgID: 50}},
+			wantMax: []string{"mid.src"},
+		},
+		{
+			name:      "member cannot delete others' messages",
+			upd:       tgDelCommand(3, 7, 1),
+			wantReply: "Удалить чужое сообщение может только админ группы.",
+		},
+		{
+			name:      "member cannot delete a bridged copy of someone's MAX message",
+			upd:       tgDelCommand(3, 9, testMaxBotUID),
+			wantReply: "Это копия сообщения из MAX. Удалить её может только админ группы, а автор — командой /del на оригинал в MAX.",
+		},
+		{
+			name: "not a reply",
+			upd: TGUpdate{Message: &TGMessage{
+				MessageID: 50,
+				Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+				From:      &UserInfo{ID: 1},
+				Text:      "/del",
+			}},
+			wantReply: "Отправьте /del ответом на сообщение, которое нужно удалить.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+			pairChats(t, b.repo, -100, 300)
+			tg.Members = map[int64]map[int64]string{-100: {2: "administrator"}}
+			b.repo.SaveMsg(-100, 7, 200, "mid.a")
+			b.repo.SaveMsg(-100, 7, 300, "mid.b")
+			// Сообщение из MAX, разошедшееся в два TG-чата
+			b.repo.SaveMsg(-100, 9, 200, "mid.src")
+			b.repo.SaveMsg(-101, 4, 200, "mid.src")
+			b.repo.SaveSent("tg", -100, "9")
+
+			runTgUpdates(b, tg, tt.upd)
+
+			if !slices.Equal(tg.Deleted, tt.wantTg) {
+				t.Errorf("TG deleted = %v, want %v", tg.Deleted, tt.wantTg)
+			}
+			if !slices.Equal(mx.Deleted, tt.wantMax) {
+				t.Errorf("MAX deleted = %v, want %v", mx.Deleted, tt.wantMax)
+			}
+			sent := tg.sent()
+			if tt.wantReply == "" && len(sent) != 0 {
+				t.Errorf("unexpected reply %+v", sent)
+			}
+			if tt.wantReply != "" && (len(sent) != 1 || sent[0].Text != tt.wantReply) {
+				t.Errorf("reply = %+v, want %q", sent, tt.wantReply)
+			}
+			if len(mx.sent()) != 0 {
+				t.Errorf("/del forwarded to MAX: %+v", mx.sent())
+			}
+		})
+	}
+}
+
+func TestMaxDel(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -101, 200)
+	b.repo.SaveMsg(-100, 9, 200, "mid.src") // сообщение из MAX и его копии в TG
+	b.repo.SaveMsg(-101, 4, 200, "mid.src")
+	b.repo.SaveMsg(-100, 7, 200, "mid.a") // сообщение из TG и его копия в MAX
+
+	del := func(userID int64, mid string, authorID int64) *maxschemes.MessageCreatedUpdate {
+		upd := maxTextUpdate(200, userID, "Olga", "mid.cmd."+mid, "/del")
+		upd.Message.Link = &maxschemes.LinkedMessage{
+			Type:    maxschemes.REPLY,
+			Sender:  maxschemes.User{UserId: authorID},
+			Message: maxschemes.MessageBody{Mid: mid},
+		}
+		return upd
+	}
+	runMaxUpdates(b, mx,
+		del(6, "mid.src", 6),                                   // автор — удаляется
+		del(6, "mid.a", testMaxBotUID),                         // копия из TG, не админ — отказ
+		&maxschemes.MessageRemovedUpdate{MessageId: "mid.src"}, // событие от MAX уже обработано /del
+	)
+
+	if want := []string{"mid.src", "mid.cmd.mid.src"}; !slices.Equal(mx.Deleted, want) {
+		t.Errorf("MAX deleted = %v, want %v", mx.Deleted, want)
+	}
+	if want := []fakeTgDelete{{ChatID: -101, MsgID: 4}, {ChatID: -100, MsgID: 9}}; !slices.Equal(tg.Deleted, want) {
+		t.Errorf("TG deleted = %v, want %v", tg.Deleted, want)
+	}
+	if sent := mx.sent(); len(sent) != 1 || sent[0].Text != "Это копия сообщения из Telegram. Удалить её может только админ группы, а автор — командой /del на оригинал в Telegram." {
+		t.Errorf("MAX replies = %+v, want one refusal", sent)
+	}
+}
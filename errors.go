@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrKind — категория ошибки TG/MAX API. По ней очередь решает, ретраить или дропать,
+// circuit breaker — учитывать ли ошибку, а пересылка — что сообщить пользователю.
+type ErrKind int
+
+const (
+	ErrTransient    ErrKind = iota // сеть, 5xx, таймауты — повторяем позже
+	ErrPermanent                   // нет доступа к чату, чат не найден, некорректный запрос — не ретраим
+	ErrRateLimited                 // 429 — повторяем не раньше RetryAfter
+	ErrChatMigrated                // TG-группа преобразована в супергруппу
+	ErrTopicGone                   // топик удалён или топики в группе выключены
+	ErrTopicClosed                 // топик (обычно General) закрыт
+)
+
+func (k ErrKind) String() string {
+	switch k {
+	case ErrPermanent:
+		return "permanent"
+	case ErrRateLimited:
+		return "rate_limited"
+	case ErrChatMigrated:
+		return "chat_migrated"
+	case ErrTopicGone:
+		return "topic_gone"
+	case ErrTopicClosed:
+		return "topic_closed"
+	default:
+		return "transient"
+	}
+}
+
+// errKind возвращает категорию ошибки. Нетипизированные ошибки (сеть, контекст) — ErrTransient.
+func errKind(err error) ErrKind {
+	var tgErr *TGError
+	if errors.As(err, &tgErr) {
+		return tgErr.Kind
+	}
+	var maxErr *MAXError
+	if errors.As(err, &maxErr) {
+		return maxErr.Kind
+	}
+	return ErrTransient
+}
+
+// classifyTGError определяет категорию ошибки Bot API по коду и description.
+func classifyTGError(code int, description string) ErrKind {
+	switch {
+	case code == 429:
+		return ErrRateLimited
+	case strings.Contains(description, "upgraded to a supergroup"):
+		return ErrChatMigrated
+	case strings.Contains(description, "TOPIC_CLOSED"):
+		return ErrTopicClosed
+	case strings.Contains(description, "message thread not found"),
+		strings.Contains(description, "TOPIC_NOT_FOUND"),
+		strings.Contains(description, "TOPIC_DELETED"),
+		strings.Contains(description, "topics are disabled"):
+		return ErrTopicGone
+	case code == 400 || code == 403 || code == 404:
+		return ErrPermanent
+	default:
+		return ErrTransient
+	}
+}
+
+// MAXError represents a MAX API error.
+type MAXError struct {
+	Status     int    // HTTP-статус
+	Code       string // code из тела ответа, например "chat.denied"
+	Message    string
+	Kind       ErrKind
+	RetryAfter time.Duration
+}
+
+func (e *MAXError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("MAX API %d: %s: %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("MAX API %d: %s", e.Status, e.Message)
+}
+
+// newMAXError разбирает неуспешный ответ MAX API.
+func newMAXError(status int, body []byte, header http.Header) *MAXError {
+	e := &MAXError{Status: status}
+	var apiErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && (apiErr.Code != "" || apiErr.Message != "") {
+		e.Code, e.Message = apiErr.Code, apiErr.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	e.Kind = classifyMAXError(status, e.Code)
+	if e.Kind == ErrRateLimited {
+		e.RetryAfter = maxRetryAfter(header)
+	}
+	return e
+}
+
+// maxRejected — ответ MAX API 200 с success: false: запрос разобран, но не выполнен
+// (сообщение уже удалено, правка запрещена). Повтор не поможет.
+func maxRejected(message string) *MAXError {
+	return &MAXError{Status: http.StatusOK, Message: message, Kind: ErrPermanent}
+}
+
+// classifyMAXError определяет категорию ошибки MAX API по HTTP-статусу и code.
+func classifyMAXError(status int, code string) ErrKind {
+	switch {
+	case status == 429 || code == "too.many.requests":
+		return ErrRateLimited
+	case code == "chat.denied" || code == "chat.not.found" || code == "access.denied":
+		return ErrPermanent
+	case status == 400 || status == 403 || status == 404:
+		return ErrPermanent
+	default:
+		return ErrTransient
+	}
+}
+
+// undeliverableError помечает ошибку, после которой сообщение не доставлено и повтор
+// бесполезен (нет доступа к чату, топик закрыт). Пользователь уже уведомлён: живая пересылка
+// такое сообщение не ставит в очередь, а очередь переносит его в dead letters.
+type undeliverableError struct{ err error }
+
+func (e *undeliverableError) Error() string { return e.err.Error() }
+func (e *undeliverableError) Unwrap() error { return e.err }
+
+func undeliverable(err error) error {
+	return &undeliverableError{err: err}
+}
+
+func isUndeliverable(err error) bool {
+	var u *undeliverableError
+	return errors.As(err, &u)
+}
+
+// noticeError — причина, по которой сообщение не доставлено, с уведомлением для
+// исходного чата (файл не загрузился, расширение запрещено).
+type noticeError struct {
+	notice string
+	err    error
+}
+
+func (e *noticeError) Error() string { return e.notice + ": " + e.err.Error() }
+func (e *noticeError) Unwrap() error { return e.err }
+
+// withNotice помечает ошибку undeliverable и прикладывает уведомление notice. Его
+// отправляет живая пересылка; ретрай из очереди переносит сообщение в dead letters молча.
+func withNotice(notice string, err error) error {
+	return undeliverable(&noticeError{notice: notice, err: err})
+}
+
+// errNotice — уведомление из ошибки withNotice, "" — его нет.
+func errNotice(err error) string {
+	var n *noticeError
+	if errors.As(err, &n) {
+		return n.notice
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyTGError(t *testing.T) {
+	tests := []struct {
+		code int
+		desc string
+		want ErrKind
+	}{
+		{429, "Too Many Requests: retry after 5", ErrRateLimited},
+		{403, "Forbidden: bot was kicked from the group chat", ErrPermanent},
+		{400, "Bad Request: chat not found", ErrPermanent},
+		{404, "Not Found", ErrPermanent},
+		{400, "Bad Request: group chat was upgraded to a supergroup chat", ErrChatMigrated},
+		{400, "Bad Request: TOPIC_CLOSED", ErrTopicClosed},
+		{400, "Bad Request: message thread not found", ErrTopicGone},
+		{400, "Bad Request: TOPIC_DELETED", ErrTopicGone},
+		{500, "Internal Server Error", ErrTransient},
+		{502, "Bad Gateway: 403 upstream", ErrTransient}, // цифры в тексте не делают ошибку permanent
+	}
+	for _, tt := range tests {
+		if got := classifyTGError(tt.code, tt.desc); got != tt.want {
+			t.Errorf("classifyTGError(%d, %q) = %v, want %v", tt.code, tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestNewMAXError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		header     http.Header
+		wantKind   ErrKind
+		wantCode   string
+		wantRetry  time.Duration
+		wantErrStr string
+	}{
+		{"denied", 403, `{"code":"chat.denied","message":"no access"}`, nil, ErrPermanent, "chat.denied", 0, "MAX API 403: chat.denied: no access"},
+		{"denied code on 400", 400, `{"code":"chat.denied","message":"no access"}`, nil, ErrPermanent, "chat.denied", 0, ""},
+		{"not found", 404, `{"code":"not.found","message":"chat 5"}`, nil, ErrPermanent, "not.found", 0, ""},
+		{"rate limited", 429, `{"code":"too.many.requests","message":"slow down"}`, http.Header{"Retry-After": {"7"}}, ErrRateLimited, "too.many.requests", 7 * time.Second, ""},
+		{"server error", 503, `{"code":"internal.error","message":"unavailable"}`, nil, ErrTransient, "internal.error", 0, ""},
+		{"non-json body", 502, "<html>bad gateway 403</html>", nil, ErrTransient, "", 0, "MAX API 502: <html>bad gateway 403</html>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newMAXError(tt.status, []byte(tt.body), tt.header)
+			if e.Kind != tt.wantKind || e.Code != tt.wantCode || e.RetryAfter != tt.wantRetry {
+				t.Errorf("newMAXError = %+v, want kind %v code %q retry %v", e, tt.wantKind, tt.wantCode, tt.wantRetry)
+			}
+			if tt.wantErrStr != "" && e.Error() != tt.wantErrStr {
+				t.Errorf("Error() = %q, want %q", e.Error(), tt.wantErrStr)
+			}
+		})
+	}
+}
+
+func TestMaxEditRejected_Permanent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success":false,"message":"message not found"}`)
+	}))
+	defer srv.Close()
+	s := &maxBotSender{apiURL: srv.URL, apiClient: srv.Client()}
+
+	err := s.EditMessage(context.Background(), "mid.1", &MaxMessage{ChatID: 200, Text: "new"})
+	var maxErr *MAXError
+	if !errors.As(err, &maxErr) || errKind(err) != ErrPermanent {
+		t.Fatalf("EditMessage err = %#v, want permanent *MAXError", err)
+	}
+	if maxErr.Message != "message not found" {
+		t.Errorf("Message = %q, want the API message", maxErr.Message)
+	}
+}
+
+func TestErrKind_Wrapped(t *testing.T) {
+	tgErr := &TGError{Code: 429, Kind: ErrRateLimited, RetryAfter: 3 * time.Second}
+	wrapped := fmt.Errorf("send: %w", tgErr)
+	if errKind(wrapped) != ErrRateLimited || errRetryAfter(wrapped) != 3*time.Second {
+		t.Errorf("wrapped TGError: kind %v retry %v", errKind(wrapped), errRetryAfter(wrapped))
+	}
+	if errKind(errors.New("connection reset")) != ErrTransient {
+		t.Error("untyped error should be transient")
+	}
+}
+
+func TestNextRetryAt(t *testing.T) {
+	now := time.Unix(1000, 0)
+	if got := nextRetryAt(now, 1, errors.New("timeout")); got != now.Add(retryDelay(1)) {
+		t.Errorf("transient: next retry %v, want %v", got, now.Add(retryDelay(1)))
+	}
+	rl := &MAXError{Status: 429, Kind: ErrRateLimited, RetryAfter: 90 * time.Second}
+	if got := nextRetryAt(now, 1, rl); got != now.Add(90*time.Second) {
+		t.Errorf("rate limited: next retry %v, want +90s", got)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// --- fakeMAXSender ---
+
+type fakeMaxEdit struct {
+	Mid string
+	Msg *MaxMessage
+}
+
+// fakeMAXSender — in-memory реализация MAXSender для тестов.
+type fakeMAXSender struct {
+	mu      sync.Mutex
+	userID  int64
+	nextMid int
+
+	Sent      []*MaxMessage
+	Edited    []fakeMaxEdit
+	Deleted   []string
+	Callbacks []string
+	Answers   []*maxschemes.CallbackAnswer
+	Admins    map[int64][]maxschemes.ChatMember
+
+	SendErr   error
+	UploadErr error // ошибка загрузки фото
+	Updates   chan maxschemes.UpdateInterface
+}
+
+func newFakeMAXSender(botUserID int64) *fakeMAXSender {
+	return &fakeMAXSender{
+		userID:  botUserID,
+		Admins:  make(map[int64][]maxschemes.ChatMember),
+		Updates: make(chan maxschemes.UpdateInterface, 100),
+	}
+}
+
+func (f *fakeMAXSender) SendMessage(ctx context.Context, msg *MaxMessage) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.SendErr != nil {
+		return "", f.SendErr
+	}
+	f.nextMid++
+	f.Sent = append(f.Sent, msg)
+	return fmt.Sprintf("mid.%d", f.nextMid), nil
+}
+
+func (f *fakeMAXSender) EditMessage(ctx context.Context, mid string, msg *MaxMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Edited = append(f.Edited, fakeMaxEdit{Mid: mid, Msg: msg})
+	return nil
+}
+
+func (f *fakeMAXSender) DeleteMessage(ctx context.Context, mid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Deleted = append(f.Deleted, mid)
+	return nil
+}
+
+func (f *fakeMAXSender) AnswerCallback(ctx context.Context, callbackID string, answer *maxschemes.CallbackAnswer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Callbacks = append(f.Callbacks, callbackID)
+	f.Answers = append(f.Answers, answer)
+	return nil
+}
+
+func (f *fakeMAXSender) UploadPhotoFromURL(ctx context.Context, url string) (*maxschemes.PhotoTokens, error) {
+	if f.UploadErr != nil {
+		return nil, f.UploadErr
+	}
+	return &maxschemes.PhotoTokens{Photos: map[string]maxschemes.PhotoToken{"url": {Token: url}}}, nil
+}
+
+func (f *fakeMAXSender) UploadPhotoFromReader(ctx context.Context, reader io.Reader) (*maxschemes.PhotoTokens, error) {
+	return &maxschemes.PhotoTokens{Photos: map[string]maxschemes.PhotoToken{"reader": {Token: "photo-token"}}}, nil
+}
+
+func (f *fakeMAXSender) UploadMedia(ctx context.Context, uploadType maxschemes.UploadType, reader io.Reader, fileName string) (*maxschemes.UploadedInfo, error) {
+	return &maxschemes.UploadedInfo{Token: string(uploadType) + "-token"}, nil
+}
+
+func (f *fakeMAXSender) GetChatAdmins(ctx context.Context, chatID int64) ([]maxschemes.ChatMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Admins[chatID], nil
+}
+
+func (f *fakeMAXSender) Subscribe(ctx context.Context, url string, updateTypes []string) error {
+	return nil
+}
+
+// ParseUpdate разбирает только message_created — других апдейтов в тестах inbox нет.
+func (f *fakeMAXSender) ParseUpdate(body []byte) (maxschemes.UpdateInterface, error) {
+	var upd maxschemes.MessageCreatedUpdate
+	if err := json.Unmarshal(body, &upd); err != nil {
+		return nil, err
+	}
+	return &upd, nil
+}
+
+func (f *fakeMAXSender) StartPolling(ctx context.Context, marker int64) <-chan maxschemes.UpdateInterface {
+	return f.Updates
+}
+
+func (f *fakeMAXSender) BotUserID() int64 { return f.userID }
+func (f *fakeMAXSender) BotName() string  { return "fake-max-bot" }
+
+func (f *fakeMAXSender) sent() []*MaxMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*MaxMessage(nil), f.Sent...)
+}
+
+// --- fakeTGSender ---
+
+type fakeTgSent struct {
+	Method string
+	ChatID int64
+	Text   string
+	File   FileArg
+	Opts   *SendOpts
+}
+
+type fakeTgEdit struct {
+	ChatID int64
+	MsgID  int
+	Text   string
+}
+
+type fakeTgDelete struct {
+	ChatID int64
+	MsgID  int
+}
+
+// fakeTGSender — in-memory реализация TGSender для тестов.
+type fakeTGSender struct {
+	mu     sync.Mutex
+	nextID int
+
+	Sent    []fakeTgSent
+	Edited  []fakeTgEdit
+	Deleted []fakeTgDelete
+	Members map[int64]map[int64]string // chatID → userID → status
+
+	SendErr  error
+	FailNext []error // ошибки для ближайших отправок, по одной на вызов (до SendErr)
+	Updates  chan TGUpdate
+}
+
+func newFakeTGSender() *fakeTGSender {
+	return &fakeTGSender{
+		Members: make(map[int64]map[int64]string),
+		Updates: make(chan TGUpdate, 100),
+	}
+}
+
+func (f *fakeTGSender) record(method string, chatID int64, text string, file FileArg, opts *SendOpts) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.FailNext) > 0 {
+		err := f.FailNext[0]
+		f.FailNext = f.FailNext[1:]
+		return 0, err
+	}
+	if f.SendErr != nil {
+		return 0, f.SendErr
+	}
+	f.nextID++
+	f.Sent = append(f.Sent, fakeTgSent{Method: method, ChatID: chatID, Text: text, File: file, Opts: opts})
+	return f.nextID, nil
+}
+
+func (f *fakeTGSender) SendMessage(ctx context.Context, chatID int64, text string, opts *SendOpts) (int, error) {
+	return f.record("sendMessage", chatID, text, FileArg{}, opts)
+}
+
+func (f *fakeTGSender) SendPhoto(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	return f.record("sendPhoto", chatID, optsCaption(opts), file, opts)
+}
+
+func (f *fakeTGSender) SendVideo(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	return f.record("sendVideo", chatID, optsCaption(opts), file, opts)
+}
+
+func (f *fakeTGSender) SendAudio(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	return f.record("sendAudio", chatID, optsCaption(opts), file, opts)
+}
+
+func (f *fakeTGSender) SendDocument(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	return f.record("sendDocument", chatID, optsCaption(opts), file, opts)
+}
+
+func (f *fakeTGSender) SendMediaGroup(ctx context.Context, chatID int64, media []TGInputMedia, opts *SendOpts) ([]int, error) {
+	ids := make([]int, 0, len(media))
+	for _, m := range media {
+		id, err := f.record("sendMediaGroup", chatID, m.Caption, m.File, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (f *fakeTGSender) SendLocation(ctx context.Context, chatID int64, loc TGLocation, opts *SendOpts) (int, error) {
+	method := "sendLocation"
+	if loc.Title != "" {
+		method = "sendVenue"
+	}
+	return f.record(method, chatID, fmt.Sprintf("%.5f,%.5f %s|%s", loc.Latitude, loc.Longitude, loc.Title, loc.Address), FileArg{}, opts)
+}
+
+func (f *fakeTGSender) SendContact(ctx context.Context, chatID int64, contact TGContact, opts *SendOpts) (int, error) {
+	return f.record("sendContact", chatID, contact.FirstName+" "+contact.LastName+" "+contact.PhoneNumber, FileArg{}, opts)
+}
+
+func (f *fakeTGSender) SendPoll(ctx context.Context, chatID int64, question string, options []string, multiple bool, opts *SendOpts) (int, string, error) {
+	id, err := f.record("sendPoll", chatID, question+"\n"+strings.Join(options, "\n"), FileArg{}, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, fmt.Sprintf("poll.%d", id), nil
+}
+
+func (f *fakeTGSender) EditMessageText(ctx context.Context, chatID int64, msgID int, text string, opts *SendOpts) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Edited = append(f.Edited, fakeTgEdit{ChatID: chatID, MsgID: msgID, Text: text})
+	return nil
+}
+
+func (f *fakeTGSender) EditMessageMedia(ctx context.Context, chatID int64, msgID int, media TGInputMedia) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Edited = append(f.Edited, fakeTgEdit{ChatID: chatID, MsgID: msgID, Text: media.Caption})
+	return nil
+}
+
+func (f *fakeTGSender) DeleteMessage(ctx context.Context, chatID int64, msgID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Deleted = append(f.Deleted, fakeTgDelete{ChatID: chatID, MsgID: msgID})
+	return nil
+}
+
+func (f *fakeTGSender) AnswerCallback(ctx context.Context, callbackID string, text string) error {
+	return nil
+}
+
+func (f *fakeTGSender) GetFile(ctx context.Context, fileID string) (string, error) {
+	return "files/" + fileID, nil
+}
+
+func (f *fakeTGSender) GetFileDirectURL(filePath string) string {
+	return "https://tg.invalid/file/" + filePath
+}
+
+func (f *fakeTGSender) GetChatMember(ctx context.Context, chatID, userID int64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status, ok := f.Members[chatID][userID]; ok {
+		return status, nil
+	}
+	return "member", nil
+}
+
+func (f *fakeTGSender) SetMyCommands(ctx context.Context, commands []BotCommand, scope *CommandScope) error {
+	return nil
+}
+
+func (f *fakeTGSender) GetChat(ctx context.Context, chatID int64) (string, error) {
+	return fmt.Sprintf("chat %d", chatID), nil
+}
+
+func (f *fakeTGSender) SetWebhook(ctx context.Context, url string) error { return nil }
+func (f *fakeTGSender) DeleteWebhook(ctx context.Context) error          { return nil }
+
+func (f *fakeTGSender) ParseUpdate(body []byte) (TGUpdate, error) {
+	var u TGUpdate
+	err := json.Unmarshal(body, &u)
+	return u, err
+}
+
+func (f *fakeTGSender) StartPolling(ctx context.Context, offset int64) <-chan TGUpdate {
+	return f.Updates
+}
+
+func (f *fakeTGSender) BotUsername() string { return "fake_tg_bot" }
+func (f *fakeTGSender) BotToken() string    { return "fake-tg-token" }
+
+func (f *fakeTGSender) sent() []fakeTgSent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeTgSent(nil), f.Sent...)
+}
+
+func optsCaption(o *SendOpts) string {
+	if o == nil {
+		return ""
+	}
+	return o.Caption
+}
+
+// --- helpers ---
+
+const testMaxBotUID = 1000
+
+// newTestBridge собирает Bridge на фейках и SQLite во временной директории.
+func newTestBridge(t *testing.T) (*Bridge, *fakeTGSender, *fakeMAXSender) {
+	t.Helper()
+	repo, err := NewSQLiteRepo(filepath.Join(t.TempDir(), "bridge.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteRepo: %v", err)
+	}
+	tg := newFakeTGSender()
+	mx := newFakeMAXSender(testMaxBotUID)
+	return NewBridge(Config{}, repo, tg, mx), tg, mx
+}
+
+// pairChats связывает TG- и MAX-чат через ключ, как это делает /bridge.
+func pairChats(t *testing.T, repo Repository, tgChatID, maxChatID int64) {
+	t.Helper()
+	pairTopic(t, repo, tgChatID, 0, maxChatID)
+}
+
+// pairTopic связывает топик TG-форума (0 — весь чат) с MAX-чатом.
+func pairTopic(t *testing.T, repo Repository, tgChatID int64, threadID int, maxChatID int64) {
+	t.Helper()
+	_, key, err := repo.Register("", "tg", tgChatID, threadID)
+	if err != nil {
+		t.Fatalf("Register tg: %v", err)
+	}
+	paired, _, err := repo.Register(key, "max", maxChatID, 0)
+	if err != nil || !paired {
+		t.Fatalf("Register max: paired=%v err=%v", paired, err)
+	}
+}
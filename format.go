@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"html"
 	"strings"
+	"text/template"
+	"unicode/utf8"
 
 	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
@@ -28,6 +32,174 @@ func formatAttribution(name, text string, newline bool) string {
 	return name + ": " + text
 }
 
+// attribution — поля шаблона подписи пересланного сообщения (/bridge format).
+type attribution struct {
+	Name       string // имя отправителя
+	Username   string // username без @, может быть пустым
+	Platform   string // откуда сообщение: "TG" / "MAX"
+	Text       string // текст сообщения
+	ReplyQuote string // начало сообщения, на которое ответили (пусто, если это не ответ)
+	Forward    string // автор пересланного сообщения (пусто, если это не пересылка)
+}
+
+// withForward добавляет перед текстом строку «↪ Переслано от …», если сообщение
+// переслано из другого чата, канала или от другого пользователя.
+func withForward(from, text string) string {
+	if from == "" {
+		return text
+	}
+	if text == "" {
+		return "↪ Переслано от " + from
+	}
+	return "↪ Переслано от " + from + "\n" + text
+}
+
+const (
+	maxFormatLen      = 500 // длина шаблона /bridge format
+	replyQuoteMaxRune = 50  // сколько символов исходного сообщения попадает в ReplyQuote
+)
+
+// attributionFuncs — функции шаблона. Разметка зависит от получателя: HTML для TG,
+// markdown для MAX. used отмечает, что шаблон добавил разметку.
+func attributionFuncs(toHTML bool, used *bool) template.FuncMap {
+	wrap := func(htmlTag, md string) func(string) string {
+		return func(s string) string {
+			*used = true
+			if toHTML {
+				return "<" + htmlTag + ">" + s + "</" + htmlTag + ">"
+			}
+			return md + s + md
+		}
+	}
+	return template.FuncMap{
+		"bold":   wrap("b", "**"),
+		"italic": wrap("i", "_"),
+		"code":   wrap("code", "`"),
+	}
+}
+
+// parseAttributionFormat разбирает шаблон и проверяет его на примере сообщения.
+func parseAttributionFormat(format string, toHTML bool, used *bool) (*template.Template, error) {
+	return template.New("format").Funcs(attributionFuncs(toHTML, used)).Parse(format)
+}
+
+// validateAttributionFormat проверяет шаблон /bridge format: синтаксис, поля и длину.
+func validateAttributionFormat(format string) error {
+	if utf8.RuneCountInString(format) > maxFormatLen {
+		return errors.New("шаблон длиннее 500 символов")
+	}
+	var used bool
+	t, err := parseAttributionFormat(format, false, &used)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, attribution{Name: "Иван", Username: "ivan", Platform: "TG", Text: "привет", ReplyQuote: "как дела?", Forward: "Новости"}); err != nil {
+		return err
+	}
+	if !strings.Contains(format, ".Text") {
+		return errors.New("в шаблоне нет {{.Text}} — текст сообщения потеряется")
+	}
+	return nil
+}
+
+// renderAttribution собирает подпись по шаблону format. toHTML — получатель TG (HTML),
+// иначе MAX (markdown); markup — a.Text уже в разметке получателя. Поля для TG
+// экранируются, поэтому результат всегда отправляется как HTML; для MAX разметка
+// нужна, только если она была в тексте или её добавил шаблон (formatted). Если шаблон
+// не выводит {{.Forward}}, строка «Переслано от» добавляется к тексту.
+func renderAttribution(format string, a attribution, toHTML, markup bool) (text string, formatted bool, err error) {
+	var used bool
+	t, err := parseAttributionFormat(format, toHTML, &used)
+	if err != nil {
+		return "", false, err
+	}
+	if toHTML {
+		a.Name = html.EscapeString(a.Name)
+		a.Username = html.EscapeString(a.Username)
+		a.ReplyQuote = html.EscapeString(a.ReplyQuote)
+		a.Forward = html.EscapeString(a.Forward)
+		if !markup {
+			a.Text = html.EscapeString(a.Text)
+		}
+	}
+	if !strings.Contains(format, ".Forward") {
+		a.Text = withForward(a.Forward, a.Text)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, a); err != nil {
+		return "", false, err
+	}
+	return sb.String(), toHTML || markup || used, nil
+}
+
+// replyQuote обрезает текст исходного сообщения для {{.ReplyQuote}}.
+func replyQuote(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= replyQuoteMaxRune {
+		return text
+	}
+	return string([]rune(text)[:replyQuoteMaxRune]) + "…"
+}
+
+// tgAttribution собирает поля шаблона для TG-сообщения с текстом text.
+func tgAttribution(msg *TGMessage, text string) attribution {
+	a := attribution{Name: tgName(msg), Platform: "TG", Text: text}
+	if msg.From != nil {
+		a.Username = msg.From.UserName
+	}
+	if r := msg.ReplyToMessage; r != nil {
+		q := r.Text
+		if q == "" {
+			q = r.Caption
+		}
+		a.ReplyQuote = replyQuote(q)
+	}
+	a.Forward = msg.ForwardFrom
+	return a
+}
+
+// maxAttribution собирает поля шаблона для MAX-сообщения с текстом text.
+func maxAttribution(msg *maxschemes.Message, text string) attribution {
+	a := attribution{Name: msg.Sender.Name, Username: msg.Sender.Username, Platform: "MAX", Text: text}
+	if a.Name == "" {
+		a.Name = msg.Sender.Username
+	}
+	if msg.Link != nil && msg.Link.Type == maxschemes.REPLY {
+		a.ReplyQuote = replyQuote(msg.Link.Message.Text)
+	}
+	a.Forward = maxForwardFrom(msg)
+	return a
+}
+
+// maxForwardFrom — автор пересланного MAX-сообщения. У поста канала автора нет,
+// а название канала в ссылке не приходит.
+func maxForwardFrom(msg *maxschemes.Message) string {
+	if msg.Link == nil || msg.Link.Type != maxschemes.FORWARD {
+		return ""
+	}
+	if name := msg.Link.Sender.Name; name != "" {
+		return name
+	}
+	if name := msg.Link.Sender.Username; name != "" {
+		return name
+	}
+	return "канала"
+}
+
+// unwrapMaxForward переносит содержимое пересланного сообщения в тело: MAX присылает
+// пересылку с пустым телом, а текст и вложения — в ссылке на исходное сообщение.
+func unwrapMaxForward(msg *maxschemes.Message) {
+	link := msg.Link
+	if link == nil || link.Type != maxschemes.FORWARD || msg.Body.Text != "" || len(msg.Body.Attachments) > 0 {
+		return
+	}
+	msg.Body.Text = link.Message.Text
+	msg.Body.Markups = link.Message.Markups
+	msg.Body.Attachments = link.Message.Attachments
+	msg.Body.RawAttachments = link.Message.RawAttachments
+}
+
 // formatTgCaption — для пересылки (текст или caption)
 func formatTgCaption(msg *TGMessage, prefix, newline bool) string {
 	name := tgName(msg)
@@ -35,6 +207,7 @@ func formatTgCaption(msg *TGMessage, prefix, newline bool) string {
 	if text == "" {
 		text = msg.Caption
 	}
+	text = withForward(msg.ForwardFrom, text)
 	if prefix {
 		return formatAttribution("[TG] "+name, text, newline)
 	}
@@ -51,6 +224,7 @@ func formatTgMessage(msg *TGMessage, prefix, newline bool) string {
 	if text == "" {
 		return ""
 	}
+	text = withForward(msg.ForwardFrom, text)
 	if prefix {
 		return formatAttribution("[TG] "+name, text, newline)
 	}
@@ -68,7 +242,7 @@ func maxName(upd *maxschemes.MessageCreatedUpdate) string {
 // formatMaxCaption — для пересылки
 func formatMaxCaption(upd *maxschemes.MessageCreatedUpdate, prefix, newline bool) string {
 	name := maxName(upd)
-	text := upd.Message.Body.Text
+	text := withForward(maxForwardFrom(&upd.Message), upd.Message.Body.Text)
 	if prefix {
 		return formatAttribution("[MAX] "+name, text, newline)
 	}
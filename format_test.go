@@ -253,3 +253,100 @@ func TestFormatMaxCrosspostCaption(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderAttribution(t *testing.T) {
+	a := attribution{Name: "Ivan <admin>", Username: "ivan", Platform: "TG", Text: "a < b", ReplyQuote: "вопрос"}
+	tests := []struct {
+		name          string
+		format        string
+		toHTML        bool
+		markup        bool
+		want          string
+		wantFormatted bool
+	}{
+		{"plain to MAX", "{{.Name}} (@{{.Username}}): {{.Text}}", false, false, "Ivan <admin> (@ivan): a < b", false},
+		{"bold to MAX", "{{bold .Name}}: {{.Text}}", false, false, "**Ivan <admin>**: a < b", true},
+		{"markdown text to MAX", "{{.Name}}: {{.Text}}", false, true, "Ivan <admin>: a < b", true},
+		{"escaped for TG", "{{italic .Name}}: {{.Text}}", true, false, "<i>Ivan &lt;admin&gt;</i>: a &lt; b", true},
+		{"HTML text kept for TG", "{{.Name}}: {{.Text}}", true, true, "Ivan &lt;admin&gt;: a < b", true},
+		{"platform emoji and reply", `{{if eq .Platform "TG"}}✈️{{end}} {{.Name}}{{with .ReplyQuote}} ↩ {{.}}{{end}}: {{.Text}}`, false, false, "✈️ Ivan <admin> ↩ вопрос: a < b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, formatted, err := renderAttribution(tt.format, a, tt.toHTML, tt.markup)
+			if err != nil {
+				t.Fatalf("renderAttribution: %v", err)
+			}
+			if got != tt.want || formatted != tt.wantFormatted {
+				t.Errorf("renderAttribution() = %q, %v; want %q, %v", got, formatted, tt.want, tt.wantFormatted)
+			}
+		})
+	}
+}
+
+func TestRenderAttribution_Forward(t *testing.T) {
+	a := attribution{Name: "Ivan", Platform: "TG", Text: "hi", Forward: "News <1>"}
+	tests := []struct {
+		name   string
+		format string
+		toHTML bool
+		want   string
+	}{
+		{"header before text", "{{.Name}}: {{.Text}}", false, "Ivan: ↪ Переслано от News <1>\nhi"},
+		{"escaped for TG", "{{.Name}}: {{.Text}}", true, "Ivan: ↪ Переслано от News &lt;1&gt;\nhi"},
+		{"template places it", "{{.Name}}{{with .Forward}} (из {{.}}){{end}}: {{.Text}}", false, "Ivan (из News <1>): hi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := renderAttribution(tt.format, a, tt.toHTML, false)
+			if err != nil {
+				t.Fatalf("renderAttribution: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderAttribution() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxForwardFrom(t *testing.T) {
+	tests := []struct {
+		name string
+		link *maxschemes.LinkedMessage
+		want string
+	}{
+		{"not a forward", nil, ""},
+		{"reply", &maxschemes.LinkedMessage{Type: maxschemes.REPLY, Sender: maxschemes.User{Name: "Вася"}}, ""},
+		{"user", &maxschemes.LinkedMessage{Type: maxschemes.FORWARD, Sender: maxschemes.User{Name: "Вася"}}, "Вася"},
+		{"username only", &maxschemes.LinkedMessage{Type: maxschemes.FORWARD, Sender: maxschemes.User{Username: "vasya"}}, "vasya"},
+		{"channel post", &maxschemes.LinkedMessage{Type: maxschemes.FORWARD, ChatId: -5}, "канала"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxForwardFrom(&maxschemes.Message{Link: tt.link}); got != tt.want {
+				t.Errorf("maxForwardFrom() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAttributionFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{"{{bold .Name}}: {{.Text}}", false},
+		{"{{.Name}}\n{{.Text}}", false},
+		{"{{.Name}: {{.Text}}", true},
+		{"{{.Nick}}: {{.Text}}", true},
+		{"{{.Name}}", true},
+		{"{{underline .Name}}: {{.Text}}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if err := validateAttributionFormat(tt.format); (err != nil) != tt.wantErr {
+				t.Errorf("validateAttributionFormat(%q) = %v, wantErr %v", tt.format, err, tt.wantErr)
+			}
+		})
+	}
+}
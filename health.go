@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthStartupGrace = 1 * time.Minute  // сколько listener'у даётся на подключение после старта или падения
+	readyQueueMaxAge   = 10 * time.Minute // старше — очередь считается застрявшей, мост не ready
+)
+
+// listenerState — состояние потока апдейтов одной платформы.
+type listenerState struct {
+	Running    bool
+	Mode       string // "polling" / "webhook"
+	StartedAt  time.Time
+	StoppedAt  time.Time
+	LastUpdate time.Time
+}
+
+// healthState отслеживает listener'ы TG и MAX для /healthz и /readyz.
+type healthState struct {
+	mu        sync.Mutex
+	createdAt time.Time
+	listeners map[string]*listenerState // "tg" / "max"
+	standby   bool                      // реплика не лидер: апдейты читает другая
+}
+
+func newHealthState() *healthState {
+	return &healthState{createdAt: time.Now(), listeners: make(map[string]*listenerState)}
+}
+
+// setLeader отмечает роль реплики. Новый лидер получает healthStartupGrace
+// на подключение listener'ов: их прошлое состояние сбрасывается.
+func (h *healthState) setLeader(leader bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.standby = !leader
+	if leader {
+		h.createdAt = time.Now()
+		h.listeners = make(map[string]*listenerState)
+	}
+}
+
+func (h *healthState) isStandby() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.standby
+}
+
+// started отмечает, что listener платформы подключился и читает апдейты.
+func (h *healthState) started(platform, mode string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[platform] = &listenerState{Running: true, Mode: mode, StartedAt: time.Now()}
+}
+
+// stopped отмечает, что поток апдейтов платформы закончился или не запустился.
+// Время остановки не сдвигается, пока listener не поднимется снова.
+func (h *healthState) stopped(platform string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.listeners[platform]
+	if !ok {
+		h.listeners[platform] = &listenerState{StoppedAt: time.Now()}
+		return
+	}
+	if l.Running {
+		l.Running = false
+		l.StoppedAt = time.Now()
+	}
+}
+
+// touch отмечает полученный апдейт.
+func (h *healthState) touch(platform string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l, ok := h.listeners[platform]; ok {
+		l.LastUpdate = time.Now()
+	}
+}
+
+// listener возвращает копию состояния listener'а; ok = false, если он ещё не запускался.
+func (h *healthState) listener(platform string) (listenerState, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.listeners[platform]
+	if !ok {
+		return listenerState{}, false
+	}
+	return *l, true
+}
+
+// alive — жив ли listener: работает, или ещё не успел подключиться после старта
+// либо перезапуска супервизором. У standby-реплики listener'ов нет, она всегда жива.
+func (h *healthState) alive(platform string) bool {
+	if h.isStandby() {
+		return true
+	}
+	if l, ok := h.listener(platform); ok {
+		return l.Running || time.Since(l.StoppedAt) < healthStartupGrace
+	}
+	return time.Since(h.createdAt) < healthStartupGrace
+}
+
+// --- HTTP ---
+
+// listenerReport — состояние listener'а в ответе /readyz.
+type listenerReport struct {
+	Running              bool    `json:"running"`
+	Mode                 string  `json:"mode,omitempty"`
+	LastUpdateSecondsAgo float64 `json:"last_update_seconds_ago"` // -1 — апдейтов ещё не было
+	StoppedSecondsAgo    float64 `json:"stopped_seconds_ago,omitempty"`
+}
+
+type queueReport struct {
+	Pending          int     `json:"pending"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+	DeadLetters      int     `json:"dead_letters"`
+}
+
+// readinessReport — ответ /readyz.
+type readinessReport struct {
+	Tenant   string         `json:"tenant,omitempty"`
+	Ready    bool           `json:"ready"`
+	Role     string         `json:"role"` // "leader" / "standby"
+	Problems []string       `json:"problems,omitempty"`
+	Telegram listenerReport `json:"telegram"`
+	Max      listenerReport `json:"max"`
+	DB       string         `json:"db"`
+	Queue    queueReport    `json:"queue"`
+}
+
+func (b *Bridge) listenerReport(platform string) listenerReport {
+	l, _ := b.health.listener(platform)
+	r := listenerReport{Running: l.Running, Mode: l.Mode, LastUpdateSecondsAgo: -1}
+	if !l.LastUpdate.IsZero() {
+		r.LastUpdateSecondsAgo = time.Since(l.LastUpdate).Seconds()
+	}
+	if !l.StoppedAt.IsZero() {
+		r.StoppedSecondsAgo = time.Since(l.StoppedAt).Seconds()
+	}
+	return r
+}
+
+// readiness собирает состояние моста: потоки апдейтов обеих платформ, БД и очередь.
+// Standby-реплика апдейты не читает, но принимает webhook'и — для неё важны БД и очередь.
+func (b *Bridge) readiness() readinessReport {
+	r := readinessReport{
+		Tenant:   b.cfg.TenantID,
+		Role:     "leader",
+		Telegram: b.listenerReport("tg"),
+		Max:      b.listenerReport("max"),
+		DB:       "ok",
+	}
+	if b.health.isStandby() {
+		r.Role = "standby"
+	} else {
+		if !r.Telegram.Running {
+			r.Problems = append(r.Problems, "telegram updates stream is not running")
+		}
+		if !r.Max.Running {
+			r.Problems = append(r.Problems, "max updates stream is not running")
+		}
+	}
+	if err := b.repo.Ping(); err != nil {
+		r.DB = err.Error()
+		r.Problems = append(r.Problems, "database unavailable")
+	} else if stats, err := b.repo.QueueStats(); err == nil {
+		var oldest int64
+		for _, s := range stats {
+			r.Queue.Pending += s.Pending
+			r.Queue.DeadLetters += s.DeadLetters
+			if s.Pending > 0 && (oldest == 0 || s.OldestCreatedAt < oldest) {
+				oldest = s.OldestCreatedAt
+			}
+		}
+		if oldest != 0 {
+			r.Queue.OldestAgeSeconds = time.Since(time.Unix(oldest, 0)).Seconds()
+		}
+		if r.Queue.OldestAgeSeconds > readyQueueMaxAge.Seconds() {
+			r.Problems = append(r.Problems, "retry queue is stuck")
+		}
+	}
+	r.Ready = len(r.Problems) == 0
+	return r
+}
+
+// handleHealthz — liveness: 503, если поток апдейтов TG или MAX какого-либо моста не
+// работает дольше healthStartupGrace (супервизор не смог его поднять). Оркестратор
+// перезапустит процесс вместо того, чтобы он работал наполовину.
+func (bs bridgeSet) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	for _, b := range bs {
+		for _, p := range []string{"tg", "max"} {
+			if !b.health.alive(p) {
+				msg := p + " updates stream stopped"
+				if b.cfg.TenantID != "" {
+					msg = b.cfg.TenantID + ": " + msg
+				}
+				http.Error(w, msg, http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// tenantsReport — ответ /readyz в мультитенантном режиме: отчёт по каждому мосту.
+type tenantsReport struct {
+	Ready   bool              `json:"ready"`
+	Tenants []readinessReport `json:"tenants"`
+}
+
+// handleReadyz — readiness: JSON-отчёт, 503 при любой проблеме. Для единственного
+// моста — его отчёт, для нескольких — отчёты всех арендаторов.
+func (bs bridgeSet) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	var (
+		rep   any
+		ready bool
+	)
+	if len(bs) == 1 {
+		one := bs[0].readiness()
+		rep, ready = one, one.Ready
+	} else {
+		all := tenantsReport{Ready: true}
+		for _, b := range bs {
+			one := b.readiness()
+			all.Tenants = append(all.Tenants, one)
+			all.Ready = all.Ready && one.Ready
+		}
+		rep, ready = all, all.Ready
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(rep)
+}
+
+// registerOpsHandlers регистрирует служебные эндпоинты: /metrics, /healthz, /readyz.
+func (bs bridgeSet) registerOpsHandlers(mux *http.ServeMux) {
+	mux.Handle("/metrics", bs.metricsHandler())
+	mux.HandleFunc("/healthz", bs.handleHealthz)
+	mux.HandleFunc("/readyz", bs.handleReadyz)
+}
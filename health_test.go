@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz_ListenerStopped(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(b *Bridge, tg *fakeTGSender)
+		want    int
+	}{
+		{"starting", func(b *Bridge, tg *fakeTGSender) {}, http.StatusOK},
+		{"startup grace expired", func(b *Bridge, tg *fakeTGSender) {
+			b.health.createdAt = time.Now().Add(-2 * healthStartupGrace)
+		}, http.StatusServiceUnavailable},
+		{"both running", func(b *Bridge, tg *fakeTGSender) {
+			b.health.started("tg", "polling")
+			b.health.started("max", "polling")
+		}, http.StatusOK},
+		{"tg restarting", func(b *Bridge, tg *fakeTGSender) {
+			b.health.started("max", "polling")
+			runTgUpdates(b, tg)
+		}, http.StatusOK},
+		{"tg down too long", func(b *Bridge, tg *fakeTGSender) {
+			b.health.started("max", "polling")
+			runTgUpdates(b, tg)
+			b.health.listeners["tg"].StoppedAt = time.Now().Add(-2 * healthStartupGrace)
+		}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, _ := newTestBridge(t)
+			tt.prepare(b, tg)
+			rec := httptest.NewRecorder()
+			bridgeSet{b}.handleHealthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name      string
+		prepare   func(b *Bridge)
+		wantReady bool
+	}{
+		{"listeners not started", func(b *Bridge) {}, false},
+		{"all good", func(b *Bridge) {
+			b.health.started("tg", "webhook")
+			b.health.started("max", "polling")
+			b.health.touch("tg")
+		}, true},
+		{"queue stuck", func(b *Bridge) {
+			b.health.started("tg", "webhook")
+			b.health.started("max", "polling")
+			b.repo.EnqueueSend(&QueueItem{Direction: "tg2max", SrcChatID: -100, DstChatID: 200, Text: "x",
+				CreatedAt: time.Now().Add(-2 * readyQueueMaxAge).Unix()})
+		}, false},
+		{"db closed", func(b *Bridge) {
+			b.health.started("tg", "webhook")
+			b.health.started("max", "polling")
+			b.repo.Close()
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _, _ := newTestBridge(t)
+			tt.prepare(b)
+			rec := httptest.NewRecorder()
+			bridgeSet{b}.handleReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+			var rep readinessReport
+			if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if rep.Ready != tt.wantReady {
+				t.Errorf("ready = %v, want %v (problems %v)", rep.Ready, tt.wantReady, rep.Problems)
+			}
+			wantCode := http.StatusOK
+			if !tt.wantReady {
+				wantCode = http.StatusServiceUnavailable
+			}
+			if rec.Code != wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Inbox webhook'ов. При нескольких репликах балансировщик отдаёт webhook любой из них,
+// а апдейты читает только лидер: реплика сохраняет тело апдейта в update_inbox и сразу
+// отвечает платформе, лидер читает inbox по порядку поступления.
+
+var inboxPollInterval = 1 * time.Second // как часто лидер проверяет inbox, если webhook пришёл на другую реплику
+
+const (
+	inboxBatch     = 100
+	maxWebhookBody = 1 << 20 // апдейты без файлов, мегабайта хватает с запасом
+)
+
+// webhookHandler принимает webhook платформы и сохраняет апдейт в inbox. Если сохранить
+// не удалось, отвечает 500 — Telegram и MAX повторят запрос.
+func (b *Bridge) webhookHandler(platform string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := b.repo.PushInbox(platform, body); err != nil {
+			slog.Error("webhook: save to inbox failed", "platform", platform, "err", err)
+			http.Error(w, "temporarily unavailable", http.StatusInternalServerError)
+			return
+		}
+		// Если лидер — эта реплика, будим чтение inbox сразу, не дожидаясь inboxPollInterval
+		select {
+		case b.inboxNotify[platform] <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// inboxUpdates читает inbox платформы и отдаёт разобранные апдейты по порядку, пока
+// не отменён ctx. Перед каждым апдейтом идёт служебный mark(id) с его записью: listener
+// удаляет запись, только когда все доставки апдейта отправили сообщения или поставили
+// их в send_queue (endUpdate). Записи, которые не успели обработать до смены лидера
+// или рестарта, прочитаются повторно — уже обработанные отсекает processed_updates.
+func inboxUpdates[T any](ctx context.Context, b *Bridge, platform string, parse func([]byte) (T, error), mark func(id int64) T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(inboxPollInterval)
+		defer t.Stop()
+		var handed int64 // id записи, отданной listener'у последней
+		for {
+			items, err := b.repo.PeekInbox(platform, handed, inboxBatch)
+			if err != nil {
+				slog.Warn("inbox read failed", "platform", platform, "err", err)
+			}
+			for _, it := range items {
+				upd, err := parse(it.Body)
+				if err != nil {
+					slog.Warn("inbox: unparsable update dropped", "platform", platform, "id", it.ID, "err", err)
+					b.repo.DeleteInbox(it.ID)
+					continue
+				}
+				for _, u := range []T{mark(it.ID), upd} {
+					select {
+					case ch <- u:
+					case <-ctx.Done():
+						return
+					}
+				}
+				handed = it.ID
+			}
+			if len(items) == inboxBatch {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.inboxNotify[platform]:
+			case <-t.C:
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// postWebhook отправляет апдейт в webhook-обработчик реплики и проверяет ответ.
+func postWebhook(t *testing.T, b *Bridge, platform string, upd any) {
+	t.Helper()
+	body, err := json.Marshal(upd)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	b.webhookHandler(platform)(rec, httptest.NewRequest(http.MethodPost, "/wh", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s webhook: status %d, want 200", platform, rec.Code)
+	}
+}
+
+// runUntil запускает listen до тех пор, пока не выполнится done (или не выйдет время).
+func runUntil(t *testing.T, listen func(context.Context) error, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		listen(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+	if !done() {
+		t.Fatal("condition not reached before timeout")
+	}
+}
+
+func TestWebhookInbox_StandbyAcceptsLeaderForwards(t *testing.T) {
+	leader, tg, mx := newTestBridge(t)
+	leader.cfg.WebhookURL = "https://bridge.example"
+	pairChats(t, leader.repo, -100, 200)
+	// Вторая реплика с той же БД: только принимает webhook'и
+	standby := NewBridge(leader.cfg, leader.repo, newFakeTGSender(), newFakeMAXSender(testMaxBotUID))
+
+	msg := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "supergroup"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: "hello"}
+	postWebhook(t, standby, "tg", TGUpdate{UpdateID: 41, Message: msg})
+	postWebhook(t, standby, "max", maxTextUpdate(200, 5, "Olga", "mid.src", "привет"))
+
+	runUntil(t, leader.listenTelegram, func() bool { leader.deliver.Wait(); return len(mx.sent()) == 1 })
+	runUntil(t, leader.listenMax, func() bool { leader.deliver.Wait(); return len(tg.sent()) == 1 })
+
+	// Телеграм повторил webhook, а новый лидер перечитал inbox — дублей нет
+	postWebhook(t, standby, "tg", TGUpdate{UpdateID: 41, Message: msg})
+	postWebhook(t, standby, "tg", TGUpdate{UpdateID: 42, Message: &TGMessage{MessageID: 8, Chat: msg.Chat, From: msg.From, Text: "again"}})
+	runUntil(t, leader.listenTelegram, func() bool {
+		leader.deliver.Wait()
+		left, _ := leader.repo.PeekInbox("tg", 0, 10)
+		return len(mx.sent()) == 2 && len(left) == 0
+	})
+}
+
+func TestWebhookInbox_KeepsItemUntilDelivered(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	b.cfg.WebhookURL = "https://bridge.example"
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -101, 201)
+
+	// Доставка в MAX-чат 200 зависла: первый апдейт ждёт в её очереди
+	release := make(chan struct{})
+	b.deliver.Submit(maxDeliveryKey(200), func() { <-release })
+	from := &UserInfo{ID: 1, FirstName: "Ivan"}
+	postWebhook(t, b, "tg", TGUpdate{UpdateID: 41, Message: &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "supergroup"}, From: from, Text: "stalled"}})
+	postWebhook(t, b, "tg", TGUpdate{UpdateID: 42, Message: &TGMessage{MessageID: 8, Chat: ChatInfo{ID: -101, Type: "supergroup"}, From: from, Text: "free"}})
+
+	stalled := true
+	runUntil(t, b.listenTelegram, func() bool {
+		if stalled {
+			if len(mx.sent()) == 0 {
+				return false
+			}
+			// Listener уже взял следующий апдейт, но запись зависшего осталась
+			left, _ := b.repo.PeekInbox("tg", 0, 10)
+			var upd TGUpdate
+			if len(left) == 0 || json.Unmarshal(left[0].Body, &upd) != nil || upd.UpdateID != 41 {
+				t.Errorf("tg inbox = %d items, want the stalled update 41 kept", len(left))
+			}
+			stalled = false
+			close(release)
+		}
+		left, _ := b.repo.PeekInbox("tg", 0, 10)
+		return len(mx.sent()) == 2 && len(left) == 0
+	})
+}
+
+func TestWebhookHandler_DBErrorAsksForRetry(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	b.repo.Close()
+
+	rec := httptest.NewRecorder()
+	b.webhookHandler("tg")(rec, httptest.NewRequest(http.MethodPost, "/wh", bytes.NewReader([]byte(`{}`))))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500 so the platform retries the webhook", rec.Code)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bearlogin-bridge/testserver"
+)
+
+const itTimeout = 10 * time.Second
+
+// startIntegrationBridge поднимает стенды TG/MAX и запускает Bridge.Run поверх настоящих адаптеров.
+func startIntegrationBridge(t *testing.T) (*Bridge, *testserver.TG, *testserver.MAX) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+
+	tgSrv := testserver.NewTG("tg-token")
+	maxSrv := testserver.NewMAX(testMaxBotUID, "bridge_bot")
+	repo, err := NewSQLiteRepo(filepath.Join(t.TempDir(), "bridge.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteRepo: %v", err)
+	}
+	b, stop := runIntegrationBridge(t, repo, tgSrv, maxSrv)
+
+	t.Cleanup(func() {
+		stop()
+		tgSrv.Close()
+		maxSrv.Close()
+		repo.Close()
+	})
+	return b, tgSrv, maxSrv
+}
+
+// runIntegrationBridge запускает Bridge.Run поверх repo и стендов; stop останавливает его и ждёт выхода.
+func runIntegrationBridge(t *testing.T, repo Repository, tgSrv *testserver.TG, maxSrv *testserver.MAX) (*Bridge, func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	tg, err := NewTGBotSender(ctx, "tg-token", tgSrv.URL())
+	if err != nil {
+		t.Fatalf("NewTGBotSender: %v", err)
+	}
+	mx, err := NewMaxBotSender(ctx, "max-token", maxSrv.URL())
+	if err != nil {
+		t.Fatalf("NewMaxBotSender: %v", err)
+	}
+
+	cfg := Config{MaxToken: "max-token", TgAPIURL: tgSrv.URL(), MaxAPIURL: maxSrv.URL()}
+	b := NewBridge(cfg, repo, tg, mx)
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+	var once sync.Once
+	return b, func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// awaitMaxText ждёт сообщение в MAX-чат, содержащее substr.
+func awaitMaxText(t *testing.T, srv *testserver.MAX, chatID int64, substr string) testserver.MAXSentMessage {
+	t.Helper()
+	deadline := time.Now().Add(itTimeout)
+	for time.Now().Before(deadline) {
+		for _, m := range srv.SentMessages(chatID) {
+			if strings.Contains(m.Text, substr) {
+				return m
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("MAX chat %d: no message containing %q", chatID, substr)
+	return testserver.MAXSentMessage{}
+}
+
+// awaitTgText ждёт вызов method в TG-чат, текст которого содержит substr.
+func awaitTgText(t *testing.T, srv *testserver.TG, method string, chatID int64, substr string) testserver.TGRequest {
+	t.Helper()
+	deadline := time.Now().Add(itTimeout)
+	for time.Now().Before(deadline) {
+		for _, r := range srv.Requests(method) {
+			if r.ChatID() == chatID && strings.Contains(r.Params["text"], substr) {
+				return r
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("TG %s to chat %d: no text containing %q", method, chatID, substr)
+	return testserver.TGRequest{}
+}
+
+var keyRe = regexp.MustCompile(`/bridge ([0-9a-f]+)`)
+
+// pairViaCommands связывает чаты командами /bridge, как это делают пользователи.
+func pairViaCommands(t *testing.T, tgSrv *testserver.TG, maxSrv *testserver.MAX, tgChatID, maxChatID int64) {
+	t.Helper()
+	tgSrv.SetChatMember(tgChatID, 10, "administrator")
+	maxSrv.SetAdmins(maxChatID, 20)
+
+	// Ключ ищем только среди ответов на эту команду — чат может связываться повторно (fan-out).
+	seen := len(tgSrv.Requests("sendMessage"))
+	tgSrv.PushMessage(tgChatID, 10, "Ivan", "/bridge")
+	var m []string
+	deadline := time.Now().Add(itTimeout)
+	for m == nil {
+		for _, r := range tgSrv.Requests("sendMessage")[seen:] {
+			if r.ChatID() == tgChatID {
+				m = keyRe.FindStringSubmatch(r.Params["text"])
+			}
+		}
+		if m == nil && time.Now().After(deadline) {
+			t.Fatalf("TG chat %d: no /bridge key", tgChatID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	maxSrv.PushMessage(maxChatID, 20, "Olga", "/bridge "+m[1])
+	awaitMaxText(t, maxSrv, maxChatID, "Связано!")
+}
+
+func TestIntegration_PairForwardEditDelete(t *testing.T) {
+	_, tgSrv, maxSrv := startIntegrationBridge(t)
+	pairViaCommands(t, tgSrv, maxSrv, -100, 200)
+
+	// TG → MAX
+	tgSrv.PushMessage(-100, 10, "Ivan", "hello")
+	awaitMaxText(t, maxSrv, 200, "[TG] Ivan: hello")
+
+	// MAX → TG
+	mid := maxSrv.PushMessage(200, 20, "Olga", "привет")
+	awaitTgText(t, tgSrv, "sendMessage", -100, "[MAX] Olga: привет")
+
+	// MAX edit → TG editMessageText
+	maxSrv.PushEdit(200, 20, "Olga", mid, "привет!")
+	awaitTgText(t, tgSrv, "editMessageText", -100, "привет!")
+
+	// MAX delete → TG deleteMessage
+	maxSrv.PushRemoved(200, mid)
+	if _, ok := tgSrv.Await("deleteMessage", 1, itTimeout); !ok {
+		t.Fatal("TG deleteMessage not called")
+	}
+}
+
+func TestIntegration_QueueRetry(t *testing.T) {
+	b, tgSrv, maxSrv := startIntegrationBridge(t)
+	pairViaCommands(t, tgSrv, maxSrv, -100, 200)
+
+	maxSrv.FailNext("POST", "/messages", 503, `{"code":"internal.error","message":"unavailable"}`)
+	msgID := tgSrv.PushMessage(-100, 10, "Ivan", "queued")
+
+	db := b.repo.(*sqliteRepo).db
+	deadline := time.Now().Add(itTimeout)
+	for {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM send_queue").Scan(&n)
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("send_queue has %d items, want 1", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Не ждём штатные 10 секунд — делаем элемент готовым к ретраю и прогоняем очередь вручную.
+	db.Exec("UPDATE send_queue SET next_retry = 0")
+	b.processQueue(context.Background())
+
+	awaitMaxText(t, maxSrv, 200, "[TG] Ivan: queued")
+	if _, ok := b.repo.LookupMaxMsgID(-100, msgID, 200); !ok {
+		t.Error("queued message mapping not saved after retry")
+	}
+}
+
+func TestIntegration_FanOut(t *testing.T) {
+	b, tgSrv, maxSrv := startIntegrationBridge(t)
+	pairViaCommands(t, tgSrv, maxSrv, -100, 200)
+	pairViaCommands(t, tgSrv, maxSrv, -100, 300)
+
+	msgID := tgSrv.PushMessage(-100, 10, "Ivan", "всем")
+	awaitMaxText(t, maxSrv, 200, "[TG] Ivan: всем")
+	awaitMaxText(t, maxSrv, 300, "[TG] Ivan: всем")
+
+	mid200, ok200 := b.repo.LookupMaxMsgID(-100, msgID, 200)
+	mid300, ok300 := b.repo.LookupMaxMsgID(-100, msgID, 300)
+	if !ok200 || !ok300 || mid200 == mid300 {
+		t.Fatalf("mappings = %q/%v, %q/%v; want two distinct copies", mid200, ok200, mid300, ok300)
+	}
+
+	// Правка в TG доходит до обеих копий
+	tgSrv.PushEdit(-100, msgID, 10, "Ivan", "всем!")
+	if _, ok := maxSrv.Await("PUT", "/messages", 2, itTimeout); !ok {
+		t.Fatal("MAX edits not delivered to both copies")
+	}
+}
+
+func TestIntegration_ResumeAfterRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	tgSrv := testserver.NewTG("tg-token")
+	maxSrv := testserver.NewMAX(testMaxBotUID, "bridge_bot")
+	defer tgSrv.Close()
+	defer maxSrv.Close()
+	repo, err := NewSQLiteRepo(filepath.Join(t.TempDir(), "bridge.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteRepo: %v", err)
+	}
+	defer repo.Close()
+
+	_, stop := runIntegrationBridge(t, repo, tgSrv, maxSrv)
+	pairViaCommands(t, tgSrv, maxSrv, -100, 200)
+	tgSrv.PushMessage(-100, 10, "Ivan", "before")
+	awaitMaxText(t, maxSrv, 200, "Ivan: before")
+	maxSrv.PushMessage(200, 20, "Olga", "до")
+	awaitTgText(t, tgSrv, "sendMessage", -100, "Olga: до")
+	stop()
+
+	if repo.GetPollState("tg") == 0 || repo.GetPollState("max") == 0 {
+		t.Fatalf("poll state not saved: tg=%d max=%d", repo.GetPollState("tg"), repo.GetPollState("max"))
+	}
+
+	// Пока мост лежит, приходят новые сообщения
+	tgSrv.PushMessage(-100, 10, "Ivan", "while down")
+	maxSrv.PushMessage(200, 20, "Olga", "пока лежал")
+
+	_, stop = runIntegrationBridge(t, repo, tgSrv, maxSrv)
+	defer stop()
+	awaitMaxText(t, maxSrv, 200, "Ivan: while down")
+	awaitTgText(t, tgSrv, "sendMessage", -100, "Olga: пока лежал")
+
+	n := 0
+	for _, m := range maxSrv.SentMessages(200) {
+		if strings.Contains(m.Text, "Ivan: before") {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("message before restart delivered %d times, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log/slog"
+	"time"
+)
+
+// Elector выбирает лидера среди реплик моста. Лидер читает апдейты (polling или inbox
+// webhook'ов), обрабатывает очередь и чистит БД; остальные реплики только принимают
+// webhook'и и ждут, когда лидерство освободится.
+type Elector interface {
+	// Lead вызывает lead каждый раз, когда реплика становится лидером, и отменяет его
+	// контекст при потере лидерства. Возвращается после отмены ctx.
+	Lead(ctx context.Context, lead func(ctx context.Context))
+}
+
+// localElector — единственный экземпляр (SQLite): всегда лидер.
+type localElector struct{}
+
+func (localElector) Lead(ctx context.Context, lead func(ctx context.Context)) {
+	lead(ctx)
+}
+
+// Параметры выборов (переменные — чтобы тесты могли их ускорить).
+var (
+	leaderRetryInterval = 2 * time.Second // как часто standby пытается взять лидерство
+	leaderCheckInterval = 2 * time.Second // как часто лидер проверяет соединение, держащее блокировку
+)
+
+// leaderLockKey — ключ advisory lock'а лидера ("bearbrdg").
+const leaderLockKey int64 = 0x6265617262726467
+
+// leaderKey — ключ блокировки арендатора: лидер выбирается для каждого моста отдельно,
+// и арендаторы могут распределиться по репликам.
+func leaderKey(tenant string) int64 {
+	if tenant == "" {
+		return leaderLockKey
+	}
+	h := fnv.New64a()
+	h.Write([]byte("bearbrdg/" + tenant))
+	return int64(h.Sum64())
+}
+
+// pgElector — лидерство через session-level advisory lock PostgreSQL на отдельном
+// соединении. Блокировка живёт, пока живо соединение: если лидер упал или потерял
+// связь с БД, PostgreSQL снимает её, и standby забирает лидерство за leaderRetryInterval.
+type pgElector struct {
+	db     *sql.DB
+	key    int64
+	tenant string // для логов
+}
+
+func newPGElector(db *sql.DB, tenant string) *pgElector {
+	return &pgElector{db: db, key: leaderKey(tenant), tenant: tenant}
+}
+
+func (e *pgElector) Lead(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		if conn, ok := e.acquire(ctx); ok {
+			slog.Info("Leadership acquired", "tenant", e.tenant)
+			e.hold(ctx, conn, lead)
+			slog.Info("Leadership released", "tenant", e.tenant)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+// acquire пытается взять блокировку. При успехе соединение остаётся за лидером.
+func (e *pgElector) acquire(ctx context.Context) (*sql.Conn, bool) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		slog.Warn("leader election: DB connection failed", "err", err)
+		return nil, false
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&locked); err != nil {
+		slog.Warn("leader election: lock query failed", "err", err)
+		conn.Close()
+		return nil, false
+	}
+	if !locked {
+		conn.Close()
+		return nil, false
+	}
+	return conn, true
+}
+
+// hold запускает lead и раз в leaderCheckInterval проверяет соединение с блокировкой.
+// Если оно оборвалось, блокировку уже может держать другая реплика — lead останавливается.
+func (e *pgElector) hold(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	t := time.NewTicker(leaderCheckInterval)
+	defer t.Stop()
+watch:
+	for {
+		select {
+		case <-done:
+			break watch
+		case <-ctx.Done():
+			break watch
+		case <-t.C:
+			if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+				slog.Error("Leader lock connection lost", "err", err)
+				break watch
+			}
+		}
+	}
+	cancel()
+	<-done
+
+	// Снимаем блокировку, чтобы standby не ждал; если не вышло — выбрасываем
+	// соединение из пула, блокировка уйдёт вместе с сессией.
+	unlockCtx, cancelUnlock := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelUnlock()
+	if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
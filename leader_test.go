@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeElector отдаёт и отбирает лидерство по команде теста.
+type fakeElector struct {
+	grant chan bool // true — стать лидером, false — потерять лидерство
+}
+
+func (e *fakeElector) Lead(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case leader := <-e.grant:
+			if leader {
+				e.hold(ctx, lead)
+			}
+		}
+	}
+}
+
+// hold держит лидерство, пока тест его не отберёт.
+func (e *fakeElector) hold(ctx context.Context, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() { defer close(done); lead(leadCtx) }()
+	for {
+		select {
+		case <-ctx.Done():
+		case leader := <-e.grant:
+			if leader {
+				continue
+			}
+		}
+		cancel()
+		<-done
+		return
+	}
+}
+
+// waitFor ждёт выполнения условия не дольше пяти секунд.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun_StandbyTakesOverAndStepsDown(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	el := &fakeElector{grant: make(chan bool)}
+	b.elector = el
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() { defer close(finished); b.Run(ctx) }()
+
+	listening := func() bool {
+		tgL, _ := b.health.listener("tg")
+		maxL, _ := b.health.listener("max")
+		return tgL.Running && maxL.Running
+	}
+
+	waitFor(t, "standby role", b.health.isStandby)
+	if rep := b.readiness(); !rep.Ready || rep.Role != "standby" || listening() {
+		t.Errorf("standby: ready=%v role=%q listening=%v; want ready standby without listeners", rep.Ready, rep.Role, listening())
+	}
+
+	el.grant <- true
+	waitFor(t, "listeners on leader", listening)
+	if rep := b.readiness(); rep.Role != "leader" {
+		t.Errorf("role = %q, want leader", rep.Role)
+	}
+
+	el.grant <- false
+	waitFor(t, "step down", func() bool { return b.health.isStandby() && !listening() })
+
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// Геопозиции, места и контакты. В MAX геопозиция и контакт — вложения к сообщению
+// с текстом, в TG — отдельные сообщения без подписи. Поэтому из TG в MAX подпись
+// идёт текстом сообщения, а в TG геопозиция из MAX отправляется местом (venue):
+// подпись — его название, координаты — адрес. Контакт из MAX приходит в TG двумя
+// сообщениями: подпись и карточка ответом на неё.
+
+// tgPlaceText — текст сообщения MAX для геопозиции или контакта из TG.
+func tgPlaceText(msg *TGMessage) string {
+	if c := msg.Contact; c != nil {
+		return "👤 " + strings.TrimSpace(c.FirstName+" "+c.LastName) + ", " + c.PhoneNumber
+	}
+	loc := msg.Location
+	switch {
+	case loc.Title != "" && loc.Address != "":
+		return "📍 " + loc.Title + ", " + loc.Address
+	case loc.Title != "":
+		return "📍 " + loc.Title
+	case loc.LivePeriod > 0:
+		return "📍 Геопозиция (трансляция)"
+	}
+	return "📍 Геопозиция"
+}
+
+// tgPlaceMaxMessage собирает сообщение MAX с геопозицией или контактом из TG.
+// В связке подпись строится по её шаблону, в кросспостинге канала — только текст.
+func (b *Bridge) tgPlaceMaxMessage(msg *TGMessage, maxChatID int64) *MaxMessage {
+	text := tgPlaceText(msg)
+	if slices.Contains(b.repo.GetMaxChats(msg.Chat.ID, tgTopicID(msg)), maxChatID) {
+		text, _ = b.attribute(tgAttribution(msg, text), msg.Chat.ID, maxChatID, false)
+	}
+	m := &MaxMessage{ChatID: maxChatID, Text: text}
+	if c := msg.Contact; c != nil {
+		m.AddContact(strings.TrimSpace(c.FirstName+" "+c.LastName), c.PhoneNumber, c.VCard)
+	} else {
+		m.AddLocation(msg.Location.Latitude, msg.Location.Longitude)
+	}
+	return m
+}
+
+// sendTgPlaceToMax пересылает геопозицию, место или контакт из TG в MAX-чат.
+func (b *Bridge) sendTgPlaceToMax(ctx context.Context, msg *TGMessage, maxChatID int64) error {
+	m := b.tgPlaceMaxMessage(msg, maxChatID)
+	if msg.ReplyToMessage != nil {
+		if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID, maxChatID); ok {
+			m.ReplyTo = maxReplyID
+		}
+	}
+	mid, err := b.max.SendMessage(ctx, m)
+	if err != nil {
+		slog.Error("TG→MAX location/contact send failed", "err", err, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+		if errKind(err) == ErrPermanent {
+			return undeliverable(err)
+		}
+		return err
+	}
+	slog.Info("TG→MAX sent", "mid", mid, "type", tgMsgType(msg), "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+	b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+	b.metricForward("tg2max", tgMsgType(msg), msg.Chat.ID, maxChatID)
+	return nil
+}
+
+// editTgLocationInMax переносит обновление трансляции геопозиции в копию в MAX.
+func (b *Bridge) editTgLocationInMax(ctx context.Context, edited *TGMessage, maxChatID int64, maxMsgID string) {
+	if err := b.max.EditMessage(ctx, maxMsgID, b.tgPlaceMaxMessage(edited, maxChatID)); err != nil {
+		slog.Error("TG→MAX location edit failed", "err", err, "tgChat", edited.Chat.ID, "mid", maxMsgID)
+		return
+	}
+	slog.Debug("TG→MAX location edited", "mid", maxMsgID, "tgChat", edited.Chat.ID)
+}
+
+// maxPlaceCaption — подпись геопозиции или контакта из MAX для TG: caption, а если
+// у сообщения нет текста — подпись связки с заглушкой placeholder. В кросспостинге
+// канала сообщение без текста уходит без подписи.
+func (b *Bridge) maxPlaceCaption(msgUpd *maxschemes.MessageCreatedUpdate, tgChatID int64, caption, placeholder string) string {
+	if strings.TrimSpace(msgUpd.Message.Body.Text) != "" {
+		return caption
+	}
+	maxChatID := msgUpd.Message.Recipient.ChatId
+	if slices.Contains(b.repo.GetTgChats(maxChatID), tgChatID) {
+		text, _ := b.attribute(maxAttribution(&msgUpd.Message, placeholder), tgChatID, maxChatID, false)
+		return text
+	}
+	return ""
+}
+
+// sendMaxLocationToTg отправляет геопозицию из MAX в TG местом с подписью caption.
+func (b *Bridge) sendMaxLocationToTg(ctx context.Context, tgChatID int64, a *maxschemes.LocationAttachment, caption string, opts *SendOpts) (int, error) {
+	loc := TGLocation{Latitude: a.Latitude, Longitude: a.Longitude}
+	if caption != "" {
+		loc.Title = caption
+		loc.Address = fmt.Sprintf("%.5f, %.5f", a.Latitude, a.Longitude)
+	}
+	return b.tg.SendLocation(ctx, tgChatID, loc, opts)
+}
+
+// sendMaxContactToTg отправляет контакт из MAX в TG: подпись, а ответом на неё —
+// карточку. Возвращает ID отправленных сообщений, карточка — последняя. Контакт
+// без телефона (пользователь MAX) карточкой в TG не отправить — остаётся подпись
+// с именем.
+func (b *Bridge) sendMaxContactToTg(ctx context.Context, tgChatID int64, a *maxschemes.ContactAttachment, caption string, opts *SendOpts) ([]int, error) {
+	contact := maxContact(a)
+	if contact.PhoneNumber == "" {
+		text := strings.TrimSpace(caption + "\n👤 " + strings.TrimSpace(contact.FirstName+" "+contact.LastName))
+		id, err := b.tg.SendMessage(ctx, tgChatID, text, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []int{id}, nil
+	}
+	var ids []int
+	cardOpts := &SendOpts{ThreadID: opts.ThreadID, ReplyToID: opts.ReplyToID}
+	if caption != "" {
+		id, err := b.tg.SendMessage(ctx, tgChatID, caption, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		cardOpts.ReplyToID = id
+	}
+	id, err := b.tg.SendContact(ctx, tgChatID, contact, cardOpts)
+	if err != nil {
+		return ids, err
+	}
+	return append(ids, id), nil
+}
+
+// maxContact переводит контакт MAX в TG: имя и телефон — из vCard, имя без vCard —
+// из профиля пользователя MAX.
+func maxContact(a *maxschemes.ContactAttachment) TGContact {
+	c := TGContact{VCard: a.Payload.VcfInfo}
+	name, phone := parseVCard(a.Payload.VcfInfo)
+	if name == "" && a.Payload.TamInfo != nil {
+		name = a.Payload.TamInfo.Name
+	}
+	c.FirstName, c.LastName, _ = strings.Cut(name, " ")
+	c.PhoneNumber = phone
+	if c.FirstName == "" {
+		c.FirstName = "Контакт"
+	}
+	return c
+}
+
+// parseVCard достаёт из vCard имя (FN) и первый телефон (TEL).
+func parseVCard(vcf string) (name, phone string) {
+	for _, line := range strings.Split(strings.ReplaceAll(vcf, "\r\n", "\n"), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, _, _ = strings.Cut(strings.ToUpper(key), ";")
+		switch {
+		case key == "FN" && name == "":
+			name = strings.TrimSpace(value)
+		case key == "TEL" && phone == "":
+			phone = strings.TrimSpace(strings.TrimPrefix(value, "tel:"))
+		}
+	}
+	return name, phone
+}
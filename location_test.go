@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+func tgPlaceMessage(msgID int, loc *TGLocation, contact *TGContact) *TGMessage {
+	return &TGMessage{
+		MessageID: msgID,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Location:  loc,
+		Contact:   contact,
+	}
+}
+
+func TestTgPlace_ToMax(t *testing.T) {
+	tests := []struct {
+		name     string
+		loc      *TGLocation
+		contact  *TGContact
+		wantText string
+		wantAtt  string
+	}{
+		{"location", &TGLocation{Latitude: 55.75, Longitude: 37.62}, nil, "[TG] Ivan: 📍 Геопозиция", "location"},
+		{"live location", &TGLocation{Latitude: 55.75, Longitude: 37.62, LivePeriod: 900}, nil, "[TG] Ivan: 📍 Геопозиция (трансляция)", "location"},
+		{"venue", &TGLocation{Latitude: 55.75, Longitude: 37.62, Title: "Кафе", Address: "Тверская, 1"}, nil, "[TG] Ivan: 📍 Кафе, Тверская, 1", "location"},
+		{"contact", nil, &TGContact{PhoneNumber: "+79001234567", FirstName: "Olga", LastName: "Petrova"}, "[TG] Ivan: 👤 Olga Petrova, +79001234567", "contact"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+
+			runTgUpdates(b, tg, TGUpdate{Message: tgPlaceMessage(7, tt.loc, tt.contact)})
+
+			sent := mx.sent()
+			if len(sent) != 1 {
+				t.Fatalf("MAX sent %d messages, want 1", len(sent))
+			}
+			if sent[0].Text != tt.wantText {
+				t.Errorf("MAX text = %q, want %q", sent[0].Text, tt.wantText)
+			}
+			if len(sent[0].Attachments) != 1 {
+				t.Fatalf("MAX attachments = %+v, want one %s", sent[0].Attachments, tt.wantAtt)
+			}
+			var got string
+			switch sent[0].Attachments[0].(type) {
+			case *maxschemes.LocationAttachmentRequest:
+				got = "location"
+			case *maxschemes.ContactAttachmentRequest:
+				got = "contact"
+			}
+			if got != tt.wantAtt {
+				t.Errorf("MAX attachment = %T, want %s", sent[0].Attachments[0], tt.wantAtt)
+			}
+			if mid, ok := b.repo.LookupMaxMsgID(-100, 7, 200); !ok || mid != "mid.1" {
+				t.Errorf("LookupMaxMsgID = %q, %v; want mid.1, true", mid, ok)
+			}
+		})
+	}
+}
+
+func TestTgLiveLocation_EditsMax(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	moved := tgPlaceMessage(7, &TGLocation{Latitude: 55.76, Longitude: 37.61, LivePeriod: 900}, nil)
+	moved.EditDate = 1
+	unknown := tgPlaceMessage(8, &TGLocation{Latitude: 1, Longitude: 2, LivePeriod: 900}, nil)
+	unknown.EditDate = 1
+	runTgUpdates(b, tg,
+		TGUpdate{Message: tgPlaceMessage(7, &TGLocation{Latitude: 55.75, Longitude: 37.62, LivePeriod: 900}, nil)},
+		TGUpdate{EditedMessage: moved},
+		TGUpdate{EditedMessage: unknown},
+	)
+
+	if sent := mx.sent(); len(sent) != 1 {
+		t.Errorf("MAX sent %d messages, want only the original location", len(sent))
+	}
+	if len(mx.Edited) != 1 || mx.Edited[0].Mid != "mid.1" {
+		t.Fatalf("MAX edited = %+v, want mid.1", mx.Edited)
+	}
+	att, ok := mx.Edited[0].Msg.Attachments[0].(*maxschemes.LocationAttachmentRequest)
+	if !ok || att.Latitude != 55.76 || att.Longitude != 37.61 {
+		t.Errorf("edited attachment = %+v, want the new position", mx.Edited[0].Msg.Attachments)
+	}
+}
+
+func TestMaxPlace_ToTg(t *testing.T) {
+	contact := &maxschemes.ContactAttachment{Payload: maxschemes.ContactAttachmentPayload{
+		VcfInfo: "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Olga Petrova\r\nTEL;TYPE=cell:+79001234567\r\nEND:VCARD",
+	}}
+	maxUser := &maxschemes.ContactAttachment{Payload: maxschemes.ContactAttachmentPayload{
+		TamInfo: &maxschemes.User{UserId: 9, Name: "Olga"},
+	}}
+	location := &maxschemes.LocationAttachment{Latitude: 55.75, Longitude: 37.62}
+
+	type tgSend struct{ method, text string }
+	tests := []struct {
+		name string
+		text string
+		att  interface{}
+		want []tgSend
+	}{
+		{"location with text", "Я тут", location, []tgSend{{"sendVenue", "55.75000,37.62000 [MAX] Olga: Я тут|55.75000, 37.62000"}}},
+		{"location", "", location, []tgSend{{"sendVenue", "55.75000,37.62000 [MAX] Olga: 📍 Геопозиция|55.75000, 37.62000"}}},
+		{"contact", "", contact, []tgSend{{"sendMessage", "[MAX] Olga: 👤 Контакт"}, {"sendContact", "Olga Petrova +79001234567"}}},
+		{"contact without phone", "", maxUser, []tgSend{{"sendMessage", "[MAX] Olga: 👤 Контакт\n👤 Olga"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+
+			upd := maxTextUpdate(200, 5, "Olga", "mid.a", tt.text)
+			upd.Message.Body.Attachments = []interface{}{tt.att}
+			runMaxUpdates(b, mx, upd)
+
+			sent := tg.sent()
+			if len(sent) != len(tt.want) {
+				t.Fatalf("TG sent %+v, want %d messages", sent, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if sent[i].Method != w.method || sent[i].Text != w.text {
+					t.Errorf("TG sent[%d] = %s %q, want %s %q", i, sent[i].Method, sent[i].Text, w.method, w.text)
+				}
+			}
+			if last := sent[len(sent)-1]; len(sent) > 1 && last.Opts.ReplyToID != 1 {
+				t.Errorf("contact card replies to %d, want the caption 1", last.Opts.ReplyToID)
+			}
+			for i := range sent {
+				if mid, ok := b.repo.LookupMaxMsgID(-100, i+1, 200); !ok || mid != "mid.a" {
+					t.Errorf("LookupMaxMsgID(%d) = %q, %v; want mid.a, true", i+1, mid, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestParseVCard(t *testing.T) {
+	tests := []struct {
+		vcf       string
+		wantName  string
+		wantPhone string
+	}{
+		{"BEGIN:VCARD\r\nFN:Olga Petrova\r\nTEL;TYPE=cell:+79001234567\r\nTEL:+70000000000\r\nEND:VCARD", "Olga Petrova", "+79001234567"},
+		{"BEGIN:VCARD\nfn:Ivan\ntel:tel:+7900\nEND:VCARD", "Ivan", "+7900"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		name, phone := parseVCard(tt.vcf)
+		if name != tt.wantName || phone != tt.wantPhone {
+			t.Errorf("parseVCard(%q) = %q, %q; want %q, %q", tt.vcf, name, phone, tt.wantName, tt.wantPhone)
+		}
+	}
+}
@@ -8,11 +8,8 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
-
-	maxbot "github.com/max-messenger/max-bot-api-client-go"
 )
 
 func mustEnv(key string) string {
@@ -50,115 +47,102 @@ func logLevel() slog.Level {
 	}
 }
 
-func main() {
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel()})))
-
-	cfg := Config{
-		MaxToken:    mustEnv("MAX_TOKEN"),
-		TgBotURL:    envOr("TG_BOT_URL", "https://t.me/MaxTelegramBridgeBot"),
-		MaxBotURL:   envOr("MAX_BOT_URL", "https://max.ru/id710708943262_bot"),
-		WebhookURL:  os.Getenv("WEBHOOK_URL"),
-		WebhookPort: envOr("WEBHOOK_PORT", "8443"),
-		TgAPIURL:    os.Getenv("TG_API_URL"),
-	}
-
-	// Parse ALLOWED_USERS whitelist
-	if v := os.Getenv("ALLOWED_USERS"); v != "" {
-		for _, s := range strings.Split(v, ",") {
-			s = strings.TrimSpace(s)
-			if s == "" {
-				continue
-			}
-			id, err := strconv.ParseInt(s, 10, 64)
-			if err != nil {
-				slog.Error("Invalid ALLOWED_USERS value", "value", s, "err", err)
-				os.Exit(1)
-			}
-			cfg.AllowedUsers = append(cfg.AllowedUsers, id)
-		}
+// logConfig пишет в лог включённые ограничения.
+func logConfig(cfg Config) {
+	if len(cfg.AllowedUsers) > 0 {
 		slog.Info("User whitelist enabled", "count", len(cfg.AllowedUsers))
 	}
-
-	// Parse file size limits
-	if v := os.Getenv("TG_MAX_FILE_SIZE_MB"); v != "" {
-		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
-			cfg.TgMaxFileSizeMB = n
-		} else {
-			slog.Error("Invalid TG_MAX_FILE_SIZE_MB value", "value", v)
-			os.Exit(1)
-		}
-	}
-	if v := os.Getenv("MAX_MAX_FILE_SIZE_MB"); v != "" {
-		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
-			cfg.MaxMaxFileSizeMB = n
-		} else {
-			slog.Error("Invalid MAX_MAX_FILE_SIZE_MB value", "value", v)
-			os.Exit(1)
-		}
-	}
-
-	// Parse MAX_ALLOWED_EXTENSIONS whitelist (e.g. "pdf,docx,zip")
-	// Если не задан — расширения не проверяются локально (ошибка придёт от CDN).
-	if v := os.Getenv("MAX_ALLOWED_EXTENSIONS"); v != "" {
-		cfg.MaxAllowedExts = make(map[string]struct{})
-		for _, ext := range strings.Split(v, ",") {
-			ext = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(ext, ".")))
-			if ext != "" {
-				cfg.MaxAllowedExts[ext] = struct{}{}
-			}
-		}
+	if cfg.MaxAllowedExts != nil {
 		slog.Info("MAX file extension whitelist enabled", "count", len(cfg.MaxAllowedExts))
 	}
-
-	// MESSAGE_FORMAT=newline — текст с новой строки после имени: "Имя:\nтекст"
-	// По умолчанию (или MESSAGE_FORMAT=inline) — "Имя: текст"
-	if strings.ToLower(os.Getenv("MESSAGE_FORMAT")) == "newline" {
-		cfg.MessageNewline = true
+	if cfg.MessageNewline {
 		slog.Info("Message format: newline")
 	}
+}
 
-	dbPath := envOr("DB_PATH", "bridge.db")
-
-	var repo Repository
-	var err error
+// openRepo открывает БД: PostgreSQL, если задан DATABASE_URL, иначе SQLite (DB_PATH).
+func openRepo() Repository {
 	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
-		repo, err = NewPostgresRepo(dsn)
+		repo, err := NewPostgresRepo(dsn)
 		if err != nil {
 			slog.Error("PostgreSQL error", "err", err)
 			os.Exit(1)
 		}
 		slog.Info("DB: PostgreSQL")
-	} else {
-		repo, err = NewSQLiteRepo(dbPath)
+		return repo
+	}
+	dbPath := envOr("DB_PATH", "bridge.db")
+	repo, err := NewSQLiteRepo(dbPath)
+	if err != nil {
+		slog.Error("SQLite error", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("DB: SQLite", "path", dbPath)
+	return repo
+}
+
+func main() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel()})))
+
+	// Операторская подкоманда: ./max-telegram-bridge-bot deadletters list|show|retry|purge
+	if len(os.Args) > 1 && os.Args[1] == "deadletters" {
+		// В мультитенантном режиме арендатор выбирается через TENANT
+		repo := openRepo()
+		err := runDeadLettersCLI(repo.ForTenant(os.Getenv("TENANT")), os.Args[2:], os.Stdout)
+		repo.Close()
 		if err != nil {
-			slog.Error("SQLite error", "err", err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		slog.Info("DB: SQLite", "path", dbPath)
+		return
 	}
-	defer repo.Close()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	tgToken := mustEnv("TG_TOKEN")
-	tg, err := NewTGBotSender(ctx, tgToken, cfg.TgAPIURL)
+	// CONFIG_FILE — YAML с настройками; переменные окружения перекрывают его значения
+	configPath := os.Getenv("CONFIG_FILE")
+	cfg, err := loadConfig(configPath, os.Getenv)
 	if err != nil {
-		slog.Error("TG bot error", "err", err)
+		slog.Error("Config error", "err", err)
 		os.Exit(1)
 	}
+	logConfig(cfg)
 
-	maxApi, err := maxbot.New(cfg.MaxToken)
-	if err != nil {
-		slog.Error("MAX bot error", "err", err)
-		os.Exit(1)
+	// Мультитенантный режим — список tenants в CONFIG_FILE или TENANTS_FILE. Иначе
+	// единственная пара из TG_TOKEN / MAX_TOKEN, обязательных только в этом случае.
+	tenants := cfg.Tenants
+	if len(tenants) > 0 {
+		slog.Info("Multi-tenant mode", "tenants", len(tenants))
+	} else {
+		tenants = []tenantConfig{{TgToken: mustEnv("TG_TOKEN"), MaxToken: mustEnv("MAX_TOKEN")}}
 	}
-	maxInfo, err := maxApi.Bots.GetBot(context.Background())
-	if err != nil {
-		slog.Error("MAX bot info error", "err", err)
-		os.Exit(1)
+
+	repo := openRepo()
+	defer repo.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var bridges bridgeSet
+	for _, t := range tenants {
+		tcfg := t.apply(cfg)
+		tg, err := NewTGBotSender(ctx, t.TgToken, tcfg.TgAPIURL)
+		if err != nil {
+			slog.Error("TG bot error", "tenant", t.ID, "err", err)
+			os.Exit(1)
+		}
+
+		mx, err := NewMaxBotSender(ctx, tcfg.MaxToken, tcfg.MaxAPIURL)
+		if err != nil {
+			slog.Error("MAX bot error", "tenant", t.ID, "err", err)
+			os.Exit(1)
+		}
+
+		bridge := NewBridge(tcfg, repo.ForTenant(t.ID), tg, mx)
+		// С PostgreSQL реплик может быть несколько: лидер выбирается через advisory lock
+		if pg, ok := repo.(*pgRepo); ok {
+			bridge.elector = newPGElector(pg.db, t.ID)
+		}
+		bridges = append(bridges, bridge)
 	}
-	slog.Info("MAX bot started", "name", maxInfo.Name)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -168,7 +152,26 @@ func main() {
 		cancel()
 	}()
 
-	bridge := NewBridge(cfg, repo, tg, maxApi, maxInfo.UserId)
-	bridge.Run(ctx)
+	// SIGHUP перечитывает CONFIG_FILE, TENANTS_FILE и окружение; при ошибке остаётся
+	// прежняя конфигурация
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			cfg, err := loadConfig(configPath, os.Getenv)
+			if err != nil {
+				slog.Error("Config reload failed, keeping current config", "err", err)
+				continue
+			}
+			tenants = reloadTenants(tenants, cfg.Tenants)
+			for i, b := range bridges {
+				b.reload(tenants[i].apply(cfg))
+			}
+			logConfig(cfg)
+			slog.Info("Config reloaded")
+		}
+	}()
+
+	bridges.Run(ctx)
 	slog.Info("Bridge stopped")
 }
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"html"
 	"log/slog"
-	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -14,169 +14,92 @@ import (
 	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
 
-func (b *Bridge) listenMax(ctx context.Context) {
+// listenMax читает апдейты MAX, пока не отменён ctx. Возвращает ошибку, если поток
+// апдейтов не удалось запустить или он закрылся; перезапуском занимается superviseListener.
+func (b *Bridge) listenMax(ctx context.Context) error {
 	var updates <-chan maxschemes.UpdateInterface
 
 	if b.cfg.WebhookURL != "" {
 		whPath := b.maxWebhookPath()
 		whURL := strings.TrimRight(b.cfg.WebhookURL, "/") + whPath
-		ch := make(chan maxschemes.UpdateInterface, 100)
-		http.HandleFunc(whPath, b.maxApi.GetHandler(ch))
 		updateTypes := []string{
 			"message_created", "message_edited", "message_removed",
 			"message_callback", "bot_added", "bot_removed",
 			"user_added", "user_removed", "chat_title_changed",
 		}
-		if _, err := b.maxApi.Subscriptions.Subscribe(ctx, whURL, updateTypes, ""); err != nil {
-			slog.Error("MAX webhook subscribe failed", "err", err)
-			return
+		if err := b.max.Subscribe(ctx, whURL, updateTypes); err != nil {
+			return fmt.Errorf("MAX webhook subscribe: %w", err)
 		}
-		updates = ch
+		// Webhook принимает любая реплика (webhookHandler), апдейты читаются из inbox в БД
+		updates = inboxUpdates(ctx, b, "max", b.max.ParseUpdate, func(id int64) maxschemes.UpdateInterface { return &maxInboxMark{ID: id} })
+		b.health.started("max", "webhook")
 		slog.Info("MAX webhook mode")
 	} else {
-		updates = b.maxApi.GetUpdates(ctx)
+		// Продолжаем с сохранённого marker, чтобы не потерять апдейты, пришедшие во время рестарта
+		updates = b.max.StartPolling(ctx, b.repo.GetPollState("max"))
+		b.health.started("max", "polling")
 		slog.Info("MAX polling mode")
 	}
+	defer b.health.stopped("max")
 
 	for {
+		// Предыдущий апдейт обработан — отметить его, когда доставки завершатся
+		b.endUpdate(ctx, &b.maxBatch)
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case upd, ok := <-updates:
 			if !ok {
-				return
+				return errors.New("MAX updates channel closed")
+			}
+			if cp, ok := upd.(*maxPollCheckpoint); ok {
+				b.finishPollBatch(ctx, "max", cp.Marker, cp.Ack)
+				continue
+			}
+			if mark, ok := upd.(*maxInboxMark); ok {
+				b.maxBatch.inboxID = mark.ID
+				continue
+			}
+			b.health.touch("max")
+			if key, ok := maxUpdateKey(upd); !b.beginUpdate(&b.maxBatch, key, ok) {
+				continue
 			}
 
 			slog.Debug("MAX update", "type", fmt.Sprintf("%T", upd))
 
-			// Обработка удаления (только bridge, не crosspost)
+			// Обработка удаления (fan-out: удаляем каждую копию в TG)
 			if delUpd, isDel := upd.(*maxschemes.MessageRemovedUpdate); isDel {
-				tgChatID, tgMsgID, ok := b.repo.LookupTgMsgID(delUpd.MessageId)
-				if !ok {
-					continue
-				}
-				// Delete sync для crosspost: проверяем настройку sync_edits и direction
-				if maxCP, dir, cpOk := b.repo.GetCrosspostMaxChat(tgChatID); cpOk {
-					if !b.repo.GetCrosspostSyncEdits(maxCP) || dir == "tg>max" {
+				for _, link := range b.repo.LookupTgMsgIDs(delUpd.MessageId) {
+					if !b.pairAllows(link.TgChatID, link.MaxChatID, "max>tg") {
 						continue
 					}
-				}
-				if err := b.tg.DeleteMessage(ctx, tgChatID, tgMsgID); err != nil {
-					slog.Error("MAX→TG delete failed", "err", err, "maxMid", delUpd.MessageId, "tgChat", tgChatID)
-				} else {
-					slog.Info("MAX→TG deleted", "tgMsg", tgMsgID, "tgChat", tgChatID)
+					// Delete sync для crosspost: проверяем настройку sync_edits и direction
+					if maxCP, dir, cpOk := b.repo.GetCrosspostMaxChat(link.TgChatID); cpOk {
+						if !b.repo.GetCrosspostSyncEdits(maxCP) || dir == "tg>max" {
+							continue
+						}
+					}
+					b.deliverToTg(link.TgChatID, func() {
+						if err := b.tg.DeleteMessage(ctx, link.TgChatID, link.TgMsgID); err != nil {
+							slog.Error("MAX→TG delete failed", "err", err, "maxMid", delUpd.MessageId, "tgChat", link.TgChatID)
+						} else {
+							slog.Info("MAX→TG deleted", "tgMsg", link.TgMsgID, "tgChat", link.TgChatID)
+						}
+					})
 				}
 				continue
 			}
 
-			// Обработка edit
+			// Обработка edit (fan-out: правим каждую копию в TG)
 			if editUpd, isEdit := upd.(*maxschemes.MessageEditedUpdate); isEdit {
-				if editUpd.Message.Sender.UserId == b.maxBotUID {
-					continue
-				}
-				mid := editUpd.Message.Body.Mid
-				tgChatID, tgMsgID, ok := b.repo.LookupTgMsgID(mid)
-				if !ok {
-					continue
-				}
-				// Edit sync для crosspost: проверяем настройку sync_edits и direction
-				if maxCP, dir, cpOk := b.repo.GetCrosspostMaxChat(tgChatID); cpOk {
-					if !b.repo.GetCrosspostSyncEdits(maxCP) || dir == "tg>max" {
-						continue
-					}
-				}
-				prefix := b.repo.HasPrefix("max", editUpd.Message.Recipient.ChatId)
-				name := editUpd.Message.Sender.Name
-				if name == "" {
-					name = editUpd.Message.Sender.Username
-				}
-				text := editUpd.Message.Body.Text
-				if strings.HasPrefix(text, "[TG]") || strings.HasPrefix(text, "[MAX]") {
+				if b.maxFromBridge(&editUpd.Message) {
 					continue
 				}
-
-				// Конвертируем markups в HTML если есть
-				var fwd string
-				var editParseMode string
-				if len(editUpd.Message.Body.Markups) > 0 {
-					htmlText := maxMarkupsToHTML(text, editUpd.Message.Body.Markups)
-					escapedName := html.EscapeString(name)
-					if prefix {
-						escapedName = "[MAX] " + escapedName
-					}
-					if b.cfg.MessageNewline {
-						fwd = escapedName + ":\n" + htmlText
-					} else {
-						fwd = escapedName + ": " + htmlText
-					}
-					editParseMode = "HTML"
-				} else {
-					if prefix {
-						fwd = formatAttribution("[MAX] "+name, text, b.cfg.MessageNewline)
-					} else {
-						fwd = formatAttribution(name, text, b.cfg.MessageNewline)
-					}
-				}
-
-				// Проверяем вложения в edit — если есть медиа, используем editMessageMedia
-				var mediaURL, mediaType string
-				for _, att := range editUpd.Message.Body.Attachments {
-					switch a := att.(type) {
-					case *maxschemes.PhotoAttachment:
-						if a.Payload.Url != "" {
-							mediaURL, mediaType = a.Payload.Url, "photo"
-						}
-					case *maxschemes.VideoAttachment:
-						if a.Payload.Url != "" {
-							mediaURL, mediaType = a.Payload.Url, "video"
-						}
-					case *maxschemes.FileAttachment:
-						if a.Payload.Url != "" {
-							mediaURL, mediaType = a.Payload.Url, "document"
-						}
-					}
-					if mediaURL != "" {
-						break
-					}
-				}
-
-				if mediaURL != "" {
-					// Скачиваем медиа и отправляем editMessageMedia
-					data, name, dlErr := b.downloadURLWithLimit(mediaURL, b.cfg.maxMaxFileBytes())
-					if dlErr != nil {
-						slog.Error("MAX→TG edit media download failed", "err", dlErr)
-					} else {
-						var mediaIM TGInputMedia
-						switch mediaType {
-						case "photo":
-							mediaIM = TGInputMedia{Type: "photo", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
-						case "video":
-							mediaIM = TGInputMedia{Type: "video", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
-						case "document":
-							mediaIM = TGInputMedia{Type: "document", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
-						}
-						if err := b.tg.EditMessageMedia(ctx, tgChatID, tgMsgID, mediaIM); err != nil {
-							slog.Error("MAX→TG edit media failed", "err", err, "uid", editUpd.Message.Sender.UserId)
-							// Fallback — отправляем как новое сообщение
-							go b.sendTgMediaFromURL(ctx, tgChatID, mediaURL, mediaType, fwd, editParseMode, 0, 0, b.cfg.maxMaxFileBytes())
-						} else {
-							slog.Info("MAX→TG edited media", "tgMsg", tgMsgID, "type", mediaType, "uid", editUpd.Message.Sender.UserId)
-						}
+				for _, link := range b.repo.LookupTgMsgIDs(editUpd.Message.Body.Mid) {
+					if !b.pairAllows(link.TgChatID, link.MaxChatID, "max>tg") {
 						continue
 					}
-				}
-
-				if text == "" {
-					continue
-				}
-				var editOpts *SendOpts
-				if editParseMode != "" {
-					editOpts = &SendOpts{ParseMode: editParseMode}
-				}
-				if err := b.tg.EditMessageText(ctx, tgChatID, tgMsgID, fwd, editOpts); err != nil {
-					slog.Error("MAX→TG edit failed", "err", err, "uid", editUpd.Message.Sender.UserId, "maxChat", editUpd.Message.Recipient.ChatId)
-				} else {
-					slog.Info("MAX→TG edited", "tgMsg", tgMsgID, "uid", editUpd.Message.Sender.UserId, "maxChat", editUpd.Message.Recipient.ChatId)
+					b.deliverToTg(link.TgChatID, func() { b.syncMaxEditToTg(ctx, editUpd, link.TgChatID, link.TgMsgID) })
 				}
 				continue
 			}
@@ -205,47 +128,50 @@ func (b *Bridge) listenMax(ctx context.Context) {
 			}
 
 			if text == "/whoami" {
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					"MaxTelegramBridgeBot — мост между Telegram и MAX.\n" +
-						"Автор: Andrey Lugovskoy (@BEARlogin)\n" +
-						"Исходники: https://github.com/BEARlogin/max-telegram-bridge-bot\n" +
-						"Лицензия: CC BY-NC 4.0")
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: "MaxTelegramBridgeBot — мост между Telegram и MAX.\n" +
+					"Автор: Andrey Lugovskoy (@BEARlogin)\n" +
+					"Исходники: https://github.com/BEARlogin/max-telegram-bridge-bot\n" +
+					"Лицензия: CC BY-NC 4.0"}
+				b.replyMax(ctx, m)
 				continue
 			}
 
 			if text == "/start" || text == "/help" {
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					"Бот-мост между MAX и Telegram.\n\n" +
-						"Команды (группы):\n" +
-						"/bridge — создать ключ для связки чатов\n" +
-						"/bridge <ключ> — связать этот чат с Telegram-чатом по ключу\n" +
-						"/bridge prefix on/off — включить/выключить префикс [TG]/[MAX]\n" +
-						"/unbridge — удалить связку\n\n" +
-						"Кросспостинг каналов (в личке бота):\n" +
-						"/crosspost <TG_ID> — связать MAX-канал с TG-каналом\n" +
-						"   (TG ID получить: перешлите пост из TG-канала TG-боту)\n\n" +
-						"Как связать каналы:\n" +
-						"1. Добавьте бота админом в оба канала (с правом постинга)\n" +
-						"   TG: " + b.cfg.TgBotURL + "\n" +
-						"2. Перешлите пост из TG-канала в личку TG-бота\n" +
-						"3. Бот покажет ID канала — скопируйте\n" +
-						"4. Здесь в личке напишите: /crosspost <TG_ID>\n" +
-						"5. Перешлите пост из MAX-канала сюда → готово!\n\n" +
-						"/crosspost — список всех связок с кнопками управления\n" +
-						"Управление: перешлите пост из связанного канала → кнопки\n\n" +
-						"Автозамены в кросспостинге:\n" +
-						"В настройках связки (кнопка 🔄) можно добавить замены текста.\n" +
-						"Формат: текст | замена  или  /regex/ | замена\n" +
-						"Можно заменять только в ссылках или во всём тексте.\n\n" +
-						"Как связать группы:\n" +
-						"1. Добавьте бота в оба чата\n" +
-						"   MAX: " + b.cfg.MaxBotURL + "\n" +
-						"2. В одном из чатов отправьте /bridge\n" +
-						"3. Бот выдаст ключ — отправьте его в другом чате\n" +
-						"4. Готово!\n\n" +
-						"Поддержка: https://github.com/BEARlogin/max-telegram-bridge-bot/issues")
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: "Бот-мост между MAX и Telegram.\n\n" +
+					"Команды (группы):\n" +
+					"/bridge — создать ключ для связки чатов\n" +
+					"/bridge <ключ> — связать этот чат с Telegram-чатом по ключу\n" +
+					"/bridge prefix on/off — включить/выключить префикс [TG]/[MAX]\n" +
+					"/bridge direction tg>max|max>tg|both — направление пересылки\n" +
+					"/bridge format <шаблон>|reset — оформление подписи, например {{bold .Name}}: {{.Text}}\n" +
+					"/del — ответом на сообщение: удалить его и копии в Telegram (своё — любой, чужое и копии из Telegram — админ)\n" +
+					"/poll Вопрос | Вариант 1 | Вариант 2 — опрос здесь и в Telegram\n" +
+					"/queue — недоставленные сообщения (/queue retry <id>|all, /queue purge)\n" +
+					"/unbridge — удалить связку\n\n" +
+					"Кросспостинг каналов (в личке бота):\n" +
+					"/crosspost <TG_ID> — связать MAX-канал с TG-каналом\n" +
+					"   (TG ID получить: перешлите пост из TG-канала TG-боту)\n\n" +
+					"Как связать каналы:\n" +
+					"1. Добавьте бота админом в оба канала (с правом постинга)\n" +
+					"   TG: " + b.cfg.TgBotURL + "\n" +
+					"2. Перешлите пост из TG-канала в личку TG-бота\n" +
+					"3. Бот покажет ID канала — скопируйте\n" +
+					"4. Здесь в личке напишите: /crosspost <TG_ID>\n" +
+					"5. Перешлите пост из MAX-канала сюда → готово!\n\n" +
+					"/crosspost — список всех связок с кнопками управления\n" +
+					"Управление: перешлите пост из связанного канала → кнопки\n\n" +
+					"Автозамены в кросспостинге:\n" +
+					"В настройках связки (кнопка 🔄) можно добавить замены текста.\n" +
+					"Формат: текст | замена  или  /regex/ | замена\n" +
+					"Можно заменять только в ссылках или во всём тексте.\n\n" +
+					"Как связать группы:\n" +
+					"1. Добавьте бота в оба чата\n" +
+					"   MAX: " + b.cfg.MaxBotURL + "\n" +
+					"2. В одном из чатов отправьте /bridge\n" +
+					"3. Бот выдаст ключ — отправьте его в другом чате\n" +
+					"4. Готово!\n\n" +
+					"Поддержка: https://github.com/BEARlogin/max-telegram-bridge-bot/issues"}
+				b.replyMax(ctx, m)
 				continue
 			}
 
@@ -253,79 +179,148 @@ func (b *Bridge) listenMax(ctx context.Context) {
 			isGroup := isMaxGroup(msgUpd.Message.Recipient.ChatType)
 			isAdmin := false
 			if isGroup && msgUpd.Message.Sender.UserId != 0 {
-				admins, err := b.maxApi.Chats.GetChatAdmins(ctx, chatID)
+				admins, err := b.max.GetChatAdmins(ctx, chatID)
 				if err == nil {
-					isAdmin = isMaxUserAdmin(admins.Members, msgUpd.Message.Sender.UserId)
+					isAdmin = isMaxUserAdmin(admins, msgUpd.Message.Sender.UserId)
 				}
 			} else if isGroup {
 				// В каналах MAX не передаёт sender userId — пропускаем проверку
 				isAdmin = true
 			}
 
-			// /bridge prefix on/off
-			if text == "/bridge prefix on" || text == "/bridge prefix off" {
+			// /bridge prefix [<ID чата>] on|off
+			if text == "/bridge prefix" || strings.HasPrefix(text, "/bridge prefix ") {
+				if isGroup && !isAdmin {
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
+					continue
+				}
+				args := strings.TrimSpace(strings.TrimPrefix(text, "/bridge prefix"))
+				m := &MaxMessage{ChatID: chatID, Text: b.setPairPrefix("max", chatID, 0, args)}
+				b.replyMax(ctx, m)
+				continue
+			}
+
+			// /queue, /queue retry <id|all>, /queue purge — недоставленные сообщения
+			if text == "/queue" || strings.HasPrefix(text, "/queue ") {
+				if isGroup && !isAdmin {
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
+					continue
+				}
+				m := &MaxMessage{ChatID: chatID, Text: b.queueCommand("max", chatID, strings.TrimPrefix(text, "/queue"))}
+				b.replyMax(ctx, m)
+				continue
+			}
+
+			// /bridge direction [<ID чата>] tg>max|max>tg|both
+			if text == "/bridge direction" || strings.HasPrefix(text, "/bridge direction ") {
+				if isGroup && !isAdmin {
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
+					continue
+				}
+				dir := strings.TrimSpace(strings.TrimPrefix(text, "/bridge direction"))
+				m := &MaxMessage{ChatID: chatID, Text: b.setPairDirection("max", chatID, 0, dir)}
+				b.replyMax(ctx, m)
+				continue
+			}
+
+			// /del — ответом на сообщение: удалить его и копии в TG
+			if text == "/del" {
+				link := msgUpd.Message.Link
+				if link == nil || link.Type != maxschemes.REPLY || link.Message.Mid == "" {
+					m := &MaxMessage{ChatID: chatID, Text: "Отправьте /del ответом на сообщение, которое нужно удалить."}
+					b.replyMax(ctx, m)
+					continue
+				}
+				own := link.Sender.UserId != 0 && link.Sender.UserId == msgUpd.Message.Sender.UserId
+				if isGroup && !isAdmin && !own {
+					bridged := link.Sender.UserId == b.maxBotUID || b.repo.IsSent("max", chatID, link.Message.Mid)
+					m := &MaxMessage{ChatID: chatID, Text: delDenied(bridged, "Telegram")}
+					b.replyMax(ctx, m)
+					continue
+				}
+				refs, mids := b.beginDelete(nil, []string{link.Message.Mid})
+				b.replyMaxTask(chatID, func() {
+					if reply := b.deleteWithCopies(ctx, refs, mids); reply != "" {
+						b.max.SendMessage(ctx, &MaxMessage{ChatID: chatID, Text: reply})
+						return
+					}
+					b.max.DeleteMessage(ctx, msgUpd.Message.Body.Mid)
+				})
+				continue
+			}
+
+			// /poll Вопрос | Вариант | Вариант — опрос здесь и в связанных TG-чатах
+			if text == "/poll" || strings.HasPrefix(text, "/poll ") || strings.HasPrefix(text, "/poll\n") {
 				if isGroup && !isAdmin {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Эта команда доступна только админам группы.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
 					continue
 				}
-				on := text == "/bridge prefix on"
-				if b.repo.SetPrefix("max", chatID, on) {
-					reply := "Префикс [TG]/[MAX] включён."
-					if !on {
-						reply = "Префикс [TG]/[MAX] выключен."
+				b.replyMaxTask(chatID, func() {
+					if reply := b.maxPollCommand(ctx, msgUpd, strings.TrimPrefix(text, "/poll")); reply != "" {
+						b.max.SendMessage(ctx, &MaxMessage{ChatID: chatID, Text: reply})
 					}
-					m := maxbot.NewMessage().SetChat(chatID).SetText(reply)
-					b.maxApi.Messages.Send(ctx, m)
-				} else {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Чат не связан. Сначала выполните /bridge.")
-					b.maxApi.Messages.Send(ctx, m)
+				})
+				continue
+			}
+
+			// /bridge format [<ID чата>] <шаблон>|reset — шаблон подписи пересланных сообщений
+			if text == "/bridge format" || strings.HasPrefix(text, "/bridge format ") || strings.HasPrefix(text, "/bridge format\n") {
+				if isGroup && !isAdmin {
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
+					continue
 				}
+				format := strings.TrimSpace(strings.TrimPrefix(text, "/bridge format"))
+				m := &MaxMessage{ChatID: chatID, Text: b.setPairFormat("max", chatID, 0, format)}
+				b.replyMax(ctx, m)
 				continue
 			}
 
 			// /bridge или /bridge <key>
 			if text == "/bridge" || strings.HasPrefix(text, "/bridge ") {
 				if isGroup && !isAdmin {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Эта команда доступна только админам группы.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
 					continue
 				}
 				key := strings.TrimSpace(strings.TrimPrefix(text, "/bridge"))
-				paired, generatedKey, err := b.repo.Register(key, "max", chatID)
+				paired, generatedKey, err := b.repo.Register(key, "max", chatID, 0)
 				if err != nil {
 					slog.Error("register failed", "err", err)
 					continue
 				}
 
 				if paired {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Связано! Сообщения теперь пересылаются.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Связано! Сообщения теперь пересылаются."}
+					b.replyMax(ctx, m)
 					slog.Info("paired", "platform", "max", "chat", chatID, "key", key)
 				} else if generatedKey != "" {
-					m := maxbot.NewMessage().SetChat(chatID).
-						SetText(fmt.Sprintf("Ключ для связки: %s\n\nОтправьте в Telegram-чате:\n/bridge %s\n\nTG-бот: %s", generatedKey, generatedKey, b.cfg.TgBotURL))
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("Ключ для связки: %s\n\nОтправьте в Telegram-чате:\n/bridge %s\n\nTG-бот: %s", generatedKey, generatedKey, b.cfg.TgBotURL)}
+					b.replyMax(ctx, m)
 					slog.Info("pending", "platform", "max", "chat", chatID, "key", generatedKey)
 				} else {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Ключ не найден или чат той же платформы.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Ключ не найден или чат той же платформы."}
+					b.replyMax(ctx, m)
 				}
 				continue
 			}
 
 			if text == "/unbridge" {
 				if isGroup && !isAdmin {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Эта команда доступна только админам группы.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Эта команда доступна только админам группы."}
+					b.replyMax(ctx, m)
 					continue
 				}
 				if b.repo.Unpair("max", chatID) {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Связка удалена.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Связка удалена."}
+					b.replyMax(ctx, m)
 				} else {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Этот чат не связан.")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Этот чат не связан."}
+					b.replyMax(ctx, m)
 				}
 				continue
 			}
@@ -336,8 +331,8 @@ func (b *Bridge) listenMax(ctx context.Context) {
 					b.clearReplWait(msgUpd.Message.Sender.UserId)
 					rule, valid := parseReplacementInput(text)
 					if !valid {
-						m := maxbot.NewMessage().SetChat(chatID).SetText("Неверный формат. Используйте:\nfrom | to\nили\n/regex/ | to")
-						b.maxApi.Messages.Send(ctx, m)
+						m := &MaxMessage{ChatID: chatID, Text: "Неверный формат. Используйте:\nfrom | to\nили\n/regex/ | to"}
+						b.replyMax(ctx, m)
 						continue
 					}
 					rule.Target = w.target
@@ -349,8 +344,8 @@ func (b *Bridge) listenMax(ctx context.Context) {
 					}
 					if err := b.repo.SetCrosspostReplacements(w.maxChatID, repl); err != nil {
 						slog.Error("save replacements failed", "err", err)
-						m := maxbot.NewMessage().SetChat(chatID).SetText("Ошибка сохранения.")
-						b.maxApi.Messages.Send(ctx, m)
+						m := &MaxMessage{ChatID: chatID, Text: "Ошибка сохранения."}
+						b.replyMax(ctx, m)
 						continue
 					}
 					ruleType := "строка"
@@ -361,9 +356,8 @@ func (b *Bridge) listenMax(ctx context.Context) {
 					if w.direction == "max>tg" {
 						dirLabel = "MAX → TG"
 					}
-					m := maxbot.NewMessage().SetChat(chatID).SetText(
-						fmt.Sprintf("Замена добавлена (%s, %s):\n%s → %s", dirLabel, ruleType, rule.From, rule.To))
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("Замена добавлена (%s, %s):\n%s → %s", dirLabel, ruleType, rule.From, rule.To)}
+					b.replyMax(ctx, m)
 					continue
 				}
 			}
@@ -376,35 +370,32 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				if arg == "" {
 					links := b.repo.ListCrossposts(msgUpd.Message.Sender.UserId)
 					if len(links) == 0 {
-						m := maxbot.NewMessage().SetChat(chatID).SetText(
-							"Нет активных связок.\n\n" +
-								"Настройка:\n" +
-								"1. Перешлите пост из TG-канала в личку TG-бота\n" +
-								"   " + b.cfg.TgBotURL + "\n" +
-								"2. Бот покажет ID канала\n" +
-								"3. Здесь напишите: /crosspost <TG_ID>\n" +
-								"4. Перешлите пост из MAX-канала сюда")
-						b.maxApi.Messages.Send(ctx, m)
+						m := &MaxMessage{ChatID: chatID, Text: "Нет активных связок.\n\n" +
+							"Настройка:\n" +
+							"1. Перешлите пост из TG-канала в личку TG-бота\n" +
+							"   " + b.cfg.TgBotURL + "\n" +
+							"2. Бот покажет ID канала\n" +
+							"3. Здесь напишите: /crosspost <TG_ID>\n" +
+							"4. Перешлите пост из MAX-канала сюда"}
+						b.replyMax(ctx, m)
 					} else {
 						for _, l := range links {
-							kb := maxCrosspostKeyboard(b.maxApi, l.Direction, l.MaxChatID, b.repo.GetCrosspostSyncEdits(l.MaxChatID))
+							kb := maxCrosspostKeyboard(l.Direction, l.MaxChatID, b.repo.GetCrosspostSyncEdits(l.MaxChatID))
 							tgTitle := b.tgChatTitle(ctx, l.TgChatID)
 							statusText := maxCrosspostStatusText(l.TgChatID, l.Direction)
 							if tgTitle != "" {
 								statusText = fmt.Sprintf("TG: «%s» (%d)\n", tgTitle, l.TgChatID) + statusText
 							}
-							m := maxbot.NewMessage().SetChat(chatID).
-								SetText(statusText).
-								AddKeyboard(kb)
-							b.maxApi.Messages.Send(ctx, m)
+							m := &MaxMessage{ChatID: chatID, Text: statusText, Keyboard: kb}
+							b.replyMax(ctx, m)
 						}
 					}
 					continue
 				}
 				tgChannelID, err := strconv.ParseInt(arg, 10, 64)
 				if err != nil {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Неверный ID. Пример: /crosspost -1001234567890")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Неверный ID. Пример: /crosspost -1001234567890"}
+					b.replyMax(ctx, m)
 					continue
 				}
 
@@ -413,9 +404,8 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				b.cpWait[msgUpd.Message.Sender.UserId] = tgChannelID
 				b.cpWaitMu.Unlock()
 
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					fmt.Sprintf("TG канал ID: %d\n\nТеперь перешлите любой пост из MAX-канала, который хотите связать.", tgChannelID))
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("TG канал ID: %d\n\nТеперь перешлите любой пост из MAX-канала, который хотите связать.", tgChannelID)}
+				b.replyMax(ctx, m)
 				slog.Info("crosspost waiting for forward", "user", msgUpd.Message.Sender.UserId, "tgChannel", tgChannelID)
 				continue
 			}
@@ -435,29 +425,27 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				if waiting && maxChannelID != 0 {
 					// Проверяем, не связан ли уже
 					if _, _, ok := b.repo.GetCrosspostTgChat(maxChannelID); ok {
-						m := maxbot.NewMessage().SetChat(chatID).SetText("Этот MAX-канал уже связан.")
-						b.maxApi.Messages.Send(ctx, m)
+						m := &MaxMessage{ChatID: chatID, Text: "Этот MAX-канал уже связан."}
+						b.replyMax(ctx, m)
 						continue
 					}
 
 					// Достаём TG owner ID (кто переслал пост из TG-канала в TG-бот)
-				b.cpTgOwnerMu.Lock()
-				tgOwnerID := b.cpTgOwner[tgChannelID]
-				b.cpTgOwnerMu.Unlock()
+					b.cpTgOwnerMu.Lock()
+					tgOwnerID := b.cpTgOwner[tgChannelID]
+					b.cpTgOwnerMu.Unlock()
 
-				if err := b.repo.PairCrosspost(tgChannelID, maxChannelID, msgUpd.Message.Sender.UserId, tgOwnerID); err != nil {
+					if err := b.repo.PairCrosspost(tgChannelID, maxChannelID, msgUpd.Message.Sender.UserId, tgOwnerID); err != nil {
 						slog.Error("crosspost pair failed", "err", err)
-						m := maxbot.NewMessage().SetChat(chatID).SetText("Ошибка при создании связки.")
-						b.maxApi.Messages.Send(ctx, m)
+						m := &MaxMessage{ChatID: chatID, Text: "Ошибка при создании связки."}
+						b.replyMax(ctx, m)
 						continue
 					}
 
 					// Показать статус + клавиатуру после паринга
-					kb := maxCrosspostKeyboard(b.maxApi, "both", maxChannelID, false)
-					m := maxbot.NewMessage().SetChat(chatID).
-						SetText(fmt.Sprintf("Кросспостинг настроен!\nTG: %d ↔ MAX: %d\nНаправление: ⟷ оба", tgChannelID, maxChannelID)).
-						AddKeyboard(kb)
-					b.maxApi.Messages.Send(ctx, m)
+					kb := maxCrosspostKeyboard("both", maxChannelID, false)
+					m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("Кросспостинг настроен!\nTG: %d ↔ MAX: %d\nНаправление: ⟷ оба", tgChannelID, maxChannelID), Keyboard: kb}
+					b.replyMax(ctx, m)
 					slog.Info("crosspost paired", "tg", tgChannelID, "max", maxChannelID, "maxOwner", msgUpd.Message.Sender.UserId, "tgOwner", tgOwnerID)
 					continue
 				}
@@ -465,39 +453,41 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				// Нет cpWait — проверяем, связан ли канал → показать управление
 				if maxChannelID != 0 {
 					if tgID, direction, ok := b.repo.GetCrosspostTgChat(maxChannelID); ok {
-						kb := maxCrosspostKeyboard(b.maxApi, direction, maxChannelID, b.repo.GetCrosspostSyncEdits(maxChannelID))
-						m := maxbot.NewMessage().SetChat(chatID).
-							SetText(maxCrosspostStatusText(tgID, direction)).
-							AddKeyboard(kb)
-						b.maxApi.Messages.Send(ctx, m)
+						kb := maxCrosspostKeyboard(direction, maxChannelID, b.repo.GetCrosspostSyncEdits(maxChannelID))
+						m := &MaxMessage{ChatID: chatID, Text: maxCrosspostStatusText(tgID, direction), Keyboard: kb}
+						b.replyMax(ctx, m)
 						continue
 					}
 				}
 
 				// Канал не связан, cpWait нет — сообщить
 				if maxChannelID != 0 {
-					m := maxbot.NewMessage().SetChat(chatID).SetText("Этот канал не связан с кросспостингом.\n\nДля настройки:\n/crosspost <TG_ID>")
-					b.maxApi.Messages.Send(ctx, m)
+					m := &MaxMessage{ChatID: chatID, Text: "Этот канал не связан с кросспостингом.\n\nДля настройки:\n/crosspost <TG_ID>"}
+					b.replyMax(ctx, m)
 				}
 				continue
 			}
 
+			// Сообщения мостов (этого и других) обратно не пересылаются — иначе петля
+			if b.maxFromBridge(&msgUpd.Message) {
+				continue
+			}
+			unwrapMaxForward(&msgUpd.Message)
+
 			// Пересылка (bridge)
-			tgChatID, linked := b.repo.GetTgChat(chatID)
-			if linked && msgUpd.Message.Sender.UserId != b.maxBotUID {
-				// Anti-loop
-				if !strings.HasPrefix(text, "[TG]") && !strings.HasPrefix(text, "[MAX]") {
-					prefix := b.repo.HasPrefix("max", chatID)
-					caption := formatMaxCaption(msgUpd, prefix, b.cfg.MessageNewline)
-					go b.forwardMaxToTg(ctx, msgUpd, tgChatID, caption)
+			tgChatIDs := b.repo.GetTgChats(chatID)
+			if len(tgChatIDs) > 0 {
+				for _, tgChatID := range tgChatIDs {
+					if !b.pairAllows(tgChatID, chatID, "max>tg") {
+						continue
+					}
+					caption := b.maxCaption(msgUpd, tgChatID)
+					b.deliverToTg(tgChatID, func() { b.forwardMaxToTg(ctx, msgUpd, tgChatID, caption) })
 				}
 				continue
 			}
 
 			// Пересылка (crosspost fallback)
-			if msgUpd.Message.Sender.UserId == b.maxBotUID {
-				continue
-			}
 			tgChatID, direction, cpLinked := b.repo.GetCrosspostTgChat(chatID)
 			if !cpLinked {
 				continue
@@ -506,11 +496,6 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				continue // только TG→MAX, пропускаем
 			}
 
-			// Anti-loop
-			if strings.HasPrefix(text, "[TG]") || strings.HasPrefix(text, "[MAX]") {
-				continue
-			}
-
 			caption := formatMaxCrosspostCaption(msgUpd)
 
 			// Применяем замены для MAX→TG
@@ -519,12 +504,95 @@ func (b *Bridge) listenMax(ctx context.Context) {
 				caption = applyReplacements(caption, repl.MaxToTg)
 			}
 
-			go b.forwardMaxToTg(ctx, msgUpd, tgChatID, caption)
+			b.deliverToTg(tgChatID, func() { b.forwardMaxToTg(ctx, msgUpd, tgChatID, caption) })
 		}
 	}
 }
 
-// handleMaxCallback обрабатывает нажатия inline-кнопок (crosspost management).
+// syncMaxEditToTg переносит MAX edit на одну TG-копию сообщения.
+func (b *Bridge) syncMaxEditToTg(ctx context.Context, editUpd *maxschemes.MessageEditedUpdate, tgChatID int64, tgMsgID int) {
+	// Edit sync для crosspost: проверяем настройку sync_edits и direction
+	if maxCP, dir, cpOk := b.repo.GetCrosspostMaxChat(tgChatID); cpOk {
+		if !b.repo.GetCrosspostSyncEdits(maxCP) || dir == "tg>max" {
+			return
+		}
+	}
+	text := editUpd.Message.Body.Text
+
+	// Конвертируем markups в HTML если есть
+	var editParseMode string
+	bodyText, hasMarkups := text, len(editUpd.Message.Body.Markups) > 0
+	if hasMarkups {
+		bodyText = maxMarkupsToHTML(text, editUpd.Message.Body.Markups)
+	}
+	fwd, formatted := b.attribute(maxAttribution(&editUpd.Message, bodyText), tgChatID, editUpd.Message.Recipient.ChatId, hasMarkups)
+	if formatted {
+		editParseMode = "HTML"
+	}
+
+	// Проверяем вложения в edit — если есть медиа, используем editMessageMedia
+	var mediaURL, mediaType string
+	for _, att := range editUpd.Message.Body.Attachments {
+		switch a := att.(type) {
+		case *maxschemes.PhotoAttachment:
+			if a.Payload.Url != "" {
+				mediaURL, mediaType = a.Payload.Url, "photo"
+			}
+		case *maxschemes.VideoAttachment:
+			if a.Payload.Url != "" {
+				mediaURL, mediaType = a.Payload.Url, "video"
+			}
+		case *maxschemes.FileAttachment:
+			if a.Payload.Url != "" {
+				mediaURL, mediaType = a.Payload.Url, "document"
+			}
+		}
+		if mediaURL != "" {
+			break
+		}
+	}
+
+	if mediaURL != "" {
+		// Скачиваем медиа и отправляем editMessageMedia
+		data, name, dlErr := b.downloadURLWithLimit(mediaURL, b.conf().maxMaxFileBytes())
+		if dlErr != nil {
+			slog.Error("MAX→TG edit media download failed", "err", dlErr)
+		} else {
+			var mediaIM TGInputMedia
+			switch mediaType {
+			case "photo":
+				mediaIM = TGInputMedia{Type: "photo", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
+			case "video":
+				mediaIM = TGInputMedia{Type: "video", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
+			case "document":
+				mediaIM = TGInputMedia{Type: "document", File: FileArg{Name: name, Bytes: data}, Caption: fwd, ParseMode: editParseMode}
+			}
+			if err := b.tg.EditMessageMedia(ctx, tgChatID, tgMsgID, mediaIM); err != nil {
+				slog.Error("MAX→TG edit media failed", "err", err, "uid", editUpd.Message.Sender.UserId)
+				// Fallback — отправляем как новое сообщение
+				b.sendTgMediaFromURL(ctx, tgChatID, mediaURL, mediaType, fwd, editParseMode, 0, 0, b.conf().maxMaxFileBytes())
+			} else {
+				slog.Info("MAX→TG edited media", "tgMsg", tgMsgID, "type", mediaType, "uid", editUpd.Message.Sender.UserId)
+			}
+			return
+		}
+	}
+
+	if text == "" {
+		return
+	}
+	var editOpts *SendOpts
+	if editParseMode != "" {
+		editOpts = &SendOpts{ParseMode: editParseMode}
+	}
+	if err := b.tg.EditMessageText(ctx, tgChatID, tgMsgID, fwd, editOpts); err != nil {
+		slog.Error("MAX→TG edit failed", "err", err, "uid", editUpd.Message.Sender.UserId, "maxChat", editUpd.Message.Recipient.ChatId)
+	} else {
+		slog.Info("MAX→TG edited", "tgMsg", tgMsgID, "uid", editUpd.Message.Sender.UserId, "maxChat", editUpd.Message.Recipient.ChatId)
+	}
+}
+
+// handleMaxCallback обрабатывает нажатия inline-кнопок (crosspost management, опросы).
 func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.MessageCallbackUpdate) {
 	data := cbUpd.Callback.Payload
 	callbackID := cbUpd.Callback.CallbackID
@@ -532,6 +600,12 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 
 	slog.Debug("MAX callback", "uid", userID, "data", data)
 
+	// poll:<номер варианта> — голос в опросе
+	if strings.HasPrefix(data, "poll:") {
+		b.handleMaxPollVote(ctx, cbUpd, strings.TrimPrefix(data, "poll:"))
+		return
+	}
+
 	// cpd:dir:maxChatID — change direction
 	if strings.HasPrefix(data, "cpd:") {
 		parts := strings.SplitN(data, ":", 3)
@@ -547,7 +621,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			return
 		}
 		if !b.isCrosspostOwner(maxChatID, userID) {
-			b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 				Notification: "Только владелец связки может изменять настройки.",
 			})
 			return
@@ -555,8 +629,8 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		b.repo.SetCrosspostDirection(maxChatID, dir)
 
 		tgID, _, _ := b.repo.GetCrosspostTgChat(maxChatID)
-		body := maxCrosspostMessageBody(b.maxApi, maxCrosspostStatusText(tgID, dir), dir, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		body := maxCrosspostMessageBody(maxCrosspostStatusText(tgID, dir), dir, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: "Готово",
 		})
@@ -570,7 +644,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			return
 		}
 		if !b.isCrosspostOwner(maxChatID, userID) {
-			b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 				Notification: "Только владелец связки может изменять настройки.",
 			})
 			return
@@ -578,12 +652,12 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		cur := b.repo.GetCrosspostSyncEdits(maxChatID)
 		b.repo.SetCrosspostSyncEdits(maxChatID, !cur)
 		tgID, direction, _ := b.repo.GetCrosspostTgChat(maxChatID)
-		body := maxCrosspostMessageBody(b.maxApi, maxCrosspostStatusText(tgID, direction), direction, maxChatID, !cur)
+		body := maxCrosspostMessageBody(maxCrosspostStatusText(tgID, direction), direction, maxChatID, !cur)
 		note := "Синхронизация правок выключена"
 		if !cur {
 			note = "Синхронизация правок включена"
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: note,
 		})
@@ -597,12 +671,12 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			return
 		}
 		if !b.isCrosspostOwner(maxChatID, userID) {
-			b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 				Notification: "Только владелец связки может удалять.",
 			})
 			return
 		}
-		kb := b.maxApi.Messages.NewKeyboardBuilder()
+		kb := &maxbot.Keyboard{}
 		kb.AddRow().
 			AddCallback("Да, удалить", maxschemes.NEGATIVE, fmt.Sprintf("cpuc:%d", maxChatID)).
 			AddCallback("Отмена", maxschemes.DEFAULT, fmt.Sprintf("cpux:%d", maxChatID))
@@ -610,7 +684,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			Text:        "Удалить кросспостинг?",
 			Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(kb.Build())},
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message: body,
 		})
 		return
@@ -623,7 +697,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			return
 		}
 		if !b.isCrosspostOwner(maxChatID, userID) {
-			b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 				Notification: "Только владелец связки может удалять.",
 			})
 			return
@@ -631,7 +705,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		slog.Info("MAX crosspost unlink", "maxChatID", maxChatID, "by", userID)
 		b.repo.UnpairCrosspost(maxChatID, userID)
 		body := &maxschemes.NewMessageBody{Text: "Кросспостинг удалён."}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: "Удалено",
 		})
@@ -647,26 +721,22 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		repl := b.repo.GetCrosspostReplacements(maxChatID)
 		id := strconv.FormatInt(maxChatID, 10)
 		// Заголовок с кнопками добавления
-		kb := maxReplacementsKeyboard(b.maxApi, maxChatID)
+		kb := maxReplacementsKeyboard(maxChatID)
 		body := &maxschemes.NewMessageBody{
 			Text:        formatReplacementsHeader(repl),
 			Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(kb.Build())},
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
 		// Каждая замена — отдельное сообщение с кнопками
 		for i, r := range repl.TgToMax {
-			dkb := maxReplItemKeyboard(b.maxApi, "tg>max", i, id, r.Target)
-			m := maxbot.NewMessage().SetChat(cbUpd.Callback.User.UserId).
-				SetText(formatReplacementItem(r, "tg>max")).
-				AddKeyboard(dkb)
-			b.maxApi.Messages.Send(ctx, m)
+			dkb := maxReplItemKeyboard("tg>max", i, id, r.Target)
+			m := &MaxMessage{ChatID: cbUpd.Callback.User.UserId, Text: formatReplacementItem(r, "tg>max"), Keyboard: dkb}
+			b.replyMax(ctx, m)
 		}
 		for i, r := range repl.MaxToTg {
-			dkb := maxReplItemKeyboard(b.maxApi, "max>tg", i, id, r.Target)
-			m := maxbot.NewMessage().SetChat(cbUpd.Callback.User.UserId).
-				SetText(formatReplacementItem(r, "max>tg")).
-				AddKeyboard(dkb)
-			b.maxApi.Messages.Send(ctx, m)
+			dkb := maxReplItemKeyboard("max>tg", i, id, r.Target)
+			m := &MaxMessage{ChatID: cbUpd.Callback.User.UserId, Text: formatReplacementItem(r, "max>tg"), Keyboard: dkb}
+			b.replyMax(ctx, m)
 		}
 		return
 	}
@@ -701,7 +771,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		r.Target = newTarget
 		b.repo.SetCrosspostReplacements(maxChatID, repl)
 		newText := formatReplacementItem(*r, dir)
-		dkb := maxReplItemKeyboard(b.maxApi, dir, idx, id, r.Target)
+		dkb := maxReplItemKeyboard(dir, idx, id, r.Target)
 		body := &maxschemes.NewMessageBody{
 			Text:        newText,
 			Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(dkb.Build())},
@@ -710,7 +780,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		if newTarget == "links" {
 			label = "только ссылки"
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: "Тип: " + label,
 		})
@@ -740,7 +810,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		}
 		b.repo.SetCrosspostReplacements(maxChatID, repl)
 		body := &maxschemes.NewMessageBody{Text: "Замена удалена."}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: "Удалено",
 		})
@@ -759,7 +829,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		if dir == "max>tg" {
 			dirLabel = "MAX → TG"
 		}
-		kb := b.maxApi.Messages.NewKeyboardBuilder()
+		kb := &maxbot.Keyboard{}
 		kb.AddRow().
 			AddCallback("📝 Весь текст", maxschemes.DEFAULT, "cprat:"+dir+":all:"+id).
 			AddCallback("🔗 Только ссылки", maxschemes.DEFAULT, "cprat:"+dir+":links:"+id)
@@ -767,7 +837,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 			Text:        fmt.Sprintf("Добавление замены для %s.\nГде применять замену?", dirLabel),
 			Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(kb.Build())},
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
 		return
 	}
 
@@ -787,7 +857,7 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		body := &maxschemes.NewMessageBody{
 			Text: "Отправьте правило замены:\nfrom | to\n\nДля регулярного выражения:\n/regex/ | to\n\nНапример:\nutm_source=tg | utm_source=max",
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
 		return
 	}
 
@@ -799,12 +869,12 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		}
 		b.repo.SetCrosspostReplacements(maxChatID, CrosspostReplacements{})
 		repl := b.repo.GetCrosspostReplacements(maxChatID)
-		kb := maxReplacementsKeyboard(b.maxApi, maxChatID)
+		kb := maxReplacementsKeyboard(maxChatID)
 		body := &maxschemes.NewMessageBody{
 			Text:        formatReplacementsHeader(repl),
 			Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(kb.Build())},
 		}
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message:      body,
 			Notification: "Очищено",
 		})
@@ -821,8 +891,8 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		if !ok {
 			return
 		}
-		body := maxCrosspostMessageBody(b.maxApi, maxCrosspostStatusText(tgID, direction), direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
+		body := maxCrosspostMessageBody(maxCrosspostStatusText(tgID, direction), direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Message: body})
 		return
 	}
 
@@ -835,13 +905,13 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 		tgID, direction, ok := b.repo.GetCrosspostTgChat(maxChatID)
 		if !ok {
 			body := &maxschemes.NewMessageBody{Text: "Кросспостинг не найден."}
-			b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 				Message: body,
 			})
 			return
 		}
-		body := maxCrosspostMessageBody(b.maxApi, maxCrosspostStatusText(tgID, direction), direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.maxApi.Messages.AnswerOnCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		body := maxCrosspostMessageBody(maxCrosspostStatusText(tgID, direction), direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
 			Message: body,
 		})
 		return
@@ -849,8 +919,8 @@ func (b *Bridge) handleMaxCallback(ctx context.Context, cbUpd *maxschemes.Messag
 }
 
 // maxCrosspostMessageBody строит NewMessageBody с текстом и inline-клавиатурой.
-func maxCrosspostMessageBody(api *maxbot.Api, text, direction string, maxChatID int64, syncEdits bool) *maxschemes.NewMessageBody {
-	kb := maxCrosspostKeyboard(api, direction, maxChatID, syncEdits)
+func maxCrosspostMessageBody(text, direction string, maxChatID int64, syncEdits bool) *maxschemes.NewMessageBody {
+	kb := maxCrosspostKeyboard(direction, maxChatID, syncEdits)
 	return &maxschemes.NewMessageBody{
 		Text:        text,
 		Attachments: []interface{}{maxschemes.NewInlineKeyboardAttachmentRequest(kb.Build())},
@@ -858,7 +928,7 @@ func maxCrosspostMessageBody(api *maxbot.Api, text, direction string, maxChatID
 }
 
 // maxCrosspostKeyboard строит inline-клавиатуру для управления кросспостингом в MAX.
-func maxCrosspostKeyboard(api *maxbot.Api, direction string, maxChatID int64, syncEdits bool) *maxbot.Keyboard {
+func maxCrosspostKeyboard(direction string, maxChatID int64, syncEdits bool) *maxbot.Keyboard {
 	lblTgMax := "TG → MAX"
 	lblMaxTg := "MAX → TG"
 	lblBoth := "⟷ Оба"
@@ -875,7 +945,7 @@ func maxCrosspostKeyboard(api *maxbot.Api, direction string, maxChatID int64, sy
 	if syncEdits {
 		lblSync = "✓ ✏️ Синк правок"
 	}
-	kb := api.Messages.NewKeyboardBuilder()
+	kb := &maxbot.Keyboard{}
 	kb.AddRow().
 		AddCallback(lblTgMax, maxschemes.DEFAULT, "cpd:tg>max:"+id).
 		AddCallback(lblMaxTg, maxschemes.DEFAULT, "cpd:max>tg:"+id).
@@ -900,27 +970,47 @@ func maxCrosspostStatusText(tgChatID int64, direction string) string {
 }
 
 // forwardMaxToTg пересылает MAX-сообщение (текст/медиа) в TG-чат.
+// При временной ошибке сообщение со всеми вложениями ставится в очередь.
 func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageCreatedUpdate, tgChatID int64, caption string) {
-	if b.cbBlocked(tgChatID) {
+	if b.cbBlocked(tgChatID) || b.alreadyForwardedMax(msgUpd.Message.Body.Mid, tgChatID) {
 		return
 	}
+	// Более ранние сообщения в этот чат ждут ретрая — встаём в очередь за ними, чтобы не обогнать.
+	if b.repo.QueuedTo("max2tg", tgChatID) {
+		b.enqueueMax2Tg(msgUpd, tgChatID, caption, nil)
+		return
+	}
+	if err := b.sendMaxToTg(ctx, msgUpd, tgChatID, caption); err != nil && !isUndeliverable(err) {
+		chatID := msgUpd.Message.Recipient.ChatId
+		notifyText := "Не удалось переслать сообщение в Telegram. Попробуем ещё раз автоматически."
+		if b.cbBlocked(tgChatID) {
+			notifyText = "TG API недоступен. Сообщения в очереди, будут доставлены автоматически."
+		}
+		b.max.SendMessage(ctx, &MaxMessage{ChatID: chatID, Text: notifyText})
+		b.enqueueMax2Tg(msgUpd, tgChatID, caption, err)
+		b.cbFail(tgChatID, err)
+	}
+}
 
-	threadID := b.repo.GetTgThreadID(tgChatID)
-
+// sendMaxToTg собирает и отправляет MAX-сообщение в TG-чат со всеми вложениями.
+// Возвращает ошибку, если сообщение не доставлено; ошибки, после которых повтор бесполезен
+// (нет доступа, топик закрыт), обрабатываются на месте и помечаются undeliverable.
+func (b *Bridge) sendMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageCreatedUpdate, tgChatID int64, caption string) error {
 	body := msgUpd.Message.Body
 	chatID := msgUpd.Message.Recipient.ChatId
+	threadID := b.repo.GetTgThreadID(tgChatID, chatID)
 	text := strings.TrimSpace(body.Text)
 
 	// Reply ID
 	var replyToID int
 	if body.ReplyTo != "" {
-		if _, rid, ok := b.repo.LookupTgMsgID(body.ReplyTo); ok {
+		if rid, ok := b.repo.LookupTgMsgID(body.ReplyTo, tgChatID); ok {
 			replyToID = rid
 		}
 	} else if msgUpd.Message.Link != nil {
 		mid := msgUpd.Message.Link.Message.Mid
 		if mid != "" {
-			if _, rid, ok := b.repo.LookupTgMsgID(mid); ok {
+			if rid, ok := b.repo.LookupTgMsgID(mid, tgChatID); ok {
 				replyToID = rid
 			}
 		}
@@ -930,29 +1020,25 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 	var sentMsgID int
 	var sendErr error
 	mediaSent := false
-	var qAttType, qAttURL string // для очереди при ошибке
+	var qAttType, qAttURL string // первое фото/видео — для отправки одиночным сообщением
 
 	// Определяем HTML caption если есть markups
 	htmlCaption := caption
 	useHTML := len(body.Markups) > 0
-	if useHTML {
-		htmlText := maxMarkupsToHTML(text, body.Markups)
-		if caption == text {
-			// Кросспостинг: caption = сырой текст, без атрибуции
-			htmlCaption = htmlText
-		} else {
-			// Bridge: caption с атрибуцией — конвертируем текст отдельно, потом строим атрибуцию
-			name := maxName(msgUpd)
-			if b.repo.HasPrefix("max", msgUpd.Message.Recipient.ChatId) {
-				name = "[MAX] " + name
-			}
-			escapedName := html.EscapeString(name)
-			if b.cfg.MessageNewline {
-				htmlCaption = escapedName + ":\n" + htmlText
-			} else {
-				htmlCaption = escapedName + ": " + htmlText
-			}
+	switch {
+	case slices.Contains(b.repo.GetTgChats(chatID), tgChatID):
+		// Bridge: конвертируем текст отдельно, потом строим атрибуцию по шаблону связки
+		bodyText := text
+		if useHTML {
+			bodyText = maxMarkupsToHTML(text, body.Markups)
 		}
+		htmlCaption, useHTML = b.attribute(maxAttribution(&msgUpd.Message, bodyText), tgChatID, chatID, useHTML)
+	case useHTML && caption == text:
+		// Кросспостинг: caption = сырой текст, без атрибуции
+		htmlCaption = maxMarkupsToHTML(text, body.Markups)
+	case useHTML:
+		// Кросспостинг с автозаменами: разметка к изменённому тексту не подходит
+		htmlCaption = html.EscapeString(caption)
 	}
 
 	// Собираем вложения: фото/видео → albumMedia (отправляем вместе), остальные → soloMedia
@@ -962,6 +1048,8 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 		attType string
 		name    string
 	}
+	var location *maxschemes.LocationAttachment
+	var contact *maxschemes.ContactAttachment
 	pm := ""
 	if useHTML {
 		pm = "HTML"
@@ -1018,6 +1106,10 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 					name    string
 				}{a.Payload.Url, "sticker", ""})
 			}
+		case *maxschemes.LocationAttachment:
+			location = a
+		case *maxschemes.ContactAttachment:
+			contact = a
 		}
 	}
 
@@ -1034,14 +1126,13 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 
 		if len(albumMedia) == 1 {
 			// Одно вложение — отправляем обычным сообщением (альбом из 1 элемента не имеет reply)
-			sentMsgID, sendErr = b.sendTgMediaFromURL(ctx, tgChatID, qAttURL, qAttType, htmlCaption, pm, replyToID, threadID, b.cfg.maxMaxFileBytes())
+			sentMsgID, sendErr = b.sendTgMediaFromURL(ctx, tgChatID, qAttURL, qAttType, htmlCaption, pm, replyToID, threadID, b.conf().maxMaxFileBytes())
 			var e *ErrFileTooLarge
 			if errors.As(sendErr, &e) {
 				slog.Warn("MAX→TG media too big", "name", e.Name, "size", e.Size)
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
-						e.Name, formatFileSize(int(e.Size)), b.cfg.MaxMaxFileSizeMB))
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
+					e.Name, formatFileSize(int(e.Size)), b.conf().MaxMaxFileSizeMB)}
+				b.max.SendMessage(ctx, m)
 			}
 		} else {
 			// Несколько — отправляем как media group (альбом)
@@ -1049,8 +1140,8 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 			if err != nil {
 				slog.Error("MAX→TG album send failed", "err", err)
 				sendErr = err
-				m := maxbot.NewMessage().SetChat(chatID).SetText("Не удалось отправить медиаальбом в Telegram.")
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: "Не удалось отправить медиаальбом в Telegram."}
+				b.max.SendMessage(ctx, m)
 			} else if len(msgIDs) > 0 {
 				sentMsgID = msgIDs[0]
 			}
@@ -1068,20 +1159,18 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 			smReplyTo = replyToID
 		}
 		firstSolo = false
-		s, err := b.sendTgMediaFromURL(ctx, tgChatID, sm.url, sm.attType, smCaption, pm, smReplyTo, threadID, b.cfg.maxMaxFileBytes(), sm.name)
+		s, err := b.sendTgMediaFromURL(ctx, tgChatID, sm.url, sm.attType, smCaption, pm, smReplyTo, threadID, b.conf().maxMaxFileBytes(), sm.name)
 		if err != nil {
 			var e *ErrFileTooLarge
 			if errors.As(err, &e) {
 				slog.Warn("MAX→TG solo media too big", "name", e.Name, "size", e.Size)
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
-						e.Name, formatFileSize(int(e.Size)), b.cfg.MaxMaxFileSizeMB))
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
+					e.Name, formatFileSize(int(e.Size)), b.conf().MaxMaxFileSizeMB)}
+				b.max.SendMessage(ctx, m)
 			} else {
 				slog.Error("MAX→TG solo media send failed", "type", sm.attType, "err", err)
-				m := maxbot.NewMessage().SetChat(chatID).SetText(
-					fmt.Sprintf("Не удалось отправить файл \"%s\" в Telegram.", sm.name))
-				b.maxApi.Messages.Send(ctx, m)
+				m := &MaxMessage{ChatID: chatID, Text: fmt.Sprintf("Не удалось отправить файл \"%s\" в Telegram.", sm.name)}
+				b.max.SendMessage(ctx, m)
 			}
 			if sendErr == nil {
 				sendErr = err
@@ -1092,10 +1181,30 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 		}
 	}
 
+	// Геопозиция или контакт — текст сообщения уходит их подписью
+	switch {
+	case mediaSent:
+	case location != nil:
+		opts := &SendOpts{ReplyToID: replyToID, ThreadID: threadID}
+		sentMsgID, sendErr = b.sendMaxLocationToTg(ctx, tgChatID, location, b.maxPlaceCaption(msgUpd, tgChatID, caption, "📍 Геопозиция"), opts)
+		mediaSent = true
+	case contact != nil:
+		opts := &SendOpts{ReplyToID: replyToID, ThreadID: threadID}
+		var ids []int
+		ids, sendErr = b.sendMaxContactToTg(ctx, tgChatID, contact, b.maxPlaceCaption(msgUpd, tgChatID, caption, "👤 Контакт"), opts)
+		if len(ids) > 0 {
+			sentMsgID = ids[len(ids)-1]
+			for _, id := range ids[:len(ids)-1] {
+				b.repo.SaveMsg(tgChatID, id, chatID, body.Mid)
+			}
+		}
+		mediaSent = true
+	}
+
 	// Текст без медиа
 	if !mediaSent {
 		if text == "" {
-			return
+			return nil
 		}
 		if useHTML {
 			sentMsgID, sendErr = b.tg.SendMessage(ctx, tgChatID, htmlCaption, &SendOpts{ParseMode: "HTML", ReplyToID: replyToID, ThreadID: threadID})
@@ -1105,66 +1214,61 @@ func (b *Bridge) forwardMaxToTg(ctx context.Context, msgUpd *maxschemes.MessageC
 	}
 
 	if sendErr != nil {
-		errStr := sendErr.Error()
-		slog.Error("MAX→TG send failed", "err", errStr, "uid", msgUpd.Message.Sender.UserId, "maxChat", chatID, "tgChat", tgChatID)
-
-		// Группа преобразована в supergroup — автоматически мигрируем chat ID
-		var tgErr *TGError
-		if errors.As(sendErr, &tgErr) && tgErr.MigrateToChatID != 0 {
-			newChatID := tgErr.MigrateToChatID
-			slog.Info("TG chat migrated, updating pair", "old", tgChatID, "new", newChatID)
-			if err := b.repo.MigrateTgChat(tgChatID, newChatID); err != nil {
-				slog.Error("MigrateTgChat failed", "err", err)
-			} else {
-				// Повторяем отправку с новым ID
-				go b.forwardMaxToTg(ctx, msgUpd, newChatID, caption)
+		kind := errKind(sendErr)
+		slog.Error("MAX→TG send failed", "err", sendErr, "kind", kind, "uid", msgUpd.Message.Sender.UserId, "maxChat", chatID, "tgChat", tgChatID)
+
+		switch {
+		case kind == ErrChatMigrated:
+			// Группа преобразована в supergroup — автоматически мигрируем chat ID
+			var tgErr *TGError
+			if errors.As(sendErr, &tgErr) && tgErr.MigrateToChatID != 0 {
+				newChatID := tgErr.MigrateToChatID
+				slog.Info("TG chat migrated, updating pair", "old", tgChatID, "new", newChatID)
+				if err := b.repo.MigrateTgChat(tgChatID, newChatID); err != nil {
+					slog.Error("MigrateTgChat failed", "err", err)
+				} else {
+					// Повторяем отправку с новым ID
+					return b.sendMaxToTg(ctx, msgUpd, newChatID, caption)
+				}
+				return undeliverable(sendErr)
 			}
-			return
-		}
-		if strings.Contains(errStr, "upgraded to a supergroup") {
 			// Fallback если не удалось получить новый ID из ошибки
-			m := maxbot.NewMessage().SetChat(chatID).SetText(
-				"TG-группа была преобразована в супергруппу. Перепривяжите чат: /unbridge в MAX, затем /bridge заново в обоих чатах.")
-			b.maxApi.Messages.Send(ctx, m)
-			return
-		}
-
-		// TOPIC_CLOSED — General топик закрыт, уведомляем и не ретраим
-		if strings.Contains(errStr, "TOPIC_CLOSED") {
-			m := maxbot.NewMessage().SetChat(chatID).SetText(
-				"Не удалось переслать в Telegram: основной топик (General) закрыт.\nОткройте General в настройках TG-группы или сделайте бота админом.")
-			b.maxApi.Messages.Send(ctx, m)
-			return
-		}
-
-		// Топики были выключены — сбрасываем thread_id и повторяем
-		if threadID != 0 && (strings.Contains(errStr, "message thread not found") ||
-			strings.Contains(errStr, "TOPIC_NOT_FOUND") ||
-			strings.Contains(errStr, "topics are disabled")) {
+			m := &MaxMessage{ChatID: chatID, Text: "TG-группа была преобразована в супергруппу. Перепривяжите чат: /unbridge в MAX, затем /bridge заново в обоих чатах."}
+			b.max.SendMessage(ctx, m)
+			return undeliverable(sendErr)
+
+		case kind == ErrTopicClosed:
+			// General топик закрыт, уведомляем и не ретраим
+			m := &MaxMessage{ChatID: chatID, Text: "Не удалось переслать в Telegram: основной топик (General) закрыт.\nОткройте General в настройках TG-группы или сделайте бота админом."}
+			b.max.SendMessage(ctx, m)
+			return undeliverable(sendErr)
+
+		case kind == ErrTopicGone && threadID != 0:
+			// Топики были выключены — сбрасываем thread_id и повторяем
 			slog.Info("TG forum topics disabled, resetting thread_id", "tgChat", tgChatID, "oldThread", threadID)
-			b.repo.SetTgThreadID(tgChatID, 0)
-			go b.forwardMaxToTg(ctx, msgUpd, tgChatID, caption)
-			return
+			b.repo.ResetTgThread(tgChatID, threadID)
+			return b.sendMaxToTg(ctx, msgUpd, tgChatID, caption)
+
+		case kind == ErrPermanent || kind == ErrTopicGone:
+			// Бот не может писать в чат — не ретраим
+			notifyText := "Не удалось переслать сообщение в Telegram."
+			if b.cbFail(tgChatID, sendErr) {
+				notifyText = fmt.Sprintf("Не удалось переслать в Telegram. Пересылка приостановлена на %d мин. Проверьте, что бот добавлен в TG-группу и может в ней писать.", int(cbCooldown.Minutes()))
+			}
+			b.max.SendMessage(ctx, &MaxMessage{ChatID: chatID, Text: notifyText})
+			return undeliverable(sendErr)
 		}
 
-		parseMode := ""
-		if useHTML {
-			parseMode = "HTML"
-		}
+		// Слишком большой файл не пройдёт и при повторе — пользователь уже предупреждён
 		var eTooLarge *ErrFileTooLarge
-		if !errors.As(sendErr, &eTooLarge) {
-			notifyText := "Не удалось переслать сообщение в Telegram. Попробуем ещё раз автоматически."
-			if b.cbBlocked(tgChatID) {
-				notifyText = "TG API недоступен. Сообщения в очереди, будут доставлены автоматически."
-			}
-			m := maxbot.NewMessage().SetChat(chatID).SetText(notifyText)
-			b.maxApi.Messages.Send(ctx, m)
+		if errors.As(sendErr, &eTooLarge) {
+			return nil
 		}
-		b.enqueueMax2Tg(chatID, tgChatID, body.Mid, htmlCaption, qAttType, qAttURL, parseMode)
-		b.cbFail(tgChatID)
-	} else {
-		b.cbSuccess(tgChatID)
-		slog.Info("MAX→TG sent", "msgID", sentMsgID, "media", mediaSent, "uid", msgUpd.Message.Sender.UserId, "maxChat", chatID, "tgChat", tgChatID)
-		b.repo.SaveMsg(tgChatID, sentMsgID, chatID, body.Mid)
+		return sendErr
 	}
+	b.cbSuccess(tgChatID)
+	slog.Info("MAX→TG sent", "msgID", sentMsgID, "media", mediaSent, "uid", msgUpd.Message.Sender.UserId, "maxChat", chatID, "tgChat", tgChatID)
+	b.repo.SaveMsg(tgChatID, sentMsgID, chatID, body.Mid)
+	b.metricForward("max2tg", maxMsgType(body.Attachments), tgChatID, chatID)
+	return nil
 }
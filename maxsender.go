@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// --- Custom types for MAX adapter ---
+
+// MaxMessage — исходящее сообщение в MAX (send/edit).
+type MaxMessage struct {
+	ChatID      int64
+	UserID      int64 // для отправки в личку по user_id (если ChatID == 0)
+	Text        string
+	Format      string // "markdown", "html" или ""
+	ReplyTo     string // mid сообщения, на которое отвечаем
+	Attachments []interface{}
+	Keyboard    *maxbot.Keyboard
+}
+
+// AddPhoto добавляет загруженное фото.
+func (m *MaxMessage) AddPhoto(photo *maxschemes.PhotoTokens) *MaxMessage {
+	m.Attachments = append(m.Attachments, maxschemes.NewPhotoAttachmentRequest(maxschemes.PhotoAttachmentRequestPayload{
+		Photos: photo.Photos,
+	}))
+	return m
+}
+
+// AddMedia добавляет загруженное вложение по типу ("video", "file", "audio").
+func (m *MaxMessage) AddMedia(attType, token string) *MaxMessage {
+	info := maxschemes.UploadedInfo{Token: token}
+	switch attType {
+	case "video":
+		m.Attachments = append(m.Attachments, maxschemes.NewVideoAttachmentRequest(info))
+	case "audio":
+		m.Attachments = append(m.Attachments, maxschemes.NewAudioAttachmentRequest(info))
+	case "file":
+		m.Attachments = append(m.Attachments, maxschemes.NewFileAttachmentRequest(info))
+	}
+	return m
+}
+
+// AddLocation добавляет геопозицию.
+func (m *MaxMessage) AddLocation(latitude, longitude float64) *MaxMessage {
+	m.Attachments = append(m.Attachments, maxschemes.NewLocationAttachmentRequest(latitude, longitude))
+	return m
+}
+
+// AddContact добавляет карточку контакта (MAX требует, чтобы она была единственным вложением).
+func (m *MaxMessage) AddContact(name, phone, vcf string) *MaxMessage {
+	m.Attachments = append(m.Attachments, maxschemes.NewContactAttachmentRequest(maxschemes.ContactAttachmentRequestPayload{
+		Name:     name,
+		VcfPhone: phone,
+		VcfInfo:  vcf,
+	}))
+	return m
+}
+
+// hasUploadedMedia возвращает true, если среди вложений есть video/audio/file —
+// их CDN обрабатывает асинхронно, и отправка может вернуть attachment.not.ready.
+func (m *MaxMessage) hasUploadedMedia() bool {
+	for _, a := range m.Attachments {
+		switch a.(type) {
+		case *maxschemes.VideoAttachmentRequest, *maxschemes.AudioAttachmentRequest, *maxschemes.FileAttachmentRequest:
+			return true
+		}
+	}
+	return false
+}
+
+// body собирает NewMessageBody для MAX API.
+func (m *MaxMessage) body() *maxschemes.NewMessageBody {
+	atts := make([]interface{}, 0, len(m.Attachments)+1)
+	atts = append(atts, m.Attachments...)
+	if m.Keyboard != nil {
+		atts = append(atts, maxschemes.NewInlineKeyboardAttachmentRequest(m.Keyboard.Build()))
+	}
+	body := &maxschemes.NewMessageBody{
+		Text:        m.Text,
+		Attachments: atts,
+		Format:      m.Format,
+	}
+	if m.ReplyTo != "" {
+		body.Link = &maxschemes.NewMessageLink{Type: maxschemes.REPLY, Mid: m.ReplyTo}
+	}
+	return body
+}
+
+// --- Interface ---
+
+// MAXSender abstracts MAX Bot API. All MAX calls go through this interface.
+type MAXSender interface {
+	// SendMessage returns mid of the sent message.
+	SendMessage(ctx context.Context, msg *MaxMessage) (string, error)
+	EditMessage(ctx context.Context, mid string, msg *MaxMessage) error
+	DeleteMessage(ctx context.Context, mid string) error
+	AnswerCallback(ctx context.Context, callbackID string, answer *maxschemes.CallbackAnswer) error
+
+	UploadPhotoFromURL(ctx context.Context, url string) (*maxschemes.PhotoTokens, error)
+	UploadPhotoFromReader(ctx context.Context, reader io.Reader) (*maxschemes.PhotoTokens, error)
+	UploadMedia(ctx context.Context, uploadType maxschemes.UploadType, reader io.Reader, fileName string) (*maxschemes.UploadedInfo, error)
+
+	GetChatAdmins(ctx context.Context, chatID int64) ([]maxschemes.ChatMember, error)
+
+	Subscribe(ctx context.Context, url string, updateTypes []string) error
+	// ParseUpdate разбирает тело webhook-запроса MAX.
+	ParseUpdate(body []byte) (maxschemes.UpdateInterface, error)
+	// StartPolling читает апдейты long polling'ом начиная с marker (0 — с текущего
+	// момента по версии MAX) и отдаёт их пачками, за каждой пачкой — *maxPollCheckpoint.
+	StartPolling(ctx context.Context, marker int64) <-chan maxschemes.UpdateInterface
+
+	BotUserID() int64
+	BotName() string
+}
+
+// maxPollCheckpoint — служебный апдейт поллера MAX: все апдейты до него переданы
+// listener'у, Marker можно сохранить, когда они доставлены, и продолжить чтение с него
+// после рестарта. Ack listener закрывает после сохранения.
+type maxPollCheckpoint struct {
+	maxschemes.Update
+	Marker int64
+	Ack    chan struct{}
+}
+
+func (maxPollCheckpoint) GetUserID() int64 { return 0 }
+func (maxPollCheckpoint) GetChatID() int64 { return 0 }
+
+// maxInboxMark — служебный апдейт webhook-режима: следующий апдейт прочитан из записи
+// inbox ID. Listener удаляет её, когда апдейт обработан.
+type maxInboxMark struct {
+	maxschemes.Update
+	ID int64
+}
+
+func (maxInboxMark) GetUserID() int64 { return 0 }
+func (maxInboxMark) GetChatID() int64 { return 0 }
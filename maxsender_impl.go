@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+const (
+	maxAPIVersion    = "1.2.5"
+	maxDefaultAPIURL = "https://platform-api.max.ru"
+)
+
+type maxBotSender struct {
+	api        *maxbot.Api
+	token      string
+	apiURL     string
+	userID     int64
+	name       string
+	httpClient *http.Client // для загрузки файлов на CDN (большой таймаут)
+	apiClient  *http.Client // для коротких API-запросов (малый таймаут)
+	pollClient *http.Client // для long polling (таймаут больше pollTimeout)
+}
+
+// NewMaxBotSender создаёт MAX-клиент. apiURL — base URL MAX API
+// (если пусто — platform-api.max.ru), используется для тестовых стендов.
+func NewMaxBotSender(ctx context.Context, token, apiURL string) (*maxBotSender, error) {
+	var api *maxbot.Api
+	var err error
+	if apiURL != "" {
+		api, err = maxbot.NewWithConfig(maxAPIConfig{url: apiURL, token: token})
+	} else {
+		api, err = maxbot.New(token)
+		apiURL = maxDefaultAPIURL
+	}
+	if err != nil {
+		return nil, fmt.Errorf("maxbot.New: %w", err)
+	}
+	info, err := api.Bots.GetBot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("MAX getBot: %w", err)
+	}
+	slog.Info("MAX bot started", "name", info.Name)
+
+	return &maxBotSender{
+		api:        api,
+		token:      token,
+		apiURL:     strings.TrimRight(apiURL, "/"),
+		userID:     info.UserId,
+		name:       info.Name,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		apiClient:  &http.Client{Timeout: 15 * time.Second},
+		pollClient: &http.Client{Timeout: pollTimeout + 15*time.Second},
+	}, nil
+}
+
+// maxAPIConfig — минимальная реализация configservice.ConfigInterface
+// для maxbot.NewWithConfig (нужна ради кастомного base URL).
+type maxAPIConfig struct {
+	url   string
+	token string
+}
+
+func (c maxAPIConfig) GetHttpBotAPIUrl() string        { return c.url }
+func (c maxAPIConfig) GetHttpBotAPITimeOut() int       { return 0 }
+func (c maxAPIConfig) GetHttpBotAPIVersion() string    { return maxAPIVersion }
+func (c maxAPIConfig) BotTokenCheckInInputSteam() bool { return false }
+func (c maxAPIConfig) BotTokenCheckString() string     { return c.token }
+func (c maxAPIConfig) GetDebugLogMode() bool           { return false }
+func (c maxAPIConfig) GetDebugLogChat() int64          { return 0 }
+
+func (s *maxBotSender) BotUserID() int64 { return s.userID }
+func (s *maxBotSender) BotName() string  { return s.name }
+
+// --- Updates ---
+
+func (s *maxBotSender) ParseUpdate(body []byte) (maxschemes.UpdateInterface, error) {
+	parsed := make(chan maxschemes.UpdateInterface, 1)
+	return parseMaxUpdate(s.api.GetHandler(parsed), parsed, body)
+}
+
+func (s *maxBotSender) Subscribe(ctx context.Context, url string, updateTypes []string) error {
+	_, err := s.api.Subscriptions.Subscribe(ctx, url, updateTypes, "")
+	return err
+}
+
+// --- Send / Edit (напрямую, в обход SDK) ---
+
+// SendMessage отправляет сообщение через POST /messages.
+// Для video/audio/file ждёт обработки на CDN и ретраит attachment.not.ready.
+func (s *maxBotSender) SendMessage(ctx context.Context, msg *MaxMessage) (string, error) {
+	data, err := json.Marshal(msg.body())
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/messages?chat_id=%d&v=%s", s.apiURL, msg.ChatID, maxAPIVersion)
+	if msg.ChatID == 0 && msg.UserID != 0 {
+		url = fmt.Sprintf("%s/messages?user_id=%d&v=%s", s.apiURL, msg.UserID, maxAPIVersion)
+	}
+
+	// Пауза перед первой отправкой если есть вложение (MAX CDN нужно время на обработку)
+	if msg.hasUploadedMedia() {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+
+	// Retry при attachment.not.ready (файл ещё обрабатывается)
+	for attempt := 0; attempt < 20; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(3+attempt*2) * time.Second
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(delay):
+			}
+			slog.Warn("MAX retry", "attempt", attempt+1, "maxAttempts", 20)
+		}
+
+		status, respBody, header, err := s.do(ctx, http.MethodPost, url, data)
+		if err != nil {
+			return "", err
+		}
+
+		if status == 200 {
+			var result struct {
+				Message struct {
+					Body struct {
+						Mid string `json:"mid"`
+					} `json:"body"`
+				} `json:"message"`
+			}
+			if err := json.Unmarshal(respBody, &result); err != nil {
+				return "", err
+			}
+			return result.Message.Body.Mid, nil
+		}
+
+		// Проверяем attachment.not.ready — ретраим
+		if status == 400 && strings.Contains(string(respBody), "attachment.not.ready") {
+			slog.Warn("MAX attachment not ready, waiting")
+			continue
+		}
+
+		return "", newMAXError(status, respBody, header)
+	}
+	return "", fmt.Errorf("MAX attachment not ready after 20 retries")
+}
+
+// EditMessage редактирует сообщение через PUT /messages.
+func (s *maxBotSender) EditMessage(ctx context.Context, mid string, msg *MaxMessage) error {
+	data, err := json.Marshal(msg.body())
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/messages?message_id=%s&v=%s", s.apiURL, mid, maxAPIVersion)
+	status, respBody, header, err := s.do(ctx, http.MethodPut, url, data)
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return newMAXError(status, respBody, header)
+	}
+	var result maxschemes.SimpleQueryResult
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return maxRejected(result.Message)
+	}
+	return nil
+}
+
+func (s *maxBotSender) do(ctx context.Context, method, url string, data []byte) (int, []byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Authorization", s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.apiClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody, resp.Header, nil
+}
+
+// --- Other ---
+
+func (s *maxBotSender) DeleteMessage(ctx context.Context, mid string) error {
+	res, err := s.api.Messages.DeleteMessage(ctx, mid)
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return maxRejected(res.Message)
+	}
+	return nil
+}
+
+func (s *maxBotSender) AnswerCallback(ctx context.Context, callbackID string, answer *maxschemes.CallbackAnswer) error {
+	_, err := s.api.Messages.AnswerOnCallback(ctx, callbackID, answer)
+	return err
+}
+
+func (s *maxBotSender) GetChatAdmins(ctx context.Context, chatID int64) ([]maxschemes.ChatMember, error) {
+	list, err := s.api.Chats.GetChatAdmins(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return list.Members, nil
+}
+
+// --- Uploads ---
+
+func (s *maxBotSender) UploadPhotoFromURL(ctx context.Context, url string) (*maxschemes.PhotoTokens, error) {
+	return s.api.Uploads.UploadPhotoFromUrl(ctx, url)
+}
+
+func (s *maxBotSender) UploadPhotoFromReader(ctx context.Context, reader io.Reader) (*maxschemes.PhotoTokens, error) {
+	return s.api.Uploads.UploadPhotoFromReader(ctx, reader)
+}
+
+// UploadMedia — обход бага SDK: CDN возвращает XML вместо JSON
+func (s *maxBotSender) UploadMedia(ctx context.Context, uploadType maxschemes.UploadType, reader io.Reader, fileName string) (*maxschemes.UploadedInfo, error) {
+	// 1. Получаем URL и token от MAX API
+	apiURL := fmt.Sprintf("%s/uploads?type=%s&v=%s", s.apiURL, string(uploadType), maxAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", s.token)
+
+	resp, err := s.apiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get upload url: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("upload endpoint status: %d", resp.StatusCode)
+	}
+
+	endpointBody, _ := io.ReadAll(resp.Body)
+	slog.Debug("MAX upload endpoint response", "status", resp.StatusCode, "body", string(endpointBody))
+
+	var endpoint maxschemes.UploadEndpoint
+	if err := json.Unmarshal(endpointBody, &endpoint); err != nil {
+		return nil, fmt.Errorf("decode upload endpoint: %w", err)
+	}
+	slog.Debug("MAX upload endpoint", "url", endpoint.Url, "token", endpoint.Token)
+
+	// Для video/audio: token приходит сразу, но файл ВСЁ РАВНО нужно загрузить на CDN URL.
+	// Для file/image: token приходит после загрузки на CDN.
+	videoToken := endpoint.Token // сохраняем для video/audio
+
+	if endpoint.Url == "" && videoToken != "" {
+		// Нет URL для загрузки, но есть token — file/image (не video/audio)
+		slog.Debug("MAX upload ok (endpoint token, no CDN needed)")
+		return &maxschemes.UploadedInfo{Token: videoToken}, nil
+	}
+
+	if endpoint.Url == "" {
+		return nil, fmt.Errorf("upload endpoint returned empty URL and no token")
+	}
+
+	// 2. Загружаем файл на CDN (multipart)
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("data", fileName)
+	if err != nil {
+		return nil, fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := io.Copy(part, reader); err != nil {
+		return nil, fmt.Errorf("copy to form: %w", err)
+	}
+	writer.Close()
+
+	cdnReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("create CDN request: %w", err)
+	}
+	cdnReq.Header.Set("Content-Type", writer.FormDataContentType())
+
+	cdnResp, err := s.httpClient.Do(cdnReq)
+	if err != nil {
+		return nil, fmt.Errorf("upload to CDN: %w", err)
+	}
+	defer cdnResp.Body.Close()
+
+	cdnBody, _ := io.ReadAll(cdnResp.Body)
+	slog.Debug("MAX CDN response", "status", cdnResp.StatusCode, "body", string(cdnBody))
+
+	// Проверяем ошибку запрещённого расширения
+	var apiErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(cdnBody, &apiErr) == nil && apiErr.Code == "upload.error" {
+		slog.Warn("MAX upload rejected", "code", apiErr.Code, "message", apiErr.Message, "file", fileName)
+		return nil, &ErrForbiddenExtension{Name: fileName}
+	}
+
+	// 3. Для video/audio: используем token из шага 1 (CDN возвращает только retval)
+	if videoToken != "" {
+		slog.Debug("MAX upload ok (video/audio token from endpoint)", "token", videoToken)
+		return &maxschemes.UploadedInfo{Token: videoToken}, nil
+	}
+
+	// Для file/image: парсим CDN ответ (fileId + token в camelCase)
+	var cdnResult struct {
+		FileID int64  `json:"fileId"`
+		Token  string `json:"token"`
+	}
+	if err := json.Unmarshal(cdnBody, &cdnResult); err == nil && cdnResult.Token != "" {
+		slog.Debug("MAX upload ok", "fileId", cdnResult.FileID)
+		return &maxschemes.UploadedInfo{Token: cdnResult.Token, FileID: cdnResult.FileID}, nil
+	}
+	return nil, fmt.Errorf("no token in CDN response: %s", string(cdnBody))
+}
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
 
@@ -17,7 +16,7 @@ const mediaGroupTimeout = 1 * time.Second
 type mediaGroupItem struct {
 	photoSizes  []PhotoSize
 	videoFileID string // для видео в альбомах
-	caption     string
+	caption     string // кросспостинг — готовый текст, bridge — caption сообщения без атрибуции
 	replyToMsg  *TGMessage
 	entities    []Entity
 	msg         *TGMessage
@@ -25,107 +24,198 @@ type mediaGroupItem struct {
 	crosspost   bool  // кросспостинг: без prefix, другой caption формат
 }
 
+// newMediaGroupItem собирает элемент альбома из TG-сообщения.
+func newMediaGroupItem(msg *TGMessage, caption string) mediaGroupItem {
+	videoID := ""
+	if msg.Video != nil {
+		videoID = msg.Video.FileID
+	}
+	return mediaGroupItem{
+		photoSizes:  msg.Photo,
+		videoFileID: videoID,
+		caption:     caption,
+		replyToMsg:  msg.ReplyToMessage,
+		entities:    msg.CaptionEntities,
+		msg:         msg,
+	}
+}
+
 // mediaGroupBuffer накапливает сообщения альбома перед отправкой.
+// items дополняются под Bridge.mgMu; после закрытия ready буфер больше не меняется.
+// sent завершается, когда альбом доставлен (или поставлен в очередь) всем получателям.
 type mediaGroupBuffer struct {
-	mu    sync.Mutex
 	items []mediaGroupItem
 	timer *time.Timer
+	ready chan struct{}
+	sent  sync.WaitGroup
 }
 
 // bufferMediaGroup добавляет сообщение в буфер альбома.
-// Если это первое сообщение — запускает таймер.
+// Первое сообщение запускает таймер и занимает место альбома в очереди доставки
+// каждого получателя — сообщения, пришедшие после альбома, его не обгонят. Остальные
+// части учитываются в текущем апдейте listener'а до отправки альбома.
 func (b *Bridge) bufferMediaGroup(ctx context.Context, groupID string, item mediaGroupItem) {
 	b.mgMu.Lock()
-
-	buf, ok := b.mgBuffers[groupID]
-	if !ok {
-		buf = &mediaGroupBuffer{}
-		b.mgBuffers[groupID] = buf
-		// Добавляем первый item до запуска таймера — исключает гонку
+	if buf, ok := b.mgBuffers[groupID]; ok {
 		buf.items = append(buf.items, item)
-		buf.timer = time.AfterFunc(mediaGroupTimeout, func() {
-			b.flushMediaGroup(ctx, groupID)
-		})
 		b.mgMu.Unlock()
+		// Апдейт этой части обработан, когда отправлен весь альбом
+		if u := b.tgBatch.cur; u != nil {
+			u.wg.Add(1)
+			go func() {
+				defer u.wg.Done()
+				buf.sent.Wait()
+			}()
+		}
 		return
 	}
-
+	buf := &mediaGroupBuffer{items: []mediaGroupItem{item}, ready: make(chan struct{})}
+	b.mgBuffers[groupID] = buf
+	buf.timer = time.AfterFunc(mediaGroupTimeout, func() {
+		b.closeMediaGroup(groupID)
+	})
 	b.mgMu.Unlock()
 
-	buf.mu.Lock()
-	buf.items = append(buf.items, item)
-	buf.mu.Unlock()
+	targets := b.mediaGroupTargets(item)
+	buf.sent.Add(len(targets))
+	for _, maxChatID := range targets {
+		b.deliverToMax(maxChatID, func() {
+			defer buf.sent.Done()
+			select {
+			case <-buf.ready:
+			case <-ctx.Done():
+				return
+			}
+			if b.alreadyForwardedTg(buf.items[0].msg, maxChatID) {
+				return
+			}
+			if b.repo.QueuedTo("tg2max", maxChatID) {
+				b.enqueueTg2Max(buf.items[0].msg.Chat.ID, maxChatID, mediaGroupPayload(buf.items), nil)
+				return
+			}
+			if err := b.sendMediaGroupToMax(ctx, buf.items, maxChatID); err != nil && !isUndeliverable(err) {
+				b.queueTg2Max(ctx, buf.items[0].msg.Chat.ID, maxChatID, mediaGroupPayload(buf.items), err)
+			}
+		})
+	}
 }
 
-// flushMediaGroup отправляет все накопленные фото/видео альбома одним сообщением в MAX.
-func (b *Bridge) flushMediaGroup(ctx context.Context, groupID string) {
+// closeMediaGroup завершает сбор альбома: ожидающие задачи доставки отправляют его.
+func (b *Bridge) closeMediaGroup(groupID string) {
 	b.mgMu.Lock()
 	buf, ok := b.mgBuffers[groupID]
-	if !ok {
-		b.mgMu.Unlock()
-		return
+	if ok {
+		delete(b.mgBuffers, groupID)
 	}
-	delete(b.mgBuffers, groupID)
 	b.mgMu.Unlock()
+	if ok {
+		close(buf.ready)
+	}
+}
 
-	buf.mu.Lock()
-	buf.timer.Stop()
-	items := buf.items
-	buf.mu.Unlock()
-
-	if len(items) == 0 {
-		return
+// flushMediaGroups завершает сбор всех альбомов, не дожидаясь таймера: перед сохранением
+// позиции поллинга они должны быть отправлены. Части альбома из следующей пачки апдейтов
+// уйдут отдельным альбомом.
+func (b *Bridge) flushMediaGroups() {
+	b.mgMu.Lock()
+	var ids []string
+	for id, buf := range b.mgBuffers {
+		buf.timer.Stop()
+		ids = append(ids, id)
 	}
+	b.mgMu.Unlock()
+	for _, id := range ids {
+		b.closeMediaGroup(id)
+	}
+}
 
-	// Определяем maxChatID
-	isCrosspost := items[0].crosspost
-	maxChatID := items[0].maxChatID
-	if maxChatID == 0 {
-		var linked bool
-		maxChatID, linked = b.repo.GetMaxChat(items[0].msg.Chat.ID)
-		if !linked {
-			slog.Warn("media group: chat not linked", "tgChat", items[0].msg.Chat.ID)
-			return
+// mediaGroupTargets определяет получателей альбома: crosspost — один MAX-чат, bridge — все связанные.
+func (b *Bridge) mediaGroupTargets(item mediaGroupItem) []int64 {
+	if item.maxChatID != 0 {
+		return []int64{item.maxChatID}
+	}
+	var targets []int64
+	for _, maxChatID := range b.repo.GetMaxChats(item.msg.Chat.ID, tgTopicID(item.msg)) {
+		if b.pairAllows(item.msg.Chat.ID, maxChatID, "tg>max") {
+			targets = append(targets, maxChatID)
 		}
 	}
+	if len(targets) == 0 {
+		slog.Warn("media group: chat not linked", "tgChat", item.msg.Chat.ID)
+	}
+	return targets
+}
 
+// albumErr — ошибка альбома, который не отправлен ни в каком виде: постоянная
+// (нет доступа к чату) не ретраится, остальные ставят альбом в очередь целиком.
+func albumErr(err error) error {
+	if errKind(err) == ErrPermanent {
+		return undeliverable(err)
+	}
+	return err
+}
+
+// mediaGroupPayload — альбом целиком для очереди: при ретрае он собирается заново по file_id.
+func mediaGroupPayload(items []mediaGroupItem) tg2maxPayload {
+	p := tg2maxPayload{Album: true, Crosspost: items[0].crosspost}
+	for _, it := range items {
+		p.Messages = append(p.Messages, tgQueuedMsg{Msg: it.msg, Caption: it.caption})
+	}
+	return p
+}
+
+// sendMediaGroupToMax отправляет альбом в один MAX-чат и сохраняет маппинг для этой копии.
+// Возвращает ошибку, если альбом не доставлен и его стоит повторить целиком.
+func (b *Bridge) sendMediaGroupToMax(ctx context.Context, items []mediaGroupItem, maxChatID int64) error {
+	isCrosspost := items[0].crosspost
 	uid := tgUserID(items[0].msg)
-	prefix := !isCrosspost && b.repo.HasPrefix("tg", items[0].msg.Chat.ID)
 
 	// Caption и entities берём из первого элемента, у которого caption не пустой
 	var caption string
 	var entities []Entity
+	var captionMsg *TGMessage
 	for _, it := range items {
 		if it.caption != "" {
 			caption = it.caption
 			entities = it.entities
+			captionMsg = it.msg
 			break
 		}
 	}
+	// Без подписи у bridge остаётся атрибуция — имя автора первого элемента
+	if captionMsg == nil && !isCrosspost {
+		captionMsg = items[0].msg
+	}
 
 	// Reply ID из первого элемента с reply
 	var replyTo string
 	for _, it := range items {
 		if it.replyToMsg != nil {
-			if maxReplyID, ok := b.repo.LookupMaxMsgID(it.msg.Chat.ID, it.replyToMsg.MessageID); ok {
+			if maxReplyID, ok := b.repo.LookupMaxMsgID(it.msg.Chat.ID, it.replyToMsg.MessageID, maxChatID); ok {
 				replyTo = maxReplyID
 			}
 			break
 		}
 	}
 
-	// Форматируем caption
+	// Форматируем caption: у кросспостинга это сам текст, у bridge — атрибуция связки
+	// поверх сконвертированного текста (entities считаются от сырого caption)
 	mdCaption := caption
-	if entities != nil {
+	formatted := false
+	if captionMsg != nil && !isCrosspost {
+		mdText := tgEntitiesToMarkdown(captionMsg.Caption, entities)
+		mdCaption, formatted = b.attribute(tgAttribution(captionMsg, mdText), captionMsg.Chat.ID, maxChatID, mdText != captionMsg.Caption)
+	} else if entities != nil {
 		mdCaption = tgEntitiesToMarkdown(caption, entities)
+		formatted = mdCaption != caption
 	}
 
-	m := maxbot.NewMessage().SetChat(maxChatID).SetText(mdCaption)
-	if mdCaption != caption {
-		m.SetFormat("markdown")
+	m := &MaxMessage{ChatID: maxChatID, Text: mdCaption}
+	if formatted {
+		m.Format = "markdown"
 	}
 	if replyTo != "" {
-		m.SetReply(mdCaption, replyTo)
+		m.ReplyTo = replyTo
 	}
 
 	// Загружаем и добавляем все фото
@@ -147,7 +237,7 @@ func (b *Bridge) flushMediaGroup(ctx context.Context, groupID string) {
 				}
 				m.AddPhoto(uploaded)
 			} else {
-				uploaded, err := b.maxApi.Uploads.UploadPhotoFromUrl(ctx, fileURL)
+				uploaded, err := b.max.UploadPhotoFromURL(ctx, fileURL)
 				if err != nil {
 					slog.Error("media group: photo upload failed", "err", err)
 					continue
@@ -158,17 +248,20 @@ func (b *Bridge) flushMediaGroup(ctx context.Context, groupID string) {
 		}
 	}
 
-	// Загружаем видео из альбома через direct API
+	// Загружаем видео из альбома через direct API. Пока ничего не отправлено, поэтому
+	// при ошибке альбом повторяется целиком
 	videosSent := 0
 	var videoTokens []string
+	var videoItems []mediaGroupItem
 	for _, it := range items {
 		if it.videoFileID != "" {
 			uploaded, err := b.uploadTgMediaToMax(ctx, it.videoFileID, maxschemes.VIDEO, "video.mp4")
 			if err != nil {
-				slog.Error("media group: video upload failed", "err", err)
-				continue
+				slog.Error("media group: video upload failed", "err", err, "kind", errKind(err))
+				return albumErr(err)
 			}
 			videoTokens = append(videoTokens, uploaded.Token)
+			videoItems = append(videoItems, it)
 			videosSent++
 		}
 	}
@@ -176,50 +269,64 @@ func (b *Bridge) flushMediaGroup(ctx context.Context, groupID string) {
 	totalMedia := photosSent + videosSent
 	if totalMedia == 0 {
 		slog.Warn("media group: no media uploaded, skipping")
-		return
+		return nil
 	}
 
 	slog.Info("TG→MAX sending media group", "photos", photosSent, "videos", videosSent, "uid", uid, "tgChat", items[0].msg.Chat.ID, "maxChat", maxChatID)
 
 	// Если есть фото — отправляем через SDK (поддерживает AddPhoto)
 	if photosSent > 0 {
-		result, err := b.maxApi.Messages.SendWithResult(ctx, m)
+		mid, err := b.max.SendMessage(ctx, m)
 		if err != nil {
-			slog.Error("TG→MAX media group send failed", "err", err)
-			if b.cbFail(maxChatID) {
+			slog.Error("TG→MAX media group send failed", "err", err, "kind", errKind(err))
+			// Временная ошибка — альбом уйдёт в очередь целиком
+			if k := errKind(err); k == ErrTransient || k == ErrRateLimited {
+				return err
+			}
+			if b.cbFail(maxChatID, err) {
 				b.tg.SendMessage(ctx, items[0].msg.Chat.ID,
 					fmt.Sprintf("Не удалось переслать альбом в MAX. Пересылка приостановлена на %d мин. Проверьте, что бот добавлен в MAX-чат и является админом.", int(cbCooldown.Minutes())), nil)
 			}
-			// Fallback — по одному
+			// Fallback — по одному (мы уже в воркере чата, порядок сохраняется)
 			for _, it := range items {
 				var cap string
 				if isCrosspost {
 					cap = formatTgCrosspostCaption(it.msg)
 				} else {
-					cap = formatTgCaption(it.msg, prefix, b.cfg.MessageNewline)
+					cap = b.tgCaption(it.msg, maxChatID)
 				}
-				go b.forwardTgToMax(ctx, it.msg, maxChatID, cap)
+				b.forwardTgToMax(ctx, it.msg, maxChatID, cap)
 			}
-			return
+			return nil
 		}
 		b.cbSuccess(maxChatID)
-		slog.Info("TG→MAX media group sent", "mid", result.Body.Mid, "photos", photosSent)
-		b.repo.SaveMsg(items[0].msg.Chat.ID, items[0].msg.MessageID, maxChatID, result.Body.Mid)
+		slog.Info("TG→MAX media group sent", "mid", mid, "photos", photosSent)
+		b.repo.SaveMsg(items[0].msg.Chat.ID, items[0].msg.MessageID, maxChatID, mid)
+		b.metricForward("tg2max", "album", items[0].msg.Chat.ID, maxChatID)
 	}
 
 	// Видео отправляем отдельно через direct API (SDK не поддерживает AddVideo)
 	for i, token := range videoTokens {
-		videoCaption := ""
+		videoCaption, videoFormat := "", ""
 		if i == 0 && photosSent == 0 {
-			videoCaption = mdCaption // caption на первое видео если нет фото
+			videoCaption, videoFormat = mdCaption, m.Format // caption на первое видео если нет фото
 		}
-		mid, err := b.sendMaxDirectFormatted(ctx, maxChatID, videoCaption, "video", token, "", "")
+		mid, err := b.sendMaxDirectFormatted(ctx, maxChatID, videoCaption, "video", token, "", videoFormat)
 		if err != nil {
-			slog.Error("TG→MAX media group video send failed", "err", err)
+			slog.Error("TG→MAX media group video send failed", "err", err, "kind", errKind(err))
+			if i == 0 && photosSent == 0 {
+				return albumErr(err)
+			}
+			// Часть альбома уже в MAX — повторяется только это видео
+			if errKind(err) != ErrPermanent {
+				b.enqueueTg2Max(items[0].msg.Chat.ID, maxChatID, tg2maxPayload{Messages: []tgQueuedMsg{{Msg: videoItems[i].msg}}, Crosspost: isCrosspost}, err)
+			}
 			continue
 		}
 		if i == 0 && photosSent == 0 {
 			b.repo.SaveMsg(items[0].msg.Chat.ID, items[0].msg.MessageID, maxChatID, mid)
+			b.metricForward("tg2max", "album", items[0].msg.Chat.ID, maxChatID)
 		}
 	}
+	return nil
 }
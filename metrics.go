@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики трафика. Счётчики общие на процесс, арендатор — в метке tenant (пустая у
+// арендатора по умолчанию); состояние очереди и circuit breaker'ов снимается в момент
+// scrape (bridgeCollector, по одному на мост).
+var (
+	metricForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bridge_messages_forwarded_total",
+		Help: "Доставленные сообщения по направлению, типу и связке.",
+	}, []string{"tenant", "direction", "type", "tg_chat", "max_chat"})
+
+	metricSendFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bridge_send_failures_total",
+		Help: "Ошибки вызовов TG/MAX API по категории ошибки.",
+	}, []string{"tenant", "api", "kind"})
+
+	metricMediaBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bridge_media_bytes_total",
+		Help: "Переданные байты медиа по направлению.",
+	}, []string{"tenant", "direction"})
+
+	metricUploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bridge_upload_duration_seconds",
+		Help:    "Длительность перекачки медиа (скачивание + загрузка).",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"tenant", "op", "status"})
+)
+
+// metricForward учитывает доставленное сообщение.
+func (b *Bridge) metricForward(direction, msgType string, tgChatID, maxChatID int64) {
+	metricForwarded.WithLabelValues(b.cfg.TenantID, direction, msgType,
+		strconv.FormatInt(tgChatID, 10), strconv.FormatInt(maxChatID, 10)).Inc()
+}
+
+// metricSendFailure учитывает ошибку вызова API ("tg" / "max") арендатора tenant.
+func metricSendFailure(tenant, api string, err error) {
+	metricSendFailures.WithLabelValues(tenant, api, errKind(err).String()).Inc()
+}
+
+// observeUpload записывает длительность перекачки медиа, начатой в start.
+func (b *Bridge) observeUpload(op string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	metricUploadDuration.WithLabelValues(b.cfg.TenantID, op, status).Observe(time.Since(start).Seconds())
+}
+
+// countingReader считает прочитанные байты медиа (для потоковой загрузки TG→MAX).
+type countingReader struct {
+	r         io.Reader
+	tenant    string
+	direction string
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		metricMediaBytes.WithLabelValues(c.tenant, c.direction).Add(float64(n))
+	}
+	return n, err
+}
+
+// bridgeCollector отдаёт состояние моста на момент scrape: глубину и возраст очереди,
+// число dead letters и открытых circuit breaker'ов.
+type bridgeCollector struct {
+	b *Bridge
+
+	queueDepth   *prometheus.Desc
+	queueAge     *prometheus.Desc
+	deadLetters  *prometheus.Desc
+	breakersOpen *prometheus.Desc
+}
+
+func newBridgeCollector(b *Bridge) *bridgeCollector {
+	tenant := prometheus.Labels{"tenant": b.cfg.TenantID}
+	return &bridgeCollector{
+		b:            b,
+		queueDepth:   prometheus.NewDesc("bridge_queue_depth", "Сообщения в retry-очереди.", []string{"direction"}, tenant),
+		queueAge:     prometheus.NewDesc("bridge_queue_oldest_age_seconds", "Возраст самого старого сообщения в очереди.", []string{"direction"}, tenant),
+		deadLetters:  prometheus.NewDesc("bridge_dead_letters", "Недоставленные сообщения в dead_letters.", []string{"direction"}, tenant),
+		breakersOpen: prometheus.NewDesc("bridge_circuit_breakers_open", "Чаты, заблокированные circuit breaker'ом.", nil, tenant),
+	}
+}
+
+func (c *bridgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueDepth
+	ch <- c.queueAge
+	ch <- c.deadLetters
+	ch <- c.breakersOpen
+}
+
+func (c *bridgeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.b.repo.QueueStats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.queueDepth, err)
+	} else {
+		now := time.Now()
+		for _, dir := range []string{"tg2max", "max2tg"} {
+			s := stats[dir]
+			var age float64
+			if s.Pending > 0 {
+				age = now.Sub(time.Unix(s.OldestCreatedAt, 0)).Seconds()
+			}
+			ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(s.Pending), dir)
+			ch <- prometheus.MustNewConstMetric(c.queueAge, prometheus.GaugeValue, age, dir)
+			ch <- prometheus.MustNewConstMetric(c.deadLetters, prometheus.GaugeValue, float64(s.DeadLetters), dir)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.breakersOpen, prometheus.GaugeValue, float64(c.b.cbOpenCount()))
+}
+
+// metricsHandler возвращает обработчик /metrics: метрики всех мостов процесса
+// плюс рантайм Go и процесса.
+func (bs bridgeSet) metricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		metricForwarded, metricSendFailures, metricMediaBytes, metricUploadDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	for _, b := range bs {
+		reg.MustRegister(newBridgeCollector(b))
+	}
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// tgMsgType — тип TG-сообщения для метрик.
+func tgMsgType(msg *TGMessage) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return "photo"
+	case msg.Animation != nil:
+		return "animation"
+	case msg.Video != nil:
+		return "video"
+	case msg.VideoNote != nil:
+		return "video_note"
+	case msg.Sticker != nil:
+		return "sticker"
+	case msg.Voice != nil:
+		return "voice"
+	case msg.Audio != nil:
+		return "audio"
+	case msg.Document != nil:
+		return "document"
+	case msg.Poll != nil:
+		return "poll"
+	case msg.Location != nil:
+		return "location"
+	case msg.Contact != nil:
+		return "contact"
+	}
+	return "text"
+}
+
+// maxMsgType — тип MAX-сообщения для метрик (по первому вложению).
+func maxMsgType(attachments []interface{}) string {
+	if len(attachments) == 0 {
+		return "text"
+	}
+	switch attachments[0].(type) {
+	case *maxschemes.PhotoAttachment:
+		return "photo"
+	case *maxschemes.VideoAttachment:
+		return "video"
+	case *maxschemes.AudioAttachment:
+		return "audio"
+	case *maxschemes.FileAttachment:
+		return "document"
+	case *maxschemes.StickerAttachment:
+		return "sticker"
+	case *maxschemes.LocationAttachment:
+		return "location"
+	case *maxschemes.ContactAttachment:
+		return "contact"
+	}
+	return "other"
+}
+
+// legacyQueueMsgType — тип элемента очереди старого формата.
+func legacyQueueMsgType(item QueueItem) string {
+	if item.AttType == "" {
+		return "text"
+	}
+	return item.AttType
+}
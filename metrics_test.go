@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrapeMetrics(t *testing.T, b *Bridge) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	bridgeSet{b}.metricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetrics_BridgeState(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	created := time.Now().Add(-time.Minute).Unix()
+	b.repo.EnqueueSend(&QueueItem{Direction: "tg2max", SrcChatID: -100, DstChatID: 200, CreatedAt: created, NextRetry: time.Now().Add(time.Hour).Unix()})
+	b.repo.EnqueueSend(&QueueItem{Direction: "max2tg", SrcChatID: 200, DstChatID: -100, CreatedAt: created})
+	items, _ := b.repo.PeekQueue(10)
+	b.repo.MoveToDeadLetters(items[0].ID, "permanent", "boom")
+	for i := 0; i < cbMaxFails; i++ {
+		b.cbFail(-100, errors.New("connection reset"))
+	}
+
+	body := scrapeMetrics(t, b)
+	for _, want := range []string{
+		`bridge_queue_depth{direction="tg2max",tenant=""} 1`,
+		`bridge_queue_depth{direction="max2tg",tenant=""} 0`,
+		`bridge_dead_letters{direction="max2tg",tenant=""} 1`,
+		`bridge_circuit_breakers_open{tenant=""} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if !strings.Contains(body, `bridge_queue_oldest_age_seconds{direction="tg2max",tenant=""} 6`) {
+		t.Errorf("oldest age not ~60s:\n%s", grepLines(body, "bridge_queue_oldest_age_seconds"))
+	}
+}
+
+func TestMetrics_ForwardAndFailures(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -501, 502)
+	fwd := metricForwarded.WithLabelValues("", "tg2max", "text", "-501", "502")
+	fails := metricSendFailures.WithLabelValues("", "max", "transient")
+	fwdBefore, failsBefore := testutil.ToFloat64(fwd), testutil.ToFloat64(fails)
+
+	msg := &TGMessage{MessageID: 1, Chat: ChatInfo{ID: -501, Type: "group"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: "привет"}
+	b.forwardTgToMax(context.Background(), msg, 502, formatTgCaption(msg, false, false))
+	mx.SendErr = errors.New("connection reset")
+	msg.MessageID = 2
+	b.forwardTgToMax(context.Background(), msg, 502, formatTgCaption(msg, false, false))
+
+	if got := testutil.ToFloat64(fwd) - fwdBefore; got != 1 {
+		t.Errorf("forwarded delta = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(fails) - failsBefore; got != 1 {
+		t.Errorf("send failures delta = %v, want 1", got)
+	}
+	if body := scrapeMetrics(t, b); !strings.Contains(body, `bridge_messages_forwarded_total{direction="tg2max",max_chat="502",tenant="",tg_chat="-501",type="text"}`) {
+		t.Errorf("forwarded series not exposed:\n%s", grepLines(body, "bridge_messages_forwarded_total"))
+	}
+}
+
+func grepLines(body, prefix string) string {
+	var out []string
+	for _, l := range strings.Split(body, "\n") {
+		if strings.HasPrefix(l, prefix) {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
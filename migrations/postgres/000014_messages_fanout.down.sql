@@ -0,0 +1,4 @@
+DELETE FROM messages a USING messages b
+ WHERE a.tg_chat_id = b.tg_chat_id AND a.tg_msg_id = b.tg_msg_id AND a.max_chat_id > b.max_chat_id;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_pkey;
+ALTER TABLE messages ADD PRIMARY KEY (tg_chat_id, tg_msg_id);
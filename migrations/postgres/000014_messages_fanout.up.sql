@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_pkey;
+ALTER TABLE messages ADD PRIMARY KEY (tg_chat_id, tg_msg_id, max_chat_id);
@@ -0,0 +1,2 @@
+ALTER TABLE pending DROP COLUMN IF EXISTS tg_thread_id;
+DROP TABLE IF EXISTS topic_pairs;
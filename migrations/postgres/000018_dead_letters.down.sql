@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS dead_letters;
+ALTER TABLE send_queue DROP COLUMN IF EXISTS history;
+ALTER TABLE send_queue DROP COLUMN IF EXISTS last_error;
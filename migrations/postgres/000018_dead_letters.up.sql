@@ -0,0 +1,24 @@
+ALTER TABLE send_queue ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE send_queue ADD COLUMN history TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id SERIAL PRIMARY KEY,
+    direction TEXT NOT NULL,
+    src_chat_id BIGINT NOT NULL,
+    dst_chat_id BIGINT NOT NULL,
+    src_msg_id TEXT NOT NULL DEFAULT '',
+    text TEXT NOT NULL DEFAULT '',
+    att_type TEXT NOT NULL DEFAULT '',
+    att_token TEXT NOT NULL DEFAULT '',
+    reply_to TEXT NOT NULL DEFAULT '',
+    format TEXT NOT NULL DEFAULT '',
+    att_url TEXT NOT NULL DEFAULT '',
+    parse_mode TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    history TEXT NOT NULL DEFAULT '',
+    dead_at BIGINT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS poll_state (
+    platform   TEXT PRIMARY KEY,
+    position   BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS update_inbox (
+    id         BIGSERIAL PRIMARY KEY,
+    platform   TEXT NOT NULL,
+    body       TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(platform, id);
@@ -0,0 +1,62 @@
+-- Данные остальных арендаторов при откате теряются: остаётся только арендатор по умолчанию.
+
+DELETE FROM pairs WHERE tenant_id <> '';
+ALTER TABLE pairs DROP CONSTRAINT IF EXISTS pairs_pkey;
+ALTER TABLE pairs ADD PRIMARY KEY (tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_pairs_tg;
+DROP INDEX IF EXISTS idx_pairs_max;
+ALTER TABLE pairs DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_pairs_tg ON pairs(tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_pairs_max ON pairs(max_chat_id);
+
+DELETE FROM topic_pairs WHERE tenant_id <> '';
+ALTER TABLE topic_pairs DROP CONSTRAINT IF EXISTS topic_pairs_pkey;
+ALTER TABLE topic_pairs ADD PRIMARY KEY (tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_topic_pairs_tg;
+DROP INDEX IF EXISTS idx_topic_pairs_max;
+ALTER TABLE topic_pairs DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_tg ON topic_pairs(tg_chat_id, tg_thread_id);
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_max ON topic_pairs(max_chat_id);
+
+DELETE FROM crossposts WHERE tenant_id <> '';
+ALTER TABLE crossposts DROP CONSTRAINT IF EXISTS crossposts_pkey;
+ALTER TABLE crossposts ADD PRIMARY KEY (tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_crossposts_tg;
+DROP INDEX IF EXISTS idx_crossposts_max;
+ALTER TABLE crossposts DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_crossposts_tg ON crossposts(tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_crossposts_max ON crossposts(max_chat_id);
+
+DELETE FROM messages WHERE tenant_id <> '';
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_pkey;
+ALTER TABLE messages ADD PRIMARY KEY (tg_chat_id, tg_msg_id, max_chat_id);
+DROP INDEX IF EXISTS idx_messages_max;
+ALTER TABLE messages DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_messages_max ON messages(max_msg_id);
+
+DELETE FROM users WHERE tenant_id <> '';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users ADD PRIMARY KEY (user_id);
+ALTER TABLE users DROP COLUMN tenant_id;
+
+DELETE FROM poll_state WHERE tenant_id <> '';
+ALTER TABLE poll_state DROP CONSTRAINT IF EXISTS poll_state_pkey;
+ALTER TABLE poll_state ADD PRIMARY KEY (platform);
+ALTER TABLE poll_state DROP COLUMN tenant_id;
+
+DELETE FROM processed_updates WHERE tenant_id <> '';
+ALTER TABLE processed_updates DROP CONSTRAINT IF EXISTS processed_updates_pkey;
+ALTER TABLE processed_updates ADD PRIMARY KEY (platform, chat_id, msg_id, kind);
+ALTER TABLE processed_updates DROP COLUMN tenant_id;
+
+DELETE FROM pending WHERE tenant_id <> '';
+DELETE FROM send_queue WHERE tenant_id <> '';
+DELETE FROM dead_letters WHERE tenant_id <> '';
+DELETE FROM update_inbox WHERE tenant_id <> '';
+DROP INDEX IF EXISTS idx_send_queue_tenant;
+DROP INDEX IF EXISTS idx_update_inbox_platform;
+ALTER TABLE pending DROP COLUMN tenant_id;
+ALTER TABLE send_queue DROP COLUMN tenant_id;
+ALTER TABLE dead_letters DROP COLUMN tenant_id;
+ALTER TABLE update_inbox DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(platform, id);
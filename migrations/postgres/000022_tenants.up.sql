@@ -0,0 +1,51 @@
+-- Арендатор (пара ботов TG/MAX) — часть ключа всех данных; '' — арендатор по умолчанию.
+
+ALTER TABLE pairs ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE pairs DROP CONSTRAINT IF EXISTS pairs_pkey;
+ALTER TABLE pairs ADD PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_pairs_tg;
+DROP INDEX IF EXISTS idx_pairs_max;
+CREATE INDEX IF NOT EXISTS idx_pairs_tg ON pairs(tenant_id, tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_pairs_max ON pairs(tenant_id, max_chat_id);
+
+ALTER TABLE topic_pairs ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE topic_pairs DROP CONSTRAINT IF EXISTS topic_pairs_pkey;
+ALTER TABLE topic_pairs ADD PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_topic_pairs_tg;
+DROP INDEX IF EXISTS idx_topic_pairs_max;
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_tg ON topic_pairs(tenant_id, tg_chat_id, tg_thread_id);
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_max ON topic_pairs(tenant_id, max_chat_id);
+
+ALTER TABLE crossposts ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE crossposts DROP CONSTRAINT IF EXISTS crossposts_pkey;
+ALTER TABLE crossposts ADD PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id);
+DROP INDEX IF EXISTS idx_crossposts_tg;
+DROP INDEX IF EXISTS idx_crossposts_max;
+CREATE INDEX IF NOT EXISTS idx_crossposts_tg ON crossposts(tenant_id, tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_crossposts_max ON crossposts(tenant_id, max_chat_id);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_pkey;
+ALTER TABLE messages ADD PRIMARY KEY (tenant_id, tg_chat_id, tg_msg_id, max_chat_id);
+DROP INDEX IF EXISTS idx_messages_max;
+CREATE INDEX IF NOT EXISTS idx_messages_max ON messages(tenant_id, max_msg_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users ADD PRIMARY KEY (tenant_id, user_id);
+
+ALTER TABLE poll_state ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE poll_state DROP CONSTRAINT IF EXISTS poll_state_pkey;
+ALTER TABLE poll_state ADD PRIMARY KEY (tenant_id, platform);
+
+ALTER TABLE processed_updates ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_updates DROP CONSTRAINT IF EXISTS processed_updates_pkey;
+ALTER TABLE processed_updates ADD PRIMARY KEY (tenant_id, platform, chat_id, msg_id, kind);
+
+ALTER TABLE pending ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE send_queue ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE update_inbox ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_send_queue_tenant ON send_queue(tenant_id, id);
+DROP INDEX IF EXISTS idx_update_inbox_platform;
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(tenant_id, platform, id);
@@ -0,0 +1,10 @@
+-- Сообщения, отправленные мостом: по ним входящие апдейты распознаются как свои.
+CREATE TABLE IF NOT EXISTS sent_messages (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    platform   TEXT NOT NULL,
+    chat_id    BIGINT NOT NULL,
+    msg_id     TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (platform, chat_id, msg_id)
+);
+CREATE INDEX IF NOT EXISTS idx_sent_messages_created_at ON sent_messages(tenant_id, created_at);
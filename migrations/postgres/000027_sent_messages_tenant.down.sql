@@ -0,0 +1,5 @@
+-- Записи остальных арендаторов при откате теряются: остаётся только арендатор по умолчанию.
+
+DELETE FROM sent_messages WHERE tenant_id <> '';
+ALTER TABLE sent_messages DROP CONSTRAINT IF EXISTS sent_messages_pkey;
+ALTER TABLE sent_messages ADD PRIMARY KEY (platform, chat_id, msg_id);
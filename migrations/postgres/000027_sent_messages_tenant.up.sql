@@ -0,0 +1,4 @@
+-- Арендатор — часть ключа sent_messages, как у остальных таблиц.
+
+ALTER TABLE sent_messages DROP CONSTRAINT IF EXISTS sent_messages_pkey;
+ALTER TABLE sent_messages ADD PRIMARY KEY (tenant_id, platform, chat_id, msg_id);
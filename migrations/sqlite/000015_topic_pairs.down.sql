@@ -0,0 +1,2 @@
+ALTER TABLE pending DROP COLUMN tg_thread_id;
+DROP TABLE IF EXISTS topic_pairs;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS topic_pairs (
+    tg_chat_id   INTEGER NOT NULL,
+    tg_thread_id INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    prefix       INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (tg_chat_id, max_chat_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_tg ON topic_pairs(tg_chat_id, tg_thread_id);
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_max ON topic_pairs(max_chat_id);
+
+ALTER TABLE pending ADD COLUMN tg_thread_id INTEGER NOT NULL DEFAULT 0;
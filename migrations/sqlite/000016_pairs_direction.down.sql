@@ -0,0 +1,2 @@
+ALTER TABLE topic_pairs DROP COLUMN direction;
+ALTER TABLE pairs DROP COLUMN direction;
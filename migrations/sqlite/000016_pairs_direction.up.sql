@@ -0,0 +1,2 @@
+ALTER TABLE pairs ADD COLUMN direction TEXT NOT NULL DEFAULT 'both';
+ALTER TABLE topic_pairs ADD COLUMN direction TEXT NOT NULL DEFAULT 'both';
@@ -0,0 +1 @@
+ALTER TABLE send_queue DROP COLUMN payload;
@@ -0,0 +1 @@
+ALTER TABLE send_queue ADD COLUMN payload TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS poll_state (
+    platform   TEXT PRIMARY KEY,
+    position   INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
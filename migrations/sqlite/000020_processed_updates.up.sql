@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS processed_updates (
+    platform   TEXT NOT NULL,
+    chat_id    INTEGER NOT NULL,
+    msg_id     TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (platform, chat_id, msg_id, kind)
+);
+CREATE INDEX IF NOT EXISTS idx_processed_updates_created_at ON processed_updates(created_at);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS update_inbox (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    platform   TEXT NOT NULL,
+    body       TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(platform, id);
@@ -0,0 +1,114 @@
+-- Данные остальных арендаторов при откате теряются: остаётся только арендатор по умолчанию.
+
+CREATE TABLE pairs_old (
+    tg_chat_id   INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    prefix       INTEGER NOT NULL DEFAULT 1,
+    tg_thread_id INTEGER NOT NULL DEFAULT 0,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    PRIMARY KEY (tg_chat_id, max_chat_id)
+);
+INSERT INTO pairs_old (tg_chat_id, max_chat_id, prefix, tg_thread_id, direction)
+SELECT tg_chat_id, max_chat_id, prefix, tg_thread_id, direction FROM pairs WHERE tenant_id = '';
+DROP TABLE pairs;
+ALTER TABLE pairs_old RENAME TO pairs;
+CREATE INDEX IF NOT EXISTS idx_pairs_tg ON pairs(tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_pairs_max ON pairs(max_chat_id);
+
+CREATE TABLE topic_pairs_old (
+    tg_chat_id   INTEGER NOT NULL,
+    tg_thread_id INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    prefix       INTEGER NOT NULL DEFAULT 1,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    PRIMARY KEY (tg_chat_id, max_chat_id)
+);
+INSERT INTO topic_pairs_old (tg_chat_id, tg_thread_id, max_chat_id, prefix, direction)
+SELECT tg_chat_id, tg_thread_id, max_chat_id, prefix, direction FROM topic_pairs WHERE tenant_id = '';
+DROP TABLE topic_pairs;
+ALTER TABLE topic_pairs_old RENAME TO topic_pairs;
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_tg ON topic_pairs(tg_chat_id, tg_thread_id);
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_max ON topic_pairs(max_chat_id);
+
+CREATE TABLE crossposts_old (
+    tg_chat_id   INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    created_at   INTEGER NOT NULL DEFAULT 0,
+    owner_id     INTEGER NOT NULL DEFAULT 0,
+    deleted_at   INTEGER NOT NULL DEFAULT 0,
+    deleted_by   INTEGER NOT NULL DEFAULT 0,
+    tg_owner_id  INTEGER NOT NULL DEFAULT 0,
+    replacements TEXT NOT NULL DEFAULT '',
+    sync_edits   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tg_chat_id, max_chat_id)
+);
+INSERT INTO crossposts_old (tg_chat_id, max_chat_id, direction, created_at, owner_id, deleted_at, deleted_by, tg_owner_id, replacements, sync_edits)
+SELECT tg_chat_id, max_chat_id, direction, created_at, owner_id, deleted_at, deleted_by, tg_owner_id, replacements, sync_edits FROM crossposts WHERE tenant_id = '';
+DROP TABLE crossposts;
+ALTER TABLE crossposts_old RENAME TO crossposts;
+CREATE INDEX IF NOT EXISTS idx_crossposts_tg ON crossposts(tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_crossposts_max ON crossposts(max_chat_id);
+
+CREATE TABLE messages_old (
+    tg_chat_id  INTEGER NOT NULL,
+    tg_msg_id   INTEGER NOT NULL,
+    max_chat_id INTEGER NOT NULL,
+    max_msg_id  TEXT NOT NULL,
+    created_at  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tg_chat_id, tg_msg_id, max_chat_id)
+);
+INSERT INTO messages_old (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at)
+SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at FROM messages WHERE tenant_id = '';
+DROP TABLE messages;
+ALTER TABLE messages_old RENAME TO messages;
+CREATE INDEX IF NOT EXISTS idx_messages_max ON messages(max_msg_id);
+
+CREATE TABLE users_old (
+    user_id    INTEGER PRIMARY KEY,
+    platform   TEXT NOT NULL,
+    username   TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    first_seen INTEGER NOT NULL DEFAULT 0,
+    last_seen  INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO users_old (user_id, platform, username, first_name, first_seen, last_seen)
+SELECT user_id, platform, username, first_name, first_seen, last_seen FROM users WHERE tenant_id = '';
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE TABLE poll_state_old (
+    platform   TEXT PRIMARY KEY,
+    position   INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+INSERT INTO poll_state_old (platform, position, updated_at)
+SELECT platform, position, updated_at FROM poll_state WHERE tenant_id = '';
+DROP TABLE poll_state;
+ALTER TABLE poll_state_old RENAME TO poll_state;
+
+CREATE TABLE processed_updates_old (
+    platform   TEXT NOT NULL,
+    chat_id    INTEGER NOT NULL,
+    msg_id     TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (platform, chat_id, msg_id, kind)
+);
+INSERT INTO processed_updates_old (platform, chat_id, msg_id, kind, created_at)
+SELECT platform, chat_id, msg_id, kind, created_at FROM processed_updates WHERE tenant_id = '';
+DROP TABLE processed_updates;
+ALTER TABLE processed_updates_old RENAME TO processed_updates;
+CREATE INDEX IF NOT EXISTS idx_processed_updates_created_at ON processed_updates(created_at);
+
+DELETE FROM pending WHERE tenant_id <> '';
+DELETE FROM send_queue WHERE tenant_id <> '';
+DELETE FROM dead_letters WHERE tenant_id <> '';
+DELETE FROM update_inbox WHERE tenant_id <> '';
+DROP INDEX IF EXISTS idx_send_queue_tenant;
+DROP INDEX IF EXISTS idx_update_inbox_platform;
+ALTER TABLE pending DROP COLUMN tenant_id;
+ALTER TABLE send_queue DROP COLUMN tenant_id;
+ALTER TABLE dead_letters DROP COLUMN tenant_id;
+ALTER TABLE update_inbox DROP COLUMN tenant_id;
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(platform, id);
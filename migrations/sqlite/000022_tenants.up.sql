@@ -0,0 +1,119 @@
+-- Арендатор (пара ботов TG/MAX) — часть ключа всех данных; '' — арендатор по умолчанию.
+
+CREATE TABLE pairs_new (
+    tenant_id    TEXT NOT NULL DEFAULT '',
+    tg_chat_id   INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    prefix       INTEGER NOT NULL DEFAULT 1,
+    tg_thread_id INTEGER NOT NULL DEFAULT 0,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id)
+);
+INSERT INTO pairs_new (tg_chat_id, max_chat_id, prefix, tg_thread_id, direction)
+SELECT tg_chat_id, max_chat_id, prefix, tg_thread_id, direction FROM pairs;
+DROP TABLE pairs;
+ALTER TABLE pairs_new RENAME TO pairs;
+CREATE INDEX IF NOT EXISTS idx_pairs_tg ON pairs(tenant_id, tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_pairs_max ON pairs(tenant_id, max_chat_id);
+
+CREATE TABLE topic_pairs_new (
+    tenant_id    TEXT NOT NULL DEFAULT '',
+    tg_chat_id   INTEGER NOT NULL,
+    tg_thread_id INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    prefix       INTEGER NOT NULL DEFAULT 1,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id)
+);
+INSERT INTO topic_pairs_new (tg_chat_id, tg_thread_id, max_chat_id, prefix, direction)
+SELECT tg_chat_id, tg_thread_id, max_chat_id, prefix, direction FROM topic_pairs;
+DROP TABLE topic_pairs;
+ALTER TABLE topic_pairs_new RENAME TO topic_pairs;
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_tg ON topic_pairs(tenant_id, tg_chat_id, tg_thread_id);
+CREATE INDEX IF NOT EXISTS idx_topic_pairs_max ON topic_pairs(tenant_id, max_chat_id);
+
+CREATE TABLE crossposts_new (
+    tenant_id    TEXT NOT NULL DEFAULT '',
+    tg_chat_id   INTEGER NOT NULL,
+    max_chat_id  INTEGER NOT NULL,
+    direction    TEXT NOT NULL DEFAULT 'both',
+    created_at   INTEGER NOT NULL DEFAULT 0,
+    owner_id     INTEGER NOT NULL DEFAULT 0,
+    deleted_at   INTEGER NOT NULL DEFAULT 0,
+    deleted_by   INTEGER NOT NULL DEFAULT 0,
+    tg_owner_id  INTEGER NOT NULL DEFAULT 0,
+    replacements TEXT NOT NULL DEFAULT '',
+    sync_edits   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, tg_chat_id, max_chat_id)
+);
+INSERT INTO crossposts_new (tg_chat_id, max_chat_id, direction, created_at, owner_id, deleted_at, deleted_by, tg_owner_id, replacements, sync_edits)
+SELECT tg_chat_id, max_chat_id, direction, created_at, owner_id, deleted_at, deleted_by, tg_owner_id, replacements, sync_edits FROM crossposts;
+DROP TABLE crossposts;
+ALTER TABLE crossposts_new RENAME TO crossposts;
+CREATE INDEX IF NOT EXISTS idx_crossposts_tg ON crossposts(tenant_id, tg_chat_id);
+CREATE INDEX IF NOT EXISTS idx_crossposts_max ON crossposts(tenant_id, max_chat_id);
+
+CREATE TABLE messages_new (
+    tenant_id   TEXT NOT NULL DEFAULT '',
+    tg_chat_id  INTEGER NOT NULL,
+    tg_msg_id   INTEGER NOT NULL,
+    max_chat_id INTEGER NOT NULL,
+    max_msg_id  TEXT NOT NULL,
+    created_at  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, tg_chat_id, tg_msg_id, max_chat_id)
+);
+INSERT INTO messages_new (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at)
+SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at FROM messages;
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
+CREATE INDEX IF NOT EXISTS idx_messages_max ON messages(tenant_id, max_msg_id);
+
+CREATE TABLE users_new (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    user_id    INTEGER NOT NULL,
+    platform   TEXT NOT NULL,
+    username   TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    first_seen INTEGER NOT NULL DEFAULT 0,
+    last_seen  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, user_id)
+);
+INSERT INTO users_new (user_id, platform, username, first_name, first_seen, last_seen)
+SELECT user_id, platform, username, first_name, first_seen, last_seen FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE poll_state_new (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    platform   TEXT NOT NULL,
+    position   INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, platform)
+);
+INSERT INTO poll_state_new (platform, position, updated_at)
+SELECT platform, position, updated_at FROM poll_state;
+DROP TABLE poll_state;
+ALTER TABLE poll_state_new RENAME TO poll_state;
+
+CREATE TABLE processed_updates_new (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    platform   TEXT NOT NULL,
+    chat_id    INTEGER NOT NULL,
+    msg_id     TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, platform, chat_id, msg_id, kind)
+);
+INSERT INTO processed_updates_new (platform, chat_id, msg_id, kind, created_at)
+SELECT platform, chat_id, msg_id, kind, created_at FROM processed_updates;
+DROP TABLE processed_updates;
+ALTER TABLE processed_updates_new RENAME TO processed_updates;
+CREATE INDEX IF NOT EXISTS idx_processed_updates_created_at ON processed_updates(created_at);
+
+ALTER TABLE pending ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE send_queue ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE dead_letters ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE update_inbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_send_queue_tenant ON send_queue(tenant_id, id);
+DROP INDEX IF EXISTS idx_update_inbox_platform;
+CREATE INDEX IF NOT EXISTS idx_update_inbox_platform ON update_inbox(tenant_id, platform, id);
@@ -0,0 +1,2 @@
+ALTER TABLE topic_pairs DROP COLUMN format;
+ALTER TABLE pairs DROP COLUMN format;
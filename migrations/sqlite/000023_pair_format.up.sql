@@ -0,0 +1,2 @@
+ALTER TABLE pairs ADD COLUMN format TEXT NOT NULL DEFAULT '';
+ALTER TABLE topic_pairs ADD COLUMN format TEXT NOT NULL DEFAULT '';
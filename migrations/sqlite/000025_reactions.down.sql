@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS reaction_notes;
+DROP TABLE IF EXISTS reactions;
@@ -0,0 +1,24 @@
+-- Реакции на TG-сообщения: текущее состояние каждого участника (actor_id 0 —
+-- анонимные счётчики канала), по ним собирается сводка для MAX.
+CREATE TABLE IF NOT EXISTS reactions (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    tg_chat_id INTEGER NOT NULL,
+    tg_msg_id  INTEGER NOT NULL,
+    actor_id   INTEGER NOT NULL,
+    emoji      TEXT NOT NULL,
+    count      INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, tg_chat_id, tg_msg_id, actor_id, emoji)
+);
+CREATE INDEX IF NOT EXISTS idx_reactions_created_at ON reactions(tenant_id, created_at);
+
+-- Сообщение со сводкой реакций в MAX-чате (ответ на копию), которое правится при изменениях.
+CREATE TABLE IF NOT EXISTS reaction_notes (
+    tenant_id   TEXT NOT NULL DEFAULT '',
+    tg_chat_id  INTEGER NOT NULL,
+    tg_msg_id   INTEGER NOT NULL,
+    max_chat_id INTEGER NOT NULL,
+    max_msg_id  TEXT NOT NULL,
+    created_at  INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, tg_chat_id, tg_msg_id, max_chat_id)
+);
@@ -0,0 +1,31 @@
+-- Опросы между платформами: сообщение с кнопками в MAX и опрос в TG-чате.
+-- У одного сообщения MAX может быть несколько TG-копий — по строке на каждую.
+-- options и tg_counts — JSON-массивы текстов вариантов и голосов TG по ним.
+CREATE TABLE IF NOT EXISTS polls (
+    tenant_id   TEXT NOT NULL DEFAULT '',
+    max_chat_id INTEGER NOT NULL,
+    max_msg_id  TEXT NOT NULL,
+    tg_chat_id  INTEGER NOT NULL,
+    tg_msg_id   INTEGER NOT NULL,
+    tg_poll_id  TEXT NOT NULL,
+    title       TEXT NOT NULL,
+    options     TEXT NOT NULL,
+    multiple    INTEGER NOT NULL DEFAULT 0,
+    closed      INTEGER NOT NULL DEFAULT 0,
+    tg_counts   TEXT NOT NULL DEFAULT '[]',
+    tg_note_id  INTEGER NOT NULL DEFAULT 0,
+    created_at  INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, max_msg_id, tg_chat_id)
+);
+CREATE INDEX IF NOT EXISTS idx_polls_tg_poll_id ON polls(tenant_id, tg_poll_id);
+CREATE INDEX IF NOT EXISTS idx_polls_created_at ON polls(tenant_id, created_at);
+
+-- Голоса участников MAX: по строке на выбранный вариант.
+CREATE TABLE IF NOT EXISTS poll_votes (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    max_msg_id TEXT NOT NULL,
+    user_id    INTEGER NOT NULL,
+    option_idx INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, max_msg_id, user_id, option_idx)
+);
@@ -0,0 +1,15 @@
+-- Записи остальных арендаторов при откате теряются: остаётся только арендатор по умолчанию.
+
+CREATE TABLE sent_messages_old (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    platform   TEXT NOT NULL,
+    chat_id    INTEGER NOT NULL,
+    msg_id     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (platform, chat_id, msg_id)
+);
+INSERT INTO sent_messages_old (tenant_id, platform, chat_id, msg_id, created_at)
+SELECT tenant_id, platform, chat_id, msg_id, created_at FROM sent_messages WHERE tenant_id = '';
+DROP TABLE sent_messages;
+ALTER TABLE sent_messages_old RENAME TO sent_messages;
+CREATE INDEX IF NOT EXISTS idx_sent_messages_created_at ON sent_messages(tenant_id, created_at);
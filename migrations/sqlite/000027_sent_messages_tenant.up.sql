@@ -0,0 +1,15 @@
+-- Арендатор — часть ключа sent_messages, как у остальных таблиц.
+
+CREATE TABLE sent_messages_new (
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    platform   TEXT NOT NULL,
+    chat_id    INTEGER NOT NULL,
+    msg_id     TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, platform, chat_id, msg_id)
+);
+INSERT INTO sent_messages_new (tenant_id, platform, chat_id, msg_id, created_at)
+SELECT tenant_id, platform, chat_id, msg_id, created_at FROM sent_messages;
+DROP TABLE sent_messages;
+ALTER TABLE sent_messages_new RENAME TO sent_messages;
+CREATE INDEX IF NOT EXISTS idx_sent_messages_created_at ON sent_messages(tenant_id, created_at);
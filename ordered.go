@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// deliveryQueue — упорядоченная доставка по ключу (чату назначения).
+// Задачи с одним ключом выполняются строго по очереди одним воркером,
+// задачи с разными ключами — параллельно. Воркер живёт, пока у ключа есть задачи.
+type deliveryQueue struct {
+	mu      sync.Mutex
+	workers map[string]*deliveryWorker
+	wg      sync.WaitGroup
+}
+
+type deliveryWorker struct {
+	tasks []func()
+}
+
+func newDeliveryQueue() *deliveryQueue {
+	return &deliveryQueue{workers: make(map[string]*deliveryWorker)}
+}
+
+// Submit ставит задачу в очередь ключа key.
+func (q *deliveryQueue) Submit(key string, task func()) {
+	q.wg.Add(1)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w, ok := q.workers[key]; ok {
+		w.tasks = append(w.tasks, task)
+		return
+	}
+	w := &deliveryWorker{tasks: []func(){task}}
+	q.workers[key] = w
+	go q.run(key, w)
+}
+
+func (q *deliveryQueue) run(key string, w *deliveryWorker) {
+	for {
+		q.mu.Lock()
+		if len(w.tasks) == 0 {
+			delete(q.workers, key)
+			q.mu.Unlock()
+			return
+		}
+		task := w.tasks[0]
+		w.tasks = w.tasks[1:]
+		q.mu.Unlock()
+
+		task()
+		q.wg.Done()
+	}
+}
+
+// Wait ждёт, пока выполнятся все поставленные задачи.
+func (q *deliveryQueue) Wait() {
+	q.wg.Wait()
+}
+
+func tgDeliveryKey(chatID int64) string  { return "tg:" + strconv.FormatInt(chatID, 10) }
+func maxDeliveryKey(chatID int64) string { return "max:" + strconv.FormatInt(chatID, 10) }
+
+// updateBatch — доставки, поставленные одним listener'ом: всё с последнего checkpoint'а
+// поллинга (wg) и то, что относится к апдейту, который он сейчас обрабатывает (cur).
+// inboxID — запись inbox, из которой придёт следующий апдейт (webhook-режим).
+// Поля меняет только горутина listener'а.
+type updateBatch struct {
+	wg      sync.WaitGroup
+	cur     *pendingUpdate
+	inboxID int64
+}
+
+// deliverToMax ставит отправку в MAX-чат в его очередь: порядок внутри чата сохраняется.
+// Отправка учитывается в текущей пачке апдейтов TG (tgBatch).
+func (b *Bridge) deliverToMax(maxChatID int64, task func()) {
+	b.submitDelivery(&b.tgBatch, maxDeliveryKey(maxChatID), task)
+}
+
+// deliverToTg ставит отправку в TG-чат в его очередь: порядок внутри чата сохраняется.
+// Отправка учитывается в текущей пачке апдейтов MAX (maxBatch).
+func (b *Bridge) deliverToTg(tgChatID int64, task func()) {
+	b.submitDelivery(&b.maxBatch, tgDeliveryKey(tgChatID), task)
+}
+
+// Ответы бота на команды и кнопки тоже идут через очередь чата: отправка может ждать
+// лимитов до rateRetryMaxWait, а listener на это время встал бы целиком. Вызываются
+// только из горутины listener'а своей платформы — ответ учитывается в его пачке.
+
+// replyTgTask ставит действие бота в TG-чате (ответ, правку, удаление) в очередь этого чата.
+func (b *Bridge) replyTgTask(tgChatID int64, task func()) {
+	b.submitDelivery(&b.tgBatch, tgDeliveryKey(tgChatID), task)
+}
+
+// replyTg отправляет ответ бота в TG-чат через его очередь.
+func (b *Bridge) replyTg(ctx context.Context, tgChatID int64, text string, opts *SendOpts) {
+	b.replyTgTask(tgChatID, func() { b.tg.SendMessage(ctx, tgChatID, text, opts) })
+}
+
+// replyTgEdit правит сообщение бота в TG-чате (меню кнопок) через очередь чата.
+func (b *Bridge) replyTgEdit(ctx context.Context, tgChatID int64, msgID int, text string, opts *SendOpts) {
+	b.replyTgTask(tgChatID, func() { b.tg.EditMessageText(ctx, tgChatID, msgID, text, opts) })
+}
+
+// replyMaxTask ставит действие бота в MAX-чате в очередь этого чата.
+func (b *Bridge) replyMaxTask(maxChatID int64, task func()) {
+	b.submitDelivery(&b.maxBatch, maxDeliveryKey(maxChatID), task)
+}
+
+// replyMax отправляет ответ бота в MAX-чат через его очередь.
+func (b *Bridge) replyMax(ctx context.Context, m *MaxMessage) {
+	b.replyMaxTask(m.ChatID, func() { b.max.SendMessage(ctx, m) })
+}
+
+// submitDelivery ставит задачу в очередь key и учитывает её в пачке batch и в текущем
+// апдейте, пока она не выполнится. Вызывается только из горутины listener'а этой пачки —
+// он же ждёт её в finishPollBatch.
+func (b *Bridge) submitDelivery(batch *updateBatch, key string, task func()) {
+	batch.wg.Add(1)
+	u := batch.cur
+	if u != nil {
+		u.wg.Add(1)
+	}
+	b.deliver.Submit(key, func() {
+		defer batch.wg.Done()
+		if u != nil {
+			defer u.wg.Done()
+		}
+		task()
+	})
+}
+
+// finishPollBatch завершает пачку апдейтов поллинга platform ("tg" / "max"): сбрасывает
+// буферы альбомов, ждёт, пока все её доставки отправят сообщения или поставят их
+// в send_queue, а апдейты будут отмечены обработанными, сохраняет позицию и отпускает
+// поллер (ack). При остановке позиция
+// не сохраняется: прерванные доставки могли ничего не сделать, и после рестарта пачка
+// будет прочитана заново.
+func (b *Bridge) finishPollBatch(ctx context.Context, platform string, position int64, ack chan struct{}) {
+	if ack != nil {
+		defer close(ack)
+	}
+	batch := &b.maxBatch
+	if platform == "tg" {
+		b.flushMediaGroups()
+		batch = &b.tgBatch
+	}
+	batch.wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	if err := b.repo.SetPollState(platform, position); err != nil {
+		slog.Error("save poll position failed", "platform", platform, "position", position, "err", err)
+	}
+}
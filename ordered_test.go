@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeliveryQueue_OrderPerKey(t *testing.T) {
+	q := newDeliveryQueue()
+
+	var mu sync.Mutex
+	got := map[string][]int{}
+	for i := 0; i < 50; i++ {
+		for _, key := range []string{"a", "b"} {
+			q.Submit(key, func() {
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+	q.Wait()
+
+	for _, key := range []string{"a", "b"} {
+		if len(got[key]) != 50 {
+			t.Fatalf("key %s: %d tasks done, want 50", key, len(got[key]))
+		}
+		for i, v := range got[key] {
+			if v != i {
+				t.Fatalf("key %s: task %d ran at position %d", key, v, i)
+			}
+		}
+	}
+}
+
+func TestDeliveryQueue_KeysIndependent(t *testing.T) {
+	q := newDeliveryQueue()
+
+	// Задача ключа "slow" блокируется, пока не выполнится задача ключа "fast".
+	release := make(chan struct{})
+	q.Submit("slow", func() { <-release })
+	q.Submit("fast", func() { close(release) })
+
+	done := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tasks of different keys blocked each other")
+	}
+}
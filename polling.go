@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// Long polling TG и MAX с сохраняемой позицией.
+//
+// Апдейты отдаются через небуферизованный канал, за каждой пачкой идёт служебный
+// checkpoint. Listener только раздаёт апдейты по очередям доставки (deliverToMax /
+// deliverToTg), а альбомы ещё и копятся в буфере, поэтому на checkpoint'е он сбрасывает
+// буферы альбомов и ждёт, пока каждая доставка пачки отправит сообщение или поставит
+// его в send_queue (finishPollBatch). Только после этого позиция сохраняется в БД и
+// закрывается Ack, а поллер, дождавшись его, запрашивает следующую пачку (для TG этот
+// запрос и подтверждает предыдущую). Так после рестарта чтение продолжается с последней
+// доставленной пачки; повторно пришедшие сообщения отсекаются по маппингу
+// (см. alreadyForwarded*).
+
+const (
+	pollTimeout    = 30 * time.Second // long polling: сколько сервер держит пустой запрос
+	pollMaxBackoff = 30 * time.Second
+	pollLimit      = 100
+)
+
+// pollBackoff — пауза после ошибки запроса апдейтов: 1s, 2s, 4s… до pollMaxBackoff.
+func pollBackoff(ctx context.Context, wait time.Duration) (time.Duration, bool) {
+	wait = min(max(2*wait, time.Second), pollMaxBackoff)
+	select {
+	case <-ctx.Done():
+		return wait, false
+	case <-time.After(wait):
+		return wait, true
+	}
+}
+
+// --- Telegram ---
+
+func (s *tgBotSender) StartPolling(ctx context.Context, offset int64) <-chan TGUpdate {
+	ch := make(chan TGUpdate)
+	go func() {
+		defer close(ch)
+		var wait time.Duration
+		for ctx.Err() == nil {
+			updates, err := s.getUpdates(ctx, offset)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("TG getUpdates failed", "err", err)
+				var ok bool
+				if wait, ok = pollBackoff(ctx, wait); !ok {
+					return
+				}
+				continue
+			}
+			wait = 0
+			if len(updates) == 0 {
+				continue
+			}
+			for _, u := range updates {
+				select {
+				case ch <- convertUpdate(u):
+				case <-ctx.Done():
+					return
+				}
+			}
+			offset = updates[len(updates)-1].ID + 1
+			ack := make(chan struct{})
+			select {
+			case ch <- TGUpdate{Checkpoint: offset, Ack: ack}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ack:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// getUpdates — один запрос getUpdates. offset подтверждает Telegram все апдейты до него.
+func (s *tgBotSender) getUpdates(ctx context.Context, offset int64) ([]*models.Update, error) {
+	data, err := json.Marshal(map[string]any{
+		"offset":          offset,
+		"limit":           pollLimit,
+		"timeout":         int(pollTimeout.Seconds()),
+		"allowed_updates": tgAllowedUpdates,
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := s.apiURL
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/bot"+s.token+"/getUpdates", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.pollClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		OK          bool             `json:"ok"`
+		Result      []*models.Update `json:"result"`
+		ErrorCode   int              `json:"error_code"`
+		Description string           `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("getUpdates: decode: %w", err)
+	}
+	if !r.OK {
+		return nil, fmt.Errorf("getUpdates: %d %s", r.ErrorCode, r.Description)
+	}
+	return r.Result, nil
+}
+
+// --- MAX ---
+
+func (s *maxBotSender) StartPolling(ctx context.Context, marker int64) <-chan maxschemes.UpdateInterface {
+	ch := make(chan maxschemes.UpdateInterface)
+	// Разбор апдейта (с вложениями) в SDK не экспортирован — используем его webhook-обработчик.
+	parsed := make(chan maxschemes.UpdateInterface, 1)
+	parse := s.api.GetHandler(parsed)
+	go func() {
+		defer close(ch)
+		var wait time.Duration
+		for ctx.Err() == nil {
+			list, err := s.getUpdates(ctx, marker)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("MAX getUpdates failed", "err", err)
+				var ok bool
+				if wait, ok = pollBackoff(ctx, wait); !ok {
+					return
+				}
+				continue
+			}
+			wait = 0
+			for _, raw := range list.Updates {
+				upd, err := parseMaxUpdate(parse, parsed, raw)
+				if err != nil {
+					slog.Warn("MAX update skipped", "err", err)
+					continue
+				}
+				select {
+				case ch <- upd:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if list.Marker == nil || *list.Marker == marker {
+				continue
+			}
+			marker = *list.Marker
+			ack := make(chan struct{})
+			select {
+			case ch <- &maxPollCheckpoint{Marker: marker, Ack: ack}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ack:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// getUpdates — один запрос GET /updates начиная с marker.
+func (s *maxBotSender) getUpdates(ctx context.Context, marker int64) (*maxschemes.UpdateList, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(pollLimit))
+	q.Set("timeout", strconv.Itoa(int(pollTimeout.Seconds())))
+	q.Set("v", maxAPIVersion)
+	if marker > 0 {
+		q.Set("marker", strconv.FormatInt(marker, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/updates?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", s.token)
+	resp, err := s.pollClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newMAXError(resp.StatusCode, buf.Bytes(), resp.Header)
+	}
+	var list maxschemes.UpdateList
+	if err := json.Unmarshal(buf.Bytes(), &list); err != nil {
+		return nil, fmt.Errorf("updates: decode: %w", err)
+	}
+	return &list, nil
+}
+
+// parseMaxUpdate разбирает сырой апдейт MAX webhook-обработчиком SDK, который кладёт результат в parsed.
+func parseMaxUpdate(parse http.HandlerFunc, parsed chan maxschemes.UpdateInterface, raw []byte) (maxschemes.UpdateInterface, error) {
+	rec := httptest.NewRecorder()
+	parse(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw)))
+	select {
+	case upd := <-parsed:
+		return upd, nil
+	default:
+		return nil, fmt.Errorf("parse update: %s", strings.TrimSpace(rec.Body.String()))
+	}
+}
+
+// alreadyForwardedTg — TG-сообщение уже доставлено в MAX-чат (апдейт пришёл повторно
+// после рестарта): копия есть в маппинге.
+func (b *Bridge) alreadyForwardedTg(msg *TGMessage, maxChatID int64) bool {
+	if _, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.MessageID, maxChatID); ok {
+		slog.Info("TG→MAX skip: already forwarded", "tgChat", msg.Chat.ID, "msgID", msg.MessageID, "maxChat", maxChatID)
+		return true
+	}
+	return false
+}
+
+// alreadyForwardedMax — MAX-сообщение mid уже доставлено в TG-чат.
+func (b *Bridge) alreadyForwardedMax(mid string, tgChatID int64) bool {
+	if _, ok := b.repo.LookupTgMsgID(mid, tgChatID); ok {
+		slog.Info("MAX→TG skip: already forwarded", "mid", mid, "tgChat", tgChatID)
+		return true
+	}
+	return false
+}
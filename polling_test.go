@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListeners_SavePollCheckpoints(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	msg := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "supergroup"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: "hello"}
+	runTgUpdates(b, tg, TGUpdate{UpdateID: 41, Message: msg}, TGUpdate{Checkpoint: 42})
+	runMaxUpdates(b, mx, maxTextUpdate(200, 5, "Olga", "mid.src", "привет"), &maxPollCheckpoint{Marker: 9000})
+
+	if got := b.repo.GetPollState("tg"); got != 42 {
+		t.Errorf("tg offset = %d, want 42", got)
+	}
+	if got := b.repo.GetPollState("max"); got != 9000 {
+		t.Errorf("max marker = %d, want 9000", got)
+	}
+	// Checkpoint'ы — служебные апдейты, пересылать нечего
+	if len(mx.sent()) != 1 || len(tg.Sent) != 1 {
+		t.Errorf("sent: max=%d tg=%d, want 1 and 1", len(mx.sent()), len(tg.Sent))
+	}
+}
+
+func TestListeners_ReplayedMessagesNotDuplicated(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	// После рестарта с несохранённым checkpoint'ом те же апдейты приходят второй раз
+	msg := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "supergroup"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: "hello"}
+	upd := maxTextUpdate(200, 5, "Olga", "mid.src", "привет")
+	runTgUpdates(b, tg, TGUpdate{UpdateID: 41, Message: msg}, TGUpdate{UpdateID: 41, Message: msg})
+	runMaxUpdates(b, mx, upd, upd)
+
+	if n := len(mx.sent()); n != 1 {
+		t.Errorf("TG message forwarded to MAX %d times, want 1", n)
+	}
+	if n := len(tg.Sent); n != 1 {
+		t.Errorf("MAX message forwarded to TG %d times, want 1", n)
+	}
+}
+
+func TestFinishPollBatch_WaitsForDelivery(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+
+	release := make(chan struct{})
+	b.deliverToMax(200, func() { <-release })
+	ack := make(chan struct{})
+	go b.finishPollBatch(context.Background(), "tg", 42, ack)
+
+	select {
+	case <-ack:
+		t.Fatal("checkpoint acknowledged before the batch was delivered")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := b.repo.GetPollState("tg"); got != 0 {
+		t.Errorf("tg offset = %d saved while delivery is in flight, want 0", got)
+	}
+
+	close(release)
+	<-ack
+	if got := b.repo.GetPollState("tg"); got != 42 {
+		t.Errorf("tg offset = %d, want 42", got)
+	}
+}
+
+func TestFinishPollBatch_FlushesAlbums(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	for i, id := range []string{"p1", "p2"} {
+		msg := &TGMessage{MessageID: 10 + i, Chat: ChatInfo{ID: -100, Type: "supergroup"}, From: &UserInfo{ID: 1, FirstName: "Ivan"},
+			MediaGroupID: "g1", Photo: []PhotoSize{{FileID: id}}}
+		b.bufferMediaGroup(context.Background(), "g1", newMediaGroupItem(msg, ""))
+	}
+	start := time.Now()
+	b.finishPollBatch(context.Background(), "tg", 42, nil)
+
+	if elapsed := time.Since(start); elapsed >= mediaGroupTimeout {
+		t.Errorf("finishPollBatch waited %v for the album timer", elapsed)
+	}
+	if len(mx.sent()) != 1 || b.repo.GetPollState("tg") != 42 {
+		t.Errorf("MAX sent %d messages, offset %d; want the album and offset 42", len(mx.sent()), b.repo.GetPollState("tg"))
+	}
+}
+
+func TestFinishPollBatch_StoppedKeepsPosition(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b.finishPollBatch(ctx, "max", 9000, nil)
+	if got := b.repo.GetPollState("max"); got != 0 {
+		t.Errorf("max marker = %d saved after stop, want 0", got)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// Опросы. В MAX нет нативных опросов, поэтому опрос из TG переносится сообщением
+// бота с кнопкой на каждый вариант: голоса участников MAX хранятся в poll_votes, а
+// сообщение показывает сумму голосов обеих платформ. В TG опрос остаётся нативным,
+// голоса MAX приходят туда сводкой — ответом бота на опрос. /poll в MAX создаёт
+// нативный опрос в связанных TG-чатах и такое же сообщение с кнопками.
+//
+// Счётчики голосов (апдейт poll) Bot API присылает только для опросов, отправленных
+// ботом, и для закрытых опросов: у опроса участника TG в MAX видны голоса на момент
+// пересылки и итог после закрытия. Сводки обновляются раз в pollFlushInterval.
+
+const (
+	pollFlushInterval = 30 * time.Second
+	pollMaxOptions    = 10  // лимит Bot API на число вариантов
+	pollQuestionLen   = 300 // лимит Bot API на длину вопроса
+	pollOptionLen     = 100 // лимит Bot API на длину варианта
+)
+
+// pollSync — что обновить у опроса при следующем flushPolls.
+type pollSync struct {
+	max bool // изменились голоса TG — править сообщение в MAX
+	tg  bool // изменились голоса MAX — обновить сводку в TG
+}
+
+// markPoll откладывает обновление опроса с сообщением maxMsgID до flushPolls.
+func (b *Bridge) markPoll(maxMsgID string, s pollSync) {
+	b.pollMu.Lock()
+	defer b.pollMu.Unlock()
+	cur := b.pollDirty[maxMsgID]
+	b.pollDirty[maxMsgID] = pollSync{max: cur.max || s.max, tg: cur.tg || s.tg}
+}
+
+// sendTgPollToMax пересылает TG-опрос в MAX-чат сообщением с кнопками.
+func (b *Bridge) sendTgPollToMax(ctx context.Context, msg *TGMessage, maxChatID int64) error {
+	p := BridgedPoll{
+		MaxChatID: maxChatID,
+		TgChatID:  msg.Chat.ID,
+		TgMsgID:   msg.MessageID,
+		TgPollID:  msg.Poll.ID,
+		Title:     "📊 " + msg.Poll.Question,
+		Multiple:  msg.Poll.Multiple,
+		Closed:    msg.Poll.Closed,
+	}
+	for _, o := range msg.Poll.Options {
+		p.Options = append(p.Options, o.Text)
+		p.TgCounts = append(p.TgCounts, o.Voters)
+	}
+	// В связке — подпись по шаблону, в кросспостинге канала — только вопрос
+	if slices.Contains(b.repo.GetMaxChats(msg.Chat.ID, tgTopicID(msg)), maxChatID) {
+		p.Title, _ = b.attribute(tgAttribution(msg, p.Title), msg.Chat.ID, maxChatID, false)
+	}
+
+	m := pollMaxMessage([]BridgedPoll{p}, nil)
+	if msg.ReplyToMessage != nil {
+		if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID, maxChatID); ok {
+			m.ReplyTo = maxReplyID
+		}
+	}
+	mid, err := b.max.SendMessage(ctx, m)
+	if err != nil {
+		slog.Error("TG→MAX poll send failed", "err", err, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+		if errKind(err) == ErrPermanent {
+			return undeliverable(err)
+		}
+		return err
+	}
+	p.MaxMsgID = mid
+	if err := b.repo.SavePoll(p); err != nil {
+		slog.Error("TG→MAX poll save failed", "err", err, "mid", mid)
+	}
+	slog.Info("TG→MAX poll sent", "mid", mid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+	b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+	b.metricForward("tg2max", tgMsgType(msg), msg.Chat.ID, maxChatID)
+	return nil
+}
+
+// handleTgPollUpdate сохраняет новые счётчики TG-опроса (апдейт poll).
+func (b *Bridge) handleTgPollUpdate(p *TGPoll) {
+	polls := b.repo.PollsByTgPoll(p.ID)
+	if len(polls) == 0 {
+		return
+	}
+	counts := make([]int, len(p.Options))
+	for i, o := range p.Options {
+		counts[i] = o.Voters
+	}
+	if err := b.repo.SetPollTgCounts(p.ID, counts, p.Closed); err != nil {
+		slog.Error("TG poll update save failed", "err", err, "poll", p.ID)
+		return
+	}
+	for _, bp := range polls {
+		b.markPoll(bp.MaxMsgID, pollSync{max: true})
+	}
+}
+
+// handleMaxPollVote обрабатывает нажатие кнопки варианта (payload "poll:<номер>").
+// Повторное нажатие отзывает голос; в опросе с одним ответом новый вариант заменяет прежний.
+func (b *Bridge) handleMaxPollVote(ctx context.Context, cbUpd *maxschemes.MessageCallbackUpdate, arg string) {
+	callbackID := cbUpd.Callback.CallbackID
+	idx, err := strconv.Atoi(arg)
+	if err != nil || cbUpd.Message == nil {
+		return
+	}
+	mid := cbUpd.Message.Body.Mid
+	polls := b.repo.PollsByMaxMsg(mid)
+	if len(polls) == 0 {
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			Notification: "Опрос больше не синхронизируется с Telegram.",
+		})
+		return
+	}
+	p := polls[0]
+	if idx < 0 || idx >= len(p.Options) {
+		return
+	}
+	if pollClosed(polls) {
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{Notification: "Опрос закрыт."})
+		return
+	}
+
+	userID := cbUpd.Callback.User.UserId
+	votes, voted := togglePollVote(b.repo.GetPollVotes(mid, userID), idx, p.Multiple)
+	if err := b.repo.SetPollVotes(mid, userID, votes); err != nil {
+		slog.Error("MAX poll vote save failed", "err", err, "mid", mid, "uid", userID)
+		b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+			Notification: "Не удалось сохранить голос, попробуйте ещё раз.",
+		})
+		return
+	}
+	note := "Голос отозван: " + p.Options[idx]
+	if voted {
+		note = "Голос учтён: " + p.Options[idx]
+	}
+	b.max.AnswerCallback(ctx, callbackID, &maxschemes.CallbackAnswer{
+		Message:      pollMaxMessage(polls, b.repo.CountPollVotes(mid)).body(),
+		Notification: note,
+	})
+	b.markPoll(mid, pollSync{tg: true})
+}
+
+// togglePollVote применяет нажатие варианта idx к выбору участника votes.
+// voted — вариант выбран (false — голос за него отозван).
+func togglePollVote(votes []int, idx int, multiple bool) (next []int, voted bool) {
+	if slices.Contains(votes, idx) {
+		return slices.DeleteFunc(slices.Clone(votes), func(v int) bool { return v == idx }), false
+	}
+	if !multiple {
+		return []int{idx}, true
+	}
+	next = append(slices.Clone(votes), idx)
+	slices.Sort(next)
+	return next, true
+}
+
+// maxPollCommand создаёт опрос по команде "/poll Вопрос | Вариант | Вариант" из MAX:
+// нативный опрос в каждом связанном TG-чате и сообщение с кнопками в MAX.
+// Возвращает ответ пользователю; "" — опрос создан.
+func (b *Bridge) maxPollCommand(ctx context.Context, msgUpd *maxschemes.MessageCreatedUpdate, args string) string {
+	question, options, ok := parsePollArgs(args)
+	if !ok {
+		return fmt.Sprintf("Используйте: /poll Вопрос | Вариант 1 | Вариант 2\n"+
+			"От 2 до %d вариантов, вопрос — до %d символов, вариант — до %d.", pollMaxOptions, pollQuestionLen, pollOptionLen)
+	}
+	maxChatID := msgUpd.Message.Recipient.ChatId
+	var tgChatIDs []int64
+	for _, tgChatID := range b.repo.GetTgChats(maxChatID) {
+		if b.pairAllows(tgChatID, maxChatID, "max>tg") {
+			tgChatIDs = append(tgChatIDs, tgChatID)
+		}
+	}
+	if len(tgChatIDs) == 0 {
+		return "Чат не связан с Telegram или пересылка в Telegram выключена (/bridge direction)."
+	}
+
+	p := BridgedPoll{MaxChatID: maxChatID, Title: "📊 " + question, Options: options}
+	mid, err := b.max.SendMessage(ctx, pollMaxMessage([]BridgedPoll{p}, nil))
+	if err != nil {
+		slog.Error("MAX poll send failed", "err", err, "maxChat", maxChatID)
+		return "Не удалось создать опрос."
+	}
+	p.MaxMsgID = mid
+	p.TgCounts = make([]int, len(options))
+
+	created := 0
+	for _, tgChatID := range tgChatIDs {
+		q, _ := b.attribute(maxAttribution(&msgUpd.Message, question), tgChatID, maxChatID, false)
+		opts := &SendOpts{ThreadID: b.repo.GetTgThreadID(tgChatID, maxChatID)}
+		msgID, pollID, err := b.tg.SendPoll(ctx, tgChatID, truncateRunes(q, pollQuestionLen), options, false, opts)
+		if err != nil {
+			slog.Error("MAX→TG poll send failed", "err", err, "maxChat", maxChatID, "tgChat", tgChatID)
+			continue
+		}
+		p.TgChatID, p.TgMsgID, p.TgPollID = tgChatID, msgID, pollID
+		if err := b.repo.SavePoll(p); err != nil {
+			slog.Error("MAX→TG poll save failed", "err", err, "mid", mid, "tgChat", tgChatID)
+			continue
+		}
+		b.repo.SaveMsg(tgChatID, msgID, maxChatID, mid)
+		slog.Info("MAX→TG poll sent", "mid", mid, "maxChat", maxChatID, "tgChat", tgChatID, "tgMsg", msgID)
+		created++
+	}
+	if created == 0 {
+		b.max.DeleteMessage(ctx, mid)
+		return "Не удалось отправить опрос в Telegram. Проверьте, что бот может писать в связанный чат."
+	}
+	return ""
+}
+
+// parsePollArgs разбирает "Вопрос | Вариант | Вариант" с учётом лимитов Bot API.
+func parsePollArgs(args string) (question string, options []string, ok bool) {
+	var parts []string
+	for _, s := range strings.Split(args, "|") {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) < 3 || len(parts) > pollMaxOptions+1 || utf8.RuneCountInString(parts[0]) > pollQuestionLen {
+		return "", nil, false
+	}
+	for _, o := range parts[1:] {
+		if utf8.RuneCountInString(o) > pollOptionLen {
+			return "", nil, false
+		}
+	}
+	return parts[0], parts[1:], true
+}
+
+// pollClosed — опрос закрыт хотя бы в одном TG-чате.
+func pollClosed(polls []BridgedPoll) bool {
+	return slices.ContainsFunc(polls, func(p BridgedPoll) bool { return p.Closed })
+}
+
+// pollTally — голоса по вариантам: сумма по TG-копиям опроса и голоса MAX.
+func pollTally(polls []BridgedPoll, votes map[int]int) []int {
+	tally := make([]int, len(polls[0].Options))
+	for _, p := range polls {
+		for i, n := range p.TgCounts {
+			if i < len(tally) {
+				tally[i] += n
+			}
+		}
+	}
+	for i, n := range votes {
+		if i >= 0 && i < len(tally) {
+			tally[i] += n
+		}
+	}
+	return tally
+}
+
+// pollMaxMessage — сообщение опроса в MAX: вопрос, голоса по вариантам и кнопки
+// (у закрытого опроса кнопок нет).
+func pollMaxMessage(polls []BridgedPoll, votes map[int]int) *MaxMessage {
+	p := polls[0]
+	closed := pollClosed(polls)
+	tally := pollTally(polls, votes)
+	var sb strings.Builder
+	sb.WriteString(p.Title)
+	sb.WriteString("\n")
+	for i, o := range p.Options {
+		fmt.Fprintf(&sb, "\n%s — %d", o, tally[i])
+	}
+	switch {
+	case closed:
+		sb.WriteString("\n\nОпрос закрыт.")
+	case p.Multiple:
+		sb.WriteString("\n\nМожно выбрать несколько вариантов.")
+	}
+	m := &MaxMessage{ChatID: p.MaxChatID, Text: sb.String()}
+	if !closed {
+		kb := &maxbot.Keyboard{}
+		for i, o := range p.Options {
+			kb.AddRow().AddCallback(o, maxschemes.DEFAULT, "poll:"+strconv.Itoa(i))
+		}
+		m.Keyboard = kb
+	}
+	return m
+}
+
+// formatPollVotes — сводка голосов MAX для TG: "Голоса из MAX: Да — 2, Нет — 1";
+// "" — голосов нет.
+func formatPollVotes(options []string, votes map[int]int) string {
+	var parts []string
+	for i, o := range options {
+		if votes[i] > 0 {
+			parts = append(parts, o+" — "+strconv.Itoa(votes[i]))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Голоса из MAX: " + strings.Join(parts, ", ")
+}
+
+// flushPolls обновляет отложенные markPoll опросы: сообщение с итогами в MAX
+// и сводку голосов MAX в TG-чатах.
+func (b *Bridge) flushPolls(ctx context.Context) {
+	b.pollMu.Lock()
+	dirty := b.pollDirty
+	b.pollDirty = make(map[string]pollSync)
+	b.pollMu.Unlock()
+
+	for mid, s := range dirty {
+		polls := b.repo.PollsByMaxMsg(mid)
+		if len(polls) == 0 {
+			continue
+		}
+		votes := b.repo.CountPollVotes(mid)
+		if s.max {
+			if err := b.max.EditMessage(ctx, mid, pollMaxMessage(polls, votes)); err != nil {
+				slog.Error("TG→MAX poll tally edit failed", "err", err, "mid", mid)
+			}
+		}
+		if s.tg {
+			text := formatPollVotes(polls[0].Options, votes)
+			for _, p := range polls {
+				b.updatePollNote(ctx, p, text)
+			}
+		}
+	}
+}
+
+// updatePollNote отправляет, правит или удаляет сводку голосов MAX у TG-опроса p.
+func (b *Bridge) updatePollNote(ctx context.Context, p BridgedPoll, text string) {
+	switch {
+	case text == "" && p.TgNoteID == 0:
+		return
+	case text == "":
+		if err := b.tg.DeleteMessage(ctx, p.TgChatID, p.TgNoteID); err != nil {
+			slog.Error("MAX→TG poll votes delete failed", "err", err, "tgChat", p.TgChatID, "tgMsg", p.TgNoteID)
+			return
+		}
+		b.repo.SetPollTgNote(p.MaxMsgID, p.TgChatID, 0)
+	case p.TgNoteID != 0:
+		if err := b.tg.EditMessageText(ctx, p.TgChatID, p.TgNoteID, text, nil); err != nil {
+			slog.Error("MAX→TG poll votes edit failed", "err", err, "tgChat", p.TgChatID, "tgMsg", p.TgNoteID)
+		}
+	default:
+		opts := &SendOpts{ReplyToID: p.TgMsgID, ThreadID: b.repo.GetTgThreadID(p.TgChatID, p.MaxChatID)}
+		id, err := b.tg.SendMessage(ctx, p.TgChatID, text, opts)
+		if err != nil {
+			slog.Error("MAX→TG poll votes send failed", "err", err, "tgChat", p.TgChatID)
+			return
+		}
+		b.repo.SetPollTgNote(p.MaxMsgID, p.TgChatID, id)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+func tgPollMessage(msgID int, poll *TGPoll) TGUpdate {
+	return TGUpdate{Message: &TGMessage{
+		MessageID: msgID,
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		From:      &UserInfo{ID: 1, FirstName: "Ivan"},
+		Poll:      poll,
+	}}
+}
+
+func maxPollVote(cbID, mid string, userID int64, option string) *maxschemes.MessageCallbackUpdate {
+	upd := &maxschemes.MessageCallbackUpdate{
+		Callback: maxschemes.Callback{CallbackID: cbID, Payload: "poll:" + option, User: maxschemes.User{UserId: userID}},
+		Message:  &maxschemes.Message{},
+	}
+	upd.Message.Body.Mid = mid
+	return upd
+}
+
+func lunchPoll(closed bool, pizza, sushi int) *TGPoll {
+	return &TGPoll{
+		ID:       "p1",
+		Question: "Обед?",
+		Options:  []TGPollOption{{Text: "Пицца", Voters: pizza}, {Text: "Суши", Voters: sushi}},
+		Closed:   closed,
+	}
+}
+
+func TestTgPoll_ToMaxButtons(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	runTgUpdates(b, tg, tgPollMessage(7, lunchPoll(false, 2, 0)))
+
+	sent := mx.sent()
+	if len(sent) != 1 {
+		t.Fatalf("MAX sent %d messages, want 1", len(sent))
+	}
+	if want := "[TG] Ivan: 📊 Обед?\n\nПицца — 2\nСуши — 0"; sent[0].Text != want {
+		t.Errorf("MAX poll text = %q, want %q", sent[0].Text, want)
+	}
+	if sent[0].Keyboard == nil {
+		t.Error("MAX poll has no vote buttons")
+	}
+	polls := b.repo.PollsByMaxMsg("mid.1")
+	if len(polls) != 1 || polls[0].TgPollID != "p1" || !slices.Equal(polls[0].TgCounts, []int{2, 0}) {
+		t.Errorf("PollsByMaxMsg = %+v, want poll p1 with TG counts [2 0]", polls)
+	}
+	if mid, ok := b.repo.LookupMaxMsgID(-100, 7, 200); !ok || mid != "mid.1" {
+		t.Errorf("LookupMaxMsgID = %q, %v; want mid.1, true", mid, ok)
+	}
+}
+
+func TestMaxPollVotes(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	runTgUpdates(b, tg, tgPollMessage(7, lunchPoll(false, 2, 0)))
+
+	runMaxUpdates(b, mx,
+		maxPollVote("cb1", "mid.1", 5, "1"),
+		maxPollVote("cb2", "mid.1", 6, "1"),
+		maxPollVote("cb3", "mid.1", 5, "0"), // один ответ: новый вариант заменяет прежний
+		maxPollVote("cb4", "mid.1", 6, "1"), // повторное нажатие отзывает голос
+		maxPollVote("cb5", "mid.1", 6, "9"), // нет такого варианта
+	)
+
+	var notes []string
+	for _, a := range mx.Answers {
+		notes = append(notes, a.Notification)
+	}
+	want := []string{"Голос учтён: Суши", "Голос учтён: Суши", "Голос учтён: Пицца", "Голос отозван: Суши"}
+	if !slices.Equal(notes, want) {
+		t.Errorf("callback notifications = %q, want %q", notes, want)
+	}
+	if last := mx.Answers[len(mx.Answers)-1].Message; last == nil || last.Text != "[TG] Ivan: 📊 Обед?\n\nПицца — 3\nСуши — 0" {
+		t.Errorf("updated MAX poll = %+v, want tally Пицца 3, Суши 0", last)
+	}
+
+	b.flushPolls(context.Background())
+	sent := tg.sent()
+	if len(sent) != 1 || sent[0].Text != "Голоса из MAX: Пицца — 1" || sent[0].Opts.ReplyToID != 7 {
+		t.Fatalf("TG sent = %+v, want MAX votes summary replying to the poll", sent)
+	}
+
+	b.handleMaxCallback(context.Background(), maxPollVote("cb6", "mid.1", 7, "1"))
+	b.flushPolls(context.Background())
+	if len(tg.Edited) != 1 || tg.Edited[0].MsgID != 1 || tg.Edited[0].Text != "Голоса из MAX: Пицца — 1, Суши — 1" {
+		t.Errorf("TG edited = %+v, want summary 1 updated", tg.Edited)
+	}
+}
+
+func TestTgPollUpdate_ClosesMaxPoll(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	runTgUpdates(b, tg, tgPollMessage(7, lunchPoll(false, 0, 0)))
+	b.handleTgPollUpdate(lunchPoll(true, 4, 1))
+	b.handleTgPollUpdate(&TGPoll{ID: "unknown", Closed: true})
+	b.flushPolls(context.Background())
+
+	if len(mx.Edited) != 1 || mx.Edited[0].Mid != "mid.1" {
+		t.Fatalf("MAX edited = %+v, want the poll mid.1", mx.Edited)
+	}
+	edited := mx.Edited[0].Msg
+	if want := "[TG] Ivan: 📊 Обед?\n\nПицца — 4\nСуши — 1\n\nОпрос закрыт."; edited.Text != want {
+		t.Errorf("closed poll text = %q, want %q", edited.Text, want)
+	}
+	if edited.Keyboard != nil {
+		t.Error("closed poll still has vote buttons")
+	}
+
+	runMaxUpdates(b, mx, maxPollVote("cb1", "mid.1", 5, "0"))
+	if len(mx.Answers) != 1 || mx.Answers[0].Notification != "Опрос закрыт." {
+		t.Errorf("vote in closed poll answered %+v, want «Опрос закрыт.»", mx.Answers)
+	}
+	if votes := b.repo.CountPollVotes("mid.1"); len(votes) != 0 {
+		t.Errorf("votes = %v after closing, want none", votes)
+	}
+}
+
+func TestMaxPollCommand(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	pairChats(t, b.repo, -300, 200)
+	mx.Admins[200] = []maxschemes.ChatMember{{UserId: 5}}
+
+	runMaxUpdates(b, mx,
+		maxTextUpdate(200, 5, "Olga", "mid.a", "/poll Обед? | Пицца | Суши"),
+		maxTextUpdate(200, 5, "Olga", "mid.b", "/poll Обед? | Пицца"),
+		maxTextUpdate(200, 6, "Oleg", "mid.c", "/poll Ужин? | Паста | Рис"), // не админ
+	)
+
+	sent := tg.sent()
+	if len(sent) != 2 {
+		t.Fatalf("TG sent %d messages, want a poll in each bridged chat", len(sent))
+	}
+	for i, s := range sent {
+		if s.Method != "sendPoll" || s.Text != "[MAX] Olga: Обед?\nПицца\nСуши" {
+			t.Errorf("TG sent %+v, want native poll with attribution", s)
+		}
+		pollID := "poll." + strconv.Itoa(i+1)
+		if polls := b.repo.PollsByTgPoll(pollID); len(polls) != 1 || polls[0].TgChatID != s.ChatID || polls[0].MaxMsgID != "mid.1" {
+			t.Errorf("PollsByTgPoll(%s) = %+v, want the copy in %d", pollID, polls, s.ChatID)
+		}
+	}
+	msent := mx.sent()
+	if len(msent) != 3 || msent[0].Text != "📊 Обед?\n\nПицца — 0\nСуши — 0" || msent[0].Keyboard == nil {
+		t.Fatalf("MAX sent = %+v, want the poll with buttons, a usage reply and a refusal", msent)
+	}
+	if msent[2].Text != "Эта команда доступна только админам группы." {
+		t.Errorf("reply to non-admin = %q, want refusal", msent[2].Text)
+	}
+	if polls := b.repo.PollsByMaxMsg("mid.1"); len(polls) != 2 {
+		t.Errorf("PollsByMaxMsg = %+v, want a row per TG chat", polls)
+	}
+}
+
+func TestTogglePollVote(t *testing.T) {
+	tests := []struct {
+		name      string
+		votes     []int
+		idx       int
+		multiple  bool
+		want      []int
+		wantVoted bool
+	}{
+		{"first vote", nil, 1, false, []int{1}, true},
+		{"replace single", []int{0}, 1, false, []int{1}, true},
+		{"revoke single", []int{1}, 1, false, []int{}, false},
+		{"add multiple", []int{2}, 0, true, []int{0, 2}, true},
+		{"revoke multiple", []int{0, 2}, 2, true, []int{0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, voted := togglePollVote(tt.votes, tt.idx, tt.multiple)
+			if !slices.Equal(got, tt.want) || voted != tt.wantVoted {
+				t.Errorf("togglePollVote(%v, %d, %v) = %v, %v; want %v, %v", tt.votes, tt.idx, tt.multiple, got, voted, tt.want, tt.wantVoted)
+			}
+		})
+	}
+}
+
+func TestParsePollArgs(t *testing.T) {
+	tests := []struct {
+		args   string
+		want   []string
+		wantOK bool
+	}{
+		{" Обед? | Пицца | Суши ", []string{"Обед?", "Пицца", "Суши"}, true},
+		{"Обед? | Пицца || Суши |", []string{"Обед?", "Пицца", "Суши"}, true},
+		{"Обед? | Пицца", nil, false},
+		{"", nil, false},
+		{"Q | 1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 | 9 | 10 | 11", nil, false},
+	}
+	for _, tt := range tests {
+		q, opts, ok := parsePollArgs(tt.args)
+		if ok != tt.wantOK || (ok && !slices.Equal(append([]string{q}, opts...), tt.want)) {
+			t.Errorf("parsePollArgs(%q) = %q, %q, %v; want %q, %v", tt.args, q, opts, ok, tt.want, tt.wantOK)
+		}
+	}
+}
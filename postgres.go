@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"sync"
 	"time"
 
@@ -9,8 +10,9 @@ import (
 )
 
 type pgRepo struct {
-	db *sql.DB
-	mu sync.Mutex
+	db     *sql.DB
+	mu     *sync.Mutex // общий для всех арендаторов
+	tenant string      // tenant_id — запросы видят только данные своего арендатора
 }
 
 func NewPostgresRepo(dsn string) (Repository, error) {
@@ -26,27 +28,32 @@ func NewPostgresRepo(dsn string) (Repository, error) {
 		return nil, err
 	}
 
-	return &pgRepo{db: db}, nil
+	return &pgRepo{db: db, mu: &sync.Mutex{}}, nil
 }
 
-func (r *pgRepo) Register(key, platform string, chatID int64) (bool, string, error) {
+func (r *pgRepo) ForTenant(tenantID string) Repository {
+	return &pgRepo{db: r.db, mu: r.mu, tenant: tenantID}
+}
+
+func (r *pgRepo) Register(key, platform string, chatID int64, tgThreadID int) (bool, string, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if key == "" {
 		var existing string
-		err := r.db.QueryRow("SELECT key FROM pending WHERE platform = $1 AND chat_id = $2 AND command = 'bridge'", platform, chatID).Scan(&existing)
+		err := r.db.QueryRow("SELECT key FROM pending WHERE tenant_id = $4 AND platform = $1 AND chat_id = $2 AND tg_thread_id = $3 AND command = 'bridge'", platform, chatID, tgThreadID, r.tenant).Scan(&existing)
 		if err == nil {
 			return false, existing, nil
 		}
 		generated := genKey()
-		_, err = r.db.Exec("INSERT INTO pending (key, platform, chat_id, created_at, command) VALUES ($1, $2, $3, $4, 'bridge')", generated, platform, chatID, time.Now().Unix())
+		_, err = r.db.Exec("INSERT INTO pending (key, platform, chat_id, tg_thread_id, created_at, command, tenant_id) VALUES ($1, $2, $3, $4, $5, 'bridge', $6)", generated, platform, chatID, tgThreadID, time.Now().Unix(), r.tenant)
 		return false, generated, err
 	}
 
 	var peerPlatform string
 	var peerChatID int64
-	err := r.db.QueryRow("SELECT platform, chat_id FROM pending WHERE key = $1 AND command = 'bridge'", key).Scan(&peerPlatform, &peerChatID)
+	var peerThreadID int
+	err := r.db.QueryRow("SELECT platform, chat_id, tg_thread_id FROM pending WHERE tenant_id = $2 AND key = $1 AND command = 'bridge'", key, r.tenant).Scan(&peerPlatform, &peerChatID, &peerThreadID)
 	if err != nil {
 		return false, "", nil
 	}
@@ -54,157 +61,275 @@ func (r *pgRepo) Register(key, platform string, chatID int64) (bool, string, err
 		return false, "", nil
 	}
 
-	r.db.Exec("DELETE FROM pending WHERE key = $1", key)
+	r.db.Exec("DELETE FROM pending WHERE tenant_id = $2 AND key = $1", key, r.tenant)
 
 	var tgID, maxID int64
+	var threadID int
 	if platform == "tg" {
-		tgID, maxID = chatID, peerChatID
+		tgID, maxID, threadID = chatID, peerChatID, tgThreadID
 	} else {
-		tgID, maxID = peerChatID, chatID
+		tgID, maxID, threadID = peerChatID, chatID, peerThreadID
 	}
 
+	// Пара TG-чат ↔ MAX-чат живёт либо в pairs (весь чат), либо в topic_pairs (один топик)
+	if threadID != 0 {
+		r.db.Exec("DELETE FROM pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2", tgID, maxID, r.tenant)
+		_, err = r.db.Exec(
+			`INSERT INTO topic_pairs (tg_chat_id, tg_thread_id, max_chat_id, tenant_id) VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (tenant_id, tg_chat_id, max_chat_id) DO UPDATE SET tg_thread_id = EXCLUDED.tg_thread_id`,
+			tgID, threadID, maxID, r.tenant)
+		return true, "", err
+	}
+	r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2", tgID, maxID, r.tenant)
 	_, err = r.db.Exec(
-		"INSERT INTO pairs (tg_chat_id, max_chat_id) VALUES ($1, $2) ON CONFLICT (tg_chat_id, max_chat_id) DO NOTHING",
-		tgID, maxID)
+		"INSERT INTO pairs (tg_chat_id, max_chat_id, tenant_id) VALUES ($1, $2, $3) ON CONFLICT (tenant_id, tg_chat_id, max_chat_id) DO NOTHING",
+		tgID, maxID, r.tenant)
 	return true, "", err
 }
 
 func (r *pgRepo) MigrateTgChat(oldID, newID int64) error {
-	_, err := r.db.Exec("UPDATE pairs SET tg_chat_id = $1 WHERE tg_chat_id = $2", newID, oldID)
+	_, err := r.db.Exec("UPDATE pairs SET tg_chat_id = $1 WHERE tenant_id = $3 AND tg_chat_id = $2", newID, oldID, r.tenant)
 	if err == nil {
-		r.db.Exec("UPDATE messages SET tg_chat_id = $1 WHERE tg_chat_id = $2", newID, oldID)
+		r.db.Exec("UPDATE topic_pairs SET tg_chat_id = $1 WHERE tenant_id = $3 AND tg_chat_id = $2", newID, oldID, r.tenant)
+		r.db.Exec("UPDATE messages SET tg_chat_id = $1 WHERE tenant_id = $3 AND tg_chat_id = $2", newID, oldID, r.tenant)
+		r.db.Exec("UPDATE send_queue SET dst_chat_id = $1 WHERE tenant_id = $3 AND direction = 'max2tg' AND dst_chat_id = $2", newID, oldID, r.tenant)
+		r.db.Exec("UPDATE send_queue SET src_chat_id = $1 WHERE tenant_id = $3 AND direction = 'tg2max' AND src_chat_id = $2", newID, oldID, r.tenant)
+		r.db.Exec("UPDATE dead_letters SET dst_chat_id = $1 WHERE tenant_id = $3 AND direction = 'max2tg' AND dst_chat_id = $2", newID, oldID, r.tenant)
+		r.db.Exec("UPDATE dead_letters SET src_chat_id = $1 WHERE tenant_id = $3 AND direction = 'tg2max' AND src_chat_id = $2", newID, oldID, r.tenant)
 	}
 	return err
 }
 
-func (r *pgRepo) GetMaxChat(tgChatID int64) (int64, bool) {
-	var id int64
-	err := r.db.QueryRow("SELECT max_chat_id FROM pairs WHERE tg_chat_id = $1", tgChatID).Scan(&id)
-	return id, err == nil
+func (r *pgRepo) GetMaxChats(tgChatID int64, tgThreadID int) []int64 {
+	if tgThreadID != 0 {
+		ids := r.queryIDs("SELECT max_chat_id FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_thread_id = $2 ORDER BY max_chat_id", tgChatID, tgThreadID, r.tenant)
+		if len(ids) > 0 {
+			return ids
+		}
+	}
+	return r.queryIDs("SELECT max_chat_id FROM pairs WHERE tenant_id = $2 AND tg_chat_id = $1 ORDER BY max_chat_id", tgChatID, r.tenant)
 }
 
-func (r *pgRepo) GetTgChat(maxChatID int64) (int64, bool) {
-	var id int64
-	err := r.db.QueryRow("SELECT tg_chat_id FROM pairs WHERE max_chat_id = $1", maxChatID).Scan(&id)
-	return id, err == nil
+func (r *pgRepo) GetTgChats(maxChatID int64) []int64 {
+	return r.queryIDs(`SELECT tg_chat_id FROM pairs WHERE tenant_id = $2 AND max_chat_id = $1
+		UNION SELECT tg_chat_id FROM topic_pairs WHERE tenant_id = $2 AND max_chat_id = $1 ORDER BY tg_chat_id`, maxChatID, r.tenant)
+}
+
+func (r *pgRepo) queryIDs(query string, args ...any) []int64 {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 func (r *pgRepo) SaveMsg(tgChatID int64, tgMsgID int, maxChatID int64, maxMsgID string) {
 	r.db.Exec(
-		`INSERT INTO messages (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at)
-		 VALUES ($1, $2, $3, $4, $5)
-		 ON CONFLICT (tg_chat_id, tg_msg_id) DO UPDATE
-		 SET max_chat_id = EXCLUDED.max_chat_id, max_msg_id = EXCLUDED.max_msg_id, created_at = EXCLUDED.created_at`,
-		tgChatID, tgMsgID, maxChatID, maxMsgID, time.Now().Unix())
+		`INSERT INTO messages (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at, tenant_id)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (tenant_id, tg_chat_id, tg_msg_id, max_chat_id) DO UPDATE
+		 SET max_msg_id = EXCLUDED.max_msg_id, created_at = EXCLUDED.created_at`,
+		tgChatID, tgMsgID, maxChatID, maxMsgID, time.Now().Unix(), r.tenant)
 }
 
-func (r *pgRepo) LookupMaxMsgID(tgChatID int64, tgMsgID int) (string, bool) {
+func (r *pgRepo) LookupMaxMsgID(tgChatID int64, tgMsgID int, maxChatID int64) (string, bool) {
 	var id string
-	err := r.db.QueryRow("SELECT max_msg_id FROM messages WHERE tg_chat_id = $1 AND tg_msg_id = $2", tgChatID, tgMsgID).Scan(&id)
+	err := r.db.QueryRow("SELECT max_msg_id FROM messages WHERE tenant_id = $4 AND tg_chat_id = $1 AND tg_msg_id = $2 AND max_chat_id = $3", tgChatID, tgMsgID, maxChatID, r.tenant).Scan(&id)
 	return id, err == nil
 }
 
-func (r *pgRepo) LookupTgMsgID(maxMsgID string) (int64, int, bool) {
-	var chatID int64
+func (r *pgRepo) LookupTgMsgID(maxMsgID string, tgChatID int64) (int, bool) {
 	var msgID int
-	err := r.db.QueryRow("SELECT tg_chat_id, tg_msg_id FROM messages WHERE max_msg_id = $1", maxMsgID).Scan(&chatID, &msgID)
-	return chatID, msgID, err == nil
+	err := r.db.QueryRow("SELECT tg_msg_id FROM messages WHERE tenant_id = $3 AND max_msg_id = $1 AND tg_chat_id = $2", maxMsgID, tgChatID, r.tenant).Scan(&msgID)
+	return msgID, err == nil
+}
+
+func (r *pgRepo) LookupTgMsgIDs(maxMsgID string) []MsgLink {
+	rows, err := r.db.Query("SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id FROM messages WHERE tenant_id = $2 AND max_msg_id = $1 ORDER BY tg_chat_id, tg_msg_id", maxMsgID, r.tenant)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var links []MsgLink
+	for rows.Next() {
+		var l MsgLink
+		if rows.Scan(&l.TgChatID, &l.TgMsgID, &l.MaxChatID, &l.MaxMsgID) == nil {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+func (r *pgRepo) LookupMaxMsgIDs(tgChatID int64, tgMsgID int) []MsgLink {
+	rows, err := r.db.Query("SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id FROM messages WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_msg_id = $2 ORDER BY max_chat_id", tgChatID, tgMsgID, r.tenant)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var links []MsgLink
+	for rows.Next() {
+		var l MsgLink
+		if rows.Scan(&l.TgChatID, &l.TgMsgID, &l.MaxChatID, &l.MaxMsgID) == nil {
+			links = append(links, l)
+		}
+	}
+	return links
 }
 
 func (r *pgRepo) CleanOldMessages() {
-	r.db.Exec("DELETE FROM messages WHERE created_at < $1", time.Now().Unix()-48*3600)
-	r.db.Exec("DELETE FROM pending WHERE created_at > 0 AND created_at < $1", time.Now().Unix()-3600)
+	r.db.Exec("DELETE FROM messages WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+	r.db.Exec("DELETE FROM pending WHERE tenant_id = $2 AND created_at > 0 AND created_at < $1", time.Now().Unix()-3600, r.tenant)
+	r.db.Exec("DELETE FROM processed_updates WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+	r.db.Exec("DELETE FROM sent_messages WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+	r.db.Exec("DELETE FROM reactions WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+	r.db.Exec("DELETE FROM reaction_notes WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+	r.db.Exec("DELETE FROM polls WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-7*24*3600, r.tenant)
+	r.db.Exec("DELETE FROM poll_votes WHERE tenant_id = $1 AND max_msg_id NOT IN (SELECT max_msg_id FROM polls WHERE tenant_id = $1)", r.tenant)
+	r.db.Exec("DELETE FROM update_inbox WHERE tenant_id = $2 AND created_at < $1", time.Now().Unix()-48*3600, r.tenant)
+}
+
+// pairSetting читает колонку col связки tgChatID ↔ maxChatID. Пара есть не больше чем
+// в одной из таблиц, ORDER BY только закрепляет порядок: сначала связка топика.
+func (r *pgRepo) pairSetting(col string, tgChatID, maxChatID int64, dest any) error {
+	return r.db.QueryRow(`SELECT `+col+` FROM (
+		SELECT `+col+`, 0 AS ord FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2
+		UNION ALL SELECT `+col+`, 1 FROM pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2
+	) AS p ORDER BY ord LIMIT 1`, tgChatID, maxChatID, r.tenant).Scan(dest)
+}
+
+// setPairSetting меняет колонку col одной связки tgChatID ↔ maxChatID.
+func (r *pgRepo) setPairSetting(col string, tgChatID, maxChatID int64, v any) bool {
+	n := affected(r.db.Exec("UPDATE topic_pairs SET "+col+" = $1 WHERE tenant_id = $4 AND tg_chat_id = $2 AND max_chat_id = $3", v, tgChatID, maxChatID, r.tenant))
+	n += affected(r.db.Exec("UPDATE pairs SET "+col+" = $1 WHERE tenant_id = $4 AND tg_chat_id = $2 AND max_chat_id = $3", v, tgChatID, maxChatID, r.tenant))
+	return n > 0
 }
 
-func (r *pgRepo) HasPrefix(platform string, chatID int64) bool {
+func (r *pgRepo) HasPrefix(tgChatID, maxChatID int64) bool {
 	var v int
-	var err error
-	if platform == "tg" {
-		err = r.db.QueryRow("SELECT prefix FROM pairs WHERE tg_chat_id = $1", chatID).Scan(&v)
-	} else {
-		err = r.db.QueryRow("SELECT prefix FROM pairs WHERE max_chat_id = $1", chatID).Scan(&v)
-	}
-	if err != nil {
+	if r.pairSetting("prefix", tgChatID, maxChatID, &v) != nil {
 		return true
 	}
 	return v == 1
 }
 
-func (r *pgRepo) SetPrefix(platform string, chatID int64, on bool) bool {
+func (r *pgRepo) SetPrefix(tgChatID, maxChatID int64, on bool) bool {
 	v := 0
 	if on {
 		v = 1
 	}
-	var res sql.Result
-	if platform == "tg" {
-		res, _ = r.db.Exec("UPDATE pairs SET prefix = $1 WHERE tg_chat_id = $2", v, chatID)
-	} else {
-		res, _ = r.db.Exec("UPDATE pairs SET prefix = $1 WHERE max_chat_id = $2", v, chatID)
-	}
-	if res == nil {
-		return false
+	return r.setPairSetting("prefix", tgChatID, maxChatID, v)
+}
+
+func (r *pgRepo) GetPairDirection(tgChatID, maxChatID int64) string {
+	var dir string
+	if r.pairSetting("direction", tgChatID, maxChatID, &dir) != nil {
+		return "both"
 	}
-	n, _ := res.RowsAffected()
-	return n > 0
+	return dir
+}
+
+func (r *pgRepo) SetPairDirection(tgChatID, maxChatID int64, direction string) bool {
+	return r.setPairSetting("direction", tgChatID, maxChatID, direction)
+}
+
+func (r *pgRepo) GetPairFormat(tgChatID, maxChatID int64) string {
+	var format string
+	r.pairSetting("format", tgChatID, maxChatID, &format)
+	return format
+}
+
+func (r *pgRepo) SetPairFormat(tgChatID, maxChatID int64, format string) bool {
+	return r.setPairSetting("format", tgChatID, maxChatID, format)
 }
 
 func (r *pgRepo) Unpair(platform string, chatID int64) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	var res sql.Result
+	col := "max_chat_id"
 	if platform == "tg" {
-		res, _ = r.db.Exec("DELETE FROM pairs WHERE tg_chat_id = $1", chatID)
-	} else {
-		res, _ = r.db.Exec("DELETE FROM pairs WHERE max_chat_id = $1", chatID)
+		col = "tg_chat_id"
 	}
-	if res == nil {
-		return false
-	}
-	n, _ := res.RowsAffected()
+	n := affected(r.db.Exec("DELETE FROM pairs WHERE tenant_id = $2 AND "+col+" = $1", chatID, r.tenant))
+	n += affected(r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = $2 AND "+col+" = $1", chatID, r.tenant))
 	return n > 0
 }
 
-func (r *pgRepo) GetTgThreadID(tgChatID int64) int {
+func (r *pgRepo) UnpairTopic(tgChatID int64, threadID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return affected(r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_thread_id = $2", tgChatID, threadID, r.tenant)) > 0
+}
+
+func (r *pgRepo) GetTgThreadID(tgChatID, maxChatID int64) int {
 	var id int
-	r.db.QueryRow("SELECT COALESCE(tg_thread_id, 0) FROM pairs WHERE tg_chat_id = $1", tgChatID).Scan(&id)
+	err := r.db.QueryRow("SELECT tg_thread_id FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2", tgChatID, maxChatID, r.tenant).Scan(&id)
+	if err == nil {
+		return id
+	}
+	r.db.QueryRow("SELECT COALESCE(tg_thread_id, 0) FROM pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND max_chat_id = $2", tgChatID, maxChatID, r.tenant).Scan(&id)
 	return id
 }
 
 func (r *pgRepo) SetTgThreadID(tgChatID int64, threadID int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = $1 WHERE tg_chat_id = $2", threadID, tgChatID)
+	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = $1 WHERE tenant_id = $3 AND tg_chat_id = $2", threadID, tgChatID, r.tenant)
+	return err
+}
+
+func (r *pgRepo) ResetTgThread(tgChatID int64, threadID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = 0 WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_thread_id = $2", tgChatID, threadID, r.tenant)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO pairs (tenant_id, tg_chat_id, max_chat_id, prefix, direction, format)
+		SELECT tenant_id, tg_chat_id, max_chat_id, prefix, direction, format FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_thread_id = $2
+		ON CONFLICT (tenant_id, tg_chat_id, max_chat_id) DO NOTHING`, tgChatID, threadID, r.tenant)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = $3 AND tg_chat_id = $1 AND tg_thread_id = $2", tgChatID, threadID, r.tenant)
 	return err
 }
 
 func (r *pgRepo) PairCrosspost(tgChatID, maxChatID, ownerID, tgOwnerID int64) error {
 	_, err := r.db.Exec(
-		"INSERT INTO crossposts (tg_chat_id, max_chat_id, created_at, owner_id, tg_owner_id) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (tg_chat_id, max_chat_id) DO NOTHING",
-		tgChatID, maxChatID, time.Now().Unix(), ownerID, tgOwnerID)
+		"INSERT INTO crossposts (tg_chat_id, max_chat_id, created_at, owner_id, tg_owner_id, tenant_id) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (tenant_id, tg_chat_id, max_chat_id) DO NOTHING",
+		tgChatID, maxChatID, time.Now().Unix(), ownerID, tgOwnerID, r.tenant)
 	return err
 }
 
 func (r *pgRepo) GetCrosspostOwner(maxChatID int64) (maxOwner, tgOwner int64) {
-	r.db.QueryRow("SELECT owner_id, tg_owner_id FROM crossposts WHERE max_chat_id = $1 AND deleted_at = 0", maxChatID).Scan(&maxOwner, &tgOwner)
+	r.db.QueryRow("SELECT owner_id, tg_owner_id FROM crossposts WHERE tenant_id = $2 AND max_chat_id = $1 AND deleted_at = 0", maxChatID, r.tenant).Scan(&maxOwner, &tgOwner)
 	return
 }
 
 func (r *pgRepo) GetCrosspostMaxChat(tgChatID int64) (int64, string, bool) {
 	var id int64
 	var dir string
-	err := r.db.QueryRow("SELECT max_chat_id, direction FROM crossposts WHERE tg_chat_id = $1 AND deleted_at = 0", tgChatID).Scan(&id, &dir)
+	err := r.db.QueryRow("SELECT max_chat_id, direction FROM crossposts WHERE tenant_id = $2 AND tg_chat_id = $1 AND deleted_at = 0", tgChatID, r.tenant).Scan(&id, &dir)
 	return id, dir, err == nil
 }
 
 func (r *pgRepo) GetCrosspostTgChat(maxChatID int64) (int64, string, bool) {
 	var id int64
 	var dir string
-	err := r.db.QueryRow("SELECT tg_chat_id, direction FROM crossposts WHERE max_chat_id = $1 AND deleted_at = 0", maxChatID).Scan(&id, &dir)
+	err := r.db.QueryRow("SELECT tg_chat_id, direction FROM crossposts WHERE tenant_id = $2 AND max_chat_id = $1 AND deleted_at = 0", maxChatID, r.tenant).Scan(&id, &dir)
 	return id, dir, err == nil
 }
 
 func (r *pgRepo) ListCrossposts(ownerID int64) []CrosspostLink {
-	rows, err := r.db.Query("SELECT tg_chat_id, max_chat_id, direction FROM crossposts WHERE (owner_id = $1 OR tg_owner_id = $1 OR (owner_id = 0 AND tg_owner_id = 0)) AND deleted_at = 0", ownerID)
+	rows, err := r.db.Query("SELECT tg_chat_id, max_chat_id, direction FROM crossposts WHERE tenant_id = $2 AND (owner_id = $1 OR tg_owner_id = $1 OR (owner_id = 0 AND tg_owner_id = 0)) AND deleted_at = 0", ownerID, r.tenant)
 	if err != nil {
 		return nil
 	}
@@ -220,7 +345,7 @@ func (r *pgRepo) ListCrossposts(ownerID int64) []CrosspostLink {
 }
 
 func (r *pgRepo) SetCrosspostDirection(maxChatID int64, direction string) bool {
-	res, _ := r.db.Exec("UPDATE crossposts SET direction = $1 WHERE max_chat_id = $2 AND deleted_at = 0", direction, maxChatID)
+	res, _ := r.db.Exec("UPDATE crossposts SET direction = $1 WHERE tenant_id = $3 AND max_chat_id = $2 AND deleted_at = 0", direction, maxChatID, r.tenant)
 	if res == nil {
 		return false
 	}
@@ -231,8 +356,8 @@ func (r *pgRepo) SetCrosspostDirection(maxChatID int64, direction string) bool {
 func (r *pgRepo) UnpairCrosspost(maxChatID, deletedBy int64) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	res, _ := r.db.Exec("UPDATE crossposts SET deleted_at = $1, deleted_by = $2 WHERE max_chat_id = $3 AND deleted_at = 0",
-		time.Now().Unix(), deletedBy, maxChatID)
+	res, _ := r.db.Exec("UPDATE crossposts SET deleted_at = $1, deleted_by = $2 WHERE tenant_id = $4 AND max_chat_id = $3 AND deleted_at = 0",
+		time.Now().Unix(), deletedBy, maxChatID, r.tenant)
 	if res == nil {
 		return false
 	}
@@ -242,7 +367,7 @@ func (r *pgRepo) UnpairCrosspost(maxChatID, deletedBy int64) bool {
 
 func (r *pgRepo) GetCrosspostReplacements(maxChatID int64) CrosspostReplacements {
 	var raw string
-	r.db.QueryRow("SELECT replacements FROM crossposts WHERE max_chat_id = $1 AND deleted_at = 0", maxChatID).Scan(&raw)
+	r.db.QueryRow("SELECT replacements FROM crossposts WHERE tenant_id = $2 AND max_chat_id = $1 AND deleted_at = 0", maxChatID, r.tenant).Scan(&raw)
 	return parseCrosspostReplacements(raw)
 }
 
@@ -250,32 +375,32 @@ func (r *pgRepo) SetCrosspostReplacements(maxChatID int64, repl CrosspostReplace
 	data := marshalCrosspostReplacements(repl)
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE crossposts SET replacements = $1 WHERE max_chat_id = $2 AND deleted_at = 0", data, maxChatID)
+	_, err := r.db.Exec("UPDATE crossposts SET replacements = $1 WHERE tenant_id = $3 AND max_chat_id = $2 AND deleted_at = 0", data, maxChatID, r.tenant)
 	return err
 }
 
 func (r *pgRepo) GetCrosspostSyncEdits(maxChatID int64) bool {
 	var v bool
-	r.db.QueryRow("SELECT COALESCE(sync_edits, FALSE) FROM crossposts WHERE max_chat_id = $1 AND deleted_at = 0", maxChatID).Scan(&v)
+	r.db.QueryRow("SELECT COALESCE(sync_edits, FALSE) FROM crossposts WHERE tenant_id = $2 AND max_chat_id = $1 AND deleted_at = 0", maxChatID, r.tenant).Scan(&v)
 	return v
 }
 
 func (r *pgRepo) SetCrosspostSyncEdits(maxChatID int64, on bool) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE crossposts SET sync_edits = $1 WHERE max_chat_id = $2 AND deleted_at = 0", on, maxChatID)
+	_, err := r.db.Exec("UPDATE crossposts SET sync_edits = $1 WHERE tenant_id = $3 AND max_chat_id = $2 AND deleted_at = 0", on, maxChatID, r.tenant)
 	return err
 }
 
 func (r *pgRepo) TouchUser(userID int64, platform, username, firstName string) {
 	now := time.Now().Unix()
-	r.db.Exec(`INSERT INTO users (user_id, platform, username, first_name, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, $5)
-		ON CONFLICT(user_id) DO UPDATE SET username=EXCLUDED.username, first_name=EXCLUDED.first_name, last_seen=EXCLUDED.last_seen`,
-		userID, platform, username, firstName, now)
+	r.db.Exec(`INSERT INTO users (user_id, platform, username, first_name, first_seen, last_seen, tenant_id) VALUES ($1, $2, $3, $4, $5, $5, $6)
+		ON CONFLICT(tenant_id, user_id) DO UPDATE SET username=EXCLUDED.username, first_name=EXCLUDED.first_name, last_seen=EXCLUDED.last_seen`,
+		userID, platform, username, firstName, now, r.tenant)
 }
 
 func (r *pgRepo) ListUsers(platform string) ([]int64, error) {
-	rows, err := r.db.Query("SELECT user_id FROM users WHERE platform = $1", platform)
+	rows, err := r.db.Query("SELECT user_id FROM users WHERE tenant_id = $2 AND platform = $1", platform, r.tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -292,21 +417,24 @@ func (r *pgRepo) ListUsers(platform string) ([]int64, error) {
 
 func (r *pgRepo) EnqueueSend(item *QueueItem) error {
 	_, err := r.db.Exec(
-		`INSERT INTO send_queue (direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, attempts, created_at, next_retry)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 0, $12, $13)`,
+		`INSERT INTO send_queue (direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, payload, attempts, created_at, next_retry, last_error, history, tenant_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 0, $13, $14, $15, $16, $17)`,
 		item.Direction, item.SrcChatID, item.DstChatID, item.SrcMsgID,
 		item.Text, item.AttType, item.AttToken, item.ReplyTo, item.Format,
-		item.AttURL, item.ParseMode,
-		item.CreatedAt, item.NextRetry,
+		item.AttURL, item.ParseMode, item.Payload,
+		item.CreatedAt, item.NextRetry, item.LastError, enqueueHistory(item), r.tenant,
 	)
 	return err
 }
 
 func (r *pgRepo) PeekQueue(limit int) ([]QueueItem, error) {
+	// Элемент не берём, пока более ранний элемент того же чата ждёт своего ретрая — порядок сохраняется
 	rows, err := r.db.Query(
-		`SELECT id, direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, attempts, created_at, next_retry
-		 FROM send_queue WHERE next_retry <= $1 ORDER BY id ASC LIMIT $2`,
-		time.Now().Unix(), limit,
+		`SELECT id, direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, payload, attempts, created_at, next_retry, last_error
+		 FROM send_queue q WHERE tenant_id = $3 AND next_retry <= $1
+		   AND NOT EXISTS (SELECT 1 FROM send_queue p WHERE p.tenant_id = q.tenant_id AND p.direction = q.direction AND p.dst_chat_id = q.dst_chat_id AND p.id < q.id AND p.next_retry > $1)
+		 ORDER BY id ASC LIMIT $2`,
+		time.Now().Unix(), limit, r.tenant,
 	)
 	if err != nil {
 		return nil, err
@@ -317,8 +445,8 @@ func (r *pgRepo) PeekQueue(limit int) ([]QueueItem, error) {
 		var q QueueItem
 		if err := rows.Scan(&q.ID, &q.Direction, &q.SrcChatID, &q.DstChatID, &q.SrcMsgID,
 			&q.Text, &q.AttType, &q.AttToken, &q.ReplyTo, &q.Format,
-			&q.AttURL, &q.ParseMode,
-			&q.Attempts, &q.CreatedAt, &q.NextRetry); err != nil {
+			&q.AttURL, &q.ParseMode, &q.Payload,
+			&q.Attempts, &q.CreatedAt, &q.NextRetry, &q.LastError); err != nil {
 			return nil, err
 		}
 		items = append(items, q)
@@ -327,15 +455,327 @@ func (r *pgRepo) PeekQueue(limit int) ([]QueueItem, error) {
 }
 
 func (r *pgRepo) DeleteFromQueue(id int64) error {
-	_, err := r.db.Exec("DELETE FROM send_queue WHERE id = $1", id)
+	_, err := r.db.Exec("DELETE FROM send_queue WHERE tenant_id = $2 AND id = $1", id, r.tenant)
 	return err
 }
 
-func (r *pgRepo) IncrementAttempt(id int64, nextRetry int64) error {
-	_, err := r.db.Exec("UPDATE send_queue SET attempts = attempts + 1, next_retry = $1 WHERE id = $2", nextRetry, id)
+func (r *pgRepo) IncrementAttempt(id int64, nextRetry int64, errText string) error {
+	_, err := r.db.Exec("UPDATE send_queue SET attempts = attempts + 1, next_retry = $1, last_error = $2, history = history || $3::text WHERE tenant_id = $5 AND id = $4",
+		nextRetry, errText, queueHistoryLine(time.Now(), errText), id, r.tenant)
 	return err
 }
 
+func (r *pgRepo) CountQueue(platform string, chatID int64) int {
+	srcDir, dstDir := queueChatDirs(platform)
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM send_queue WHERE tenant_id = $4 AND ((direction = $1 AND src_chat_id = $2) OR (direction = $3 AND dst_chat_id = $2))",
+		srcDir, chatID, dstDir, r.tenant).Scan(&n)
+	return n
+}
+
+func (r *pgRepo) QueuedTo(direction string, dstChatID int64) bool {
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM send_queue WHERE tenant_id = $3 AND direction = $1 AND dst_chat_id = $2",
+		direction, dstChatID, r.tenant).Scan(&n)
+	return n > 0
+}
+
+func (r *pgRepo) QueueStats() (map[string]QueueStat, error) {
+	stats := make(map[string]QueueStat)
+	rows, err := r.db.Query("SELECT direction, COUNT(*), MIN(created_at) FROM send_queue WHERE tenant_id = $1 GROUP BY direction", r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanQueueStats(rows, stats, false); err != nil {
+		return nil, err
+	}
+	rows, err = r.db.Query("SELECT direction, COUNT(*), 0 FROM dead_letters WHERE tenant_id = $1 GROUP BY direction", r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanQueueStats(rows, stats, true); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *pgRepo) MoveToDeadLetters(id int64, reason, errText string) error {
+	var hist string
+	if errText != "" {
+		hist = queueHistoryLine(time.Now(), errText)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(
+		`INSERT INTO dead_letters (tenant_id, `+deadLetterCols+`, attempts, created_at, reason, last_error, history, dead_at)
+		 SELECT tenant_id, `+deadLetterCols+`, attempts, created_at, $1, COALESCE(NULLIF($2::text, ''), last_error), history || $3::text, $4
+		 FROM send_queue WHERE tenant_id = $6 AND id = $5`,
+		reason, errText, hist, time.Now().Unix(), id, r.tenant,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM send_queue WHERE tenant_id = $2 AND id = $1", id, r.tenant); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *pgRepo) ListDeadLetters(platform string, chatID int64, limit int) ([]DeadLetter, error) {
+	query := "SELECT id, " + deadLetterCols + ", attempts, created_at, reason, last_error, history, dead_at FROM dead_letters WHERE tenant_id = $1"
+	args := []any{r.tenant}
+	if platform != "" {
+		srcDir, dstDir := queueChatDirs(platform)
+		query += " AND ((direction = $2 AND src_chat_id = $3) OR (direction = $4 AND dst_chat_id = $3))"
+		args = append(args, srcDir, chatID, dstDir)
+	}
+	query += " ORDER BY id ASC"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeadLetters(rows)
+}
+
+func (r *pgRepo) GetDeadLetter(id int64) (DeadLetter, bool) {
+	rows, err := r.db.Query("SELECT id, "+deadLetterCols+", attempts, created_at, reason, last_error, history, dead_at FROM dead_letters WHERE tenant_id = $2 AND id = $1", id, r.tenant)
+	if err != nil {
+		return DeadLetter{}, false
+	}
+	items, err := scanDeadLetters(rows)
+	if err != nil || len(items) == 0 {
+		return DeadLetter{}, false
+	}
+	return items[0], true
+}
+
+func (r *pgRepo) RetryDeadLetter(id int64) (bool, error) {
+	now := time.Now().Unix()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`INSERT INTO send_queue (tenant_id, `+deadLetterCols+`, attempts, created_at, next_retry, last_error, history)
+		 SELECT tenant_id, `+deadLetterCols+`, 0, $1, $1, last_error, history FROM dead_letters WHERE tenant_id = $3 AND id = $2`,
+		now, id, r.tenant,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected(res, nil) == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM dead_letters WHERE tenant_id = $2 AND id = $1", id, r.tenant); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *pgRepo) PurgeDeadLetters(platform string, chatID int64) (int64, error) {
+	if platform == "" {
+		res, err := r.db.Exec("DELETE FROM dead_letters WHERE tenant_id = $1", r.tenant)
+		return affected(res, err), err
+	}
+	srcDir, dstDir := queueChatDirs(platform)
+	res, err := r.db.Exec("DELETE FROM dead_letters WHERE tenant_id = $4 AND ((direction = $1 AND src_chat_id = $2) OR (direction = $3 AND dst_chat_id = $2))",
+		srcDir, chatID, dstDir, r.tenant)
+	return affected(res, err), err
+}
+
+func (r *pgRepo) MarkUpdateProcessed(key UpdateKey) (bool, error) {
+	res, err := r.db.Exec(`INSERT INTO processed_updates (platform, chat_id, msg_id, kind, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING`, key.Platform, key.ChatID, key.MsgID, key.Kind, time.Now().Unix(), r.tenant)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *pgRepo) UpdateProcessed(key UpdateKey) (bool, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM processed_updates WHERE platform = $1 AND chat_id = $2 AND msg_id = $3 AND kind = $4 AND tenant_id = $5",
+		key.Platform, key.ChatID, key.MsgID, key.Kind, r.tenant).Scan(&n)
+	return n > 0, err
+}
+
+func (r *pgRepo) SetReactions(tgChatID int64, tgMsgID int, actorID int64, counts map[string]int) ([]ReactionCount, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM reactions WHERE tg_chat_id = $1 AND tg_msg_id = $2 AND actor_id = $3 AND tenant_id = $4", tgChatID, tgMsgID, actorID, r.tenant); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for emoji, n := range counts {
+		if n <= 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO reactions (tg_chat_id, tg_msg_id, actor_id, emoji, count, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			tgChatID, tgMsgID, actorID, emoji, n, now, r.tenant); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := tx.Query("SELECT emoji, SUM(count) AS n FROM reactions WHERE tg_chat_id = $1 AND tg_msg_id = $2 AND tenant_id = $3 GROUP BY emoji ORDER BY n DESC, emoji", tgChatID, tgMsgID, r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := scanReactionCounts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return summary, tx.Commit()
+}
+
+func (r *pgRepo) GetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64) string {
+	var mid string
+	r.db.QueryRow("SELECT max_msg_id FROM reaction_notes WHERE tg_chat_id = $1 AND tg_msg_id = $2 AND max_chat_id = $3 AND tenant_id = $4", tgChatID, tgMsgID, maxChatID, r.tenant).Scan(&mid)
+	return mid
+}
+
+func (r *pgRepo) SetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64, mid string) {
+	if mid == "" {
+		r.db.Exec("DELETE FROM reaction_notes WHERE tg_chat_id = $1 AND tg_msg_id = $2 AND max_chat_id = $3 AND tenant_id = $4", tgChatID, tgMsgID, maxChatID, r.tenant)
+		return
+	}
+	r.db.Exec(`INSERT INTO reaction_notes (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, tg_chat_id, tg_msg_id, max_chat_id) DO UPDATE SET max_msg_id = EXCLUDED.max_msg_id`,
+		tgChatID, tgMsgID, maxChatID, mid, time.Now().Unix(), r.tenant)
+}
+
+func (r *pgRepo) SavePoll(p BridgedPoll) error {
+	_, err := r.db.Exec(`INSERT INTO polls (max_chat_id, max_msg_id, tg_chat_id, tg_msg_id, tg_poll_id, title, options, multiple, closed, tg_counts, tg_note_id, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) ON CONFLICT DO NOTHING`,
+		p.MaxChatID, p.MaxMsgID, p.TgChatID, p.TgMsgID, p.TgPollID, p.Title, jsonText(p.Options), p.Multiple, p.Closed, jsonText(p.TgCounts), p.TgNoteID, time.Now().Unix(), r.tenant)
+	return err
+}
+
+func (r *pgRepo) PollsByMaxMsg(maxMsgID string) []BridgedPoll {
+	return scanPolls(r.db.Query("SELECT "+pollColumns+" FROM polls WHERE max_msg_id = $1 AND tenant_id = $2 ORDER BY tg_chat_id", maxMsgID, r.tenant))
+}
+
+func (r *pgRepo) PollsByTgPoll(tgPollID string) []BridgedPoll {
+	return scanPolls(r.db.Query("SELECT "+pollColumns+" FROM polls WHERE tg_poll_id = $1 AND tenant_id = $2 ORDER BY max_msg_id", tgPollID, r.tenant))
+}
+
+func (r *pgRepo) SetPollTgCounts(tgPollID string, counts []int, closed bool) error {
+	_, err := r.db.Exec("UPDATE polls SET tg_counts = $1, closed = $2 WHERE tg_poll_id = $3 AND tenant_id = $4", jsonText(counts), closed, tgPollID, r.tenant)
+	return err
+}
+
+func (r *pgRepo) SetPollTgNote(maxMsgID string, tgChatID int64, noteID int) error {
+	_, err := r.db.Exec("UPDATE polls SET tg_note_id = $1 WHERE max_msg_id = $2 AND tg_chat_id = $3 AND tenant_id = $4", noteID, maxMsgID, tgChatID, r.tenant)
+	return err
+}
+
+func (r *pgRepo) GetPollVotes(maxMsgID string, userID int64) []int {
+	rows, err := r.db.Query("SELECT option_idx FROM poll_votes WHERE max_msg_id = $1 AND user_id = $2 AND tenant_id = $3 ORDER BY option_idx", maxMsgID, userID, r.tenant)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []int
+	for rows.Next() {
+		var idx int
+		if rows.Scan(&idx) == nil {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+func (r *pgRepo) SetPollVotes(maxMsgID string, userID int64, options []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE max_msg_id = $1 AND user_id = $2 AND tenant_id = $3", maxMsgID, userID, r.tenant); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, idx := range options {
+		if _, err := tx.Exec("INSERT INTO poll_votes (max_msg_id, user_id, option_idx, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+			maxMsgID, userID, idx, now, r.tenant); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *pgRepo) CountPollVotes(maxMsgID string) map[int]int {
+	return scanPollVotes(r.db.Query("SELECT option_idx, COUNT(*) FROM poll_votes WHERE max_msg_id = $1 AND tenant_id = $2 GROUP BY option_idx", maxMsgID, r.tenant))
+}
+
+func (r *pgRepo) SaveSent(platform string, chatID int64, msgID string) {
+	r.db.Exec(`INSERT INTO sent_messages (platform, chat_id, msg_id, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`, platform, chatID, msgID, time.Now().Unix(), r.tenant)
+}
+
+func (r *pgRepo) IsSent(platform string, chatID int64, msgID string) bool {
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM sent_messages WHERE platform = $1 AND chat_id = $2 AND msg_id = $3 AND tenant_id = $4", platform, chatID, msgID, r.tenant).Scan(&n)
+	return n > 0
+}
+
+func (r *pgRepo) GetPollState(platform string) int64 {
+	var pos int64
+	r.db.QueryRow("SELECT position FROM poll_state WHERE tenant_id = $2 AND platform = $1", platform, r.tenant).Scan(&pos)
+	return pos
+}
+
+func (r *pgRepo) SetPollState(platform string, position int64) error {
+	_, err := r.db.Exec(`INSERT INTO poll_state (platform, position, updated_at, tenant_id) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, platform) DO UPDATE SET position = EXCLUDED.position, updated_at = EXCLUDED.updated_at`,
+		platform, position, time.Now().Unix(), r.tenant)
+	return err
+}
+
+func (r *pgRepo) PushInbox(platform string, body []byte) error {
+	_, err := r.db.Exec("INSERT INTO update_inbox (platform, body, created_at, tenant_id) VALUES ($1, $2, $3, $4)",
+		platform, string(body), time.Now().Unix(), r.tenant)
+	return err
+}
+
+func (r *pgRepo) PeekInbox(platform string, afterID int64, limit int) ([]InboxItem, error) {
+	rows, err := r.db.Query("SELECT id, body FROM update_inbox WHERE tenant_id = $4 AND platform = $1 AND id > $2 ORDER BY id LIMIT $3",
+		platform, afterID, limit, r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InboxItem
+	for rows.Next() {
+		var it InboxItem
+		var body string
+		if err := rows.Scan(&it.ID, &body); err != nil {
+			return nil, err
+		}
+		it.Body = []byte(body)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *pgRepo) DeleteInbox(id int64) error {
+	_, err := r.db.Exec("DELETE FROM update_inbox WHERE tenant_id = $2 AND id = $1", id, r.tenant)
+	return err
+}
+
+func (r *pgRepo) Ping() error {
+	return r.db.Ping()
+}
+
 func (r *pgRepo) Close() error {
 	return r.db.Close()
 }
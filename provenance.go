@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// Защита от петель по происхождению сообщения, а не по тексту: всё, что отправил
+// мост, записывается в sent_messages, а сообщения известных ботов-мостов
+// (BRIDGE_TG_BOTS / BRIDGE_MAX_BOTS) не пересылаются. Поэтому текст "[TG] ..." от
+// пользователя доходит, а выключенный префикс не открывает дорогу петле.
+
+// tgFromBridge проверяет, что сообщение TG отправил мост — этот или другой.
+func (b *Bridge) tgFromBridge(msg *TGMessage) bool {
+	if b.isSelfTgBot(msg.From) {
+		return true
+	}
+	if msg.From != nil && slices.Contains(b.conf().BridgeTgBots, msg.From.ID) {
+		return true
+	}
+	return b.repo.IsSent("tg", msg.Chat.ID, strconv.Itoa(msg.MessageID))
+}
+
+// maxFromBridge проверяет, что сообщение MAX отправил мост — этот или другой.
+func (b *Bridge) maxFromBridge(msg *maxschemes.Message) bool {
+	uid := msg.Sender.UserId
+	if uid == b.maxBotUID || slices.Contains(b.conf().BridgeMaxBots, uid) {
+		return true
+	}
+	return b.repo.IsSent("max", msg.Recipient.ChatId, msg.Body.Mid)
+}
+
+// --- TG ---
+
+// provenanceTGSender записывает ID отправленных в TG сообщений.
+type provenanceTGSender struct {
+	TGSender
+	repo Repository
+}
+
+func (s *provenanceTGSender) saveSent(chatID int64, id int, err error) (int, error) {
+	if err == nil {
+		s.repo.SaveSent("tg", chatID, strconv.Itoa(id))
+	}
+	return id, err
+}
+
+func (s *provenanceTGSender) SendMessage(ctx context.Context, chatID int64, text string, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendMessage(ctx, chatID, text, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendPhoto(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendPhoto(ctx, chatID, file, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendVideo(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendVideo(ctx, chatID, file, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendAudio(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendAudio(ctx, chatID, file, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendDocument(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendDocument(ctx, chatID, file, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendMediaGroup(ctx context.Context, chatID int64, media []TGInputMedia, opts *SendOpts) ([]int, error) {
+	ids, err := s.TGSender.SendMediaGroup(ctx, chatID, media, opts)
+	for _, id := range ids {
+		s.saveSent(chatID, id, err)
+	}
+	return ids, err
+}
+
+func (s *provenanceTGSender) SendLocation(ctx context.Context, chatID int64, loc TGLocation, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendLocation(ctx, chatID, loc, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendContact(ctx context.Context, chatID int64, contact TGContact, opts *SendOpts) (int, error) {
+	id, err := s.TGSender.SendContact(ctx, chatID, contact, opts)
+	return s.saveSent(chatID, id, err)
+}
+
+func (s *provenanceTGSender) SendPoll(ctx context.Context, chatID int64, question string, options []string, multiple bool, opts *SendOpts) (int, string, error) {
+	id, pollID, err := s.TGSender.SendPoll(ctx, chatID, question, options, multiple, opts)
+	id, err = s.saveSent(chatID, id, err)
+	return id, pollID, err
+}
+
+// --- MAX ---
+
+// provenanceMAXSender записывает mid отправленных в MAX сообщений.
+type provenanceMAXSender struct {
+	MAXSender
+	repo Repository
+}
+
+func (s *provenanceMAXSender) SendMessage(ctx context.Context, msg *MaxMessage) (string, error) {
+	mid, err := s.MAXSender.SendMessage(ctx, msg)
+	if err == nil && mid != "" {
+		s.repo.SaveSent("max", msg.ChatID, mid)
+	}
+	return mid, err
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
 
 const (
@@ -29,43 +33,82 @@ func retryDelay(attempt int) time.Duration {
 	}
 }
 
-// enqueueTg2Max ставит сообщение TG→MAX в очередь.
-func (b *Bridge) enqueueTg2Max(tgChatID int64, tgMsgID int, maxChatID int64, text, attType, attToken, replyTo, format string) {
-	now := time.Now().Unix()
+// nextRetryAt возвращает время следующей попытки: при 429 — не раньше retry_after из ответа API.
+// Без ошибки (сообщение встало в очередь за более ранними) — сразу.
+func nextRetryAt(now time.Time, attempt int, err error) time.Time {
+	if err == nil {
+		return now
+	}
+	delay := retryDelay(attempt)
+	if errKind(err) == ErrRateLimited {
+		if ra := errRetryAfter(err); ra > delay {
+			delay = ra
+		}
+	}
+	return now.Add(delay)
+}
+
+// queueTg2Max ставит TG→MAX сообщение (или альбом) в очередь после временной ошибки err
+// и предупреждает TG-чат, если MAX-чат только что заблокирован circuit breaker'ом.
+func (b *Bridge) queueTg2Max(ctx context.Context, tgChatID, maxChatID int64, payload tg2maxPayload, err error) {
+	b.enqueueTg2Max(tgChatID, maxChatID, payload, err)
+	if b.cbFail(maxChatID, err) {
+		b.tg.SendMessage(ctx, tgChatID,
+			"MAX API недоступен. Сообщения в очереди, будут доставлены автоматически.", nil)
+	}
+}
+
+// enqueueTg2Max ставит сообщение TG→MAX в очередь. Хранится исходное сообщение:
+// медиа заново загружается по file_id при ретрае (токены загрузки MAX протухают).
+func (b *Bridge) enqueueTg2Max(tgChatID, maxChatID int64, payload tg2maxPayload, sendErr error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("enqueue: encode payload failed", "err", err)
+		return
+	}
+	first := payload.Messages[0]
+	now := time.Now()
 	item := &QueueItem{
 		Direction: "tg2max",
 		SrcChatID: tgChatID,
 		DstChatID: maxChatID,
-		SrcMsgID:  strconv.Itoa(tgMsgID),
-		Text:      text,
-		AttType:   attType,
-		AttToken:  attToken,
-		ReplyTo:   replyTo,
-		Format:    format,
-		CreatedAt: now,
-		NextRetry: now + int64(retryDelay(0).Seconds()),
+		SrcMsgID:  strconv.Itoa(first.Msg.MessageID),
+		Text:      first.Caption,
+		Payload:   string(data),
+		CreatedAt: now.Unix(),
+		NextRetry: nextRetryAt(now, 0, sendErr).Unix(),
+		LastError: errText(sendErr),
 	}
 	if err := b.repo.EnqueueSend(item); err != nil {
 		slog.Error("enqueue failed", "err", err)
 	} else {
-		slog.Info("enqueued for retry", "dir", "tg2max", "dst", maxChatID)
+		slog.Info("enqueued for retry", "dir", "tg2max", "dst", maxChatID, "messages", len(payload.Messages))
 	}
 }
 
-// enqueueMax2Tg ставит сообщение MAX→TG в очередь.
-func (b *Bridge) enqueueMax2Tg(maxChatID, tgChatID int64, maxMid, text, attType, attURL, parseMode string) {
-	now := time.Now().Unix()
+// enqueueMax2Tg ставит сообщение MAX→TG в очередь вместе с полным списком вложений.
+func (b *Bridge) enqueueMax2Tg(msgUpd *maxschemes.MessageCreatedUpdate, tgChatID int64, caption string, sendErr error) {
+	upd, err := encodeMaxUpdate(msgUpd)
+	if err != nil {
+		slog.Error("enqueue: encode payload failed", "err", err)
+		return
+	}
+	data, err := json.Marshal(max2tgPayload{Update: upd, Caption: caption})
+	if err != nil {
+		slog.Error("enqueue: encode payload failed", "err", err)
+		return
+	}
+	now := time.Now()
 	item := &QueueItem{
 		Direction: "max2tg",
-		SrcChatID: maxChatID,
+		SrcChatID: msgUpd.Message.Recipient.ChatId,
 		DstChatID: tgChatID,
-		SrcMsgID:  maxMid,
-		Text:      text,
-		AttType:   attType,
-		AttURL:    attURL,
-		ParseMode: parseMode,
-		CreatedAt: now,
-		NextRetry: now + int64(retryDelay(0).Seconds()),
+		SrcMsgID:  msgUpd.Message.Body.Mid,
+		Text:      caption,
+		Payload:   string(data),
+		CreatedAt: now.Unix(),
+		NextRetry: nextRetryAt(now, 0, sendErr).Unix(),
+		LastError: errText(sendErr),
 	}
 	if err := b.repo.EnqueueSend(item); err != nil {
 		slog.Error("enqueue failed", "err", err)
@@ -83,54 +126,159 @@ func (b *Bridge) processQueue(ctx context.Context) {
 	}
 
 	now := time.Now()
+
+	// Ретраи идут через те же воркеры чатов, что и живые сообщения. Если элемент
+	// не доставлен, следующие элементы того же чата ждут следующего прохода —
+	// иначе они обогнали бы его.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	blocked := make(map[string]bool)
 	for _, item := range items {
-		// Слишком старое или слишком много попыток — дропаем
+		// Слишком старое или слишком много попыток — в dead letters, источник предупреждаем
 		age := now.Sub(time.Unix(item.CreatedAt, 0))
 		if item.Attempts >= queueMaxAttempts || age > queueMaxAge {
 			slog.Warn("queue item expired", "id", item.ID, "dir", item.Direction, "attempts", item.Attempts, "age", age)
-			b.repo.DeleteFromQueue(item.ID)
-			if item.Direction == "tg2max" {
-				b.tg.SendMessage(ctx, item.SrcChatID, fmt.Sprintf("Сообщение не доставлено в MAX после %d попыток.", item.Attempts), nil)
+			b.deadLetter(item, "expired", nil)
+			switch item.Direction {
+			case "tg2max":
+				b.tg.SendMessage(ctx, item.SrcChatID, fmt.Sprintf("Сообщение не доставлено в MAX после %d попыток. Админ может повторить отправку: /queue", item.Attempts), nil)
+			case "max2tg":
+				b.max.SendMessage(ctx, &MaxMessage{ChatID: item.SrcChatID, Text: fmt.Sprintf("Сообщение не доставлено в Telegram после %d попыток. Админ может повторить отправку: /queue", item.Attempts)})
 			}
 			continue
 		}
 
+		var key string
+		var process func(context.Context, QueueItem, time.Time) bool
 		switch item.Direction {
 		case "tg2max":
-			b.processQueueTg2Max(ctx, item, now)
+			key, process = maxDeliveryKey(item.DstChatID), b.processQueueTg2Max
 		case "max2tg":
-			b.processQueueMax2Tg(ctx, item, now)
+			key, process = tgDeliveryKey(item.DstChatID), b.processQueueMax2Tg
+		default:
+			continue
 		}
+		wg.Add(1)
+		b.deliver.Submit(key, func() {
+			defer wg.Done()
+			mu.Lock()
+			skip := blocked[key]
+			mu.Unlock()
+			if skip {
+				return
+			}
+			if !process(ctx, item, now) {
+				mu.Lock()
+				blocked[key] = true
+				mu.Unlock()
+			}
+		})
 	}
+	// Ждём проход целиком, чтобы следующий тик не взял те же элементы повторно
+	wg.Wait()
 }
 
-func (b *Bridge) processQueueTg2Max(ctx context.Context, item QueueItem, now time.Time) {
+// processQueueTg2Max повторяет отправку в MAX. Возвращает true, если элемент покинул очередь
+// (доставлен или отброшен).
+func (b *Bridge) processQueueTg2Max(ctx context.Context, item QueueItem, now time.Time) bool {
+	if item.Payload == "" {
+		return b.processLegacyTg2Max(ctx, item, now)
+	}
+	var p tg2maxPayload
+	if err := json.Unmarshal([]byte(item.Payload), &p); err != nil || len(p.Messages) == 0 {
+		if err == nil {
+			err = errors.New("empty payload")
+		}
+		b.deadLetter(item, "bad_payload", err)
+		return true
+	}
+
+	// Сообщение собирается заново: file_id → свежая загрузка, reply ищется по текущему маппингу
+	var err error
+	if p.Album {
+		items := make([]mediaGroupItem, 0, len(p.Messages))
+		for _, m := range p.Messages {
+			it := newMediaGroupItem(m.Msg, m.Caption)
+			it.crosspost = p.Crosspost
+			if p.Crosspost {
+				it.maxChatID = item.DstChatID
+			}
+			items = append(items, it)
+		}
+		err = b.sendMediaGroupToMax(ctx, items, item.DstChatID)
+	} else {
+		err = b.sendTgToMax(ctx, p.Messages[0].Msg, item.DstChatID, p.Messages[0].Caption)
+	}
+	if isUndeliverable(err) {
+		b.deadLetter(item, "permanent", err)
+		return true
+	}
+	if err != nil {
+		b.retryLater(item, now, err)
+		return false
+	}
+	slog.Info("queue retry ok", "id", item.ID, "dir", "tg2max")
+	b.repo.DeleteFromQueue(item.ID)
+	return true
+}
+
+// processLegacyTg2Max повторяет элемент старого формата (готовый текст и токен вложения).
+func (b *Bridge) processLegacyTg2Max(ctx context.Context, item QueueItem, now time.Time) bool {
 	mid, err := b.sendMaxDirectFormatted(ctx, item.DstChatID, item.Text, item.AttType, item.AttToken, item.ReplyTo, item.Format)
 	if err != nil {
-		errStr := err.Error()
-		// Permanent errors — дропаем
-		if strings.Contains(errStr, "403") || strings.Contains(errStr, "404") || strings.Contains(errStr, "chat.denied") {
-			slog.Warn("queue item dropped (permanent error)", "id", item.ID, "err", errStr)
-			b.repo.DeleteFromQueue(item.ID)
-			return
+		if errKind(err) == ErrPermanent {
+			b.deadLetter(item, "permanent", err)
+			return true
 		}
-		slog.Warn("queue retry failed", "id", item.ID, "dir", "tg2max", "attempt", item.Attempts+1, "err", err)
-		b.repo.IncrementAttempt(item.ID, now.Add(retryDelay(item.Attempts+1)).Unix())
-		return
+		b.retryLater(item, now, err)
+		return false
 	}
 	slog.Info("queue retry ok", "id", item.ID, "dir", "tg2max", "mid", mid)
 	tgMsgID, _ := strconv.Atoi(item.SrcMsgID)
 	if tgMsgID > 0 {
 		b.repo.SaveMsg(item.SrcChatID, tgMsgID, item.DstChatID, mid)
 	}
+	b.metricForward("tg2max", legacyQueueMsgType(item), item.SrcChatID, item.DstChatID)
 	b.repo.DeleteFromQueue(item.ID)
+	return true
 }
 
-func (b *Bridge) processQueueMax2Tg(ctx context.Context, item QueueItem, now time.Time) {
+// processQueueMax2Tg повторяет отправку в TG. Возвращает true, если элемент покинул очередь.
+func (b *Bridge) processQueueMax2Tg(ctx context.Context, item QueueItem, now time.Time) bool {
+	if item.Payload == "" {
+		return b.processLegacyMax2Tg(ctx, item, now)
+	}
+	var p max2tgPayload
+	var msgUpd *maxschemes.MessageCreatedUpdate
+	err := json.Unmarshal([]byte(item.Payload), &p)
+	if err == nil {
+		msgUpd, err = decodeMaxUpdate(p.Update)
+	}
+	if err != nil {
+		b.deadLetter(item, "bad_payload", err)
+		return true
+	}
+
+	// Все вложения, подпись с форматированием и reply собираются заново
+	if err := b.sendMaxToTg(ctx, msgUpd, item.DstChatID, p.Caption); err != nil {
+		if isUndeliverable(err) {
+			b.deadLetter(item, "permanent", err)
+			return true
+		}
+		b.retryLater(item, now, err)
+		return false
+	}
+	slog.Info("queue retry ok", "id", item.ID, "dir", "max2tg")
+	b.repo.DeleteFromQueue(item.ID)
+	return true
+}
+
+// processLegacyMax2Tg повторяет элемент старого формата (готовый текст и URL одного вложения).
+func (b *Bridge) processLegacyMax2Tg(ctx context.Context, item QueueItem, now time.Time) bool {
 	var sentMsgID int
 	var err error
 
-	threadID := b.repo.GetTgThreadID(item.DstChatID)
+	threadID := b.repo.GetTgThreadID(item.DstChatID, item.SrcChatID)
 
 	if item.AttType != "" && item.AttURL != "" {
 		opts := &SendOpts{Caption: item.Text, ParseMode: item.ParseMode, ThreadID: threadID}
@@ -151,26 +299,165 @@ func (b *Bridge) processQueueMax2Tg(ctx context.Context, item QueueItem, now tim
 	}
 
 	if err != nil {
-		errStr := err.Error()
-		// Топики выключены — сбрасываем и повторяем без thread_id
-		if threadID != 0 && (strings.Contains(errStr, "message thread not found") ||
-			strings.Contains(errStr, "TOPIC_NOT_FOUND") ||
-			strings.Contains(errStr, "topics are disabled")) {
+		switch kind := errKind(err); {
+		case kind == ErrTopicGone && threadID != 0:
+			// Топики выключены — сбрасываем и повторяем без thread_id
 			slog.Info("queue: forum topics disabled, resetting thread_id", "tgChat", item.DstChatID)
-			b.repo.SetTgThreadID(item.DstChatID, 0)
-			b.repo.IncrementAttempt(item.ID, now.Unix()) // retry immediately
-			return
-		}
-		if strings.Contains(errStr, "TOPIC_CLOSED") || strings.Contains(errStr, "403") || strings.Contains(errStr, "chat not found") {
-			slog.Warn("queue item dropped (permanent error)", "id", item.ID, "dir", "max2tg", "err", errStr)
-			b.repo.DeleteFromQueue(item.ID)
-			return
+			b.repo.ResetTgThread(item.DstChatID, threadID)
+			b.repo.IncrementAttempt(item.ID, now.Unix(), err.Error()) // retry immediately
+			return false
+		case kind == ErrChatMigrated:
+			// Группа стала супергруппой — переносим связку (вместе с очередью) и повторяем
+			var tgErr *TGError
+			if errors.As(err, &tgErr) && tgErr.MigrateToChatID != 0 {
+				if mErr := b.repo.MigrateTgChat(item.DstChatID, tgErr.MigrateToChatID); mErr == nil {
+					slog.Info("queue: TG chat migrated", "old", item.DstChatID, "new", tgErr.MigrateToChatID)
+					b.repo.IncrementAttempt(item.ID, now.Unix(), err.Error())
+					return false
+				}
+			}
+			b.deadLetter(item, "permanent", err)
+			return true
+		case kind == ErrPermanent || kind == ErrTopicClosed || kind == ErrTopicGone:
+			b.deadLetter(item, "permanent", err)
+			return true
 		}
-		slog.Warn("queue retry failed", "id", item.ID, "dir", "max2tg", "attempt", item.Attempts+1, "err", err)
-		b.repo.IncrementAttempt(item.ID, now.Add(retryDelay(item.Attempts+1)).Unix())
-		return
+		b.retryLater(item, now, err)
+		return false
 	}
 	slog.Info("queue retry ok", "id", item.ID, "dir", "max2tg", "msgID", sentMsgID)
 	b.repo.SaveMsg(item.DstChatID, sentMsgID, item.SrcChatID, item.SrcMsgID)
+	b.metricForward("max2tg", legacyQueueMsgType(item), item.DstChatID, item.SrcChatID)
 	b.repo.DeleteFromQueue(item.ID)
+	return true
+}
+
+// retryLater записывает неудачную попытку и откладывает элемент до следующего ретрая.
+func (b *Bridge) retryLater(item QueueItem, now time.Time, err error) {
+	slog.Warn("queue retry failed", "id", item.ID, "dir", item.Direction, "attempt", item.Attempts+1, "kind", errKind(err), "err", err)
+	b.repo.IncrementAttempt(item.ID, nextRetryAt(now, item.Attempts+1, err).Unix(), err.Error())
+}
+
+// deadLetter переносит элемент в dead_letters: доставка прекращена, но сообщение
+// не теряется — админ может вернуть его в очередь (/queue retry).
+func (b *Bridge) deadLetter(item QueueItem, reason string, err error) {
+	slog.Warn("queue item dead-lettered", "id", item.ID, "dir", item.Direction, "reason", reason, "attempts", item.Attempts, "err", err)
+	if mErr := b.repo.MoveToDeadLetters(item.ID, reason, errText(err)); mErr != nil {
+		slog.Error("move to dead letters failed", "id", item.ID, "err", mErr)
+	}
+}
+
+func errText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// --- Payload ---
+
+// tgQueuedMsg — исходное TG-сообщение в очереди и подпись, с которой оно пересылалось.
+type tgQueuedMsg struct {
+	Msg     *TGMessage `json:"msg"`
+	Caption string     `json:"caption"`
+}
+
+// tg2maxPayload — TG→MAX элемент очереди: одно сообщение или альбом целиком.
+type tg2maxPayload struct {
+	Messages  []tgQueuedMsg `json:"messages"`
+	Album     bool          `json:"album,omitempty"`
+	Crosspost bool          `json:"crosspost,omitempty"`
+}
+
+// max2tgPayload — MAX→TG элемент очереди: исходный апдейт со всеми вложениями.
+type max2tgPayload struct {
+	Update  json.RawMessage `json:"update"`
+	Caption string          `json:"caption"`
+}
+
+// encodeMaxUpdate сериализует апдейт: вложения (interface{}) кладутся в RawAttachments,
+// чтобы decodeMaxUpdate мог восстановить их типы.
+func encodeMaxUpdate(msgUpd *maxschemes.MessageCreatedUpdate) (json.RawMessage, error) {
+	upd := *msgUpd
+	raw, err := rawAttachments(upd.Message.Body.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	upd.Message.Body.RawAttachments, upd.Message.Body.Attachments = raw, nil
+	if upd.Message.Link != nil {
+		link := *upd.Message.Link
+		if link.Message.RawAttachments, err = rawAttachments(link.Message.Attachments); err != nil {
+			return nil, err
+		}
+		link.Message.Attachments = nil
+		upd.Message.Link = &link
+	}
+	return json.Marshal(upd)
+}
+
+func rawAttachments(atts []interface{}) ([]json.RawMessage, error) {
+	var out []json.RawMessage
+	for _, a := range atts {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+// decodeMaxUpdate восстанавливает апдейт, сохранённый encodeMaxUpdate.
+func decodeMaxUpdate(data json.RawMessage) (*maxschemes.MessageCreatedUpdate, error) {
+	var upd maxschemes.MessageCreatedUpdate
+	if err := json.Unmarshal(data, &upd); err != nil {
+		return nil, err
+	}
+	var err error
+	if upd.Message.Body.Attachments, err = parseMaxAttachments(upd.Message.Body.RawAttachments); err != nil {
+		return nil, err
+	}
+	if upd.Message.Link != nil {
+		if upd.Message.Link.Message.Attachments, err = parseMaxAttachments(upd.Message.Link.Message.RawAttachments); err != nil {
+			return nil, err
+		}
+	}
+	return &upd, nil
+}
+
+// parseMaxAttachments превращает сырые вложения в типы SDK (как это делает сам SDK при получении апдейта).
+func parseMaxAttachments(raw []json.RawMessage) ([]interface{}, error) {
+	var out []interface{}
+	for _, data := range raw {
+		var base maxschemes.Attachment
+		if err := json.Unmarshal(data, &base); err != nil {
+			return nil, err
+		}
+		var att interface{}
+		switch base.Type {
+		case maxschemes.AttachmentImage:
+			att = new(maxschemes.PhotoAttachment)
+		case maxschemes.AttachmentVideo:
+			att = new(maxschemes.VideoAttachment)
+		case maxschemes.AttachmentAudio:
+			att = new(maxschemes.AudioAttachment)
+		case maxschemes.AttachmentFile:
+			att = new(maxschemes.FileAttachment)
+		case maxschemes.AttachmentSticker:
+			att = new(maxschemes.StickerAttachment)
+		case maxschemes.AttachmentContact:
+			att = new(maxschemes.ContactAttachment)
+		case maxschemes.AttachmentLocation:
+			att = new(maxschemes.LocationAttachment)
+		case maxschemes.AttachmentShare:
+			att = new(maxschemes.ShareAttachment)
+		default:
+			att = &base
+		}
+		if err := json.Unmarshal(data, att); err != nil {
+			return nil, err
+		}
+		out = append(out, att)
+	}
+	return out, nil
 }
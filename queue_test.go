@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+// retryQueueNow делает все элементы очереди готовыми к ретраю и прогоняет очередь.
+func retryQueueNow(t *testing.T, b *Bridge) {
+	t.Helper()
+	b.repo.(*sqliteRepo).db.Exec("UPDATE send_queue SET next_retry = 0")
+	b.processQueue(context.Background())
+}
+
+func queueLen(b *Bridge) int {
+	var n int
+	b.repo.(*sqliteRepo).db.QueryRow("SELECT COUNT(*) FROM send_queue").Scan(&n)
+	return n
+}
+
+func TestQueue_Tg2MaxRebuildsPhotoAndReply(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	msg := &TGMessage{
+		MessageID:      7,
+		Chat:           ChatInfo{ID: -100, Type: "group"},
+		From:           &UserInfo{ID: 1, FirstName: "Ivan"},
+		Photo:          []PhotoSize{{FileID: "small"}, {FileID: "big"}},
+		Caption:        "фото",
+		ReplyToMessage: &TGMessage{MessageID: 5},
+	}
+	mx.SendErr = errors.New("connection reset")
+	b.forwardTgToMax(context.Background(), msg, 200, formatTgCaption(msg, false, false))
+	if n := queueLen(b); n != 1 {
+		t.Fatalf("queue has %d items, want 1", n)
+	}
+
+	// К моменту ретрая оригинал reply уже доставлен — ссылка должна найтись
+	mx.SendErr = nil
+	b.repo.SaveMsg(-100, 5, 200, "mid.orig")
+	retryQueueNow(t, b)
+
+	sent := mx.sent()
+	if len(sent) != 1 {
+		t.Fatalf("MAX sent %d messages, want 1", len(sent))
+	}
+	if len(sent[0].Attachments) != 1 || sent[0].ReplyTo != "mid.orig" {
+		t.Errorf("retried message = %+v, want photo re-uploaded and reply to mid.orig", sent[0])
+	}
+	if _, ok := b.repo.LookupMaxMsgID(-100, 7, 200); !ok {
+		t.Error("mapping not saved after retry")
+	}
+	if n := queueLen(b); n != 0 {
+		t.Errorf("queue has %d items after retry, want 0", n)
+	}
+}
+
+func TestQueue_Tg2MaxAlbumQueuedWhole(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	var items []mediaGroupItem
+	for i, fileID := range []string{"p1", "p2", "p3"} {
+		msg := &TGMessage{
+			MessageID:    10 + i,
+			Chat:         ChatInfo{ID: -100, Type: "group"},
+			From:         &UserInfo{ID: 1, FirstName: "Ivan"},
+			Photo:        []PhotoSize{{FileID: fileID}},
+			MediaGroupID: "album",
+		}
+		items = append(items, newMediaGroupItem(msg, ""))
+	}
+	mx.SendErr = errors.New("connection reset")
+	if err := b.sendMediaGroupToMax(context.Background(), items, 200); err == nil {
+		t.Fatal("sendMediaGroupToMax: want error")
+	}
+	b.queueTg2Max(context.Background(), -100, 200, mediaGroupPayload(items), mx.SendErr)
+
+	mx.SendErr = nil
+	retryQueueNow(t, b)
+
+	sent := mx.sent()
+	if len(sent) != 1 || len(sent[0].Attachments) != 3 {
+		t.Fatalf("MAX sent = %+v, want one album with 3 photos", sent)
+	}
+}
+
+func TestQueue_Tg2MaxVideoAlbumQueued(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	video := func(id int, fileID string) TGUpdate {
+		return TGUpdate{Message: &TGMessage{
+			MessageID:    id,
+			Chat:         ChatInfo{ID: -100, Type: "group"},
+			From:         &UserInfo{ID: 1, FirstName: "Ivan"},
+			Video:        &FileInfo{FileID: fileID},
+			MediaGroupID: "album",
+		}}
+	}
+	// Файлы с tg.invalid не скачиваются: загрузка видео падает, альбом ждёт ретрая
+	runTgUpdates(b, tg, video(1, "v1"), video(2, "v2"))
+
+	if n := queueLen(b); n != 1 {
+		t.Errorf("queue has %d items, want the album", n)
+	}
+	if len(mx.sent()) != 0 {
+		t.Errorf("MAX sent = %+v, want nothing", mx.sent())
+	}
+}
+
+func TestQueue_Max2TgRebuildsAllAttachments(t *testing.T) {
+	b, tg, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	upd := maxTextUpdate(200, 5, "Olga", "mid.src", "два фото")
+	for _, url := range []string{"https://cdn.invalid/1.jpg", "https://cdn.invalid/2.jpg"} {
+		upd.Message.Body.Attachments = append(upd.Message.Body.Attachments, &maxschemes.PhotoAttachment{
+			Attachment: maxschemes.Attachment{Type: maxschemes.AttachmentImage},
+			Payload:    maxschemes.PhotoAttachmentPayload{Url: url},
+		})
+	}
+	tg.SendErr = errors.New("connection reset")
+	b.forwardMaxToTg(context.Background(), upd, -100, formatMaxCaption(upd, false, false))
+	if n := queueLen(b); n != 1 {
+		t.Fatalf("queue has %d items, want 1", n)
+	}
+
+	tg.SendErr = nil
+	retryQueueNow(t, b)
+
+	var album []fakeTgSent
+	for _, s := range tg.sent() {
+		if s.Method == "sendMediaGroup" {
+			album = append(album, s)
+		}
+	}
+	if len(album) != 2 || album[0].File.URL != "https://cdn.invalid/1.jpg" || album[1].File.URL != "https://cdn.invalid/2.jpg" {
+		t.Fatalf("TG album = %+v, want both photos", album)
+	}
+	if _, ok := b.repo.LookupTgMsgID("mid.src", -100); !ok {
+		t.Error("mapping not saved after retry")
+	}
+}
+
+func TestQueue_LiveMessagesWaitBehindRetries(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	tgMsg := func(id int, text string) *TGMessage {
+		return &TGMessage{MessageID: id, Chat: ChatInfo{ID: -100, Type: "group"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: text}
+	}
+	mx.SendErr = errors.New("connection reset")
+	b.forwardTgToMax(context.Background(), tgMsg(7, "первое"), 200, "первое")
+	mx.SendErr = nil
+	b.forwardTgToMax(context.Background(), tgMsg(8, "второе"), 200, "второе")
+
+	tg.SendErr = errors.New("connection reset")
+	b.forwardMaxToTg(context.Background(), maxTextUpdate(200, 5, "Olga", "mid.1", "первое"), -100, "первое")
+	tg.SendErr = nil
+	b.forwardMaxToTg(context.Background(), maxTextUpdate(200, 5, "Olga", "mid.2", "второе"), -100, "второе")
+
+	// Уведомление в MAX о сбое доставки в TG — не пересылка, его не считаем
+	relayed := func() (toMax, toTg []string) {
+		for _, m := range mx.sent() {
+			if !strings.HasPrefix(m.Text, "Не удалось") {
+				toMax = append(toMax, m.Text)
+			}
+		}
+		for _, m := range tg.sent() {
+			toTg = append(toTg, m.Text)
+		}
+		return toMax, toTg
+	}
+	if toMax, toTg := relayed(); len(toMax) != 0 || len(toTg) != 0 {
+		t.Fatalf("sent MAX %q, TG %q; want live messages queued behind the retries", toMax, toTg)
+	}
+	if n := queueLen(b); n != 4 {
+		t.Fatalf("queue has %d items, want 4", n)
+	}
+
+	// Пока первые ждут ретрая, вторые их не обгоняют
+	b.processQueue(context.Background())
+	if toMax, toTg := relayed(); len(toMax) != 0 || len(toTg) != 0 {
+		t.Fatalf("sent MAX %q, TG %q before the first retry", toMax, toTg)
+	}
+
+	retryQueueNow(t, b)
+	toMax, toTg := relayed()
+	if len(toMax) != 2 || !strings.Contains(toMax[0], "первое") || !strings.Contains(toMax[1], "второе") {
+		t.Errorf("MAX sent %q, want первое then второе", toMax)
+	}
+	if len(toTg) != 2 || !strings.Contains(toTg[0], "первое") || !strings.Contains(toTg[1], "второе") {
+		t.Errorf("TG sent %q, want первое then второе", toTg)
+	}
+	if n := queueLen(b); n != 0 {
+		t.Errorf("queue has %d items after retry, want 0", n)
+	}
+}
+
+func TestEncodeMaxUpdate_RoundTrip(t *testing.T) {
+	upd := maxTextUpdate(200, 5, "Olga", "mid.src", "файл")
+	upd.Message.Body.Attachments = []interface{}{
+		&maxschemes.FileAttachment{
+			Attachment: maxschemes.Attachment{Type: maxschemes.AttachmentFile},
+			Payload:    maxschemes.FileAttachmentPayload{Url: "https://cdn.invalid/doc.pdf"},
+			Filename:   "doc.pdf",
+		},
+		&maxschemes.VideoAttachment{
+			Attachment: maxschemes.Attachment{Type: maxschemes.AttachmentVideo},
+		},
+	}
+
+	data, err := encodeMaxUpdate(upd)
+	if err != nil {
+		t.Fatalf("encodeMaxUpdate: %v", err)
+	}
+	got, err := decodeMaxUpdate(data)
+	if err != nil {
+		t.Fatalf("decodeMaxUpdate: %v", err)
+	}
+	if got.Message.Body.Mid != "mid.src" || got.Message.Recipient.ChatId != 200 {
+		t.Errorf("decoded message = %+v", got.Message)
+	}
+	if len(got.Message.Body.Attachments) != 2 {
+		t.Fatalf("decoded %d attachments, want 2", len(got.Message.Body.Attachments))
+	}
+	file, ok := got.Message.Body.Attachments[0].(*maxschemes.FileAttachment)
+	if !ok || file.Filename != "doc.pdf" || file.Payload.Url != "https://cdn.invalid/doc.pdf" {
+		t.Errorf("attachment[0] = %#v, want file doc.pdf", got.Message.Body.Attachments[0])
+	}
+	if _, ok := got.Message.Body.Attachments[1].(*maxschemes.VideoAttachment); !ok {
+		t.Errorf("attachment[1] = %T, want *VideoAttachment", got.Message.Body.Attachments[1])
+	}
+	// Исходный апдейт не изменён
+	if len(upd.Message.Body.Attachments) != 2 || upd.Message.Body.RawAttachments != nil {
+		t.Error("encodeMaxUpdate modified the source update")
+	}
+}
+
+func deadLetters(t *testing.T, b *Bridge) []DeadLetter {
+	t.Helper()
+	items, err := b.repo.ListDeadLetters("", 0, 0)
+	if err != nil {
+		t.Fatalf("ListDeadLetters: %v", err)
+	}
+	return items
+}
+
+func TestQueue_PermanentErrorMovesToDeadLetters(t *testing.T) {
+	b, _, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+
+	msg := &TGMessage{MessageID: 7, Chat: ChatInfo{ID: -100, Type: "group"}, From: &UserInfo{ID: 1, FirstName: "Ivan"}, Text: "привет"}
+	mx.SendErr = errors.New("connection reset")
+	b.forwardTgToMax(context.Background(), msg, 200, formatTgCaption(msg, false, false))
+
+	mx.SendErr = &MAXError{Status: 403, Code: "chat.denied", Message: "denied", Kind: ErrPermanent}
+	retryQueueNow(t, b)
+	if n := queueLen(b); n != 0 {
+		t.Fatalf("queue has %d items, want 0", n)
+	}
+	dl := deadLetters(t, b)
+	if len(dl) != 1 || dl[0].Reason != "permanent" || !strings.Contains(dl[0].LastError, "chat.denied") {
+		t.Fatalf("dead letters = %+v, want one permanent with last error", dl)
+	}
+	if !strings.Contains(dl[0].History, "connection reset") {
+		t.Errorf("history = %q, want initial error", dl[0].History)
+	}
+
+	// Доступ вернули — админ повторяет отправку
+	mx.SendErr = nil
+	if reply := b.queueCommand("tg", -100, " retry "+strconv.FormatInt(dl[0].ID, 10)); !strings.Contains(reply, "возвращено") {
+		t.Fatalf("/queue retry reply = %q", reply)
+	}
+	retryQueueNow(t, b)
+	if sent := mx.sent(); len(sent) != 1 || !strings.Contains(sent[0].Text, "привет") {
+		t.Errorf("MAX sent = %+v, want the replayed message", sent)
+	}
+	if _, ok := b.repo.LookupMaxMsgID(-100, 7, 200); !ok {
+		t.Error("mapping not saved after replay")
+	}
+	if n := len(deadLetters(t, b)); n != 0 {
+		t.Errorf("dead letters after replay = %d, want 0", n)
+	}
+}
+
+func TestQueue_ExpiredNotifiesSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		item   QueueItem
+		wantTG bool
+		notify string
+	}{
+		{"tg2max", QueueItem{Direction: "tg2max", SrcChatID: -100, DstChatID: 200, Payload: "{}"}, true, "не доставлено в MAX после 30 попыток"},
+		{"max2tg", QueueItem{Direction: "max2tg", SrcChatID: 200, DstChatID: -100, Payload: "{}"}, false, "не доставлено в Telegram после 30 попыток"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg, mx := newTestBridge(t)
+			pairChats(t, b.repo, -100, 200)
+			tt.item.CreatedAt = time.Now().Unix()
+			b.repo.EnqueueSend(&tt.item)
+			b.repo.(*sqliteRepo).db.Exec("UPDATE send_queue SET attempts = ?", queueMaxAttempts)
+			retryQueueNow(t, b)
+
+			if dl := deadLetters(t, b); len(dl) != 1 || dl[0].Reason != "expired" || dl[0].Attempts != queueMaxAttempts {
+				t.Fatalf("dead letters = %+v, want one expired", dl)
+			}
+			var notified string
+			if tt.wantTG {
+				if len(tg.Sent) == 1 && tg.Sent[0].ChatID == -100 {
+					notified = tg.Sent[0].Text
+				}
+			} else if sent := mx.sent(); len(sent) == 1 && sent[0].ChatID == 200 {
+				notified = sent[0].Text
+			}
+			if !strings.Contains(notified, tt.notify) || !strings.Contains(notified, "/queue") {
+				t.Errorf("notification = %q, want %q with /queue hint", notified, tt.notify)
+			}
+		})
+	}
+}
+
+func TestQueueCommand_ScopedToChat(t *testing.T) {
+	b, _, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.EnqueueSend(&QueueItem{Direction: "tg2max", SrcChatID: -100, DstChatID: 200, Text: "Ivan: привет", CreatedAt: time.Now().Unix()})
+	items, _ := b.repo.PeekQueue(1)
+	b.repo.MoveToDeadLetters(items[0].ID, "permanent", "MAX API 403: chat.denied: denied")
+	id := strconv.FormatInt(deadLetters(t, b)[0].ID, 10)
+
+	tests := []struct {
+		platform string
+		chatID   int64
+		args     string
+		want     string
+	}{
+		{"tg", -100, "", "#" + id + " TG → MAX"},
+		{"max", 200, "", "chat.denied"},
+		{"max", 999, "", "Недоставленных сообщений нет."},
+		{"max", 999, " retry " + id, "не найдено"},
+		{"max", 999, " purge", "Удалено недоставленных сообщений: 0."},
+		{"tg", -100, " retry x", "Используйте:"},
+		{"max", 200, " retry " + id, "возвращено в очередь"},
+	}
+	for _, tt := range tests {
+		if got := b.queueCommand(tt.platform, tt.chatID, tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("queueCommand(%s %d %q) = %q, want %q", tt.platform, tt.chatID, tt.args, got, tt.want)
+		}
+	}
+	if n := queueLen(b); n != 1 {
+		t.Errorf("queue has %d items after retry, want 1", n)
+	}
+}
+
+func TestRunDeadLettersCLI(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.EnqueueSend(&QueueItem{Direction: "max2tg", SrcChatID: 200, DstChatID: -100, Text: "привет", CreatedAt: 1})
+	items, _ := repo.PeekQueue(1)
+	repo.MoveToDeadLetters(items[0].ID, "expired", "telegram: Bad Gateway (502)")
+
+	var out strings.Builder
+	if err := runDeadLettersCLI(repo, []string{"list", "tg", "-100"}, &out); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out.String(), "max2tg") || !strings.Contains(out.String(), "Bad Gateway") {
+		t.Errorf("list output = %q", out.String())
+	}
+	for _, args := range [][]string{nil, {"bogus"}, {"retry"}, {"list", "tg"}, {"show", "42"}} {
+		if err := runDeadLettersCLI(repo, args, &out); err == nil {
+			t.Errorf("runDeadLettersCLI(%q): want error", args)
+		}
+	}
+	out.Reset()
+	if err := runDeadLettersCLI(repo, []string{"retry", "all"}, &out); err != nil || out.String() != "requeued 1\n" {
+		t.Errorf("retry all = %q, %v", out.String(), err)
+	}
+	if queued, _ := repo.PeekQueue(10); len(queued) != 1 || queued[0].Text != "привет" {
+		t.Errorf("queue after retry = %+v", queued)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+const (
+	rateChatBurst    = 3                // сколько сообщений в чат можно отправить подряд без паузы
+	rateRetryMaxWait = 30 * time.Second // дольше retry_after не ждём — сообщение уходит в очередь
+)
+
+// tokenBucket — token bucket с возможностью паузы (retry_after).
+type tokenBucket struct {
+	rate        float64 // токенов в секунду, 0 — без ограничения
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// reserve забирает токен и возвращает, сколько нужно подождать до его появления.
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	ready := now
+	if tb.rate > 0 {
+		if tb.last.IsZero() {
+			tb.tokens, tb.last = tb.burst, now
+		}
+		if now.After(tb.last) {
+			tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+			tb.last = now
+		}
+		tb.tokens--
+		ready = tb.last
+		if tb.tokens < 0 {
+			ready = ready.Add(time.Duration(-tb.tokens / tb.rate * float64(time.Second)))
+		}
+	}
+	if tb.pausedUntil.After(ready) {
+		ready = tb.pausedUntil
+	}
+	if !ready.After(now) {
+		return 0
+	}
+	return ready.Sub(now)
+}
+
+// pause запрещает отправку до until; токены начинают копиться заново после паузы.
+func (tb *tokenBucket) pause(until time.Time) {
+	if !until.After(tb.pausedUntil) {
+		return
+	}
+	tb.pausedUntil = until
+	if tb.rate > 0 {
+		tb.tokens = 0
+		if until.After(tb.last) {
+			tb.last = until
+		}
+	}
+}
+
+// idle — корзина снова полна и не на паузе: удалить её — то же, что завести новую.
+func (tb *tokenBucket) idle(now time.Time) bool {
+	if tb.pausedUntil.After(now) {
+		return false
+	}
+	return tb.rate == 0 || tb.tokens+now.Sub(tb.last).Seconds()*tb.rate >= tb.burst
+}
+
+// rateLimiter ограничивает исходящие отправки: общий лимит на бота плюс лимит на каждый чат.
+type rateLimiter struct {
+	name     string // "tg" / "max" — для логов
+	tenant   string // арендатор — для метрик
+	mu       sync.Mutex
+	global   *tokenBucket
+	chats    map[int64]*tokenBucket
+	chatRate float64 // токенов в секунду на чат
+	now      func() time.Time
+}
+
+// newRateLimiter создаёт лимитер: globalPerSec — сообщений в секунду на бота,
+// chatPerMin — сообщений в минуту на чат (0 — без ограничения).
+func newRateLimiter(name string, globalPerSec, chatPerMin float64) *rateLimiter {
+	return &rateLimiter{
+		name:     name,
+		global:   &tokenBucket{rate: globalPerSec, burst: math.Max(1, globalPerSec)},
+		chats:    make(map[int64]*tokenBucket),
+		chatRate: chatPerMin / 60,
+		now:      time.Now,
+	}
+}
+
+func (l *rateLimiter) chat(chatID int64) *tokenBucket {
+	tb, ok := l.chats[chatID]
+	if !ok {
+		tb = &tokenBucket{rate: l.chatRate, burst: rateChatBurst}
+		l.chats[chatID] = tb
+	}
+	return tb
+}
+
+// evictIdle удаляет корзины чатов, которые простаивают: иначе карта растёт с каждым
+// чатом, куда бот когда-либо писал. Возвращает число удалённых.
+func (l *rateLimiter) evictIdle() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	n := 0
+	for chatID, tb := range l.chats {
+		if tb.idle(now) {
+			delete(l.chats, chatID)
+			n++
+		}
+	}
+	return n
+}
+
+// Wait ждёт, пока отправка в chatID станет разрешена. chatID = 0 — только общий лимит.
+func (l *rateLimiter) Wait(ctx context.Context, chatID int64) error {
+	l.mu.Lock()
+	now := l.now()
+	wait := l.global.reserve(now)
+	if chatID != 0 {
+		if w := l.chat(chatID).reserve(now); w > wait {
+			wait = w
+		}
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Pause приостанавливает отправку в chatID на d (по retry_after). chatID = 0 — весь бот.
+func (l *rateLimiter) Pause(chatID int64, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := l.now().Add(d)
+	if chatID == 0 {
+		l.global.pause(until)
+		return
+	}
+	l.chat(chatID).pause(until)
+}
+
+// do выполняет отправку с учётом лимитов. При 429 чат ставится на паузу по retry_after;
+// если пауза короткая — отправка повторяется один раз, иначе ошибка уходит наверх (в очередь).
+// Каждая неудачная попытка учитывается в bridge_send_failures_total.
+func (l *rateLimiter) do(ctx context.Context, chatID int64, call func() error) error {
+	send := func() error {
+		err := call()
+		if err != nil {
+			metricSendFailure(l.tenant, l.name, err)
+		}
+		return err
+	}
+	if err := l.Wait(ctx, chatID); err != nil {
+		return err
+	}
+	err := send()
+	if errKind(err) != ErrRateLimited {
+		return err
+	}
+	retryAfter := errRetryAfter(err)
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	slog.Warn("rate limited", "api", l.name, "chat", chatID, "retryAfter", retryAfter)
+	l.Pause(chatID, retryAfter)
+	if retryAfter > rateRetryMaxWait {
+		return err
+	}
+	if err := l.Wait(ctx, chatID); err != nil {
+		return err
+	}
+	return send()
+}
+
+// --- retry_after ---
+
+// Пауза, которую API просит выдержать после 429: в TG — retry_after в ответе, в MAX —
+// заголовок Retry-After. Классификация ошибок только помечает 429 как ErrRateLimited,
+// паузу из ответа достают функции ниже.
+
+// errRetryAfter возвращает паузу, запрошенную API при ErrRateLimited (0 — не указана).
+func errRetryAfter(err error) time.Duration {
+	var tgErr *TGError
+	if errors.As(err, &tgErr) {
+		return tgErr.RetryAfter
+	}
+	var maxErr *MAXError
+	if errors.As(err, &maxErr) {
+		return maxErr.RetryAfter
+	}
+	return 0
+}
+
+// tgRetryAfter — пауза из ответа Bot API 429.
+func tgRetryAfter(tmr *bot.TooManyRequestsError) time.Duration {
+	return time.Duration(tmr.RetryAfter) * time.Second
+}
+
+// maxRetryAfter — пауза из заголовка Retry-After ответа MAX API (0 — не указана).
+func maxRetryAfter(header http.Header) time.Duration {
+	secs, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// --- TG ---
+
+// rateLimitedTGSender пропускает отправки в TG-чаты через rateLimiter.
+// Остальные вызовы TGSender идут напрямую.
+type rateLimitedTGSender struct {
+	TGSender
+	lim *rateLimiter
+}
+
+func (s *rateLimitedTGSender) SendMessage(ctx context.Context, chatID int64, text string, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendMessage(ctx, chatID, text, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendPhoto(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendPhoto(ctx, chatID, file, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendVideo(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendVideo(ctx, chatID, file, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendAudio(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendAudio(ctx, chatID, file, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendDocument(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendDocument(ctx, chatID, file, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendMediaGroup(ctx context.Context, chatID int64, media []TGInputMedia, opts *SendOpts) (ids []int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		ids, err = s.TGSender.SendMediaGroup(ctx, chatID, media, opts)
+		return err
+	})
+	return ids, err
+}
+
+func (s *rateLimitedTGSender) SendLocation(ctx context.Context, chatID int64, loc TGLocation, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendLocation(ctx, chatID, loc, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendContact(ctx context.Context, chatID int64, contact TGContact, opts *SendOpts) (id int, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, err = s.TGSender.SendContact(ctx, chatID, contact, opts)
+		return err
+	})
+	return id, err
+}
+
+func (s *rateLimitedTGSender) SendPoll(ctx context.Context, chatID int64, question string, options []string, multiple bool, opts *SendOpts) (id int, pollID string, err error) {
+	err = s.lim.do(ctx, chatID, func() error {
+		id, pollID, err = s.TGSender.SendPoll(ctx, chatID, question, options, multiple, opts)
+		return err
+	})
+	return id, pollID, err
+}
+
+func (s *rateLimitedTGSender) EditMessageText(ctx context.Context, chatID int64, msgID int, text string, opts *SendOpts) error {
+	return s.lim.do(ctx, chatID, func() error {
+		return s.TGSender.EditMessageText(ctx, chatID, msgID, text, opts)
+	})
+}
+
+func (s *rateLimitedTGSender) EditMessageMedia(ctx context.Context, chatID int64, msgID int, media TGInputMedia) error {
+	return s.lim.do(ctx, chatID, func() error {
+		return s.TGSender.EditMessageMedia(ctx, chatID, msgID, media)
+	})
+}
+
+func (s *rateLimitedTGSender) DeleteMessage(ctx context.Context, chatID int64, msgID int) error {
+	return s.lim.do(ctx, chatID, func() error {
+		return s.TGSender.DeleteMessage(ctx, chatID, msgID)
+	})
+}
+
+// --- MAX ---
+
+// rateLimitedMAXSender пропускает отправки в MAX-чаты через rateLimiter.
+type rateLimitedMAXSender struct {
+	MAXSender
+	lim *rateLimiter
+}
+
+func (s *rateLimitedMAXSender) SendMessage(ctx context.Context, msg *MaxMessage) (mid string, err error) {
+	err = s.lim.do(ctx, msg.ChatID, func() error {
+		mid, err = s.MAXSender.SendMessage(ctx, msg)
+		return err
+	})
+	return mid, err
+}
+
+func (s *rateLimitedMAXSender) EditMessage(ctx context.Context, mid string, msg *MaxMessage) error {
+	return s.lim.do(ctx, msg.ChatID, func() error {
+		return s.MAXSender.EditMessage(ctx, mid, msg)
+	})
+}
+
+// DeleteMessage знает только mid — учитывается лишь общий лимит.
+func (s *rateLimitedMAXSender) DeleteMessage(ctx context.Context, mid string) error {
+	return s.lim.do(ctx, 0, func() error {
+		return s.MAXSender.DeleteMessage(ctx, mid)
+	})
+}
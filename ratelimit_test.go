@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tb := &tokenBucket{rate: 1, burst: 2} // 1 токен в секунду, 2 подряд
+
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, time.Second},     // burst исчерпан
+		{0, 2 * time.Second}, // очередь резервов
+		{5 * time.Second, 0}, // за паузу накопился токен
+		{5 * time.Second, 0}, // и ещё один (burst)
+		{5 * time.Second, time.Second},
+	}
+	for i, tt := range tests {
+		if got := tb.reserve(now.Add(tt.at)); got != tt.want {
+			t.Errorf("reserve #%d at +%v = %v, want %v", i, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucket_Pause(t *testing.T) {
+	now := time.Unix(1000, 0)
+	unlimited := &tokenBucket{}
+	unlimited.pause(now.Add(3 * time.Second))
+	if got := unlimited.reserve(now); got != 3*time.Second {
+		t.Errorf("unlimited paused: reserve = %v, want 3s", got)
+	}
+	if got := unlimited.reserve(now.Add(4 * time.Second)); got != 0 {
+		t.Errorf("unlimited after pause: reserve = %v, want 0", got)
+	}
+
+	limited := &tokenBucket{rate: 1, burst: 5}
+	limited.reserve(now)
+	limited.pause(now.Add(3 * time.Second))
+	// После паузы токены копятся заново: первый появится через секунду после её окончания
+	if got := limited.reserve(now); got != 4*time.Second {
+		t.Errorf("limited paused: reserve = %v, want 4s", got)
+	}
+}
+
+func TestRateLimiter_PerChat(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter("test", 0, 60) // 1 сообщение в секунду на чат
+	l.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Burst чата проходит сразу; следующий ждал бы и падает по отменённому контексту
+	for i := 0; i < rateChatBurst; i++ {
+		if err := l.Wait(ctx, -100); err != nil {
+			t.Fatalf("Wait #%d: %v", i, err)
+		}
+	}
+	if err := l.Wait(ctx, -100); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait over burst = %v, want context.Canceled", err)
+	}
+	// Другой чат не затронут
+	if err := l.Wait(ctx, -200); err != nil {
+		t.Errorf("Wait other chat: %v", err)
+	}
+}
+
+func TestRateLimiter_EvictIdle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter("test", 0, 60) // 1 сообщение в секунду на чат
+	l.now = func() time.Time { return now }
+
+	for _, chatID := range []int64{-100, -200} {
+		if err := l.Wait(context.Background(), chatID); err != nil {
+			t.Fatalf("Wait %d: %v", chatID, err)
+		}
+	}
+	l.Pause(-300, time.Minute)
+	if n := l.evictIdle(); n != 0 {
+		t.Errorf("evictIdle right after sends = %d, want 0", n)
+	}
+
+	// Через 10 секунд корзины -100 и -200 снова полны, -300 ещё на паузе
+	now = now.Add(10 * time.Second)
+	if n := l.evictIdle(); n != 2 {
+		t.Errorf("evictIdle = %d, want 2", n)
+	}
+	if _, ok := l.chats[-300]; !ok || len(l.chats) != 1 {
+		t.Errorf("chats left = %v, want only the paused -300", l.chats)
+	}
+}
+
+func TestRateLimiter_DoRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		wantCalls  int
+		wantErr    bool
+	}{
+		{"short pause — retry", 10 * time.Millisecond, 2, false},
+		{"long pause — give up", time.Hour, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter("test", 0, 0)
+			calls := 0
+			err := l.do(context.Background(), -100, func() error {
+				calls++
+				if calls == 1 {
+					return &TGError{Code: 429, Kind: ErrRateLimited, RetryAfter: tt.retryAfter}
+				}
+				return nil
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("calls = %d, err = %v; want %d calls, err %v", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForwardMaxToTg_RateLimitedRetry(t *testing.T) {
+	b, tg, _ := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	tg.FailNext = []error{&TGError{Code: 429, Kind: ErrRateLimited, RetryAfter: 10 * time.Millisecond}}
+
+	upd := maxTextUpdate(200, 5, "Olga", "mid.src", "привет")
+	b.forwardMaxToTg(context.Background(), upd, -100, formatMaxCaption(upd, false, false))
+
+	if sent := tg.sent(); len(sent) != 1 {
+		t.Fatalf("TG sent %d messages, want 1 after retry_after", len(sent))
+	}
+	if _, ok := b.repo.LookupTgMsgID("mid.src", -100); !ok {
+		t.Error("mapping not saved after retry")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Реакции синхронизируются только из TG в MAX. MAX Bot API не умеет ставить реакции
+// и не присылает их (в API нет такого типа апдейта), поэтому реакции из MAX в TG не
+// переносятся. В MAX реакции из TG приходят сводкой: бот отвечает на копию сообщения
+// строкой «👍 3  ❤️ 1», правит её при каждом изменении и удаляет, когда реакций не осталось.
+// Апдейты реакций не дедуплицируются: каждый задаёт состояние участника целиком,
+// и повтор ничего не меняет.
+
+// handleTgReaction обрабатывает изменение реакций участника (message_reaction).
+func (b *Bridge) handleTgReaction(ctx context.Context, r *TGReaction) {
+	var actorID int64
+	switch {
+	case r.User != nil:
+		if b.isSelfTgBot(r.User) || slices.Contains(b.conf().BridgeTgBots, r.User.ID) {
+			return
+		}
+		actorID = r.User.ID
+	case r.ActorChat != nil:
+		actorID = r.ActorChat.ID
+	default:
+		return
+	}
+	counts := make(map[string]int)
+	for _, emoji := range r.Emoji {
+		counts[emoji]++
+	}
+	b.syncReactions(ctx, r.Chat.ID, r.MessageID, actorID, counts)
+}
+
+// handleTgReactionCount обрабатывает анонимные счётчики реакций (message_reaction_count).
+func (b *Bridge) handleTgReactionCount(ctx context.Context, r *TGReactionCount) {
+	b.syncReactions(ctx, r.Chat.ID, r.MessageID, 0, r.Counts)
+}
+
+// syncReactions сохраняет реакции участника actorID и обновляет сводку у каждой
+// MAX-копии сообщения (или MAX-оригинала, если в TG реагируют на копию).
+func (b *Bridge) syncReactions(ctx context.Context, tgChatID int64, tgMsgID int, actorID int64, counts map[string]int) {
+	links := b.repo.LookupMaxMsgIDs(tgChatID, tgMsgID)
+	if len(links) == 0 {
+		return
+	}
+	summary, err := b.repo.SetReactions(tgChatID, tgMsgID, actorID, counts)
+	if err != nil {
+		slog.Error("TG→MAX reactions: save failed", "err", err, "tgChat", tgChatID, "tgMsg", tgMsgID)
+		return
+	}
+	text := formatReactions(summary)
+	for _, link := range links {
+		if !b.reactionsAllowed(tgChatID, link.MaxChatID) {
+			continue
+		}
+		b.deliverToMax(link.MaxChatID, func() { b.updateReactionNote(ctx, link, text) })
+	}
+}
+
+// reactionsAllowed — реакции следуют направлению связки или кросспостинга.
+func (b *Bridge) reactionsAllowed(tgChatID, maxChatID int64) bool {
+	if _, dir, ok := b.repo.GetCrosspostMaxChat(tgChatID); ok {
+		return dir != "max>tg"
+	}
+	return b.pairAllows(tgChatID, maxChatID, "tg>max")
+}
+
+// updateReactionNote отправляет, правит или удаляет сводку реакций у MAX-сообщения link.
+func (b *Bridge) updateReactionNote(ctx context.Context, link MsgLink, text string) {
+	note := b.repo.GetReactionNote(link.TgChatID, link.TgMsgID, link.MaxChatID)
+	switch {
+	case text == "" && note == "":
+		return
+	case text == "":
+		if err := b.max.DeleteMessage(ctx, note); err != nil {
+			slog.Error("TG→MAX reactions: delete failed", "err", err, "maxChat", link.MaxChatID, "mid", note)
+			return
+		}
+		b.repo.SetReactionNote(link.TgChatID, link.TgMsgID, link.MaxChatID, "")
+	case note != "":
+		m := &MaxMessage{ChatID: link.MaxChatID, Text: text, ReplyTo: link.MaxMsgID}
+		if err := b.max.EditMessage(ctx, note, m); err != nil {
+			slog.Error("TG→MAX reactions: edit failed", "err", err, "maxChat", link.MaxChatID, "mid", note)
+			return
+		}
+	default:
+		m := &MaxMessage{ChatID: link.MaxChatID, Text: text, ReplyTo: link.MaxMsgID}
+		mid, err := b.max.SendMessage(ctx, m)
+		if err != nil {
+			slog.Error("TG→MAX reactions: send failed", "err", err, "maxChat", link.MaxChatID)
+			return
+		}
+		b.repo.SetReactionNote(link.TgChatID, link.TgMsgID, link.MaxChatID, mid)
+	}
+	slog.Debug("TG→MAX reactions synced", "maxChat", link.MaxChatID, "mid", link.MaxMsgID, "text", text)
+}
+
+// formatReactions — сводка реакций: "Реакции в Telegram: 👍 3  ❤️ 1"; "" — реакций нет.
+func formatReactions(summary []ReactionCount) string {
+	if len(summary) == 0 {
+		return ""
+	}
+	parts := make([]string, len(summary))
+	for i, rc := range summary {
+		parts[i] = rc.Emoji + " " + strconv.Itoa(rc.Count)
+	}
+	return "Реакции в Telegram: " + strings.Join(parts, "  ")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func tgReaction(userID int64, msgID int, emoji ...string) TGUpdate {
+	return TGUpdate{MessageReaction: &TGReaction{
+		Chat:      ChatInfo{ID: -100, Type: "supergroup"},
+		MessageID: msgID,
+		User:      &UserInfo{ID: userID, FirstName: "Ivan"},
+		Emoji:     emoji,
+	}}
+}
+
+func TestTgReactions_SummaryNote(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.SaveMsg(-100, 7, 200, "mid.a")
+
+	runTgUpdates(b, tg,
+		tgReaction(1, 7, "👍"),
+		tgReaction(2, 7, "👍", "❤️"),
+		tgReaction(1, 7),
+		tgReaction(1, 99, "🔥"), // сообщение не пересылалось — сводки нет
+		tgReaction(2, 7),
+	)
+
+	sent := mx.sent()
+	if len(sent) != 1 || sent[0].Text != "Реакции в Telegram: 👍 1" || sent[0].ReplyTo != "mid.a" {
+		t.Fatalf("MAX sent = %+v, want one summary reply to mid.a", sent)
+	}
+	var edits []string
+	for _, e := range mx.Edited {
+		if e.Mid != "mid.1" {
+			t.Errorf("edited %q, want the summary mid.1", e.Mid)
+		}
+		edits = append(edits, e.Msg.Text)
+	}
+	if want := []string{"Реакции в Telegram: 👍 2  ❤️ 1", "Реакции в Telegram: ❤️ 1  👍 1"}; !slices.Equal(edits, want) {
+		t.Errorf("summary edits = %q, want %q", edits, want)
+	}
+	if !slices.Equal(mx.Deleted, []string{"mid.1"}) {
+		t.Errorf("MAX deleted = %v, want the summary removed when no reactions left", mx.Deleted)
+	}
+	if note := b.repo.GetReactionNote(-100, 7, 200); note != "" {
+		t.Errorf("reaction note = %q after removal, want none", note)
+	}
+}
+
+func TestTgReactions_Direction(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	pairChats(t, b.repo, -100, 200)
+	b.repo.SetPairDirection(-100, 200, "max>tg")
+	b.repo.SaveMsg(-100, 7, 200, "mid.a")
+
+	runTgUpdates(b, tg, tgReaction(1, 7, "👍"))
+
+	if sent := mx.sent(); len(sent) != 0 {
+		t.Errorf("MAX sent %+v for max>tg pair, want nothing", sent)
+	}
+}
+
+func TestTgReactions_AnonymousCounts(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	if err := b.repo.PairCrosspost(-1001, 500, 1, 2); err != nil {
+		t.Fatalf("PairCrosspost: %v", err)
+	}
+	b.repo.SaveMsg(-1001, 3, 500, "mid.post")
+
+	runTgUpdates(b, tg, TGUpdate{MessageReactionCount: &TGReactionCount{
+		Chat:      ChatInfo{ID: -1001, Type: "channel"},
+		MessageID: 3,
+		Counts:    map[string]int{"🔥": 5, "👍": 12},
+	}})
+
+	if sent := mx.sent(); len(sent) != 1 || sent[0].Text != "Реакции в Telegram: 👍 12  🔥 5" {
+		t.Errorf("MAX sent = %+v, want channel reaction summary", sent)
+	}
+}
@@ -146,9 +146,9 @@ func tgReplItemKeyboard(dir string, idx int, maxChatID string, currentTarget str
 }
 
 // maxReplacementsKeyboard строит inline-клавиатуру для управления заменами в MAX.
-func maxReplacementsKeyboard(api *maxbot.Api, maxChatID int64) *maxbot.Keyboard {
+func maxReplacementsKeyboard(maxChatID int64) *maxbot.Keyboard {
 	id := fmt.Sprintf("%d", maxChatID)
-	kb := api.Messages.NewKeyboardBuilder()
+	kb := &maxbot.Keyboard{}
 	kb.AddRow().
 		AddCallback("+ TG→MAX", maxschemes.DEFAULT, "cpra:tg>max:"+id).
 		AddCallback("+ MAX→TG", maxschemes.DEFAULT, "cpra:max>tg:"+id)
@@ -159,14 +159,14 @@ func maxReplacementsKeyboard(api *maxbot.Api, maxChatID int64) *maxbot.Keyboard
 }
 
 // maxReplItemKeyboard — кнопки для одной замены в MAX.
-func maxReplItemKeyboard(api *maxbot.Api, dir string, idx int, maxChatID string, currentTarget string) *maxbot.Keyboard {
+func maxReplItemKeyboard(dir string, idx int, maxChatID string, currentTarget string) *maxbot.Keyboard {
 	toggleLabel := "🔗 Только ссылки"
 	toggleTarget := "links"
 	if currentTarget == "links" {
 		toggleLabel = "📝 Весь текст"
 		toggleTarget = "all"
 	}
-	kb := api.Messages.NewKeyboardBuilder()
+	kb := &maxbot.Keyboard{}
 	kb.AddRow().
 		AddCallback(toggleLabel, maxschemes.DEFAULT, fmt.Sprintf("cprt:%s:%d:%s:%s", dir, idx, toggleTarget, maxChatID)).
 		AddCallback("❌ Удалить", maxschemes.NEGATIVE, fmt.Sprintf("cprd:%s:%d:%s", dir, idx, maxChatID))
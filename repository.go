@@ -1,5 +1,11 @@
 package main
 
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
 // Replacement — одно правило замены текста.
 // Target: "" или "all" — весь текст, "links" — только ссылки.
 type Replacement struct {
@@ -22,29 +28,66 @@ type CrosspostLink struct {
 	Direction string
 }
 
+// MsgLink — связь TG-сообщения с его копией в MAX (строка таблицы messages).
+type MsgLink struct {
+	TgChatID  int64
+	TgMsgID   int
+	MaxChatID int64
+	MaxMsgID  string
+}
+
 // Repository — абстракция хранилища для bridge.
 type Repository interface {
 	// Register обрабатывает /bridge команду.
 	// Без ключа — создаёт pending запись и возвращает сгенерированный ключ.
 	// С ключом — ищет пару и создаёт связку.
-	Register(key, platform string, chatID int64) (paired bool, generatedKey string, err error)
+	// tgThreadID — топик TG-форума, в котором выполнена команда (0 — весь чат):
+	// если топик задан с TG-стороны, связывается только этот топик.
+	Register(key, platform string, chatID int64, tgThreadID int) (paired bool, generatedKey string, err error)
 
-	GetMaxChat(tgChatID int64) (int64, bool)
-	GetTgChat(maxChatID int64) (int64, bool)
+	// GetMaxChats/GetTgChats возвращают всех пиров чата (fan-out: чат может быть
+	// связан с несколькими чатами другой платформы). Пустой слайс — чат не связан.
+	// Для сообщения из топика, у которого есть своя связка, GetMaxChats возвращает
+	// только MAX-чаты этого топика, иначе — связки всего чата.
+	GetMaxChats(tgChatID int64, tgThreadID int) []int64
+	GetTgChats(maxChatID int64) []int64
 	MigrateTgChat(oldID, newID int64) error
 
+	// Маппинг сообщений хранится отдельно для каждой копии (по одной строке на пир).
 	SaveMsg(tgChatID int64, tgMsgID int, maxChatID int64, maxMsgID string)
-	LookupMaxMsgID(tgChatID int64, tgMsgID int) (string, bool)
-	LookupTgMsgID(maxMsgID string) (int64, int, bool)
+	LookupMaxMsgID(tgChatID int64, tgMsgID int, maxChatID int64) (string, bool)
+	LookupTgMsgID(maxMsgID string, tgChatID int64) (int, bool)
+	LookupTgMsgIDs(maxMsgID string) []MsgLink
+	// LookupMaxMsgIDs возвращает копии TG-сообщения во всех MAX-чатах.
+	LookupMaxMsgIDs(tgChatID int64, tgMsgID int) []MsgLink
 	CleanOldMessages()
 
-	HasPrefix(platform string, chatID int64) bool
-	SetPrefix(platform string, chatID int64, on bool) bool
+	// Настройки связки читаются и меняются по паре tgChatID ↔ maxChatID: она лежит либо
+	// в pairs, либо в topic_pairs, и в каждой таблице не больше одной строки на пару.
+	// Setter'ы возвращают false, если такой связки нет.
+
+	// Префикс [TG]/[MAX] в подписи (по умолчанию включён).
+	HasPrefix(tgChatID, maxChatID int64) bool
+	SetPrefix(tgChatID, maxChatID int64, on bool) bool
+
+	// Направление пересылки связки: "tg>max", "max>tg" или "both" (по умолчанию).
+	GetPairDirection(tgChatID, maxChatID int64) string
+	SetPairDirection(tgChatID, maxChatID int64, direction string) bool
+
+	// Шаблон подписи пересланных сообщений связки (/bridge format); пустой — "Имя: текст".
+	GetPairFormat(tgChatID, maxChatID int64) string
+	SetPairFormat(tgChatID, maxChatID int64, format string) bool
 
 	Unpair(platform string, chatID int64) bool
+	UnpairTopic(tgChatID int64, threadID int) bool
 
-	GetTgThreadID(tgChatID int64) int
+	// GetTgThreadID возвращает топик, в который пишутся сообщения из maxChatID:
+	// топик связки топика, либо топик по умолчанию (/thread) для связки всего чата.
+	GetTgThreadID(tgChatID, maxChatID int64) int
 	SetTgThreadID(tgChatID int64, threadID int) error
+	// ResetTgThread вызывается, когда топик threadID больше недоступен:
+	// сбрасывает топик по умолчанию и превращает связки этого топика в связки всего чата.
+	ResetTgThread(tgChatID int64, threadID int) error
 
 	// Crosspost methods
 	PairCrosspost(tgChatID, maxChatID, ownerID, tgOwnerID int64) error
@@ -67,11 +110,122 @@ type Repository interface {
 	EnqueueSend(item *QueueItem) error
 	PeekQueue(limit int) ([]QueueItem, error)
 	DeleteFromQueue(id int64) error
-	IncrementAttempt(id int64, nextRetry int64) error
+	// IncrementAttempt записывает неудачную попытку: errText попадает в last_error и history.
+	IncrementAttempt(id int64, nextRetry int64, errText string) error
+	// CountQueue — число ожидающих элементов, касающихся чата платформы platform.
+	CountQueue(platform string, chatID int64) int
+	// QueuedTo — есть ли в очереди элементы направления direction в чат dstChatID.
+	QueuedTo(direction string, dstChatID int64) bool
+
+	// QueueStats — состояние очереди и dead letters по направлениям (для метрик).
+	QueueStats() (map[string]QueueStat, error)
+
+	// Dead letters — элементы очереди, от доставки которых отказались
+	// MoveToDeadLetters переносит элемент очереди в dead_letters. errText (если не пуст)
+	// дописывается в историю как последняя ошибка.
+	MoveToDeadLetters(id int64, reason, errText string) error
+	// ListDeadLetters возвращает dead letters чата (platform "" — все), старые первыми; limit <= 0 — без ограничения.
+	ListDeadLetters(platform string, chatID int64, limit int) ([]DeadLetter, error)
+	GetDeadLetter(id int64) (DeadLetter, bool)
+	// RetryDeadLetter возвращает dead letter в очередь с чистым счётчиком попыток.
+	RetryDeadLetter(id int64) (bool, error)
+	// PurgeDeadLetters удаляет dead letters чата (platform "" — все) и возвращает их число.
+	PurgeDeadLetters(platform string, chatID int64) (int64, error)
+
+	// MarkUpdateProcessed отмечает апдейт обработанным и возвращает false, если он уже
+	// был отмечен (повтор webhook'а или polling'а). Отметки живут 48 часов (CleanOldMessages).
+	MarkUpdateProcessed(key UpdateKey) (bool, error)
+	// UpdateProcessed сообщает, отмечен ли апдейт обработанным.
+	UpdateProcessed(key UpdateKey) (bool, error)
+
+	// Реакции на TG-сообщения. SetReactions заменяет реакции участника actorID
+	// (0 — анонимные счётчики канала) и возвращает сводку по сообщению.
+	SetReactions(tgChatID int64, tgMsgID int, actorID int64, counts map[string]int) ([]ReactionCount, error)
+	// Сообщение со сводкой реакций в MAX-чате; "" — сводки нет. mid "" удаляет запись.
+	// Реакции и сводки живут 48 часов (CleanOldMessages), как и маппинг сообщений.
+	GetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64) string
+	SetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64, mid string)
+
+	// Опросы: строка на каждую TG-копию сообщения с кнопками в MAX. Опросы и голоса
+	// живут 7 дней (CleanOldMessages), потом кнопки перестают работать.
+	SavePoll(p BridgedPoll) error
+	PollsByMaxMsg(maxMsgID string) []BridgedPoll
+	PollsByTgPoll(tgPollID string) []BridgedPoll
+	// SetPollTgCounts сохраняет голоса TG-опроса по вариантам и признак закрытия.
+	SetPollTgCounts(tgPollID string, counts []int, closed bool) error
+	// SetPollTgNote запоминает сводку голосов MAX в TG-чате (ответ на опрос).
+	SetPollTgNote(maxMsgID string, tgChatID int64, noteID int) error
+	// Голоса участников MAX: SetPollVotes заменяет выбор участника (пустой — голос отозван).
+	GetPollVotes(maxMsgID string, userID int64) []int
+	SetPollVotes(maxMsgID string, userID int64, options []int) error
+	// CountPollVotes — число голосов MAX по номерам вариантов.
+	CountPollVotes(maxMsgID string) map[int]int
+
+	// Происхождение сообщений: SaveSent записывает каждое сообщение, отправленное мостом
+	// арендатора, IsSent узнаёт его во входящих апдейтах. Мосты других арендаторов —
+	// чужие боты, их распознаёт BRIDGE_TG_BOTS / BRIDGE_MAX_BOTS. Записи живут 48 часов
+	// (CleanOldMessages).
+	SaveSent(platform string, chatID int64, msgID string)
+	IsSent(platform string, chatID int64, msgID string) bool
+
+	// Позиция long polling: offset TG ("tg") и marker MAX ("max"), с которых
+	// продолжать чтение апдейтов после рестарта. 0 — позиция не сохранена.
+	GetPollState(platform string) int64
+	SetPollState(platform string, position int64) error
+
+	// Inbox webhook'ов: любая реплика кладёт тело апдейта, лидер читает и удаляет.
+	// Записи старше 48 часов удаляет CleanOldMessages.
+	PushInbox(platform string, body []byte) error
+	// PeekInbox возвращает до limit записей платформы с id > afterID по порядку поступления.
+	PeekInbox(platform string, afterID int64, limit int) ([]InboxItem, error)
+	DeleteInbox(id int64) error
+
+	// ForTenant возвращает репозиторий с данными арендатора tenantID на том же
+	// соединении с БД. "" — арендатор по умолчанию (одна пара ботов).
+	ForTenant(tenantID string) Repository
+
+	// Ping проверяет соединение с БД (для /readyz).
+	Ping() error
 
 	Close() error
 }
 
+// UpdateKey — ключ апдейта в processed_updates.
+type UpdateKey struct {
+	Platform string // "tg" / "max"
+	ChatID   int64  // 0, если у апдейта нет чата (удаление в MAX, callback)
+	MsgID    string // ID сообщения TG, mid MAX или ID callback'а
+	Kind     string // "message", "edit:<время правки>", "remove", "callback"
+}
+
+// ReactionCount — эмодзи реакции и сколько раз её поставили.
+type ReactionCount struct {
+	Emoji string
+	Count int
+}
+
+// BridgedPoll — опрос, перенесённый между платформами: сообщение с кнопками в MAX
+// и опрос в TG-чате.
+type BridgedPoll struct {
+	MaxChatID int64
+	MaxMsgID  string
+	TgChatID  int64
+	TgMsgID   int
+	TgPollID  string
+	Title     string // первая строка сообщения в MAX: подпись и вопрос
+	Options   []string
+	Multiple  bool
+	Closed    bool
+	TgCounts  []int // голоса в TG по вариантам
+	TgNoteID  int   // сводка голосов MAX в TG; 0 — не отправлялась
+}
+
+// InboxItem — апдейт из update_inbox.
+type InboxItem struct {
+	ID   int64
+	Body []byte
+}
+
 // QueueItem — сообщение в очереди на повторную отправку.
 type QueueItem struct {
 	ID        int64
@@ -86,7 +240,167 @@ type QueueItem struct {
 	Format    string
 	AttURL    string // URL медиа (для MAX→TG)
 	ParseMode string // "HTML" или ""
+	// Payload — исходное сообщение (JSON), по которому отправка собирается заново при ретрае.
+	// Пусто у элементов, поставленных старыми версиями: для них используются Text/Att*.
+	Payload   string
 	Attempts  int
 	CreatedAt int64
 	NextRetry int64
+	LastError string // ошибка последней попытки (при постановке — первой)
+}
+
+// QueueStat — сводка по одному направлению очереди.
+type QueueStat struct {
+	Pending         int
+	OldestCreatedAt int64 // created_at самого старого ожидающего элемента (0 — очередь пуста)
+	DeadLetters     int
+}
+
+// DeadLetter — элемент очереди, от доставки которого отказались (истёк срок,
+// кончились попытки, постоянная ошибка). Хранится до ручного retry или purge.
+type DeadLetter struct {
+	QueueItem        // ID — id в dead_letters
+	Reason    string // "expired", "permanent", "bad_payload"
+	History   string // по строке на каждую неудачную попытку
+	DeadAt    int64
+}
+
+// InChat проверяет, относится ли элемент к чату chatID платформы platform ("tg"/"max").
+func (d DeadLetter) InChat(platform string, chatID int64) bool {
+	srcDir, dstDir := queueChatDirs(platform)
+	return (d.Direction == srcDir && d.SrcChatID == chatID) || (d.Direction == dstDir && d.DstChatID == chatID)
+}
+
+// queueChatDirs возвращает направления, в которых чат платформы platform является
+// источником (src_chat_id) и получателем (dst_chat_id) — для SQL-фильтров по чату.
+func queueChatDirs(platform string) (srcDir, dstDir string) {
+	if platform == "max" {
+		return "max2tg", "tg2max"
+	}
+	return "tg2max", "max2tg"
+}
+
+// deadLetterCols — общие колонки send_queue и dead_letters, переносимые между ними.
+const deadLetterCols = "direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, payload"
+
+// queueHistoryLine — строка истории попыток элемента очереди.
+func queueHistoryLine(at time.Time, errText string) string {
+	return at.UTC().Format(time.DateTime) + " " + errText + "\n"
+}
+
+// enqueueHistory — начальная история элемента: ошибка, из-за которой он попал в очередь.
+func enqueueHistory(item *QueueItem) string {
+	if item.LastError == "" {
+		return ""
+	}
+	return queueHistoryLine(time.Unix(item.CreatedAt, 0), item.LastError)
+}
+
+// scanDeadLetters читает строки "SELECT id, "+deadLetterCols+", attempts, created_at, reason, last_error, history, dead_at".
+func scanDeadLetters(rows *sql.Rows) ([]DeadLetter, error) {
+	defer rows.Close()
+	var out []DeadLetter
+	for rows.Next() {
+		var d DeadLetter
+		if err := rows.Scan(&d.ID, &d.Direction, &d.SrcChatID, &d.DstChatID, &d.SrcMsgID,
+			&d.Text, &d.AttType, &d.AttToken, &d.ReplyTo, &d.Format,
+			&d.AttURL, &d.ParseMode, &d.Payload,
+			&d.Attempts, &d.CreatedAt, &d.Reason, &d.LastError, &d.History, &d.DeadAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// scanQueueStats дополняет stats строками "SELECT direction, COUNT(*), MIN(created_at)"
+// (dead = false) или "SELECT direction, COUNT(*), 0" из dead_letters (dead = true).
+func scanQueueStats(rows *sql.Rows, stats map[string]QueueStat, dead bool) error {
+	defer rows.Close()
+	for rows.Next() {
+		var dir string
+		var n int
+		var oldest int64
+		if err := rows.Scan(&dir, &n, &oldest); err != nil {
+			return err
+		}
+		s := stats[dir]
+		if dead {
+			s.DeadLetters = n
+		} else {
+			s.Pending, s.OldestCreatedAt = n, oldest
+		}
+		stats[dir] = s
+	}
+	return rows.Err()
+}
+
+// pollColumns — колонки polls в порядке scanPolls.
+const pollColumns = "max_chat_id, max_msg_id, tg_chat_id, tg_msg_id, tg_poll_id, title, options, multiple, closed, tg_counts, tg_note_id"
+
+// scanPolls читает строки "SELECT " + pollColumns.
+func scanPolls(rows *sql.Rows, err error) []BridgedPoll {
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []BridgedPoll
+	for rows.Next() {
+		var p BridgedPoll
+		var options, counts string
+		if err := rows.Scan(&p.MaxChatID, &p.MaxMsgID, &p.TgChatID, &p.TgMsgID, &p.TgPollID, &p.Title,
+			&options, &p.Multiple, &p.Closed, &counts, &p.TgNoteID); err != nil {
+			return out
+		}
+		json.Unmarshal([]byte(options), &p.Options)
+		json.Unmarshal([]byte(counts), &p.TgCounts)
+		out = append(out, p)
+	}
+	return out
+}
+
+// scanPollVotes читает строки "SELECT option_idx[, COUNT(*)]".
+func scanPollVotes(rows *sql.Rows, err error) map[int]int {
+	out := make(map[int]int)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx, n int
+		if err := rows.Scan(&idx, &n); err != nil {
+			return out
+		}
+		out[idx] = n
+	}
+	return out
+}
+
+// jsonText — JSON-представление значения для текстовых колонок.
+func jsonText(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// affected возвращает число затронутых строк результата Exec (0 при ошибке).
+func affected(res sql.Result, err error) int64 {
+	if err != nil {
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// scanReactionCounts читает строки "SELECT emoji, SUM(count)" — сводку реакций.
+func scanReactionCounts(rows *sql.Rows) ([]ReactionCount, error) {
+	defer rows.Close()
+	var out []ReactionCount
+	for rows.Next() {
+		var rc ReactionCount
+		if err := rows.Scan(&rc.Emoji, &rc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, rc)
+	}
+	return out, rows.Err()
 }
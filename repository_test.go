@@ -0,0 +1,343 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRepo(t *testing.T) Repository {
+	t.Helper()
+	repo, err := NewSQLiteRepo(filepath.Join(t.TempDir(), "bridge.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteRepo: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestRepo_TopicRouting(t *testing.T) {
+	repo := newTestRepo(t)
+	pairChats(t, repo, -100, 200)
+	pairTopic(t, repo, -100, 5, 300)
+	pairTopic(t, repo, -100, 6, 400)
+
+	tests := []struct {
+		name   string
+		thread int
+		want   []int64
+	}{
+		{"general", 0, []int64{200}},
+		{"bound topic", 5, []int64{300}},
+		{"other bound topic", 6, []int64{400}},
+		{"unbound topic", 7, []int64{200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repo.GetMaxChats(-100, tt.thread); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMaxChats(-100, %d) = %v, want %v", tt.thread, got, tt.want)
+			}
+		})
+	}
+
+	for maxChatID, want := range map[int64]int{200: 0, 300: 5, 400: 6} {
+		if got := repo.GetTgThreadID(-100, maxChatID); got != want {
+			t.Errorf("GetTgThreadID(-100, %d) = %d, want %d", maxChatID, got, want)
+		}
+		if got := repo.GetTgChats(maxChatID); !reflect.DeepEqual(got, []int64{-100}) {
+			t.Errorf("GetTgChats(%d) = %v, want [-100]", maxChatID, got)
+		}
+	}
+}
+
+func TestRepo_RebindTopicReplacesChatPair(t *testing.T) {
+	repo := newTestRepo(t)
+	pairChats(t, repo, -100, 200)
+	pairTopic(t, repo, -100, 5, 200)
+
+	if got := repo.GetMaxChats(-100, 0); len(got) != 0 {
+		t.Errorf("GetMaxChats(-100, 0) = %v, want none after binding the topic", got)
+	}
+	if got := repo.GetTgThreadID(-100, 200); got != 5 {
+		t.Errorf("GetTgThreadID = %d, want 5", got)
+	}
+}
+
+func TestRepo_ResetTgThread(t *testing.T) {
+	repo := newTestRepo(t)
+	pairChats(t, repo, -100, 200)
+	repo.SetTgThreadID(-100, 5)
+	pairTopic(t, repo, -100, 5, 300)
+	pairTopic(t, repo, -100, 6, 400)
+	if !repo.SetPairFormat(-100, 300, "{{.Text}}") {
+		t.Fatal("SetPairFormat = false, want true")
+	}
+
+	if err := repo.ResetTgThread(-100, 5); err != nil {
+		t.Fatalf("ResetTgThread: %v", err)
+	}
+
+	// Связка пропавшего топика стала связкой всего чата, чужой топик не тронут
+	if got, want := repo.GetMaxChats(-100, 0), []int64{200, 300}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaxChats(-100, 0) = %v, want %v", got, want)
+	}
+	if got, want := repo.GetMaxChats(-100, 6), []int64{400}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaxChats(-100, 6) = %v, want %v", got, want)
+	}
+	for _, maxChatID := range []int64{200, 300} {
+		if got := repo.GetTgThreadID(-100, maxChatID); got != 0 {
+			t.Errorf("GetTgThreadID(-100, %d) = %d, want 0", maxChatID, got)
+		}
+	}
+	if got := repo.GetPairFormat(-100, 300); got != "{{.Text}}" {
+		t.Errorf("GetPairFormat(-100, 300) = %q, want the topic's format kept", got)
+	}
+}
+
+func TestRepo_UnpairTopic(t *testing.T) {
+	repo := newTestRepo(t)
+	pairChats(t, repo, -100, 200)
+	pairTopic(t, repo, -100, 5, 300)
+
+	if !repo.UnpairTopic(-100, 5) {
+		t.Fatal("UnpairTopic = false, want true")
+	}
+	if repo.UnpairTopic(-100, 5) {
+		t.Error("second UnpairTopic = true, want false")
+	}
+	if got, want := repo.GetMaxChats(-100, 5), []int64{200}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMaxChats(-100, 5) = %v, want %v", got, want)
+	}
+}
+
+func TestRepo_PairSettingsPerPair(t *testing.T) {
+	repo := newTestRepo(t)
+	pairChats(t, repo, -100, 200)
+	pairChats(t, repo, -100, 300)
+	pairTopic(t, repo, -100, 5, 400)
+
+	if !repo.SetPairDirection(-100, 300, "tg>max") || !repo.SetPrefix(-100, 400, false) || !repo.SetPairFormat(-100, 400, "{{.Text}}") {
+		t.Fatal("setters on existing pairs returned false")
+	}
+	if repo.SetPairDirection(-100, 999, "tg>max") {
+		t.Error("SetPairDirection on a missing pair returned true")
+	}
+	if got := repo.GetPairDirection(-100, 200); got != "both" {
+		t.Errorf("GetPairDirection(-100, 200) = %q, want both", got)
+	}
+	if got := repo.GetPairDirection(-100, 300); got != "tg>max" {
+		t.Errorf("GetPairDirection(-100, 300) = %q, want tg>max", got)
+	}
+	if !repo.HasPrefix(-100, 200) || repo.HasPrefix(-100, 400) {
+		t.Errorf("HasPrefix = %v, %v; want only the topic pair without prefix", repo.HasPrefix(-100, 200), repo.HasPrefix(-100, 400))
+	}
+	if got := repo.GetPairFormat(-100, 200); got != "" {
+		t.Errorf("GetPairFormat(-100, 200) = %q, want the chat pair untouched", got)
+	}
+}
+
+func TestRepo_DeadLetters(t *testing.T) {
+	repo := newTestRepo(t)
+	enqueue := func(dir string, src, dst int64, text string) int64 {
+		t.Helper()
+		if err := repo.EnqueueSend(&QueueItem{Direction: dir, SrcChatID: src, DstChatID: dst, Text: text, CreatedAt: 1, LastError: "connection reset"}); err != nil {
+			t.Fatalf("EnqueueSend: %v", err)
+		}
+		items, _ := repo.PeekQueue(100)
+		return items[len(items)-1].ID
+	}
+	id1 := enqueue("tg2max", -100, 200, "из TG")
+	repo.IncrementAttempt(id1, 0, "MAX API 502: bad gateway")
+	if err := repo.MoveToDeadLetters(id1, "permanent", "MAX API 403: chat.denied: denied"); err != nil {
+		t.Fatalf("MoveToDeadLetters: %v", err)
+	}
+	id2 := enqueue("max2tg", 300, -100, "из MAX")
+	repo.MoveToDeadLetters(id2, "expired", "")
+
+	if n := repo.CountQueue("tg", -100); n != 0 {
+		t.Errorf("CountQueue after move = %d, want 0", n)
+	}
+
+	// TG-чат -100 видит оба элемента, MAX-чаты — только свои
+	for _, tt := range []struct {
+		platform string
+		chatID   int64
+		want     []string
+	}{
+		{"tg", -100, []string{"из TG", "из MAX"}},
+		{"max", 200, []string{"из TG"}},
+		{"max", 300, []string{"из MAX"}},
+		{"max", -100, nil},
+		{"", 0, []string{"из TG", "из MAX"}},
+	} {
+		items, err := repo.ListDeadLetters(tt.platform, tt.chatID, 0)
+		if err != nil {
+			t.Fatalf("ListDeadLetters: %v", err)
+		}
+		var got []string
+		for _, d := range items {
+			got = append(got, d.Text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListDeadLetters(%q, %d) = %v, want %v", tt.platform, tt.chatID, got, tt.want)
+		}
+	}
+
+	items, _ := repo.ListDeadLetters("max", 200, 0)
+	d, ok := repo.GetDeadLetter(items[0].ID)
+	if !ok {
+		t.Fatal("GetDeadLetter: not found")
+	}
+	if d.Reason != "permanent" || d.LastError != "MAX API 403: chat.denied: denied" || d.Attempts != 1 {
+		t.Errorf("dead letter = %+v", d)
+	}
+	if lines := strings.Split(strings.TrimSpace(d.History), "\n"); len(lines) != 3 ||
+		!strings.HasSuffix(lines[0], "connection reset") || !strings.HasSuffix(lines[2], "chat.denied: denied") {
+		t.Errorf("history = %q, want 3 attempts in order", d.History)
+	}
+	// Без новой ошибки last_error остаётся от последней попытки
+	items, _ = repo.ListDeadLetters("max", 300, 0)
+	if items[0].LastError != "connection reset" {
+		t.Errorf("expired LastError = %q, want connection reset", items[0].LastError)
+	}
+
+	if ok, err := repo.RetryDeadLetter(d.ID); err != nil || !ok {
+		t.Fatalf("RetryDeadLetter = %v, %v", ok, err)
+	}
+	if ok, _ := repo.RetryDeadLetter(d.ID); ok {
+		t.Error("RetryDeadLetter twice: want false")
+	}
+	queued, _ := repo.PeekQueue(10)
+	if len(queued) != 1 || queued[0].Text != "из TG" || queued[0].Attempts != 0 {
+		t.Errorf("requeued = %+v, want one fresh item", queued)
+	}
+
+	if n, err := repo.PurgeDeadLetters("tg", -100); err != nil || n != 1 {
+		t.Errorf("PurgeDeadLetters = %d, %v, want 1", n, err)
+	}
+	if items, _ := repo.ListDeadLetters("", 0, 0); len(items) != 0 {
+		t.Errorf("dead letters after purge = %d, want 0", len(items))
+	}
+}
+
+func TestRepo_PollState(t *testing.T) {
+	repo := newTestRepo(t)
+	if got := repo.GetPollState("tg"); got != 0 {
+		t.Errorf("initial tg offset = %d, want 0", got)
+	}
+	for _, pos := range []int64{100, 250} {
+		if err := repo.SetPollState("tg", pos); err != nil {
+			t.Fatalf("SetPollState: %v", err)
+		}
+		if got := repo.GetPollState("tg"); got != pos {
+			t.Errorf("tg offset = %d, want %d", got, pos)
+		}
+	}
+	if got := repo.GetPollState("max"); got != 0 {
+		t.Errorf("max marker = %d, want 0 (platforms are independent)", got)
+	}
+}
+
+func TestRepo_Inbox(t *testing.T) {
+	repo := newTestRepo(t)
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		if err := repo.PushInbox("tg", []byte(body)); err != nil {
+			t.Fatalf("PushInbox: %v", err)
+		}
+	}
+	repo.PushInbox("max", []byte(`{"n":4}`))
+
+	items, err := repo.PeekInbox("tg", 0, 2)
+	if err != nil || len(items) != 2 || string(items[0].Body) != `{"n":1}` || string(items[1].Body) != `{"n":2}` {
+		t.Fatalf("PeekInbox(tg, 0, 2) = %+v, %v; want first two tg updates in order", items, err)
+	}
+	rest, _ := repo.PeekInbox("tg", items[1].ID, 10)
+	if len(rest) != 1 || string(rest[0].Body) != `{"n":3}` {
+		t.Errorf("PeekInbox after id = %+v, want only the third update", rest)
+	}
+
+	if err := repo.DeleteInbox(items[0].ID); err != nil {
+		t.Fatalf("DeleteInbox: %v", err)
+	}
+	if left, _ := repo.PeekInbox("tg", 0, 10); len(left) != 2 {
+		t.Errorf("tg inbox after delete: %d items, want 2", len(left))
+	}
+	if other, _ := repo.PeekInbox("max", 0, 10); len(other) != 1 {
+		t.Errorf("max inbox: %d items, want 1 (platforms are independent)", len(other))
+	}
+}
+
+func TestRepo_TenantIsolation(t *testing.T) {
+	base := newTestRepo(t)
+	acme, globex := base.ForTenant("acme"), base.ForTenant("globex")
+
+	// Одинаковые ID чатов у разных арендаторов — разные связки
+	pairChats(t, acme, -100, 200)
+	pairChats(t, globex, -100, 300)
+	if got := acme.GetMaxChats(-100, 0); len(got) != 1 || got[0] != 200 {
+		t.Errorf("acme GetMaxChats = %v, want [200]", got)
+	}
+	if got := globex.GetMaxChats(-100, 0); len(got) != 1 || got[0] != 300 {
+		t.Errorf("globex GetMaxChats = %v, want [300]", got)
+	}
+	if got := base.GetMaxChats(-100, 0); len(got) != 0 {
+		t.Errorf("default tenant GetMaxChats = %v, want none", got)
+	}
+
+	acme.SaveMsg(-100, 7, 200, "mid.a")
+	if _, ok := globex.LookupTgMsgID("mid.a", -100); ok {
+		t.Error("globex sees acme message link")
+	}
+
+	acme.EnqueueSend(&QueueItem{Direction: "tg2max", SrcChatID: -100, DstChatID: 200, Text: "x"})
+	if items, _ := globex.PeekQueue(10); len(items) != 0 {
+		t.Errorf("globex queue = %d items, want 0", len(items))
+	}
+	if items, _ := acme.PeekQueue(10); len(items) != 1 {
+		t.Errorf("acme queue = %d items, want 1", len(items))
+	}
+
+	key := UpdateKey{Platform: "tg", ChatID: -100, MsgID: "7", Kind: "message"}
+	for _, r := range []Repository{acme, globex} {
+		if fresh, err := r.MarkUpdateProcessed(key); err != nil || !fresh {
+			t.Errorf("MarkUpdateProcessed = %v, %v; want fresh per tenant", fresh, err)
+		}
+	}
+
+	acme.SetPollState("tg", 42)
+	if got := globex.GetPollState("tg"); got != 0 {
+		t.Errorf("globex poll state = %d, want 0", got)
+	}
+
+	acme.PushInbox("tg", []byte(`{}`))
+	if items, _ := globex.PeekInbox("tg", 0, 10); len(items) != 0 {
+		t.Errorf("globex inbox = %d items, want 0", len(items))
+	}
+}
+
+func TestRepo_SentMessages(t *testing.T) {
+	base := newTestRepo(t)
+	acme, globex := base.ForTenant("acme"), base.ForTenant("globex")
+
+	acme.SaveSent("tg", -100, "7")
+	acme.SaveSent("tg", -100, "7") // повтор не ошибка
+	acme.SaveSent("max", 200, "mid.a")
+
+	if !acme.IsSent("tg", -100, "7") || !acme.IsSent("max", 200, "mid.a") {
+		t.Error("sent message not recognized")
+	}
+	// Записи арендатора не видны другим арендаторам той же БД
+	for _, r := range []Repository{globex, base} {
+		if r.IsSent("tg", -100, "7") || r.IsSent("max", 200, "mid.a") {
+			t.Error("sent message recognized by another tenant")
+		}
+	}
+	globex.SaveSent("tg", -100, "7")
+	if !globex.IsSent("tg", -100, "7") {
+		t.Error("same message id of another tenant not saved")
+	}
+	if acme.IsSent("tg", -100, "8") || acme.IsSent("tg", -101, "7") || acme.IsSent("max", -100, "7") {
+		t.Error("IsSent matched a different message")
+	}
+}
@@ -9,8 +9,9 @@ import (
 )
 
 type sqliteRepo struct {
-	db *sql.DB
-	mu sync.Mutex
+	db     *sql.DB
+	mu     *sync.Mutex // общий для всех арендаторов: запись в SQLite последовательная
+	tenant string      // tenant_id — запросы видят только данные своего арендатора
 }
 
 func NewSQLiteRepo(dbPath string) (Repository, error) {
@@ -23,27 +24,32 @@ func NewSQLiteRepo(dbPath string) (Repository, error) {
 		return nil, err
 	}
 
-	return &sqliteRepo{db: db}, nil
+	return &sqliteRepo{db: db, mu: &sync.Mutex{}}, nil
 }
 
-func (r *sqliteRepo) Register(key, platform string, chatID int64) (bool, string, error) {
+func (r *sqliteRepo) ForTenant(tenantID string) Repository {
+	return &sqliteRepo{db: r.db, mu: r.mu, tenant: tenantID}
+}
+
+func (r *sqliteRepo) Register(key, platform string, chatID int64, tgThreadID int) (bool, string, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if key == "" {
 		var existing string
-		err := r.db.QueryRow("SELECT key FROM pending WHERE platform = ? AND chat_id = ? AND command = 'bridge'", platform, chatID).Scan(&existing)
+		err := r.db.QueryRow("SELECT key FROM pending WHERE tenant_id = ? AND platform = ? AND chat_id = ? AND tg_thread_id = ? AND command = 'bridge'", r.tenant, platform, chatID, tgThreadID).Scan(&existing)
 		if err == nil {
 			return false, existing, nil
 		}
 		generated := genKey()
-		_, err = r.db.Exec("INSERT INTO pending (key, platform, chat_id, created_at, command) VALUES (?, ?, ?, ?, 'bridge')", generated, platform, chatID, time.Now().Unix())
+		_, err = r.db.Exec("INSERT INTO pending (tenant_id, key, platform, chat_id, tg_thread_id, created_at, command) VALUES (?, ?, ?, ?, ?, ?, 'bridge')", r.tenant, generated, platform, chatID, tgThreadID, time.Now().Unix())
 		return false, generated, err
 	}
 
 	var peerPlatform string
 	var peerChatID int64
-	err := r.db.QueryRow("SELECT platform, chat_id FROM pending WHERE key = ? AND command = 'bridge'", key).Scan(&peerPlatform, &peerChatID)
+	var peerThreadID int
+	err := r.db.QueryRow("SELECT platform, chat_id, tg_thread_id FROM pending WHERE tenant_id = ? AND key = ? AND command = 'bridge'", r.tenant, key).Scan(&peerPlatform, &peerChatID, &peerThreadID)
 	if err != nil {
 		return false, "", nil
 	}
@@ -51,152 +57,266 @@ func (r *sqliteRepo) Register(key, platform string, chatID int64) (bool, string,
 		return false, "", nil
 	}
 
-	r.db.Exec("DELETE FROM pending WHERE key = ?", key)
+	r.db.Exec("DELETE FROM pending WHERE tenant_id = ? AND key = ?", r.tenant, key)
 
 	var tgID, maxID int64
+	var threadID int
 	if platform == "tg" {
-		tgID, maxID = chatID, peerChatID
+		tgID, maxID, threadID = chatID, peerChatID, tgThreadID
 	} else {
-		tgID, maxID = peerChatID, chatID
+		tgID, maxID, threadID = peerChatID, chatID, peerThreadID
 	}
 
-	_, err = r.db.Exec("INSERT OR REPLACE INTO pairs (tg_chat_id, max_chat_id) VALUES (?, ?)", tgID, maxID)
+	// Пара TG-чат ↔ MAX-чат живёт либо в pairs (весь чат), либо в topic_pairs (один топик)
+	if threadID != 0 {
+		r.db.Exec("DELETE FROM pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", r.tenant, tgID, maxID)
+		_, err = r.db.Exec("INSERT OR REPLACE INTO topic_pairs (tenant_id, tg_chat_id, tg_thread_id, max_chat_id) VALUES (?, ?, ?, ?)", r.tenant, tgID, threadID, maxID)
+		return true, "", err
+	}
+	r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", r.tenant, tgID, maxID)
+	_, err = r.db.Exec("INSERT OR REPLACE INTO pairs (tenant_id, tg_chat_id, max_chat_id) VALUES (?, ?, ?)", r.tenant, tgID, maxID)
 	return true, "", err
 }
 
 func (r *sqliteRepo) MigrateTgChat(oldID, newID int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE pairs SET tg_chat_id = ? WHERE tg_chat_id = ?", newID, oldID)
+	_, err := r.db.Exec("UPDATE pairs SET tg_chat_id = ? WHERE tenant_id = ? AND tg_chat_id = ?", newID, r.tenant, oldID)
 	if err == nil {
-		r.db.Exec("UPDATE messages SET tg_chat_id = ? WHERE tg_chat_id = ?", newID, oldID)
+		r.db.Exec("UPDATE topic_pairs SET tg_chat_id = ? WHERE tenant_id = ? AND tg_chat_id = ?", newID, r.tenant, oldID)
+		r.db.Exec("UPDATE messages SET tg_chat_id = ? WHERE tenant_id = ? AND tg_chat_id = ?", newID, r.tenant, oldID)
+		r.db.Exec("UPDATE send_queue SET dst_chat_id = ? WHERE tenant_id = ? AND direction = 'max2tg' AND dst_chat_id = ?", newID, r.tenant, oldID)
+		r.db.Exec("UPDATE send_queue SET src_chat_id = ? WHERE tenant_id = ? AND direction = 'tg2max' AND src_chat_id = ?", newID, r.tenant, oldID)
+		r.db.Exec("UPDATE dead_letters SET dst_chat_id = ? WHERE tenant_id = ? AND direction = 'max2tg' AND dst_chat_id = ?", newID, r.tenant, oldID)
+		r.db.Exec("UPDATE dead_letters SET src_chat_id = ? WHERE tenant_id = ? AND direction = 'tg2max' AND src_chat_id = ?", newID, r.tenant, oldID)
 	}
 	return err
 }
 
-func (r *sqliteRepo) GetMaxChat(tgChatID int64) (int64, bool) {
-	var id int64
-	err := r.db.QueryRow("SELECT max_chat_id FROM pairs WHERE tg_chat_id = ?", tgChatID).Scan(&id)
-	return id, err == nil
+func (r *sqliteRepo) GetMaxChats(tgChatID int64, tgThreadID int) []int64 {
+	if tgThreadID != 0 {
+		ids := r.queryIDs("SELECT max_chat_id FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND tg_thread_id = ? ORDER BY max_chat_id", r.tenant, tgChatID, tgThreadID)
+		if len(ids) > 0 {
+			return ids
+		}
+	}
+	return r.queryIDs("SELECT max_chat_id FROM pairs WHERE tenant_id = ? AND tg_chat_id = ? ORDER BY max_chat_id", r.tenant, tgChatID)
 }
 
-func (r *sqliteRepo) GetTgChat(maxChatID int64) (int64, bool) {
-	var id int64
-	err := r.db.QueryRow("SELECT tg_chat_id FROM pairs WHERE max_chat_id = ?", maxChatID).Scan(&id)
-	return id, err == nil
+func (r *sqliteRepo) GetTgChats(maxChatID int64) []int64 {
+	return r.queryIDs(`SELECT tg_chat_id FROM pairs WHERE tenant_id = ? AND max_chat_id = ?
+		UNION SELECT tg_chat_id FROM topic_pairs WHERE tenant_id = ? AND max_chat_id = ? ORDER BY tg_chat_id`, r.tenant, maxChatID, r.tenant, maxChatID)
+}
+
+func (r *sqliteRepo) queryIDs(query string, args ...any) []int64 {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 func (r *sqliteRepo) SaveMsg(tgChatID int64, tgMsgID int, maxChatID int64, maxMsgID string) {
-	r.db.Exec("INSERT OR REPLACE INTO messages (tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at) VALUES (?, ?, ?, ?, ?)",
-		tgChatID, tgMsgID, maxChatID, maxMsgID, time.Now().Unix())
+	r.db.Exec("INSERT OR REPLACE INTO messages (tenant_id, tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		r.tenant, tgChatID, tgMsgID, maxChatID, maxMsgID, time.Now().Unix())
 }
 
-func (r *sqliteRepo) LookupMaxMsgID(tgChatID int64, tgMsgID int) (string, bool) {
+func (r *sqliteRepo) LookupMaxMsgID(tgChatID int64, tgMsgID int, maxChatID int64) (string, bool) {
 	var id string
-	err := r.db.QueryRow("SELECT max_msg_id FROM messages WHERE tg_chat_id = ? AND tg_msg_id = ?", tgChatID, tgMsgID).Scan(&id)
+	err := r.db.QueryRow("SELECT max_msg_id FROM messages WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? AND max_chat_id = ?", r.tenant, tgChatID, tgMsgID, maxChatID).Scan(&id)
 	return id, err == nil
 }
 
-func (r *sqliteRepo) LookupTgMsgID(maxMsgID string) (int64, int, bool) {
-	var chatID int64
+func (r *sqliteRepo) LookupTgMsgID(maxMsgID string, tgChatID int64) (int, bool) {
 	var msgID int
-	err := r.db.QueryRow("SELECT tg_chat_id, tg_msg_id FROM messages WHERE max_msg_id = ?", maxMsgID).Scan(&chatID, &msgID)
-	return chatID, msgID, err == nil
+	err := r.db.QueryRow("SELECT tg_msg_id FROM messages WHERE tenant_id = ? AND max_msg_id = ? AND tg_chat_id = ?", r.tenant, maxMsgID, tgChatID).Scan(&msgID)
+	return msgID, err == nil
+}
+
+func (r *sqliteRepo) LookupTgMsgIDs(maxMsgID string) []MsgLink {
+	rows, err := r.db.Query("SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id FROM messages WHERE tenant_id = ? AND max_msg_id = ? ORDER BY tg_chat_id, tg_msg_id", r.tenant, maxMsgID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var links []MsgLink
+	for rows.Next() {
+		var l MsgLink
+		if rows.Scan(&l.TgChatID, &l.TgMsgID, &l.MaxChatID, &l.MaxMsgID) == nil {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+func (r *sqliteRepo) LookupMaxMsgIDs(tgChatID int64, tgMsgID int) []MsgLink {
+	rows, err := r.db.Query("SELECT tg_chat_id, tg_msg_id, max_chat_id, max_msg_id FROM messages WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? ORDER BY max_chat_id", r.tenant, tgChatID, tgMsgID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var links []MsgLink
+	for rows.Next() {
+		var l MsgLink
+		if rows.Scan(&l.TgChatID, &l.TgMsgID, &l.MaxChatID, &l.MaxMsgID) == nil {
+			links = append(links, l)
+		}
+	}
+	return links
 }
 
 func (r *sqliteRepo) CleanOldMessages() {
-	r.db.Exec("DELETE FROM messages WHERE created_at < ?", time.Now().Unix()-48*3600)
-	r.db.Exec("DELETE FROM pending WHERE created_at > 0 AND created_at < ?", time.Now().Unix()-3600)
+	r.db.Exec("DELETE FROM messages WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+	r.db.Exec("DELETE FROM pending WHERE tenant_id = ? AND created_at > 0 AND created_at < ?", r.tenant, time.Now().Unix()-3600)
+	r.db.Exec("DELETE FROM processed_updates WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+	r.db.Exec("DELETE FROM sent_messages WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+	r.db.Exec("DELETE FROM reactions WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+	r.db.Exec("DELETE FROM reaction_notes WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+	r.db.Exec("DELETE FROM polls WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-7*24*3600)
+	r.db.Exec("DELETE FROM poll_votes WHERE tenant_id = ? AND max_msg_id NOT IN (SELECT max_msg_id FROM polls WHERE tenant_id = ?)", r.tenant, r.tenant)
+	r.db.Exec("DELETE FROM update_inbox WHERE tenant_id = ? AND created_at < ?", r.tenant, time.Now().Unix()-48*3600)
+}
+
+// pairSetting читает колонку col связки tgChatID ↔ maxChatID. Пара есть не больше чем
+// в одной из таблиц, ORDER BY только закрепляет порядок: сначала связка топика.
+func (r *sqliteRepo) pairSetting(col string, tgChatID, maxChatID int64, dest any) error {
+	return r.db.QueryRow(`SELECT `+col+` FROM (
+		SELECT `+col+`, 0 AS ord FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?
+		UNION ALL SELECT `+col+`, 1 FROM pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?
+	) AS p ORDER BY ord LIMIT 1`, r.tenant, tgChatID, maxChatID, r.tenant, tgChatID, maxChatID).Scan(dest)
+}
+
+// setPairSetting меняет колонку col одной связки tgChatID ↔ maxChatID.
+func (r *sqliteRepo) setPairSetting(col string, tgChatID, maxChatID int64, v any) bool {
+	n := affected(r.db.Exec("UPDATE topic_pairs SET "+col+" = ? WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", v, r.tenant, tgChatID, maxChatID))
+	n += affected(r.db.Exec("UPDATE pairs SET "+col+" = ? WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", v, r.tenant, tgChatID, maxChatID))
+	return n > 0
 }
 
-func (r *sqliteRepo) HasPrefix(platform string, chatID int64) bool {
+func (r *sqliteRepo) HasPrefix(tgChatID, maxChatID int64) bool {
 	var v int
-	var err error
-	if platform == "tg" {
-		err = r.db.QueryRow("SELECT prefix FROM pairs WHERE tg_chat_id = ?", chatID).Scan(&v)
-	} else {
-		err = r.db.QueryRow("SELECT prefix FROM pairs WHERE max_chat_id = ?", chatID).Scan(&v)
-	}
-	if err != nil {
+	if r.pairSetting("prefix", tgChatID, maxChatID, &v) != nil {
 		return true
 	}
 	return v == 1
 }
 
-func (r *sqliteRepo) SetPrefix(platform string, chatID int64, on bool) bool {
+func (r *sqliteRepo) SetPrefix(tgChatID, maxChatID int64, on bool) bool {
 	v := 0
 	if on {
 		v = 1
 	}
-	var res sql.Result
-	if platform == "tg" {
-		res, _ = r.db.Exec("UPDATE pairs SET prefix = ? WHERE tg_chat_id = ?", v, chatID)
-	} else {
-		res, _ = r.db.Exec("UPDATE pairs SET prefix = ? WHERE max_chat_id = ?", v, chatID)
-	}
-	if res == nil {
-		return false
+	return r.setPairSetting("prefix", tgChatID, maxChatID, v)
+}
+
+func (r *sqliteRepo) GetPairDirection(tgChatID, maxChatID int64) string {
+	var dir string
+	if r.pairSetting("direction", tgChatID, maxChatID, &dir) != nil {
+		return "both"
 	}
-	n, _ := res.RowsAffected()
-	return n > 0
+	return dir
+}
+
+func (r *sqliteRepo) SetPairDirection(tgChatID, maxChatID int64, direction string) bool {
+	return r.setPairSetting("direction", tgChatID, maxChatID, direction)
+}
+
+func (r *sqliteRepo) GetPairFormat(tgChatID, maxChatID int64) string {
+	var format string
+	r.pairSetting("format", tgChatID, maxChatID, &format)
+	return format
+}
+
+func (r *sqliteRepo) SetPairFormat(tgChatID, maxChatID int64, format string) bool {
+	return r.setPairSetting("format", tgChatID, maxChatID, format)
 }
 
 func (r *sqliteRepo) Unpair(platform string, chatID int64) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	var res sql.Result
+	col := "max_chat_id"
 	if platform == "tg" {
-		res, _ = r.db.Exec("DELETE FROM pairs WHERE tg_chat_id = ?", chatID)
-	} else {
-		res, _ = r.db.Exec("DELETE FROM pairs WHERE max_chat_id = ?", chatID)
+		col = "tg_chat_id"
 	}
-	if res == nil {
-		return false
-	}
-	n, _ := res.RowsAffected()
+	n := affected(r.db.Exec("DELETE FROM pairs WHERE tenant_id = ? AND "+col+" = ?", r.tenant, chatID))
+	n += affected(r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = ? AND "+col+" = ?", r.tenant, chatID))
 	return n > 0
 }
 
-func (r *sqliteRepo) GetTgThreadID(tgChatID int64) int {
+func (r *sqliteRepo) UnpairTopic(tgChatID int64, threadID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return affected(r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND tg_thread_id = ?", r.tenant, tgChatID, threadID)) > 0
+}
+
+func (r *sqliteRepo) GetTgThreadID(tgChatID, maxChatID int64) int {
 	var id int
-	r.db.QueryRow("SELECT COALESCE(tg_thread_id, 0) FROM pairs WHERE tg_chat_id = ?", tgChatID).Scan(&id)
+	err := r.db.QueryRow("SELECT tg_thread_id FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", r.tenant, tgChatID, maxChatID).Scan(&id)
+	if err == nil {
+		return id
+	}
+	r.db.QueryRow("SELECT COALESCE(tg_thread_id, 0) FROM pairs WHERE tenant_id = ? AND tg_chat_id = ? AND max_chat_id = ?", r.tenant, tgChatID, maxChatID).Scan(&id)
 	return id
 }
 
 func (r *sqliteRepo) SetTgThreadID(tgChatID int64, threadID int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = ? WHERE tg_chat_id = ?", threadID, tgChatID)
+	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = ? WHERE tenant_id = ? AND tg_chat_id = ?", threadID, r.tenant, tgChatID)
+	return err
+}
+
+func (r *sqliteRepo) ResetTgThread(tgChatID int64, threadID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("UPDATE pairs SET tg_thread_id = 0 WHERE tenant_id = ? AND tg_chat_id = ? AND tg_thread_id = ?", r.tenant, tgChatID, threadID)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT OR IGNORE INTO pairs (tenant_id, tg_chat_id, max_chat_id, prefix, direction, format)
+		SELECT tenant_id, tg_chat_id, max_chat_id, prefix, direction, format FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND tg_thread_id = ?`, r.tenant, tgChatID, threadID)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("DELETE FROM topic_pairs WHERE tenant_id = ? AND tg_chat_id = ? AND tg_thread_id = ?", r.tenant, tgChatID, threadID)
 	return err
 }
 
 func (r *sqliteRepo) PairCrosspost(tgChatID, maxChatID, ownerID, tgOwnerID int64) error {
-	_, err := r.db.Exec("INSERT OR REPLACE INTO crossposts (tg_chat_id, max_chat_id, created_at, owner_id, tg_owner_id) VALUES (?, ?, ?, ?, ?)",
-		tgChatID, maxChatID, time.Now().Unix(), ownerID, tgOwnerID)
+	_, err := r.db.Exec("INSERT OR REPLACE INTO crossposts (tenant_id, tg_chat_id, max_chat_id, created_at, owner_id, tg_owner_id) VALUES (?, ?, ?, ?, ?, ?)",
+		r.tenant, tgChatID, maxChatID, time.Now().Unix(), ownerID, tgOwnerID)
 	return err
 }
 
 func (r *sqliteRepo) GetCrosspostOwner(maxChatID int64) (maxOwner, tgOwner int64) {
-	r.db.QueryRow("SELECT owner_id, tg_owner_id FROM crossposts WHERE max_chat_id = ? AND deleted_at = 0", maxChatID).Scan(&maxOwner, &tgOwner)
+	r.db.QueryRow("SELECT owner_id, tg_owner_id FROM crossposts WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", r.tenant, maxChatID).Scan(&maxOwner, &tgOwner)
 	return
 }
 
 func (r *sqliteRepo) GetCrosspostMaxChat(tgChatID int64) (int64, string, bool) {
 	var id int64
 	var dir string
-	err := r.db.QueryRow("SELECT max_chat_id, direction FROM crossposts WHERE tg_chat_id = ? AND deleted_at = 0", tgChatID).Scan(&id, &dir)
+	err := r.db.QueryRow("SELECT max_chat_id, direction FROM crossposts WHERE tenant_id = ? AND tg_chat_id = ? AND deleted_at = 0", r.tenant, tgChatID).Scan(&id, &dir)
 	return id, dir, err == nil
 }
 
 func (r *sqliteRepo) GetCrosspostTgChat(maxChatID int64) (int64, string, bool) {
 	var id int64
 	var dir string
-	err := r.db.QueryRow("SELECT tg_chat_id, direction FROM crossposts WHERE max_chat_id = ? AND deleted_at = 0", maxChatID).Scan(&id, &dir)
+	err := r.db.QueryRow("SELECT tg_chat_id, direction FROM crossposts WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", r.tenant, maxChatID).Scan(&id, &dir)
 	return id, dir, err == nil
 }
 
 func (r *sqliteRepo) ListCrossposts(ownerID int64) []CrosspostLink {
-	rows, err := r.db.Query("SELECT tg_chat_id, max_chat_id, direction FROM crossposts WHERE (owner_id = ? OR tg_owner_id = ? OR (owner_id = 0 AND tg_owner_id = 0)) AND deleted_at = 0", ownerID, ownerID)
+	rows, err := r.db.Query("SELECT tg_chat_id, max_chat_id, direction FROM crossposts WHERE tenant_id = ? AND (owner_id = ? OR tg_owner_id = ? OR (owner_id = 0 AND tg_owner_id = 0)) AND deleted_at = 0", r.tenant, ownerID, ownerID)
 	if err != nil {
 		return nil
 	}
@@ -212,7 +332,7 @@ func (r *sqliteRepo) ListCrossposts(ownerID int64) []CrosspostLink {
 }
 
 func (r *sqliteRepo) SetCrosspostDirection(maxChatID int64, direction string) bool {
-	res, _ := r.db.Exec("UPDATE crossposts SET direction = ? WHERE max_chat_id = ? AND deleted_at = 0", direction, maxChatID)
+	res, _ := r.db.Exec("UPDATE crossposts SET direction = ? WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", direction, r.tenant, maxChatID)
 	if res == nil {
 		return false
 	}
@@ -223,8 +343,8 @@ func (r *sqliteRepo) SetCrosspostDirection(maxChatID int64, direction string) bo
 func (r *sqliteRepo) UnpairCrosspost(maxChatID, deletedBy int64) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	res, _ := r.db.Exec("UPDATE crossposts SET deleted_at = ?, deleted_by = ? WHERE max_chat_id = ? AND deleted_at = 0",
-		time.Now().Unix(), deletedBy, maxChatID)
+	res, _ := r.db.Exec("UPDATE crossposts SET deleted_at = ?, deleted_by = ? WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0",
+		time.Now().Unix(), deletedBy, r.tenant, maxChatID)
 	if res == nil {
 		return false
 	}
@@ -234,7 +354,7 @@ func (r *sqliteRepo) UnpairCrosspost(maxChatID, deletedBy int64) bool {
 
 func (r *sqliteRepo) GetCrosspostReplacements(maxChatID int64) CrosspostReplacements {
 	var raw string
-	r.db.QueryRow("SELECT replacements FROM crossposts WHERE max_chat_id = ? AND deleted_at = 0", maxChatID).Scan(&raw)
+	r.db.QueryRow("SELECT replacements FROM crossposts WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", r.tenant, maxChatID).Scan(&raw)
 	return parseCrosspostReplacements(raw)
 }
 
@@ -242,13 +362,13 @@ func (r *sqliteRepo) SetCrosspostReplacements(maxChatID int64, repl CrosspostRep
 	data := marshalCrosspostReplacements(repl)
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE crossposts SET replacements = ? WHERE max_chat_id = ? AND deleted_at = 0", data, maxChatID)
+	_, err := r.db.Exec("UPDATE crossposts SET replacements = ? WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", data, r.tenant, maxChatID)
 	return err
 }
 
 func (r *sqliteRepo) GetCrosspostSyncEdits(maxChatID int64) bool {
 	var v int
-	r.db.QueryRow("SELECT COALESCE(sync_edits, 0) FROM crossposts WHERE max_chat_id = ? AND deleted_at = 0", maxChatID).Scan(&v)
+	r.db.QueryRow("SELECT COALESCE(sync_edits, 0) FROM crossposts WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", r.tenant, maxChatID).Scan(&v)
 	return v != 0
 }
 
@@ -259,7 +379,7 @@ func (r *sqliteRepo) SetCrosspostSyncEdits(maxChatID int64, on bool) error {
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE crossposts SET sync_edits = ? WHERE max_chat_id = ? AND deleted_at = 0", v, maxChatID)
+	_, err := r.db.Exec("UPDATE crossposts SET sync_edits = ? WHERE tenant_id = ? AND max_chat_id = ? AND deleted_at = 0", v, r.tenant, maxChatID)
 	return err
 }
 
@@ -267,13 +387,13 @@ func (r *sqliteRepo) TouchUser(userID int64, platform, username, firstName strin
 	now := time.Now().Unix()
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.db.Exec(`INSERT INTO users (user_id, platform, username, first_name, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(user_id) DO UPDATE SET username=excluded.username, first_name=excluded.first_name, last_seen=excluded.last_seen`,
-		userID, platform, username, firstName, now, now)
+	r.db.Exec(`INSERT INTO users (tenant_id, user_id, platform, username, first_name, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tenant_id, user_id) DO UPDATE SET username=excluded.username, first_name=excluded.first_name, last_seen=excluded.last_seen`,
+		r.tenant, userID, platform, username, firstName, now, now)
 }
 
 func (r *sqliteRepo) ListUsers(platform string) ([]int64, error) {
-	rows, err := r.db.Query("SELECT user_id FROM users WHERE platform = ?", platform)
+	rows, err := r.db.Query("SELECT user_id FROM users WHERE tenant_id = ? AND platform = ?", r.tenant, platform)
 	if err != nil {
 		return nil, err
 	}
@@ -292,12 +412,12 @@ func (r *sqliteRepo) EnqueueSend(item *QueueItem) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	_, err := r.db.Exec(
-		`INSERT INTO send_queue (direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, attempts, created_at, next_retry)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)`,
-		item.Direction, item.SrcChatID, item.DstChatID, item.SrcMsgID,
+		`INSERT INTO send_queue (tenant_id, direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, payload, attempts, created_at, next_retry, last_error, history)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)`,
+		r.tenant, item.Direction, item.SrcChatID, item.DstChatID, item.SrcMsgID,
 		item.Text, item.AttType, item.AttToken, item.ReplyTo, item.Format,
-		item.AttURL, item.ParseMode,
-		item.CreatedAt, item.NextRetry,
+		item.AttURL, item.ParseMode, item.Payload,
+		item.CreatedAt, item.NextRetry, item.LastError, enqueueHistory(item),
 	)
 	return err
 }
@@ -305,10 +425,14 @@ func (r *sqliteRepo) EnqueueSend(item *QueueItem) error {
 func (r *sqliteRepo) PeekQueue(limit int) ([]QueueItem, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	// Элемент не берём, пока более ранний элемент того же чата ждёт своего ретрая — порядок сохраняется
+	now := time.Now().Unix()
 	rows, err := r.db.Query(
-		`SELECT id, direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, attempts, created_at, next_retry
-		 FROM send_queue WHERE next_retry <= ? ORDER BY id ASC LIMIT ?`,
-		time.Now().Unix(), limit,
+		`SELECT id, direction, src_chat_id, dst_chat_id, src_msg_id, text, att_type, att_token, reply_to, format, att_url, parse_mode, payload, attempts, created_at, next_retry, last_error
+		 FROM send_queue q WHERE tenant_id = ? AND next_retry <= ?
+		   AND NOT EXISTS (SELECT 1 FROM send_queue p WHERE p.tenant_id = q.tenant_id AND p.direction = q.direction AND p.dst_chat_id = q.dst_chat_id AND p.id < q.id AND p.next_retry > ?)
+		 ORDER BY id ASC LIMIT ?`,
+		r.tenant, now, now, limit,
 	)
 	if err != nil {
 		return nil, err
@@ -319,8 +443,8 @@ func (r *sqliteRepo) PeekQueue(limit int) ([]QueueItem, error) {
 		var q QueueItem
 		if err := rows.Scan(&q.ID, &q.Direction, &q.SrcChatID, &q.DstChatID, &q.SrcMsgID,
 			&q.Text, &q.AttType, &q.AttToken, &q.ReplyTo, &q.Format,
-			&q.AttURL, &q.ParseMode,
-			&q.Attempts, &q.CreatedAt, &q.NextRetry); err != nil {
+			&q.AttURL, &q.ParseMode, &q.Payload,
+			&q.Attempts, &q.CreatedAt, &q.NextRetry, &q.LastError); err != nil {
 			return nil, err
 		}
 		items = append(items, q)
@@ -331,17 +455,367 @@ func (r *sqliteRepo) PeekQueue(limit int) ([]QueueItem, error) {
 func (r *sqliteRepo) DeleteFromQueue(id int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("DELETE FROM send_queue WHERE id = ?", id)
+	_, err := r.db.Exec("DELETE FROM send_queue WHERE tenant_id = ? AND id = ?", r.tenant, id)
+	return err
+}
+
+func (r *sqliteRepo) IncrementAttempt(id int64, nextRetry int64, errText string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("UPDATE send_queue SET attempts = attempts + 1, next_retry = ?, last_error = ?, history = history || ? WHERE tenant_id = ? AND id = ?",
+		nextRetry, errText, queueHistoryLine(time.Now(), errText), r.tenant, id)
+	return err
+}
+
+func (r *sqliteRepo) CountQueue(platform string, chatID int64) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	srcDir, dstDir := queueChatDirs(platform)
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM send_queue WHERE tenant_id = ? AND ((direction = ? AND src_chat_id = ?) OR (direction = ? AND dst_chat_id = ?))",
+		r.tenant, srcDir, chatID, dstDir, chatID).Scan(&n)
+	return n
+}
+
+func (r *sqliteRepo) QueuedTo(direction string, dstChatID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM send_queue WHERE tenant_id = ? AND direction = ? AND dst_chat_id = ?",
+		r.tenant, direction, dstChatID).Scan(&n)
+	return n > 0
+}
+
+func (r *sqliteRepo) QueueStats() (map[string]QueueStat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]QueueStat)
+	rows, err := r.db.Query("SELECT direction, COUNT(*), MIN(created_at) FROM send_queue WHERE tenant_id = ? GROUP BY direction", r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanQueueStats(rows, stats, false); err != nil {
+		return nil, err
+	}
+	rows, err = r.db.Query("SELECT direction, COUNT(*), 0 FROM dead_letters WHERE tenant_id = ? GROUP BY direction", r.tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanQueueStats(rows, stats, true); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *sqliteRepo) MoveToDeadLetters(id int64, reason, errText string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var hist string
+	if errText != "" {
+		hist = queueHistoryLine(time.Now(), errText)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(
+		`INSERT INTO dead_letters (tenant_id, `+deadLetterCols+`, attempts, created_at, reason, last_error, history, dead_at)
+		 SELECT tenant_id, `+deadLetterCols+`, attempts, created_at, ?, COALESCE(NULLIF(?, ''), last_error), history || ?, ?
+		 FROM send_queue WHERE tenant_id = ? AND id = ?`,
+		reason, errText, hist, time.Now().Unix(), r.tenant, id,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM send_queue WHERE tenant_id = ? AND id = ?", r.tenant, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepo) ListDeadLetters(platform string, chatID int64, limit int) ([]DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	query := "SELECT id, " + deadLetterCols + ", attempts, created_at, reason, last_error, history, dead_at FROM dead_letters WHERE tenant_id = ?"
+	args := []any{r.tenant}
+	if platform != "" {
+		srcDir, dstDir := queueChatDirs(platform)
+		query += " AND ((direction = ? AND src_chat_id = ?) OR (direction = ? AND dst_chat_id = ?))"
+		args = append(args, srcDir, chatID, dstDir, chatID)
+	}
+	query += " ORDER BY id ASC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeadLetters(rows)
+}
+
+func (r *sqliteRepo) GetDeadLetter(id int64) (DeadLetter, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows, err := r.db.Query("SELECT id, "+deadLetterCols+", attempts, created_at, reason, last_error, history, dead_at FROM dead_letters WHERE tenant_id = ? AND id = ?", r.tenant, id)
+	if err != nil {
+		return DeadLetter{}, false
+	}
+	items, err := scanDeadLetters(rows)
+	if err != nil || len(items) == 0 {
+		return DeadLetter{}, false
+	}
+	return items[0], true
+}
+
+func (r *sqliteRepo) RetryDeadLetter(id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().Unix()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`INSERT INTO send_queue (tenant_id, `+deadLetterCols+`, attempts, created_at, next_retry, last_error, history)
+		 SELECT tenant_id, `+deadLetterCols+`, 0, ?, ?, last_error, history FROM dead_letters WHERE tenant_id = ? AND id = ?`,
+		now, now, r.tenant, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected(res, nil) == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM dead_letters WHERE tenant_id = ? AND id = ?", r.tenant, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *sqliteRepo) PurgeDeadLetters(platform string, chatID int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if platform == "" {
+		res, err := r.db.Exec("DELETE FROM dead_letters WHERE tenant_id = ?", r.tenant)
+		return affected(res, err), err
+	}
+	srcDir, dstDir := queueChatDirs(platform)
+	res, err := r.db.Exec("DELETE FROM dead_letters WHERE tenant_id = ? AND ((direction = ? AND src_chat_id = ?) OR (direction = ? AND dst_chat_id = ?))",
+		r.tenant, srcDir, chatID, dstDir, chatID)
+	return affected(res, err), err
+}
+
+func (r *sqliteRepo) MarkUpdateProcessed(key UpdateKey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, err := r.db.Exec(`INSERT INTO processed_updates (tenant_id, platform, chat_id, msg_id, kind, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, r.tenant, key.Platform, key.ChatID, key.MsgID, key.Kind, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *sqliteRepo) UpdateProcessed(key UpdateKey) (bool, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM processed_updates WHERE tenant_id = ? AND platform = ? AND chat_id = ? AND msg_id = ? AND kind = ?",
+		r.tenant, key.Platform, key.ChatID, key.MsgID, key.Kind).Scan(&n)
+	return n > 0, err
+}
+
+func (r *sqliteRepo) SetReactions(tgChatID int64, tgMsgID int, actorID int64, counts map[string]int) ([]ReactionCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM reactions WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? AND actor_id = ?", r.tenant, tgChatID, tgMsgID, actorID); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for emoji, n := range counts {
+		if n <= 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO reactions (tenant_id, tg_chat_id, tg_msg_id, actor_id, emoji, count, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			r.tenant, tgChatID, tgMsgID, actorID, emoji, n, now); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := tx.Query("SELECT emoji, SUM(count) AS n FROM reactions WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? GROUP BY emoji ORDER BY n DESC, emoji", r.tenant, tgChatID, tgMsgID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := scanReactionCounts(rows)
+	if err != nil {
+		return nil, err
+	}
+	return summary, tx.Commit()
+}
+
+func (r *sqliteRepo) GetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64) string {
+	var mid string
+	r.db.QueryRow("SELECT max_msg_id FROM reaction_notes WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? AND max_chat_id = ?", r.tenant, tgChatID, tgMsgID, maxChatID).Scan(&mid)
+	return mid
+}
+
+func (r *sqliteRepo) SetReactionNote(tgChatID int64, tgMsgID int, maxChatID int64, mid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if mid == "" {
+		r.db.Exec("DELETE FROM reaction_notes WHERE tenant_id = ? AND tg_chat_id = ? AND tg_msg_id = ? AND max_chat_id = ?", r.tenant, tgChatID, tgMsgID, maxChatID)
+		return
+	}
+	r.db.Exec(`INSERT INTO reaction_notes (tenant_id, tg_chat_id, tg_msg_id, max_chat_id, max_msg_id, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, tg_chat_id, tg_msg_id, max_chat_id) DO UPDATE SET max_msg_id = excluded.max_msg_id`,
+		r.tenant, tgChatID, tgMsgID, maxChatID, mid, time.Now().Unix())
+}
+
+func (r *sqliteRepo) SavePoll(p BridgedPoll) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec(`INSERT INTO polls (tenant_id, max_chat_id, max_msg_id, tg_chat_id, tg_msg_id, tg_poll_id, title, options, multiple, closed, tg_counts, tg_note_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		r.tenant, p.MaxChatID, p.MaxMsgID, p.TgChatID, p.TgMsgID, p.TgPollID, p.Title, jsonText(p.Options), p.Multiple, p.Closed, jsonText(p.TgCounts), p.TgNoteID, time.Now().Unix())
 	return err
 }
 
-func (r *sqliteRepo) IncrementAttempt(id int64, nextRetry int64) error {
+func (r *sqliteRepo) PollsByMaxMsg(maxMsgID string) []BridgedPoll {
+	return scanPolls(r.db.Query("SELECT "+pollColumns+" FROM polls WHERE tenant_id = ? AND max_msg_id = ? ORDER BY tg_chat_id", r.tenant, maxMsgID))
+}
+
+func (r *sqliteRepo) PollsByTgPoll(tgPollID string) []BridgedPoll {
+	return scanPolls(r.db.Query("SELECT "+pollColumns+" FROM polls WHERE tenant_id = ? AND tg_poll_id = ? ORDER BY max_msg_id", r.tenant, tgPollID))
+}
+
+func (r *sqliteRepo) SetPollTgCounts(tgPollID string, counts []int, closed bool) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, err := r.db.Exec("UPDATE send_queue SET attempts = attempts + 1, next_retry = ? WHERE id = ?", nextRetry, id)
+	_, err := r.db.Exec("UPDATE polls SET tg_counts = ?, closed = ? WHERE tenant_id = ? AND tg_poll_id = ?", jsonText(counts), closed, r.tenant, tgPollID)
 	return err
 }
 
+func (r *sqliteRepo) SetPollTgNote(maxMsgID string, tgChatID int64, noteID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("UPDATE polls SET tg_note_id = ? WHERE tenant_id = ? AND max_msg_id = ? AND tg_chat_id = ?", noteID, r.tenant, maxMsgID, tgChatID)
+	return err
+}
+
+func (r *sqliteRepo) GetPollVotes(maxMsgID string, userID int64) []int {
+	rows, err := r.db.Query("SELECT option_idx FROM poll_votes WHERE tenant_id = ? AND max_msg_id = ? AND user_id = ? ORDER BY option_idx", r.tenant, maxMsgID, userID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []int
+	for rows.Next() {
+		var idx int
+		if rows.Scan(&idx) == nil {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+func (r *sqliteRepo) SetPollVotes(maxMsgID string, userID int64, options []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE tenant_id = ? AND max_msg_id = ? AND user_id = ?", r.tenant, maxMsgID, userID); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, idx := range options {
+		if _, err := tx.Exec("INSERT INTO poll_votes (tenant_id, max_msg_id, user_id, option_idx, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			r.tenant, maxMsgID, userID, idx, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepo) CountPollVotes(maxMsgID string) map[int]int {
+	return scanPollVotes(r.db.Query("SELECT option_idx, COUNT(*) FROM poll_votes WHERE tenant_id = ? AND max_msg_id = ? GROUP BY option_idx", r.tenant, maxMsgID))
+}
+
+func (r *sqliteRepo) SaveSent(platform string, chatID int64, msgID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.db.Exec(`INSERT INTO sent_messages (tenant_id, platform, chat_id, msg_id, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, r.tenant, platform, chatID, msgID, time.Now().Unix())
+}
+
+func (r *sqliteRepo) IsSent(platform string, chatID int64, msgID string) bool {
+	var n int
+	r.db.QueryRow("SELECT COUNT(*) FROM sent_messages WHERE tenant_id = ? AND platform = ? AND chat_id = ? AND msg_id = ?", r.tenant, platform, chatID, msgID).Scan(&n)
+	return n > 0
+}
+
+func (r *sqliteRepo) GetPollState(platform string) int64 {
+	var pos int64
+	r.db.QueryRow("SELECT position FROM poll_state WHERE tenant_id = ? AND platform = ?", r.tenant, platform).Scan(&pos)
+	return pos
+}
+
+func (r *sqliteRepo) SetPollState(platform string, position int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec(`INSERT INTO poll_state (tenant_id, platform, position, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, platform) DO UPDATE SET position = excluded.position, updated_at = excluded.updated_at`,
+		r.tenant, platform, position, time.Now().Unix())
+	return err
+}
+
+func (r *sqliteRepo) PushInbox(platform string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("INSERT INTO update_inbox (tenant_id, platform, body, created_at) VALUES (?, ?, ?, ?)",
+		r.tenant, platform, string(body), time.Now().Unix())
+	return err
+}
+
+func (r *sqliteRepo) PeekInbox(platform string, afterID int64, limit int) ([]InboxItem, error) {
+	rows, err := r.db.Query("SELECT id, body FROM update_inbox WHERE tenant_id = ? AND platform = ? AND id > ? ORDER BY id LIMIT ?",
+		r.tenant, platform, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InboxItem
+	for rows.Next() {
+		var it InboxItem
+		var body string
+		if err := rows.Scan(&it.ID, &body); err != nil {
+			return nil, err
+		}
+		it.Body = []byte(body)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *sqliteRepo) DeleteInbox(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec("DELETE FROM update_inbox WHERE tenant_id = ? AND id = ?", r.tenant, id)
+	return err
+}
+
+func (r *sqliteRepo) Ping() error {
+	return r.db.Ping()
+}
+
 func (r *sqliteRepo) Close() error {
 	return r.db.Close()
 }
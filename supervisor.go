@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Параметры перезапуска listener'ов (переменные — чтобы тесты могли их ускорить).
+var (
+	listenerBackoffMin    = 1 * time.Second
+	listenerBackoffMax    = 5 * time.Minute
+	listenerStableAfter   = 1 * time.Minute  // проработал дольше — backoff сбрасывается
+	listenerWatchInterval = 15 * time.Second // как часто проверять, не пора ли предупредить операторов
+)
+
+const defaultListenerAlertAfter = 5 * time.Minute
+
+// superviseListener запускает listen и перезапускает его с экспоненциальным backoff,
+// пока не отменён ctx. Каждый запуск получает свой контекст: при перезапуске воркеры
+// предыдущего (polling, webhook-диспетчер) останавливаются, а listener заново
+// регистрирует webhook (SetWebhook в TG, Subscribe в MAX).
+func (b *Bridge) superviseListener(ctx context.Context, platform string, listen func(context.Context) error) {
+	backoff := listenerBackoffMin
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		started := time.Now()
+		err := listen(runCtx)
+		cancel()
+		b.health.stopped(platform)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) >= listenerStableAfter {
+			backoff = listenerBackoffMin
+		}
+		slog.Error("Listener stopped, restarting", "platform", platform, "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenerBackoffMax)
+	}
+}
+
+// watchListeners следит за listener'ами и предупреждает операторов,
+// если поток апдейтов платформы не работает дольше cfg.ListenerAlertAfter.
+func (b *Bridge) watchListeners(ctx context.Context) {
+	alerted := make(map[string]bool)
+	t := time.NewTicker(listenerWatchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			b.checkListeners(ctx, alerted)
+		}
+	}
+}
+
+// checkListeners шлёт операторам одно предупреждение на каждый простой платформы
+// и сообщение о восстановлении после него. alerted — по каким платформам уже предупредили.
+func (b *Bridge) checkListeners(ctx context.Context, alerted map[string]bool) {
+	threshold := b.conf().ListenerAlertAfter
+	if threshold <= 0 {
+		threshold = defaultListenerAlertAfter
+	}
+	for _, p := range []string{"tg", "max"} {
+		l, ok := b.health.listener(p)
+		if !ok {
+			continue
+		}
+		name := platformTitle(p)
+		switch {
+		case !l.Running && !alerted[p] && time.Since(l.StoppedAt) >= threshold:
+			alerted[p] = true
+			down := time.Since(l.StoppedAt).Round(time.Second)
+			slog.Error("Listener down too long", "platform", p, "down", down)
+			b.notifyOperators(ctx, fmt.Sprintf("⚠️ Мост: апдейты %s не приходят уже %s. Подключение перезапускается автоматически.", name, down))
+		case l.Running && alerted[p]:
+			alerted[p] = false
+			slog.Info("Listener recovered", "platform", p)
+			b.notifyOperators(ctx, fmt.Sprintf("✅ Мост: апдейты %s снова приходят.", name))
+		}
+	}
+}
+
+// notifyOperators отправляет служебное сообщение в чаты операторов обеих платформ.
+func (b *Bridge) notifyOperators(ctx context.Context, text string) {
+	for _, chatID := range b.conf().OperatorTgChats {
+		if _, err := b.tg.SendMessage(ctx, chatID, text, nil); err != nil {
+			slog.Warn("operator alert to TG failed", "chat", chatID, "err", err)
+		}
+	}
+	for _, chatID := range b.conf().OperatorMaxChats {
+		if _, err := b.max.SendMessage(ctx, &MaxMessage{ChatID: chatID, Text: text}); err != nil {
+			slog.Warn("operator alert to MAX failed", "chat", chatID, "err", err)
+		}
+	}
+}
+
+func platformTitle(platform string) string {
+	if platform == "max" {
+		return "MAX"
+	}
+	return "Telegram"
+}
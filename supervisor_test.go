@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSuperviseListener_RestartsWithFreshContext(t *testing.T) {
+	oldMin, oldMax := listenerBackoffMin, listenerBackoffMax
+	listenerBackoffMin, listenerBackoffMax = time.Millisecond, 4*time.Millisecond
+	defer func() { listenerBackoffMin, listenerBackoffMax = oldMin, oldMax }()
+
+	b, _, _ := newTestBridge(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int32
+	var prev context.Context
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.superviseListener(ctx, "tg", func(runCtx context.Context) error {
+			if prev != nil && prev.Err() == nil {
+				t.Error("previous run context not cancelled before restart")
+			}
+			prev = runCtx
+			if calls.Add(1) == 3 {
+				cancel()
+				<-runCtx.Done()
+				return nil
+			}
+			return errors.New("set webhook: boom")
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not stop after ctx cancel")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("listen calls = %d, want 3", n)
+	}
+	if l, ok := b.health.listener("tg"); !ok || l.Running {
+		t.Errorf("tg listener state = %+v, want stopped", l)
+	}
+}
+
+func TestCheckListeners_AlertsOperatorsOnce(t *testing.T) {
+	b, tg, mx := newTestBridge(t)
+	b.cfg.OperatorTgChats = []int64{-100}
+	b.cfg.OperatorMaxChats = []int64{200}
+	b.cfg.ListenerAlertAfter = time.Minute
+	ctx := context.Background()
+	alerted := make(map[string]bool)
+
+	b.health.started("tg", "polling")
+	b.health.started("max", "polling")
+	b.health.stopped("max")
+	b.checkListeners(ctx, alerted)
+	if len(tg.Sent) != 0 || len(mx.sent()) != 0 {
+		t.Fatalf("alert sent before threshold: tg=%v max=%v", tg.Sent, mx.sent())
+	}
+
+	b.health.listeners["max"].StoppedAt = time.Now().Add(-2 * time.Minute)
+	b.checkListeners(ctx, alerted)
+	b.checkListeners(ctx, alerted)
+	if len(tg.Sent) != 1 || len(mx.sent()) != 1 {
+		t.Fatalf("want one alert per operator chat, got tg=%d max=%d", len(tg.Sent), len(mx.sent()))
+	}
+	if tg.Sent[0].ChatID != -100 || !strings.Contains(tg.Sent[0].Text, "MAX") {
+		t.Errorf("tg alert = %+v", tg.Sent[0])
+	}
+	if m := mx.sent()[0]; m.ChatID != 200 || !strings.Contains(m.Text, "MAX") {
+		t.Errorf("max alert = %+v", m)
+	}
+
+	b.health.started("max", "polling")
+	b.checkListeners(ctx, alerted)
+	if len(tg.Sent) != 2 || !strings.Contains(tg.Sent[1].Text, "снова") {
+		t.Errorf("want recovery message, got %+v", tg.Sent)
+	}
+}
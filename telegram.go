@@ -6,40 +6,76 @@ import (
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
-	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	maxschemes "github.com/max-messenger/max-bot-api-client-go/schemes"
 )
 
-func (b *Bridge) listenTelegram(ctx context.Context) {
+// listenTelegram читает апдейты TG, пока не отменён ctx. Возвращает ошибку, если поток
+// апдейтов не удалось запустить или он закрылся; перезапуском занимается superviseListener.
+func (b *Bridge) listenTelegram(ctx context.Context) error {
 	var updates <-chan TGUpdate
 
 	if b.cfg.WebhookURL != "" {
 		whPath := b.tgWebhookPath()
 		whURL := strings.TrimRight(b.cfg.WebhookURL, "/") + whPath
 		if err := b.tg.SetWebhook(ctx, whURL); err != nil {
-			slog.Error("TG set webhook failed", "err", err)
-			return
+			return fmt.Errorf("TG set webhook: %w", err)
 		}
-		updates = b.tg.StartWebhook(ctx, whPath)
+		// Webhook принимает любая реплика (webhookHandler), апдейты читаются из inbox в БД
+		updates = inboxUpdates(ctx, b, "tg", b.tg.ParseUpdate, func(id int64) TGUpdate { return TGUpdate{InboxID: id} })
+		b.health.started("tg", "webhook")
 		slog.Info("TG webhook mode")
 	} else {
 		// Удаляем webhook если был, переключаемся на polling
 		b.tg.DeleteWebhook(ctx)
-		updates = b.tg.StartPolling(ctx)
+		// Продолжаем с сохранённого offset, чтобы не потерять апдейты, пришедшие во время рестарта
+		updates = b.tg.StartPolling(ctx, b.repo.GetPollState("tg"))
+		b.health.started("tg", "polling")
 		slog.Info("TG polling mode")
 	}
+	defer b.health.stopped("tg")
 
 	for {
+		// Предыдущий апдейт обработан — отметить его, когда доставки завершатся
+		b.endUpdate(ctx, &b.tgBatch)
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case update, ok := <-updates:
 			if !ok {
-				slog.Warn("TG updates channel closed")
-				return
+				return errors.New("TG updates channel closed")
+			}
+			if update.Checkpoint != 0 {
+				b.finishPollBatch(ctx, "tg", update.Checkpoint, update.Ack)
+				continue
+			}
+			if update.InboxID != 0 {
+				b.tgBatch.inboxID = update.InboxID
+				continue
+			}
+			b.health.touch("tg")
+			if key, ok := tgUpdateKey(update); !b.beginUpdate(&b.tgBatch, key, ok) {
+				continue
+			}
+
+			// Реакции: сводка у копий сообщения в MAX
+			if update.MessageReaction != nil {
+				b.handleTgReaction(ctx, update.MessageReaction)
+				continue
+			}
+			if update.MessageReactionCount != nil {
+				b.handleTgReactionCount(ctx, update.MessageReactionCount)
+				continue
+			}
+
+			// Новые счётчики голосов опроса: итоги в MAX
+			if update.Poll != nil {
+				b.handleTgPollUpdate(update.Poll)
+				continue
 			}
 
 			// Обработка channel posts (crosspost forwarding only)
@@ -55,64 +91,15 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 			// Обработка edit
 			if update.EditedMessage != nil {
 				edited := update.EditedMessage
-				if b.isSelfTgBot(edited.From) {
-					continue
-				}
-				maxChatID, linked := b.repo.GetMaxChat(edited.Chat.ID)
-				if !linked {
-					continue
-				}
-
-				hasMedia := edited.Photo != nil || edited.Video != nil || edited.Document != nil ||
-					edited.Animation != nil || edited.Sticker != nil || edited.Voice != nil || edited.Audio != nil
-
-				maxMsgID, hasMapping := b.repo.LookupMaxMsgID(edited.Chat.ID, edited.MessageID)
-
-				// Если маппинг не найден и есть медиа — отправляем как новое сообщение (fallback)
-				if hasMedia && !hasMapping {
-					prefix := b.repo.HasPrefix("tg", edited.Chat.ID)
-					caption := formatTgCaption(edited, prefix, b.cfg.MessageNewline)
-					go b.forwardTgToMax(ctx, edited, maxChatID, caption)
-					continue
-				}
-
-				if !hasMapping {
-					continue
-				}
-
-				prefix := b.repo.HasPrefix("tg", edited.Chat.ID)
-
-				if hasMedia {
-					// Edit с медиа — редактируем сообщение в MAX с новым вложением
-					caption := formatTgCaption(edited, prefix, b.cfg.MessageNewline)
-					go b.editTgMediaInMax(ctx, edited, maxChatID, maxMsgID, caption)
-					continue
-				}
-
-				// Текстовый edit — конвертируем entities в markdown
-				rawText := edited.Text
-				editEntities := edited.Entities
-				if rawText == "" {
-					rawText = edited.Caption
-					editEntities = edited.CaptionEntities
-				}
-				if rawText == "" {
+				if b.tgFromBridge(edited) {
 					continue
 				}
-				mdText := tgEntitiesToMarkdown(rawText, editEntities)
-				name := tgName(edited)
-				if prefix {
-					name = "[TG] " + name
-				}
-				fwd := formatAttribution(name, mdText, b.cfg.MessageNewline)
-				m := maxbot.NewMessage().SetChat(maxChatID).SetText(fwd)
-				if mdText != rawText {
-					m.SetFormat("markdown")
-				}
-				if err := b.maxApi.Messages.EditMessage(ctx, maxMsgID, m); err != nil {
-					slog.Error("TG→MAX edit failed", "err", err, "uid", tgUserID(edited), "tgChat", edited.Chat.ID)
-				} else {
-					slog.Info("TG→MAX edited", "mid", maxMsgID, "uid", tgUserID(edited), "tgChat", edited.Chat.ID)
+				// fan-out: правим копию в каждом связанном MAX-чате
+				for _, maxChatID := range b.repo.GetMaxChats(edited.Chat.ID, tgTopicID(edited)) {
+					if !b.pairAllows(edited.Chat.ID, maxChatID, "tg>max") {
+						continue
+					}
+					b.deliverToMax(maxChatID, func() { b.syncTgEditToMax(ctx, edited, maxChatID) })
 				}
 				continue
 			}
@@ -140,13 +127,13 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 
 			text := strings.TrimSpace(msg.Text)
 			// Убираем @botname из команд: /bridge@MaxTelegramBridgeBot → /bridge
+			// (только в первом слове: в аргументах @ бывает, например в шаблоне /bridge format)
 			if strings.HasPrefix(text, "/") {
-				if at := strings.Index(text, "@"); at > 0 {
-					rest := text[at:]
-					if sp := strings.IndexByte(rest, ' '); sp > 0 {
-						text = text[:at] + rest[sp:]
-					} else {
-						text = text[:at]
+				cmd, args, hasArgs := strings.Cut(text, " ")
+				if at := strings.Index(cmd, "@"); at > 0 {
+					text = cmd[:at]
+					if hasArgs {
+						text += " " + args
 					}
 				}
 			}
@@ -158,7 +145,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 			}
 
 			if text == "/whoami" {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
+				b.replyTg(ctx, msg.Chat.ID,
 					"MaxTelegramBridgeBot — мост между Telegram и MAX.\n"+
 						"Автор: Andrey Lugovskoy (@BEARlogin)\n"+
 						"Исходники: https://github.com/BEARlogin/max-telegram-bridge-bot\n"+
@@ -167,12 +154,17 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 			}
 
 			if text == "/start" || text == "/help" {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
+				b.replyTg(ctx, msg.Chat.ID,
 					"Бот-мост между Telegram и MAX.\n\n"+
 						"Команды (группы):\n"+
 						"/bridge — создать ключ для связки чатов\n"+
 						"/bridge <ключ> — связать этот чат с MAX-чатом по ключу\n"+
+						"(внутри топика форума связывается только этот топик)\n"+
 						"/bridge prefix on/off — включить/выключить префикс [TG]/[MAX]\n"+
+						"/bridge direction tg>max|max>tg|both — направление пересылки\n"+
+						"/bridge format <шаблон>|reset — оформление подписи, например {{bold .Name}}: {{.Text}}\n"+
+						"/del — ответом на сообщение: удалить его и копии в MAX (своё — любой, чужое и копии из MAX — админ)\n"+
+						"/queue — недоставленные сообщения (/queue retry <id>|all, /queue purge)\n"+
 						"/unbridge — удалить связку\n"+
 						"/thread — направить сообщения из MAX в текущий топик (форум)\n\n"+
 						"Кросспостинг каналов:\n"+
@@ -205,7 +197,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 					b.clearReplWait(msg.From.ID)
 					rule, valid := parseReplacementInput(text)
 					if !valid {
-						b.tg.SendMessage(ctx, msg.Chat.ID, "Неверный формат. Используйте:\n<code>from | to</code>\nили\n<code>/regex/ | to</code>", &SendOpts{ParseMode: "HTML", ThreadID: msg.MessageThreadID})
+						b.replyTg(ctx, msg.Chat.ID, "Неверный формат. Используйте:\n<code>from | to</code>\nили\n<code>/regex/ | to</code>", &SendOpts{ParseMode: "HTML", ThreadID: msg.MessageThreadID})
 						continue
 					}
 					rule.Target = w.target
@@ -217,7 +209,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 					}
 					if err := b.repo.SetCrosspostReplacements(w.maxChatID, repl); err != nil {
 						slog.Error("save replacements failed", "err", err)
-						b.tg.SendMessage(ctx, msg.Chat.ID, "Ошибка сохранения.", &SendOpts{ThreadID: msg.MessageThreadID})
+						b.replyTg(ctx, msg.Chat.ID, "Ошибка сохранения.", &SendOpts{ThreadID: msg.MessageThreadID})
 						continue
 					}
 					ruleType := "строка"
@@ -228,7 +220,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 					if w.direction == "max>tg" {
 						dirLabel = "MAX → TG"
 					}
-					b.tg.SendMessage(ctx, msg.Chat.ID,
+					b.replyTg(ctx, msg.Chat.ID,
 						fmt.Sprintf("Замена добавлена (%s, %s):\n<code>%s</code> → <code>%s</code>", dirLabel, ruleType, rule.From, rule.To),
 						&SendOpts{ParseMode: "HTML", ThreadID: msg.MessageThreadID})
 					continue
@@ -242,7 +234,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 				}
 				links := b.repo.ListCrossposts(msg.From.ID)
 				if len(links) == 0 {
-					b.tg.SendMessage(ctx, msg.Chat.ID,
+					b.replyTg(ctx, msg.Chat.ID,
 						"Нет активных связок.\n\nНастройка: перешлите пост из TG-канала сюда, затем в MAX-боте /crosspost <ID>", &SendOpts{ThreadID: msg.MessageThreadID})
 				} else {
 					for _, l := range links {
@@ -254,7 +246,7 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 						} else {
 							statusText += fmt.Sprintf("\nTG: «%s» (%d)\nMAX: %d", tgTitle, l.TgChatID, l.MaxChatID)
 						}
-						b.tg.SendMessage(ctx, msg.Chat.ID, statusText, &SendOpts{ReplyMarkup: kb, ThreadID: msg.MessageThreadID})
+						b.replyTg(ctx, msg.Chat.ID, statusText, &SendOpts{ReplyMarkup: kb, ThreadID: msg.MessageThreadID})
 					}
 				}
 				continue
@@ -278,11 +270,11 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 				if maxChatID, direction, ok := b.repo.GetCrosspostMaxChat(channelID); ok {
 					text := tgCrosspostStatusText(channelTitle, direction)
 					kb := tgCrosspostKeyboard(direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-					b.tg.SendMessage(ctx, msg.Chat.ID, text, &SendOpts{ReplyMarkup: kb, ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, text, &SendOpts{ReplyMarkup: kb, ThreadID: msg.MessageThreadID})
 					continue
 				}
 
-				b.tg.SendMessage(ctx, msg.Chat.ID,
+				b.replyTg(ctx, msg.Chat.ID,
 					fmt.Sprintf("TG-канал «%s»\nID: <code>%d</code>\n\nВ личке MAX-бота напишите:\n<code>/crosspost %d</code>\n\nMAX-бот: %s\n\nЗатем перешлите пост из MAX-канала в личку MAX-бота.", channelTitle, channelID, channelID, b.cfg.MaxBotURL),
 					&SendOpts{ParseMode: "HTML", ThreadID: msg.MessageThreadID})
 				continue
@@ -304,45 +296,105 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 					continue
 				}
 				if isGroup && !isAdmin {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
 					continue
 				}
-				if _, ok := b.repo.GetMaxChat(msg.Chat.ID); !ok {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Чат не связан. Сначала выполните /bridge.", &SendOpts{ThreadID: msg.MessageThreadID})
+				if len(b.repo.GetMaxChats(msg.Chat.ID, 0)) == 0 {
+					b.replyTg(ctx, msg.Chat.ID, "Чат не связан. Сначала выполните /bridge.", &SendOpts{ThreadID: msg.MessageThreadID})
 					continue
 				}
 				if msg.MessageThreadID != 0 {
 					b.repo.SetTgThreadID(msg.Chat.ID, msg.MessageThreadID)
-					b.tg.SendMessage(ctx, msg.Chat.ID,
+					b.replyTg(ctx, msg.Chat.ID,
 						fmt.Sprintf("Топик по умолчанию установлен (thread %d). Сообщения из MAX будут приходить сюда.", msg.MessageThreadID),
 						&SendOpts{ThreadID: msg.MessageThreadID})
 				} else {
 					b.repo.SetTgThreadID(msg.Chat.ID, 0)
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Топик сброшен. Сообщения из MAX будут приходить в основной чат.", &SendOpts{})
+					b.replyTg(ctx, msg.Chat.ID, "Топик сброшен. Сообщения из MAX будут приходить в основной чат.", &SendOpts{})
 				}
 				slog.Info("thread set", "tgChat", msg.Chat.ID, "thread", msg.MessageThreadID, "uid", tgUserID(msg))
 				continue
 			}
 
-			// /bridge prefix on/off
-			if text == "/bridge prefix on" || text == "/bridge prefix off" {
+			// /del — ответом на сообщение: удалить его и копии в MAX
+			if text == "/del" {
 				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
 					continue
 				}
-				if isGroup && !isAdmin {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+				target := msg.ReplyToMessage
+				// В топике форума сообщение без ответа «отвечает» на начало топика
+				if target == nil || (msg.IsTopicMessage && target.MessageID == msg.MessageThreadID) {
+					b.replyTg(ctx, msg.Chat.ID, "Отправьте /del ответом на сообщение, которое нужно удалить.", &SendOpts{ThreadID: msg.MessageThreadID})
 					continue
 				}
-				on := text == "/bridge prefix on"
-				if b.repo.SetPrefix("tg", msg.Chat.ID, on) {
-					if on {
-						b.tg.SendMessage(ctx, msg.Chat.ID, "Префикс [TG]/[MAX] включён.", &SendOpts{ThreadID: msg.MessageThreadID})
-					} else {
-						b.tg.SendMessage(ctx, msg.Chat.ID, "Префикс [TG]/[MAX] выключен.", &SendOpts{ThreadID: msg.MessageThreadID})
+				own := target.From != nil && target.From.ID == tgUserID(msg)
+				if isGroup && !isAdmin && !own {
+					b.replyTg(ctx, msg.Chat.ID, delDenied(b.tgFromBridge(target), "MAX"), &SendOpts{ThreadID: msg.MessageThreadID})
+					continue
+				}
+				refs, mids := b.beginDelete([]tgMsgRef{{chatID: msg.Chat.ID, msgID: target.MessageID}}, nil)
+				b.replyTgTask(msg.Chat.ID, func() {
+					if reply := b.deleteWithCopies(ctx, refs, mids); reply != "" {
+						b.tg.SendMessage(ctx, msg.Chat.ID, reply, &SendOpts{ThreadID: msg.MessageThreadID})
+						return
 					}
-				} else {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Чат не связан. Сначала выполните /bridge.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.tg.DeleteMessage(ctx, msg.Chat.ID, msg.MessageID)
+				})
+				continue
+			}
+
+			// /bridge prefix [<ID чата>] on|off
+			if text == "/bridge prefix" || strings.HasPrefix(text, "/bridge prefix ") {
+				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
+					continue
 				}
+				if isGroup && !isAdmin {
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					continue
+				}
+				args := strings.TrimSpace(strings.TrimPrefix(text, "/bridge prefix"))
+				b.replyTg(ctx, msg.Chat.ID, b.setPairPrefix("tg", msg.Chat.ID, tgTopicID(msg), args), &SendOpts{ThreadID: msg.MessageThreadID})
+				continue
+			}
+
+			// /bridge direction [<ID чата>] tg>max|max>tg|both
+			if text == "/bridge direction" || strings.HasPrefix(text, "/bridge direction ") {
+				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
+					continue
+				}
+				if isGroup && !isAdmin {
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					continue
+				}
+				dir := strings.TrimSpace(strings.TrimPrefix(text, "/bridge direction"))
+				b.replyTg(ctx, msg.Chat.ID, b.setPairDirection("tg", msg.Chat.ID, tgTopicID(msg), dir), &SendOpts{ThreadID: msg.MessageThreadID})
+				continue
+			}
+
+			// /bridge format [<ID чата>] <шаблон>|reset — шаблон подписи пересланных сообщений
+			if text == "/bridge format" || strings.HasPrefix(text, "/bridge format ") || strings.HasPrefix(text, "/bridge format\n") {
+				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
+					continue
+				}
+				if isGroup && !isAdmin {
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					continue
+				}
+				format := strings.TrimSpace(strings.TrimPrefix(text, "/bridge format"))
+				b.replyTg(ctx, msg.Chat.ID, b.setPairFormat("tg", msg.Chat.ID, tgTopicID(msg), format), &SendOpts{ThreadID: msg.MessageThreadID})
+				continue
+			}
+
+			// /queue, /queue retry <id|all>, /queue purge — недоставленные сообщения
+			if text == "/queue" || strings.HasPrefix(text, "/queue ") {
+				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
+					continue
+				}
+				if isGroup && !isAdmin {
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					continue
+				}
+				b.replyTg(ctx, msg.Chat.ID, b.queueCommand("tg", msg.Chat.ID, strings.TrimPrefix(text, "/queue")), &SendOpts{ThreadID: msg.MessageThreadID})
 				continue
 			}
 
@@ -352,88 +404,155 @@ func (b *Bridge) listenTelegram(ctx context.Context) {
 					continue
 				}
 				if isGroup && !isAdmin {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
 					continue
 				}
 				key := strings.TrimSpace(strings.TrimPrefix(text, "/bridge"))
-				paired, generatedKey, err := b.repo.Register(key, "tg", msg.Chat.ID)
+				paired, generatedKey, err := b.repo.Register(key, "tg", msg.Chat.ID, tgTopicID(msg))
 				if err != nil {
 					slog.Error("register failed", "err", err)
 					continue
 				}
 
-				if paired {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Связано! Сообщения теперь пересылаются.", &SendOpts{ThreadID: msg.MessageThreadID})
-					b.repo.SetTgThreadID(msg.Chat.ID, msg.MessageThreadID) // 0 = no topics
+				if paired && tgTopicID(msg) != 0 {
+					b.replyTg(ctx, msg.Chat.ID, "Связано! Сообщения этого топика теперь пересылаются.", &SendOpts{ThreadID: msg.MessageThreadID})
+					slog.Info("paired", "platform", "tg", "chat", msg.Chat.ID, "thread", tgTopicID(msg), "key", key)
+				} else if paired {
+					b.replyTg(ctx, msg.Chat.ID, "Связано! Сообщения теперь пересылаются.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.repo.SetTgThreadID(msg.Chat.ID, 0) // связка всего чата — без топика по умолчанию
 					slog.Info("paired", "platform", "tg", "chat", msg.Chat.ID, "key", key)
 				} else if generatedKey != "" {
-					b.tg.SendMessage(ctx, msg.Chat.ID,
+					b.replyTg(ctx, msg.Chat.ID,
 						fmt.Sprintf("Ключ для связки: <code>%s</code>\n\nОтправьте в MAX-чате:\n<code>/bridge %s</code>\n\nMAX-бот: %s", generatedKey, generatedKey, b.cfg.MaxBotURL),
 						&SendOpts{ParseMode: "HTML", ThreadID: msg.MessageThreadID})
 					slog.Info("pending", "platform", "tg", "chat", msg.Chat.ID, "key", generatedKey)
 				} else {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Ключ не найден или чат той же платформы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, "Ключ не найден или чат той же платформы.", &SendOpts{ThreadID: msg.MessageThreadID})
 				}
 				continue
 			}
 
 			if text == "/unbridge" {
 				if isGroup && !isAdmin {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, "Эта команда доступна только админам группы.", &SendOpts{ThreadID: msg.MessageThreadID})
 					continue
 				}
 				if !b.checkUserAllowed(ctx, msg.Chat.ID, tgUserID(msg), msg.MessageThreadID) {
 					continue
 				}
-				if b.repo.Unpair("tg", msg.Chat.ID) {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Связка удалена.", &SendOpts{ThreadID: msg.MessageThreadID})
+				// В топике со своей связкой /unbridge удаляет только её
+				if topic := tgTopicID(msg); topic != 0 && b.repo.UnpairTopic(msg.Chat.ID, topic) {
+					b.replyTg(ctx, msg.Chat.ID, "Связка топика удалена.", &SendOpts{ThreadID: msg.MessageThreadID})
+				} else if b.repo.Unpair("tg", msg.Chat.ID) {
+					b.replyTg(ctx, msg.Chat.ID, "Связка удалена.", &SendOpts{ThreadID: msg.MessageThreadID})
 				} else {
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Этот чат не связан.", &SendOpts{ThreadID: msg.MessageThreadID})
+					b.replyTg(ctx, msg.Chat.ID, "Этот чат не связан.", &SendOpts{ThreadID: msg.MessageThreadID})
 				}
 				continue
 			}
 
 			// Пересылка
-			maxChatID, linked := b.repo.GetMaxChat(msg.Chat.ID)
-			if !linked {
+			maxChatIDs := b.repo.GetMaxChats(msg.Chat.ID, tgTopicID(msg))
+			if len(maxChatIDs) == 0 {
 				continue
 			}
-			if b.isSelfTgBot(msg.From) {
+			// Сообщения мостов (этого и других) обратно не пересылаются — иначе петля
+			if b.tgFromBridge(msg) {
 				continue
 			}
 
-			prefix := b.repo.HasPrefix("tg", msg.Chat.ID)
-			caption := formatTgCaption(msg, prefix, b.cfg.MessageNewline)
-
-			// Проверяем anti-loop
-			checkText := msg.Text
-			if checkText == "" {
-				checkText = msg.Caption
-			}
-			if strings.HasPrefix(checkText, "[MAX]") || strings.HasPrefix(checkText, "[TG]") {
+			// Media group (альбом) — буферизуем и отправляем вместе
+			if msg.MediaGroupID != "" {
+				// Атрибуция у каждой связки своя — её добавит sendMediaGroupToMax
+				b.bufferMediaGroup(ctx, msg.MediaGroupID, newMediaGroupItem(msg, msg.Caption))
 				continue
 			}
 
-			// Media group (альбом) — буферизуем и отправляем вместе
-			if msg.MediaGroupID != "" {
-				videoID := ""
-				if msg.Video != nil {
-					videoID = msg.Video.FileID
+			var targets []int64
+			for _, maxChatID := range maxChatIDs {
+				if b.pairAllows(msg.Chat.ID, maxChatID, "tg>max") {
+					targets = append(targets, maxChatID)
 				}
-				go b.bufferMediaGroup(ctx, msg.MediaGroupID, mediaGroupItem{
-					photoSizes:  msg.Photo,
-					videoFileID: videoID,
-					caption:     caption,
-					replyToMsg:  msg.ReplyToMessage,
-					entities:    msg.CaptionEntities,
-					msg:         msg,
-				})
+			}
+			if len(targets) == 0 {
+				continue
+			}
+			// Файл, который MAX не примет, отклоняется один раз, а не в каждой связке
+			if warn := b.tgMediaRejection(msg); warn != "" {
+				b.replyTg(ctx, msg.Chat.ID, warn, nil)
 				continue
 			}
+			for _, maxChatID := range targets {
+				caption := b.tgCaption(msg, maxChatID)
+				b.deliverToMax(maxChatID, func() { b.forwardTgToMax(ctx, msg, maxChatID, caption) })
+			}
+		}
+	}
+}
+
+// syncTgEditToMax переносит правку TG-сообщения в его копию в одном MAX-чате.
+func (b *Bridge) syncTgEditToMax(ctx context.Context, edited *TGMessage, maxChatID int64) {
+	hasMedia := edited.Photo != nil || edited.Video != nil || edited.Document != nil ||
+		edited.Animation != nil || edited.Sticker != nil || edited.Voice != nil || edited.Audio != nil
 
-			go b.forwardTgToMax(ctx, msg, maxChatID, caption)
+	maxMsgID, hasMapping := b.repo.LookupMaxMsgID(edited.Chat.ID, edited.MessageID, maxChatID)
+
+	// Если маппинг не найден и есть медиа — отправляем как новое сообщение (fallback).
+	// Файл, отклонённый при отправке оригинала, молча пропускаем: предупреждение уже было
+	if hasMedia && !hasMapping {
+		if b.tgMediaRejection(edited) != "" {
+			return
 		}
+		b.forwardTgToMax(ctx, edited, maxChatID, b.tgCaption(edited, maxChatID))
+		return
+	}
+
+	if !hasMapping {
+		return
+	}
+
+	if edited.Location != nil {
+		// Обновление трансляции геопозиции
+		b.editTgLocationInMax(ctx, edited, maxChatID, maxMsgID)
+		return
+	}
+
+	if hasMedia {
+		// Edit с медиа — редактируем сообщение в MAX с новым вложением
+		b.editTgMediaInMax(ctx, edited, maxChatID, maxMsgID, b.tgCaption(edited, maxChatID))
+		return
+	}
+
+	// Текстовый edit — конвертируем entities в markdown
+	rawText := edited.Text
+	editEntities := edited.Entities
+	if rawText == "" {
+		rawText = edited.Caption
+		editEntities = edited.CaptionEntities
+	}
+	if rawText == "" {
+		return
+	}
+	mdText := tgEntitiesToMarkdown(rawText, editEntities)
+	fwd, formatted := b.attribute(tgAttribution(edited, mdText), edited.Chat.ID, maxChatID, mdText != rawText)
+	m := &MaxMessage{ChatID: maxChatID, Text: fwd}
+	if formatted {
+		m.Format = "markdown"
+	}
+	if err := b.max.EditMessage(ctx, maxMsgID, m); err != nil {
+		slog.Error("TG→MAX edit failed", "err", err, "uid", tgUserID(edited), "tgChat", edited.Chat.ID)
+	} else {
+		slog.Info("TG→MAX edited", "mid", maxMsgID, "uid", tgUserID(edited), "tgChat", edited.Chat.ID)
+	}
+}
+
+// tgTopicID возвращает топик форума, в котором отправлено сообщение (0 — вне топика).
+// MessageThreadID бывает и у обычных reply-тредов в супергруппах, поэтому смотрим на IsTopicMessage.
+func tgTopicID(msg *TGMessage) int {
+	if msg.IsTopicMessage {
+		return msg.MessageThreadID
 	}
+	return 0
 }
 
 func tgUserID(msg *TGMessage) int64 {
@@ -444,29 +563,130 @@ func tgUserID(msg *TGMessage) int64 {
 }
 
 // forwardTgToMax пересылает TG-сообщение (текст/медиа) в MAX-чат.
+// При временной ошибке сообщение ставится в очередь и будет собрано заново при ретрае.
 func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID int64, caption string) {
-	if b.cbBlocked(maxChatID) {
+	if b.cbBlocked(maxChatID) || b.alreadyForwardedTg(msg, maxChatID) {
+		return
+	}
+	payload := tg2maxPayload{Messages: []tgQueuedMsg{{Msg: msg, Caption: caption}}}
+	// Более ранние сообщения в этот чат ждут ретрая — встаём в очередь за ними, чтобы не обогнать.
+	if b.repo.QueuedTo("tg2max", maxChatID) {
+		b.enqueueTg2Max(msg.Chat.ID, maxChatID, payload, nil)
 		return
 	}
+	err := b.sendTgToMax(ctx, msg, maxChatID, caption)
+	if notice := errNotice(err); notice != "" {
+		b.noticeTgSource(ctx, msg, notice)
+	}
+	if err != nil && !isUndeliverable(err) {
+		b.queueTg2Max(ctx, msg.Chat.ID, maxChatID, payload, err)
+	}
+}
 
-	uid := tgUserID(msg)
+// tgMediaFile — файл TG-сообщения для проверок перед пересылкой: размер, имя, под
+// которым он уйдёт в MAX, и сверять ли расширение с MAX_ALLOWED_EXTENSIONS.
+// ok = false — файла нет (или он не проверяется, как обычный стикер).
+func tgMediaFile(msg *TGMessage) (size int, name string, checkExt, ok bool) {
+	orDefault := func(name, def string) string {
+		if name == "" {
+			return def
+		}
+		return name
+	}
+	switch {
+	case msg.Photo != nil:
+		return msg.Photo[len(msg.Photo)-1].FileSize, "", false, true
+	case msg.Animation != nil:
+		return msg.Animation.FileSize, orDefault(msg.Animation.FileName, "animation.mp4"), false, true
+	case msg.Sticker != nil:
+		return msg.Sticker.FileSize, "sticker.webm", false, msg.Sticker.IsAnimated
+	case msg.Video != nil:
+		return msg.Video.FileSize, orDefault(msg.Video.FileName, "video.mp4"), false, true
+	case msg.VideoNote != nil:
+		return msg.VideoNote.FileSize, "circle.mp4", false, true
+	case msg.Document != nil:
+		name := msg.Document.FileName
+		isVideo := strings.HasPrefix(msg.Document.MimeType, "video/")
+		if name == "" && isVideo {
+			name = mimeToFilename("video", msg.Document.MimeType)
+		}
+		return msg.Document.FileSize, orDefault(name, mimeToFilename("document", msg.Document.MimeType)), !isVideo, true
+	case msg.Voice != nil:
+		return msg.Voice.FileSize, "voice.ogg", false, true
+	case msg.Audio != nil:
+		return msg.Audio.FileSize, orDefault(msg.Audio.FileName, "audio.mp3"), true, true
+	}
+	return 0, "", false, false
+}
 
-	// checkSize returns true and sends warning if file exceeds TG_MAX_FILE_SIZE_MB limit.
-	// fileSize=0 means the size is unknown (old TG messages may omit it) — we skip the check.
-	checkSize := func(fileSize int, fileName string) bool {
-		limit := b.cfg.TgMaxFileSizeMB
-		if limit <= 0 || fileSize <= 0 || fileSize <= limit*1024*1024 {
-			return false
+// tgMediaRejection проверяет файл сообщения до пересылки: размер (TG_MAX_FILE_SIZE_MB)
+// и расширение (MAX_ALLOWED_EXTENSIONS, до загрузки на CDN). Возвращает предупреждение
+// для исходного чата или "", если файл можно пересылать. Проверка одна на исходное
+// сообщение: listener делает её до раздачи по связкам.
+func (b *Bridge) tgMediaRejection(msg *TGMessage) string {
+	size, name, checkExt, ok := tgMediaFile(msg)
+	if !ok {
+		return ""
+	}
+	// size = 0 — размер неизвестен (старые сообщения TG его не передают), не проверяем
+	if limit := b.conf().TgMaxFileSizeMB; limit > 0 && size > limit*1024*1024 {
+		if name == "" {
+			return fmt.Sprintf("⚠️ Файл слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
+				formatFileSize(size), limit)
+		}
+		return fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
+			name, formatFileSize(size), limit)
+	}
+	if exts := b.conf().MaxAllowedExts; exts != nil && checkExt {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if _, ok := exts[ext]; !ok {
+			return fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (расширение .%s не разрешено).", name, ext)
 		}
-		warn := fmt.Sprintf("⚠️ Файл слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
-			formatFileSize(fileSize), limit)
-		if fileName != "" {
-			warn = fmt.Sprintf("⚠️ Файл \"%s\" слишком большой для пересылки (%s). Максимальный размер файла %d МБ.",
-				fileName, formatFileSize(fileSize), limit)
+	}
+	return ""
+}
+
+// noticeTgSource отправляет в исходный TG-чат уведомление о том, что сообщение msg не
+// удалось переслать. Уведомление одно на сообщение: при раздаче по нескольким связкам
+// остальные отказы уже не пишутся.
+func (b *Bridge) noticeTgSource(ctx context.Context, msg *TGMessage, text string) {
+	ref := tgMsgRef{chatID: msg.Chat.ID, msgID: msg.MessageID}
+	b.noticeMu.Lock()
+	_, sent := b.notices[ref]
+	if !sent {
+		b.notices[ref] = time.Now()
+	}
+	b.noticeMu.Unlock()
+	if !sent {
+		b.tg.SendMessage(ctx, msg.Chat.ID, text, nil)
+	}
+}
+
+// expireNotices забывает уведомления старше часа: раздача сообщения по связкам к этому
+// времени давно закончилась.
+func (b *Bridge) expireNotices(now time.Time) {
+	b.noticeMu.Lock()
+	defer b.noticeMu.Unlock()
+	for ref, at := range b.notices {
+		if now.Sub(at) > time.Hour {
+			delete(b.notices, ref)
 		}
-		b.tg.SendMessage(ctx, msg.Chat.ID, warn, nil)
-		return true
 	}
+}
+
+// sendTgToMax собирает и отправляет TG-сообщение в MAX-чат: загружает медиа по file_id,
+// конвертирует форматирование, ищет reply. Если сообщение не доставлено, возвращается ошибка;
+// когда повтор бесполезен, она помечена undeliverable. Уведомление для исходного чата
+// (файл не загрузился) возвращается в ошибке (withNotice) — отправляет его вызывающий.
+// Размер и расширение файла к этому моменту уже проверены (tgMediaRejection).
+func (b *Bridge) sendTgToMax(ctx context.Context, msg *TGMessage, maxChatID int64, caption string) error {
+	if msg.Poll != nil {
+		return b.sendTgPollToMax(ctx, msg, maxChatID)
+	}
+	if msg.Location != nil || msg.Contact != nil {
+		return b.sendTgPlaceToMax(ctx, msg, maxChatID)
+	}
+	uid := tgUserID(msg)
 
 	// Определяем медиа
 	var mediaToken string
@@ -474,23 +694,16 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 
 	if msg.Photo != nil {
 		photo := msg.Photo[len(msg.Photo)-1]
-		if checkSize(photo.FileSize, "") {
-			return
-		}
 		// Конвертируем entities в markdown на сыром тексте (до атрибуции, иначе офсеты съезжают)
 		rawText := msg.Caption
 		if rawText == "" {
 			rawText = msg.Text
 		}
 		mdText := tgEntitiesToMarkdown(rawText, msg.CaptionEntities)
-		name := tgName(msg)
-		if b.repo.HasPrefix("tg", msg.Chat.ID) {
-			name = "[TG] " + name
-		}
-		mdCaption := formatAttribution(name, mdText, b.cfg.MessageNewline)
-		m := maxbot.NewMessage().SetChat(maxChatID).SetText(mdCaption)
-		if mdText != rawText {
-			m.SetFormat("markdown")
+		mdCaption, formatted := b.attribute(tgAttribution(msg, mdText), msg.Chat.ID, maxChatID, mdText != rawText)
+		m := &MaxMessage{ChatID: maxChatID, Text: mdCaption}
+		if formatted {
+			m.Format = "markdown"
 		}
 		if b.cfg.TgAPIURL != "" {
 			// Custom TG API — MAX не может скачать по URL, скачиваем и загружаем через reader
@@ -498,93 +711,96 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 				m.AddPhoto(uploaded)
 			} else {
 				slog.Error("TG→MAX photo upload failed", "err", err)
-				b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить фото в MAX.", nil)
-				return
+				return withNotice("Не удалось отправить фото в MAX.", err)
 			}
 		} else if fileURL, err := b.tgFileURL(ctx, photo.FileID); err == nil {
-			if uploaded, err := b.maxApi.Uploads.UploadPhotoFromUrl(ctx, fileURL); err == nil {
+			if uploaded, err := b.max.UploadPhotoFromURL(ctx, fileURL); err == nil {
 				m.AddPhoto(uploaded)
 			} else {
 				slog.Error("TG→MAX photo upload failed", "err", err)
-				b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить фото в MAX.", nil)
-				return
+				return withNotice("Не удалось отправить фото в MAX.", err)
 			}
 		}
 		if msg.ReplyToMessage != nil {
-			if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID); ok {
-				m.SetReply(mdCaption, maxReplyID)
+			if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID, maxChatID); ok {
+				m.ReplyTo = maxReplyID
 			}
 		}
 		slog.Info("TG→MAX sending photo", "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
-		result, err := b.maxApi.Messages.SendWithResult(ctx, m)
+		mid, err := b.max.SendMessage(ctx, m)
 		if err != nil {
-			slog.Error("TG→MAX send failed", "err", err, "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
-			if b.cbFail(maxChatID) {
+			slog.Error("TG→MAX send failed", "err", err, "kind", errKind(err), "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+			if errKind(err) != ErrPermanent {
+				return err // фото будет загружено заново при ретрае
+			}
+			if b.cbFail(maxChatID, err) {
 				b.tg.SendMessage(ctx, msg.Chat.ID,
 					fmt.Sprintf("Не удалось переслать в MAX. Пересылка приостановлена на %d мин. Проверьте, что бот добавлен в MAX-чат и является админом.", int(cbCooldown.Minutes())), nil)
 			}
+			return undeliverable(err)
 		} else {
 			b.cbSuccess(maxChatID)
-			slog.Info("TG→MAX sent", "mid", result.Body.Mid)
-			b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, result.Body.Mid)
+			slog.Info("TG→MAX sent", "mid", mid)
+			b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+			b.metricForward("tg2max", tgMsgType(msg), msg.Chat.ID, maxChatID)
 		}
-		return
+		return nil
 	} else if msg.Animation != nil {
 		// GIF в Telegram — это mp4 в поле Animation
 		name := "animation.mp4"
 		if msg.Animation.FileName != "" {
 			name = msg.Animation.FileName
 		}
-		if checkSize(msg.Animation.FileSize, name) {
-			return
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Animation.FileID, maxschemes.VIDEO, name); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = "video"
 		} else {
 			slog.Error("TG→MAX gif upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Не удалось отправить GIF \"%s\" в MAX.", name), nil)
-			return
+			return withNotice(fmt.Sprintf("Не удалось отправить GIF \"%s\" в MAX.", name), err)
 		}
 	} else if msg.Sticker != nil {
 		// Стикеры: обычные — WebP (фото), анимированные — TGS/WEBM
 		if msg.Sticker.IsAnimated {
-			if checkSize(msg.Sticker.FileSize, "sticker.webm") {
-				return
-			}
 			if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Sticker.FileID, maxschemes.FILE, "sticker.webm"); err == nil {
 				mediaToken = uploaded.Token
 				mediaAttType = "video"
 			} else {
 				slog.Error("TG→MAX sticker upload failed", "err", err)
-				b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить стикер в MAX.", nil)
-				return
+				return withNotice("Не удалось отправить стикер в MAX.", err)
 			}
 		} else {
 			// Обычный стикер WebP → отправляем как фото
 			if fileURL, err := b.tgFileURL(ctx, msg.Sticker.FileID); err == nil {
-				if uploaded, err := b.maxApi.Uploads.UploadPhotoFromUrl(ctx, fileURL); err == nil {
-					m := maxbot.NewMessage().SetChat(maxChatID).SetText(caption)
+				if uploaded, err := b.max.UploadPhotoFromURL(ctx, fileURL); err == nil {
+					// Подпись связки — по её шаблону, как у фото; в кросспостинге — caption канала
+					m := &MaxMessage{ChatID: maxChatID, Text: caption}
+					if slices.Contains(b.repo.GetMaxChats(msg.Chat.ID, tgTopicID(msg)), maxChatID) {
+						mdText := tgEntitiesToMarkdown(msg.Caption, msg.CaptionEntities)
+						var formatted bool
+						m.Text, formatted = b.attribute(tgAttribution(msg, mdText), msg.Chat.ID, maxChatID, mdText != msg.Caption)
+						if formatted {
+							m.Format = "markdown"
+						}
+					}
 					m.AddPhoto(uploaded)
 					if msg.ReplyToMessage != nil {
-						if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID); ok {
-							m.SetReply(caption, maxReplyID)
+						if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID, maxChatID); ok {
+							m.ReplyTo = maxReplyID
 						}
 					}
 					slog.Info("TG→MAX sending sticker as photo", "uid", uid, "tgChat", msg.Chat.ID)
-					result, err := b.maxApi.Messages.SendWithResult(ctx, m)
+					mid, err := b.max.SendMessage(ctx, m)
 					if err != nil {
 						slog.Error("TG→MAX sticker send failed", "err", err)
-						b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить стикер в MAX.", nil)
-					} else {
-						slog.Info("TG→MAX sent", "mid", result.Body.Mid)
-						b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, result.Body.Mid)
+						return withNotice("Не удалось отправить стикер в MAX.", err)
 					}
-					return
+					slog.Info("TG→MAX sent", "mid", mid)
+					b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+					b.metricForward("tg2max", tgMsgType(msg), msg.Chat.ID, maxChatID)
+					return nil
 				} else {
 					slog.Error("TG→MAX sticker photo upload failed", "err", err)
-					b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить стикер в MAX.", nil)
-					return
+					return withNotice("Не удалось отправить стикер в MAX.", err)
 				}
 			}
 		}
@@ -593,28 +809,20 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 		if msg.Video.FileName != "" {
 			name = msg.Video.FileName
 		}
-		if checkSize(msg.Video.FileSize, name) {
-			return
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Video.FileID, maxschemes.VIDEO, name); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = "video"
 		} else {
 			slog.Error("TG→MAX video upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Не удалось отправить видео \"%s\" в MAX.", name), nil)
-			return
+			return withNotice(fmt.Sprintf("Не удалось отправить видео \"%s\" в MAX.", name), err)
 		}
 	} else if msg.VideoNote != nil {
-		if checkSize(msg.VideoNote.FileSize, "circle.mp4") {
-			return
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.VideoNote.FileID, maxschemes.VIDEO, "circle.mp4"); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = "video"
 		} else {
 			slog.Error("TG→MAX video note upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить кружок в MAX.", nil)
-			return
+			return withNotice("Не удалось отправить кружок в MAX.", err)
 		}
 	} else if msg.Document != nil {
 		name := msg.Document.FileName
@@ -631,81 +839,44 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 		if name == "" {
 			name = mimeToFilename("document", msg.Document.MimeType)
 		}
-		if checkSize(msg.Document.FileSize, name) {
-			return
-		}
-		// Pre-check расширения до отправки на CDN (если whitelist задан)
-		if b.cfg.MaxAllowedExts != nil && attType == "file" {
-			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
-			if _, ok := b.cfg.MaxAllowedExts[ext]; !ok {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
-					fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (расширение .%s не разрешено).", name, ext), nil)
-				return
-			}
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Document.FileID, uploadType, name); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = attType
 		} else {
 			var e *ErrForbiddenExtension
 			if errors.As(err, &e) {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
-					fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", name), nil)
-				return
+				return withNotice(fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", name), err)
 			}
 			slog.Error("TG→MAX file upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID,
-				fmt.Sprintf("Не удалось отправить файл \"%s\" в MAX.", name), nil)
-			return
+			return withNotice(fmt.Sprintf("Не удалось отправить файл \"%s\" в MAX.", name), err)
 		}
 	} else if msg.Voice != nil {
-		if checkSize(msg.Voice.FileSize, "voice.ogg") {
-			return
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Voice.FileID, maxschemes.AUDIO, "voice.ogg"); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = "audio"
 		} else {
 			var e *ErrForbiddenExtension
 			if errors.As(err, &e) {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
-					fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", e.Name), nil)
-				return
+				return withNotice(fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", e.Name), err)
 			}
 			slog.Error("TG→MAX voice upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID, "Не удалось отправить голосовое сообщение в MAX.", nil)
-			return
+			return withNotice("Не удалось отправить голосовое сообщение в MAX.", err)
 		}
 	} else if msg.Audio != nil {
 		name := "audio.mp3"
 		if msg.Audio.FileName != "" {
 			name = msg.Audio.FileName
 		}
-		if checkSize(msg.Audio.FileSize, name) {
-			return
-		}
-		// Pre-check расширения до отправки на CDN (если whitelist задан)
-		if b.cfg.MaxAllowedExts != nil {
-			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
-			if _, ok := b.cfg.MaxAllowedExts[ext]; !ok {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
-					fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (расширение .%s не разрешено).", name, ext), nil)
-				return
-			}
-		}
 		if uploaded, err := b.uploadTgMediaToMax(ctx, msg.Audio.FileID, maxschemes.FILE, name); err == nil {
 			mediaToken = uploaded.Token
 			mediaAttType = "file"
 		} else {
 			var e *ErrForbiddenExtension
 			if errors.As(err, &e) {
-				b.tg.SendMessage(ctx, msg.Chat.ID,
-					fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", name), nil)
-				return
+				return withNotice(fmt.Sprintf("Файл \"%s\" не поддерживается в MAX (запрещённое расширение).", name), err)
 			}
 			slog.Error("TG→MAX audio upload failed", "err", err)
-			b.tg.SendMessage(ctx, msg.Chat.ID, fmt.Sprintf("Не удалось отправить аудио \"%s\" в MAX.", name), nil)
-			return
+			return withNotice(fmt.Sprintf("Не удалось отправить аудио \"%s\" в MAX.", name), err)
 		}
 	}
 
@@ -736,7 +907,7 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 		case msg.Sticker != nil:
 			mediaType = "[Стикер]"
 		default:
-			return
+			return nil
 		}
 		mdText = mdText + mediaType
 	}
@@ -744,16 +915,12 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 	// Reply ID
 	var replyTo string
 	if msg.ReplyToMessage != nil {
-		if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID); ok {
+		if maxReplyID, ok := b.repo.LookupMaxMsgID(msg.Chat.ID, msg.ReplyToMessage.MessageID, maxChatID); ok {
 			replyTo = maxReplyID
 		}
 	}
 
-	name := tgName(msg)
-	if b.repo.HasPrefix("tg", msg.Chat.ID) {
-		name = "[TG] " + name
-	}
-	mdCaption := formatAttribution(name, mdText, b.cfg.MessageNewline)
+	mdCaption, hasFormatting := b.attribute(tgAttribution(msg, mdText), msg.Chat.ID, maxChatID, hasFormatting)
 
 	var mid string
 	var sendErr error
@@ -775,31 +942,29 @@ func (b *Bridge) forwardTgToMax(ctx context.Context, msg *TGMessage, maxChatID i
 	}
 
 	if sendErr != nil {
-		errStr := sendErr.Error()
-		slog.Error("TG→MAX send failed", "err", errStr, "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
-		// 403/404 — permanent error, не ретраим
-		if !strings.Contains(errStr, "403") && !strings.Contains(errStr, "404") && !strings.Contains(errStr, "chat.denied") {
-			var format string
-			if hasFormatting {
-				format = "markdown"
+		kind := errKind(sendErr)
+		slog.Error("TG→MAX send failed", "err", sendErr, "kind", kind, "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+		// Permanent — бот не имеет доступа к чату, не ретраим
+		if kind == ErrPermanent {
+			if b.cbFail(maxChatID, sendErr) {
+				b.tg.SendMessage(ctx, msg.Chat.ID,
+					fmt.Sprintf("Не удалось переслать в MAX. Пересылка приостановлена на %d мин. Проверьте, что бот добавлен в MAX-чат и является админом.", int(cbCooldown.Minutes())), nil)
 			}
-			b.enqueueTg2Max(msg.Chat.ID, msg.MessageID, maxChatID, mdCaption, mediaAttType, mediaToken, replyTo, format)
-		}
-		if b.cbFail(maxChatID) {
-			b.tg.SendMessage(ctx, msg.Chat.ID,
-				"MAX API недоступен. Сообщения в очереди, будут доставлены автоматически.", nil)
+			return undeliverable(sendErr)
 		}
-	} else {
-		b.cbSuccess(maxChatID)
-		slog.Info("TG→MAX sent", "mid", mid, "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
-		b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+		return sendErr
 	}
+	b.cbSuccess(maxChatID)
+	slog.Info("TG→MAX sent", "mid", mid, "uid", uid, "tgChat", msg.Chat.ID, "maxChat", maxChatID)
+	b.repo.SaveMsg(msg.Chat.ID, msg.MessageID, maxChatID, mid)
+	b.metricForward("tg2max", tgMsgType(msg), msg.Chat.ID, maxChatID)
+	return nil
 }
 
 // editTgMediaInMax редактирует сообщение с медиа в MAX (TG→MAX edit с вложением).
 func (b *Bridge) editTgMediaInMax(ctx context.Context, msg *TGMessage, maxChatID int64, maxMsgID string, caption string) {
 	uid := tgUserID(msg)
-	m := maxbot.NewMessage().SetChat(maxChatID)
+	m := &MaxMessage{ChatID: maxChatID}
 
 	// Конвертируем entities в markdown на сыром тексте (до атрибуции)
 	rawText := msg.Caption
@@ -809,14 +974,10 @@ func (b *Bridge) editTgMediaInMax(ctx context.Context, msg *TGMessage, maxChatID
 		editEntities = msg.Entities
 	}
 	mdText := tgEntitiesToMarkdown(rawText, editEntities)
-	name := tgName(msg)
-	if b.repo.HasPrefix("tg", msg.Chat.ID) {
-		name = "[TG] " + name
-	}
-	mdCaption := formatAttribution(name, mdText, b.cfg.MessageNewline)
-	m.SetText(mdCaption)
-	if mdText != rawText {
-		m.SetFormat("markdown")
+	mdCaption, formatted := b.attribute(tgAttribution(msg, mdText), msg.Chat.ID, maxChatID, mdText != rawText)
+	m.Text = mdCaption
+	if formatted {
+		m.Format = "markdown"
 	}
 
 	if msg.Photo != nil {
@@ -829,7 +990,7 @@ func (b *Bridge) editTgMediaInMax(ctx context.Context, msg *TGMessage, maxChatID
 				return
 			}
 		} else if fileURL, err := b.tgFileURL(ctx, photo.FileID); err == nil {
-			if uploaded, err := b.maxApi.Uploads.UploadPhotoFromUrl(ctx, fileURL); err == nil {
+			if uploaded, err := b.max.UploadPhotoFromURL(ctx, fileURL); err == nil {
 				m.AddPhoto(uploaded)
 			} else {
 				slog.Error("TG→MAX edit photo upload failed", "err", err)
@@ -838,7 +999,7 @@ func (b *Bridge) editTgMediaInMax(ctx context.Context, msg *TGMessage, maxChatID
 		}
 	}
 
-	if err := b.maxApi.Messages.EditMessage(ctx, maxMsgID, m); err != nil {
+	if err := b.max.EditMessage(ctx, maxMsgID, m); err != nil {
 		slog.Error("TG→MAX edit media failed", "err", err, "uid", uid, "tgChat", msg.Chat.ID, "maxMsgID", maxMsgID)
 	} else {
 		slog.Info("TG→MAX edited media", "mid", maxMsgID, "uid", uid, "tgChat", msg.Chat.ID)
@@ -862,12 +1023,8 @@ func (b *Bridge) handleTgChannelPost(ctx context.Context, msg *TGMessage) {
 		return // только MAX→TG, пропускаем
 	}
 
-	// Anti-loop
-	checkText := msg.Text
-	if checkText == "" {
-		checkText = msg.Caption
-	}
-	if strings.HasPrefix(checkText, "[MAX]") || strings.HasPrefix(checkText, "[TG]") {
+	// Anti-loop: пост, опубликованный мостом
+	if b.tgFromBridge(msg) {
 		return
 	}
 
@@ -881,24 +1038,18 @@ func (b *Bridge) handleTgChannelPost(ctx context.Context, msg *TGMessage) {
 
 	// Media group (альбом) — буферизуем и отправляем вместе
 	if msg.MediaGroupID != "" {
-		videoID := ""
-		if msg.Video != nil {
-			videoID = msg.Video.FileID
-		}
-		go b.bufferMediaGroup(ctx, msg.MediaGroupID, mediaGroupItem{
-			photoSizes:  msg.Photo,
-			videoFileID: videoID,
-			caption:     caption,
-			replyToMsg:  msg.ReplyToMessage,
-			entities:    msg.CaptionEntities,
-			msg:         msg,
-			maxChatID:   maxChatID,
-			crosspost:   true,
-		})
+		item := newMediaGroupItem(msg, caption)
+		item.maxChatID = maxChatID
+		item.crosspost = true
+		b.bufferMediaGroup(ctx, msg.MediaGroupID, item)
 		return
 	}
 
-	go b.forwardTgToMax(ctx, msg, maxChatID, caption)
+	if warn := b.tgMediaRejection(msg); warn != "" {
+		b.replyTg(ctx, msg.Chat.ID, warn, nil)
+		return
+	}
+	b.deliverToMax(maxChatID, func() { b.forwardTgToMax(ctx, msg, maxChatID, caption) })
 }
 
 // handleTgCallback обрабатывает нажатия inline-кнопок (crosspost management).
@@ -936,7 +1087,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		title := parseTgCrosspostTitle(query.Message.Text)
 		text := tgCrosspostStatusText(title, dir)
 		kb := tgCrosspostKeyboard(dir, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.tg.EditMessageText(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "Готово")
 		return
 	}
@@ -957,7 +1108,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		_, direction, _ := b.repo.GetCrosspostTgChat(maxChatID)
 		text := tgCrosspostStatusText(title, direction)
 		kb := tgCrosspostKeyboard(direction, maxChatID, !cur)
-		b.tg.EditMessageText(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
 		if !cur {
 			b.tg.AnswerCallback(ctx, query.ID, "Синхронизация правок включена")
 		} else {
@@ -982,7 +1133,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 				NewInlineButton("Отмена", fmt.Sprintf("cpux:%d", maxChatID)),
 			),
 		)
-		b.tg.EditMessageText(ctx, chatID, msgID, "Удалить кросспостинг?", &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, "Удалить кросспостинг?", &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "")
 		return
 	}
@@ -996,16 +1147,16 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		repl := b.repo.GetCrosspostReplacements(maxChatID)
 		id := strconv.FormatInt(maxChatID, 10)
 		// Удаляем сообщение со связкой
-		b.tg.DeleteMessage(ctx, chatID, msgID)
+		b.replyTgTask(chatID, func() { b.tg.DeleteMessage(ctx, chatID, msgID) })
 		// Заголовок с кнопками добавления
 		kb := tgReplacementsKeyboard(maxChatID)
-		b.tg.SendMessage(ctx, chatID, formatReplacementsHeader(repl), &SendOpts{ReplyMarkup: kb})
+		b.replyTg(ctx, chatID, formatReplacementsHeader(repl), &SendOpts{ReplyMarkup: kb})
 		// Каждая замена — отдельное сообщение с кнопкой удаления
 		for i, r := range repl.TgToMax {
-			b.tg.SendMessage(ctx, chatID, formatReplacementItem(r, "tg>max"), &SendOpts{ParseMode: "HTML", ReplyMarkup: tgReplItemKeyboard("tg>max", i, id, r.Target)})
+			b.replyTg(ctx, chatID, formatReplacementItem(r, "tg>max"), &SendOpts{ParseMode: "HTML", ReplyMarkup: tgReplItemKeyboard("tg>max", i, id, r.Target)})
 		}
 		for i, r := range repl.MaxToTg {
-			b.tg.SendMessage(ctx, chatID, formatReplacementItem(r, "max>tg"), &SendOpts{ParseMode: "HTML", ReplyMarkup: tgReplItemKeyboard("max>tg", i, id, r.Target)})
+			b.replyTg(ctx, chatID, formatReplacementItem(r, "max>tg"), &SendOpts{ParseMode: "HTML", ReplyMarkup: tgReplItemKeyboard("max>tg", i, id, r.Target)})
 		}
 		b.tg.AnswerCallback(ctx, query.ID, "")
 		return
@@ -1043,7 +1194,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		// Обновляем сообщение
 		newText := formatReplacementItem(*r, dir)
 		kb := tgReplItemKeyboard(dir, idx, id, r.Target)
-		b.tg.EditMessageText(ctx, chatID, msgID, newText, &SendOpts{ParseMode: "HTML", ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, newText, &SendOpts{ParseMode: "HTML", ReplyMarkup: kb})
 		label := "весь текст"
 		if newTarget == "links" {
 			label = "только ссылки"
@@ -1074,7 +1225,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 			repl.MaxToTg = append(repl.MaxToTg[:idx], repl.MaxToTg[idx+1:]...)
 		}
 		b.repo.SetCrosspostReplacements(maxChatID, repl)
-		b.tg.EditMessageText(ctx, chatID, msgID, "Замена удалена.", nil)
+		b.replyTgEdit(ctx, chatID, msgID, "Замена удалена.", nil)
 		b.tg.AnswerCallback(ctx, query.ID, "Удалено")
 		return
 	}
@@ -1097,7 +1248,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 				NewInlineButton("🔗 Только ссылки", "cprat:"+dir+":links:"+id),
 			),
 		)
-		b.tg.EditMessageText(ctx, chatID, msgID,
+		b.replyTgEdit(ctx, chatID, msgID,
 			fmt.Sprintf("Добавление замены для %s.\nГде применять замену?", dirLabel), &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "")
 		return
@@ -1116,7 +1267,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 			return
 		}
 		b.setReplWait(fromID, maxChatID, dir, target)
-		b.tg.EditMessageText(ctx, chatID, msgID,
+		b.replyTgEdit(ctx, chatID, msgID,
 			fmt.Sprintf("Отправьте правило замены:\n<code>from | to</code>\n\nДля регулярного выражения:\n<code>/regex/ | to</code>\n\nНапример:\n<code>utm_source=tg | utm_source=max</code>"),
 			&SendOpts{ParseMode: "HTML"})
 		b.tg.AnswerCallback(ctx, query.ID, "")
@@ -1132,7 +1283,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		b.repo.SetCrosspostReplacements(maxChatID, CrosspostReplacements{})
 		repl := b.repo.GetCrosspostReplacements(maxChatID)
 		kb := tgReplacementsKeyboard(maxChatID)
-		b.tg.EditMessageText(ctx, chatID, msgID, formatReplacementsHeader(repl), &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, formatReplacementsHeader(repl), &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "Очищено")
 		return
 	}
@@ -1150,7 +1301,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		title := parseTgCrosspostTitle(query.Message.Text)
 		text := tgCrosspostStatusText(title, direction) + fmt.Sprintf("\nTG: ↔ MAX: %d", maxChatID)
 		kb := tgCrosspostKeyboard(direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.tg.EditMessageText(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "")
 		return
 	}
@@ -1167,7 +1318,7 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		}
 		slog.Info("TG crosspost unlink", "maxChatID", maxChatID, "by", fromID)
 		b.repo.UnpairCrosspost(maxChatID, fromID)
-		b.tg.EditMessageText(ctx, chatID, msgID, "Кросспостинг удалён.", nil)
+		b.replyTgEdit(ctx, chatID, msgID, "Кросспостинг удалён.", nil)
 		b.tg.AnswerCallback(ctx, query.ID, "Удалено")
 		return
 	}
@@ -1181,14 +1332,14 @@ func (b *Bridge) handleTgCallback(ctx context.Context, query *TGCallback) {
 		// Lookup current direction
 		_, direction, ok := b.repo.GetCrosspostTgChat(maxChatID)
 		if !ok {
-			b.tg.EditMessageText(ctx, chatID, msgID, "Кросспостинг не найден.", nil)
+			b.replyTgEdit(ctx, chatID, msgID, "Кросспостинг не найден.", nil)
 			b.tg.AnswerCallback(ctx, query.ID, "")
 			return
 		}
 		title := parseTgCrosspostTitle(query.Message.Text)
 		text := tgCrosspostStatusText(title, direction)
 		kb := tgCrosspostKeyboard(direction, maxChatID, b.repo.GetCrosspostSyncEdits(maxChatID))
-		b.tg.EditMessageText(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
+		b.replyTgEdit(ctx, chatID, msgID, text, &SendOpts{ReplyMarkup: kb})
 		b.tg.AnswerCallback(ctx, query.ID, "")
 		return
 	}
@@ -1254,15 +1405,14 @@ func parseTgCrosspostTitle(text string) string {
 
 // handleTgEditedChannelPost обрабатывает редактирования постов в TG-каналах.
 func (b *Bridge) handleTgEditedChannelPost(ctx context.Context, edited *TGMessage) {
-	maxMsgID, ok := b.repo.LookupMaxMsgID(edited.Chat.ID, edited.MessageID)
-	if !ok {
-		return
-	}
-
 	maxChatID, direction, linked := b.repo.GetCrosspostMaxChat(edited.Chat.ID)
 	if !linked {
 		return
 	}
+	maxMsgID, ok := b.repo.LookupMaxMsgID(edited.Chat.ID, edited.MessageID, maxChatID)
+	if !ok {
+		return
+	}
 	if direction == "max>tg" {
 		return
 	}
@@ -1278,10 +1428,12 @@ func (b *Bridge) handleTgEditedChannelPost(ctx context.Context, edited *TGMessag
 		return
 	}
 
-	m := maxbot.NewMessage().SetChat(maxChatID).SetText(text)
-	if err := b.maxApi.Messages.EditMessage(ctx, maxMsgID, m); err != nil {
-		slog.Error("TG→MAX crosspost edit failed", "err", err)
-	} else {
-		slog.Info("TG→MAX crosspost edited", "mid", maxMsgID)
-	}
+	m := &MaxMessage{ChatID: maxChatID, Text: text}
+	b.deliverToMax(maxChatID, func() {
+		if err := b.max.EditMessage(ctx, maxMsgID, m); err != nil {
+			slog.Error("TG→MAX crosspost edit failed", "err", err)
+		} else {
+			slog.Info("TG→MAX crosspost edited", "mid", maxMsgID)
+		}
+	})
 }
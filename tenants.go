@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Мультитенантный режим: несколько пар TG/MAX-ботов в одном процессе. У каждого
+// арендатора свой Bridge, секрет webhook'ов и пространство имён в общей БД
+// (Repository.ForTenant); HTTP-серверы, webhook- и служебный, общие.
+
+// bridgeSet — мосты процесса: один в обычном режиме, по одному на арендатора в мультитенантном.
+type bridgeSet []*Bridge
+
+// Run поднимает общие HTTP-серверы и запускает все мосты; возвращается, когда все
+// мосты остановились после отмены ctx. Сетевые настройки берутся у первого моста —
+// у арендаторов они общие.
+func (bs bridgeSet) Run(ctx context.Context) {
+	if len(bs) == 0 {
+		return
+	}
+	cfg := bs[0].cfg
+
+	// HTTP поднимается на каждой реплике: webhook'и принимает любая, служебные эндпоинты нужны всем
+	var webhookMux *http.ServeMux
+	if cfg.WebhookURL != "" {
+		webhookMux = http.NewServeMux()
+		for _, b := range bs {
+			webhookMux.HandleFunc(b.tgWebhookPath(), b.webhookHandler("tg"))
+			webhookMux.HandleFunc(b.maxWebhookPath(), b.webhookHandler("max"))
+		}
+	}
+
+	switch {
+	case cfg.MetricsPort != "":
+		go func() {
+			addr := ":" + cfg.MetricsPort
+			mux := http.NewServeMux()
+			bs.registerOpsHandlers(mux)
+			srv := &http.Server{
+				Addr:         addr,
+				Handler:      mux,
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			}
+			slog.Info("Metrics server starting", "addr", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("Metrics server failed", "err", err)
+			}
+		}()
+	case webhookMux != nil:
+		bs.registerOpsHandlers(webhookMux)
+	}
+
+	if webhookMux != nil {
+		go func() {
+			addr := ":" + cfg.WebhookPort
+			srv := &http.Server{
+				Addr:         addr,
+				Handler:      webhookMux,
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			}
+			slog.Info("Webhook server starting", "addr", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("Webhook server failed", "err", err)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range bs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// tenantConfig — пара ботов одного арендатора из списка tenants (CONFIG_FILE или
+// TENANTS_FILE). Остальные настройки (порты, лимиты, форматы) общие.
+type tenantConfig struct {
+	ID               string  `yaml:"id"`
+	TgToken          string  `yaml:"tg_token"`
+	MaxToken         string  `yaml:"max_token"`
+	TgBotURL         string  `yaml:"tg_bot_url"`
+	MaxBotURL        string  `yaml:"max_bot_url"`
+	WebhookSecret    string  `yaml:"webhook_secret"`
+	AllowedUsers     []int64 `yaml:"allowed_users"`
+	OperatorTgChats  []int64 `yaml:"operator_tg_chats"`
+	OperatorMaxChats []int64 `yaml:"operator_max_chats"`
+}
+
+// loadTenants читает TENANTS_FILE — список арендаторов в YAML (JSON-массив тоже
+// подходит) — и проверяет его.
+func loadTenants(path string) ([]tenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []tenantConfig
+	if err := yaml.UnmarshalStrict(data, &tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateTenants(tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tenants, nil
+}
+
+// validateTenants проверяет список арендаторов: id и токены обязательны, id и токены
+// ботов не повторяются.
+func validateTenants(tenants []tenantConfig) error {
+	if len(tenants) == 0 {
+		return fmt.Errorf("no tenants")
+	}
+	ids := make(map[string]bool)
+	tokens := make(map[string]bool)
+	secrets := make(map[string]bool)
+	for i, t := range tenants {
+		switch {
+		case t.ID == "":
+			return fmt.Errorf("tenant #%d: id is empty", i+1)
+		case t.TgToken == "" || t.MaxToken == "":
+			return fmt.Errorf("tenant %q: tg_token and max_token are required", t.ID)
+		case ids[t.ID]:
+			return fmt.Errorf("tenant %q: duplicate id", t.ID)
+		case tokens[t.TgToken] || tokens[t.MaxToken]:
+			return fmt.Errorf("tenant %q: bot token used by another tenant", t.ID)
+		case t.WebhookSecret != "" && secrets[t.WebhookSecret]:
+			return fmt.Errorf("tenant %q: webhook_secret used by another tenant", t.ID)
+		}
+		ids[t.ID] = true
+		tokens[t.TgToken], tokens[t.MaxToken] = true, true
+		secrets[t.WebhookSecret] = true
+	}
+	return nil
+}
+
+// reloadTenants сопоставляет перечитанный по SIGHUP список арендаторов loaded с
+// запущенными running и возвращает их новые настройки. Настройки арендатора применяются
+// на лету, а новые и удалённые арендаторы и смена токенов вступают в силу только после
+// перезапуска — об этом пишется в лог. Без списка (один мост из TG_TOKEN / MAX_TOKEN)
+// running не меняется.
+func reloadTenants(running, loaded []tenantConfig) []tenantConfig {
+	if len(loaded) == 0 {
+		if len(running) > 0 && running[0].ID != "" {
+			slog.Warn("Tenant list removed from config, restart to apply")
+		}
+		return running
+	}
+	byID := make(map[string]tenantConfig, len(loaded))
+	for _, t := range loaded {
+		byID[t.ID] = t
+	}
+	out := make([]tenantConfig, len(running))
+	for i, t := range running {
+		nt, ok := byID[t.ID]
+		delete(byID, t.ID)
+		switch {
+		case !ok:
+			slog.Warn("Tenant removed from config, restart to stop it", "tenant", t.ID)
+			nt = t
+		case nt.TgToken != t.TgToken || nt.MaxToken != t.MaxToken:
+			slog.Warn("Tenant bot tokens changed, restart to apply", "tenant", t.ID)
+			nt.TgToken, nt.MaxToken = t.TgToken, t.MaxToken
+		}
+		out[i] = nt
+	}
+	for id := range byID {
+		slog.Warn("Tenant added to config, restart to start it", "tenant", id)
+	}
+	return out
+}
+
+// apply накладывает настройки арендатора на общую конфигурацию.
+func (t tenantConfig) apply(base Config) Config {
+	cfg := base
+	cfg.Tenants = nil // токены других арендаторов мосту не нужны
+	cfg.TenantID = t.ID
+	cfg.MaxToken = t.MaxToken
+	cfg.WebhookSecret = t.WebhookSecret
+	if t.TgBotURL != "" {
+		cfg.TgBotURL = t.TgBotURL
+	}
+	if t.MaxBotURL != "" {
+		cfg.MaxBotURL = t.MaxBotURL
+	}
+	if t.AllowedUsers != nil {
+		cfg.AllowedUsers = t.AllowedUsers
+	}
+	if t.OperatorTgChats != nil {
+		cfg.OperatorTgChats = t.OperatorTgChats
+	}
+	if t.OperatorMaxChats != nil {
+		cfg.OperatorMaxChats = t.OperatorMaxChats
+	}
+	return cfg
+}
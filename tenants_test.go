@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"ok", `[{"id":"acme","tg_token":"t1","max_token":"m1"},{"id":"globex","tg_token":"t2","max_token":"m2"}]`, ""},
+		{"empty list", `[]`, "no tenants"},
+		{"no id", `[{"tg_token":"t1","max_token":"m1"}]`, "id is empty"},
+		{"no token", `[{"id":"acme","tg_token":"t1"}]`, "required"},
+		{"duplicate id", `[{"id":"acme","tg_token":"t1","max_token":"m1"},{"id":"acme","tg_token":"t2","max_token":"m2"}]`, "duplicate id"},
+		{"shared bot", `[{"id":"acme","tg_token":"t1","max_token":"m1"},{"id":"globex","tg_token":"t1","max_token":"m2"}]`, "another tenant"},
+		{"shared webhook secret", `[{"id":"acme","tg_token":"t1","max_token":"m1","webhook_secret":"s"},{"id":"globex","tg_token":"t2","max_token":"m2","webhook_secret":"s"}]`, "webhook_secret used by another tenant"},
+		{"yaml", "- id: acme\n  tg_token: t1\n  max_token: m1\n- id: globex\n  tg_token: t2\n  max_token: m2\n", ""},
+		{"unknown field", `[{"id":"acme","tg_token":"t1","max_token":"m1","token":"x"}]`, "token"},
+		{"bad json", `{`, "did not find expected node content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			os.WriteFile(path, []byte(tt.json), 0o600)
+			tenants, err := loadTenants(path)
+			if tt.wantErr == "" {
+				if err != nil || len(tenants) != 2 {
+					t.Fatalf("loadTenants = %d tenants, %v; want 2, nil", len(tenants), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReloadTenants(t *testing.T) {
+	running := []tenantConfig{
+		{ID: "acme", TgToken: "t1", MaxToken: "m1"},
+		{ID: "globex", TgToken: "t2", MaxToken: "m2", AllowedUsers: []int64{1}},
+	}
+	loaded := []tenantConfig{
+		{ID: "acme", TgToken: "t1", MaxToken: "m1", AllowedUsers: []int64{7}},
+		{ID: "initech", TgToken: "t3", MaxToken: "m3"},
+	}
+	got := reloadTenants(running, loaded)
+	if len(got) != 2 || got[0].ID != "acme" || len(got[0].AllowedUsers) != 1 || got[0].AllowedUsers[0] != 7 {
+		t.Errorf("acme = %+v, want the reloaded whitelist", got[0])
+	}
+	if got[1].ID != "globex" || len(got[1].AllowedUsers) != 1 || got[1].AllowedUsers[0] != 1 {
+		t.Errorf("removed tenant = %+v, want it unchanged until restart", got[1])
+	}
+
+	loaded[0].TgToken = "t9"
+	if got := reloadTenants(running, loaded); got[0].TgToken != "t1" {
+		t.Errorf("TgToken = %q, want the running token kept", got[0].TgToken)
+	}
+	single := []tenantConfig{{TgToken: "t", MaxToken: "m"}}
+	if got := reloadTenants(single, nil); len(got) != 1 || got[0].TgToken != "t" {
+		t.Errorf("single bridge = %+v, want unchanged", got)
+	}
+}
+
+func TestTenantConfig_Apply(t *testing.T) {
+	base := Config{MaxToken: "base", TgBotURL: "https://t.me/base", AllowedUsers: []int64{1}, WebhookPort: "8443"}
+	cfg := tenantConfig{ID: "acme", MaxToken: "m1", TgBotURL: "https://t.me/acme", OperatorTgChats: []int64{-5}}.apply(base)
+	if cfg.TenantID != "acme" || cfg.MaxToken != "m1" || cfg.TgBotURL != "https://t.me/acme" {
+		t.Errorf("tenant fields not applied: %+v", cfg)
+	}
+	if cfg.WebhookPort != "8443" || len(cfg.AllowedUsers) != 1 || len(cfg.OperatorTgChats) != 1 {
+		t.Errorf("shared fields lost: %+v", cfg)
+	}
+}
+
+func TestBridgeSet_ReadyzPerTenant(t *testing.T) {
+	acme, _, _ := newTestBridge(t)
+	globex, _, _ := newTestBridge(t)
+	acme.cfg.TenantID, globex.cfg.TenantID = "acme", "globex"
+	for _, b := range []*Bridge{acme, globex} {
+		b.health.started("tg", "polling")
+		b.health.started("max", "polling")
+	}
+	globex.health.stopped("max")
+
+	rec := httptest.NewRecorder()
+	bridgeSet{acme, globex}.handleReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var rep tenantsReport
+	if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rep.Ready {
+		t.Errorf("status = %d, ready = %v; want 503, false", rec.Code, rep.Ready)
+	}
+	if len(rep.Tenants) != 2 || rep.Tenants[0].Tenant != "acme" || !rep.Tenants[0].Ready || rep.Tenants[1].Ready {
+		t.Errorf("tenants = %+v, want acme ready and globex not", rep.Tenants)
+	}
+}
@@ -0,0 +1,341 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MAXRequest — запрос бота к фейковому MAX API.
+type MAXRequest struct {
+	Method string // HTTP-метод
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// JSON декодирует тело запроса в v.
+func (r MAXRequest) JSON(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// MAXSentMessage — тело POST /messages в удобном для проверок виде.
+type MAXSentMessage struct {
+	Text        string            `json:"text"`
+	Format      string            `json:"format"`
+	Attachments []json.RawMessage `json:"attachments"`
+	Link        *struct {
+		Type string `json:"type"`
+		Mid  string `json:"mid"`
+	} `json:"link"`
+}
+
+type maxFailure struct {
+	status int
+	body   string
+}
+
+// MAX — фейковый MAX platform API вместе с CDN для загрузок.
+// URL() передаётся в NewMaxBotSender как apiURL.
+type MAX struct {
+	srv       *httptest.Server
+	botUserID int64
+	botName   string
+
+	mu        sync.Mutex
+	nextMid   int
+	nextFile  int
+	updates   []map[string]any
+	requests  []MAXRequest
+	admins    map[int64][]int64
+	failures  map[string][]maxFailure
+	notify    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMAX запускает фейковый MAX API для бота с указанным user_id.
+func NewMAX(botUserID int64, botName string) *MAX {
+	s := &MAX{
+		botUserID: botUserID,
+		botName:   botName,
+		admins:    make(map[int64][]int64),
+		failures:  make(map[string][]maxFailure),
+		notify:    make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL — base URL стенда.
+func (s *MAX) URL() string { return s.srv.URL }
+
+// Close останавливает стенд, прерывая висящие long-poll запросы.
+func (s *MAX) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.srv.Close()
+}
+
+// --- Входящие апдейты ---
+
+// PushUpdate добавляет апдейт в ленту GET /updates (timestamp проставляется автоматически).
+func (s *MAX) PushUpdate(update map[string]any) {
+	if _, ok := update["timestamp"]; !ok {
+		update["timestamp"] = time.Now().UnixMilli()
+	}
+	s.mu.Lock()
+	s.updates = append(s.updates, update)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// PushMessage добавляет message_created в групповой чат и возвращает mid сообщения.
+func (s *MAX) PushMessage(chatID, senderID int64, senderName, text string) string {
+	mid := s.newMid()
+	s.PushUpdate(map[string]any{
+		"update_type": "message_created",
+		"message":     maxMessage(chatID, "chat", senderID, senderName, mid, text),
+	})
+	return mid
+}
+
+// PushDialogMessage добавляет message_created в личку бота и возвращает mid.
+func (s *MAX) PushDialogMessage(chatID, senderID int64, senderName, text string) string {
+	mid := s.newMid()
+	s.PushUpdate(map[string]any{
+		"update_type": "message_created",
+		"message":     maxMessage(chatID, "dialog", senderID, senderName, mid, text),
+	})
+	return mid
+}
+
+// PushEdit добавляет message_edited для сообщения mid.
+func (s *MAX) PushEdit(chatID, senderID int64, senderName, mid, text string) {
+	s.PushUpdate(map[string]any{
+		"update_type": "message_edited",
+		"message":     maxMessage(chatID, "chat", senderID, senderName, mid, text),
+	})
+}
+
+// PushRemoved добавляет message_removed для сообщения mid.
+func (s *MAX) PushRemoved(chatID int64, mid string) {
+	s.PushUpdate(map[string]any{
+		"update_type": "message_removed",
+		"message_id":  mid,
+		"chat_id":     chatID,
+	})
+}
+
+func (s *MAX) newMid() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextMid++
+	return fmt.Sprintf("mid.%d", s.nextMid)
+}
+
+func maxMessage(chatID int64, chatType string, senderID int64, senderName, mid, text string) map[string]any {
+	return map[string]any{
+		"sender":    map[string]any{"user_id": senderID, "name": senderName},
+		"recipient": map[string]any{"chat_id": chatID, "chat_type": chatType},
+		"timestamp": time.Now().UnixMilli(),
+		"body":      map[string]any{"mid": mid, "seq": 0, "text": text},
+	}
+}
+
+// --- Настройка ---
+
+// SetAdmins задаёт список админов чата для GET /chats/{id}/members/admins.
+func (s *MAX) SetAdmins(chatID int64, userIDs ...int64) {
+	s.mu.Lock()
+	s.admins[chatID] = userIDs
+	s.mu.Unlock()
+}
+
+// FailNext заставляет следующий запрос "METHOD /path" вернуть status с телом body
+// (такой запрос не попадает в Requests).
+func (s *MAX) FailNext(method, path string, status int, body string) {
+	key := method + " " + path
+	s.mu.Lock()
+	s.failures[key] = append(s.failures[key], maxFailure{status, body})
+	s.mu.Unlock()
+}
+
+// --- Проверки ---
+
+// Requests возвращает запросы с данным HTTP-методом и путём (пустые значения — любые).
+func (s *MAX) Requests(method, path string) []MAXRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []MAXRequest
+	for _, r := range s.requests {
+		if (method == "" || r.Method == method) && (path == "" || r.Path == path) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Await ждёт, пока придёт хотя бы n запросов "METHOD /path".
+func (s *MAX) Await(method, path string, n int, timeout time.Duration) ([]MAXRequest, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		reqs := s.Requests(method, path)
+		if len(reqs) >= n {
+			return reqs, true
+		}
+		if time.Now().After(deadline) {
+			return reqs, false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// SentMessages возвращает тела всех успешных POST /messages в чат chatID.
+func (s *MAX) SentMessages(chatID int64) []MAXSentMessage {
+	var out []MAXSentMessage
+	for _, r := range s.Requests(http.MethodPost, "/messages") {
+		if r.Query.Get("chat_id") != strconv.FormatInt(chatID, 10) {
+			continue
+		}
+		var m MAXSentMessage
+		if r.JSON(&m) == nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// --- HTTP ---
+
+func (s *MAX) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := "/" + strings.TrimLeft(r.URL.Path, "/")
+
+	if r.Method == http.MethodGet && path == "/updates" {
+		s.getUpdates(w, r)
+		return
+	}
+
+	key := r.Method + " " + path
+	s.mu.Lock()
+	var fail *maxFailure
+	if q := s.failures[key]; len(q) > 0 {
+		fail = &q[0]
+		s.failures[key] = q[1:]
+	} else {
+		s.requests = append(s.requests, MAXRequest{Method: r.Method, Path: path, Query: r.URL.Query(), Body: body})
+	}
+	s.mu.Unlock()
+	if fail != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(fail.status)
+		io.WriteString(w, fail.body)
+		return
+	}
+
+	switch {
+	case key == "GET /me":
+		maxReply(w, map[string]any{"user_id": s.botUserID, "name": s.botName, "username": s.botName, "is_bot": true})
+	case key == "POST /messages":
+		mid := s.newMid()
+		var m MAXSentMessage
+		json.Unmarshal(body, &m)
+		chatID, _ := strconv.ParseInt(r.URL.Query().Get("chat_id"), 10, 64)
+		maxReply(w, map[string]any{"message": maxMessage(chatID, "chat", s.botUserID, s.botName, mid, m.Text)})
+	case key == "PUT /messages", key == "DELETE /messages", key == "POST /answers",
+		key == "POST /subscriptions", key == "DELETE /subscriptions":
+		maxReply(w, map[string]any{"success": true})
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/members/admins"):
+		id, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(path, "/chats/"), "/members/admins"), 10, 64)
+		s.mu.Lock()
+		members := make([]map[string]any, 0, len(s.admins[id]))
+		for _, uid := range s.admins[id] {
+			members = append(members, map[string]any{"user_id": uid, "name": fmt.Sprintf("Admin %d", uid), "is_admin": true})
+		}
+		s.mu.Unlock()
+		maxReply(w, map[string]any{"members": members})
+	case key == "POST /uploads":
+		typ := r.URL.Query().Get("type")
+		resp := map[string]any{"url": s.srv.URL + "/cdn/upload?type=" + typ}
+		if typ == "video" || typ == "audio" {
+			resp["token"] = s.newFileToken(typ)
+		}
+		maxReply(w, resp)
+	case key == "POST /cdn/upload":
+		switch typ := r.URL.Query().Get("type"); typ {
+		case "image":
+			maxReply(w, map[string]any{"photos": map[string]any{"orig": map[string]any{"token": s.newFileToken(typ)}}})
+		case "video", "audio":
+			io.WriteString(w, "<retval>1</retval>")
+		default:
+			s.mu.Lock()
+			s.nextFile++
+			id := s.nextFile
+			s.mu.Unlock()
+			maxReply(w, map[string]any{"fileId": id, "token": fmt.Sprintf("%s-token-%d", typ, id)})
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		maxReply(w, map[string]any{"code": "not.found", "message": "Unknown path " + path})
+	}
+}
+
+func (s *MAX) newFileToken(typ string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextFile++
+	return fmt.Sprintf("%s-token-%d", typ, s.nextFile)
+}
+
+// getUpdates отдаёт апдейты начиная с marker (индекс в ленте), держа запрос до timeout секунд.
+func (s *MAX) getUpdates(w http.ResponseWriter, r *http.Request) {
+	marker, _ := strconv.Atoi(r.URL.Query().Get("marker"))
+	timeout, _ := strconv.Atoi(r.URL.Query().Get("timeout"))
+	// Отвечаем чуть раньше клиентского таймаута, чтобы не ловить timeout error в SDK.
+	hold := time.Duration(timeout)*time.Second - 500*time.Millisecond
+	deadline := time.After(hold)
+	for {
+		s.mu.Lock()
+		var out []map[string]any
+		if marker < len(s.updates) {
+			out = append(out, s.updates[marker:]...)
+		}
+		next := len(s.updates)
+		notify := s.notify
+		s.mu.Unlock()
+		if len(out) > 0 || hold <= 0 {
+			if out == nil {
+				out = []map[string]any{}
+			}
+			maxReply(w, map[string]any{"updates": out, "marker": next})
+			return
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			maxReply(w, map[string]any{"updates": []any{}, "marker": next})
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func maxReply(w http.ResponseWriter, v any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,365 @@
+// Package testserver — httptest-стенды Telegram Bot API и MAX API для интеграционных тестов.
+//
+// Стенды держат всё состояние в памяти: входящие апдейты кладутся через Push*,
+// исходящие запросы бота записываются и доступны через Requests/Await.
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TGRequest — запрос бота к фейковому Telegram Bot API.
+type TGRequest struct {
+	Method string
+	Params map[string]string
+	Files  map[string][]byte
+}
+
+// ChatID возвращает chat_id запроса (0, если не задан).
+func (r TGRequest) ChatID() int64 {
+	id, _ := strconv.ParseInt(r.Params["chat_id"], 10, 64)
+	return id
+}
+
+type tgFailure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// TG — фейковый Telegram Bot API.
+// URL() передаётся в NewTGBotSender как apiURL; файлы отдаются по /files/<file_id>.
+type TG struct {
+	srv   *httptest.Server
+	token string
+
+	mu        sync.Mutex
+	nextMsgID int
+	nextUpdID int
+	updates   []map[string]any
+	requests  []TGRequest
+	files     map[string][]byte
+	members   map[[2]int64]string
+	failures  map[string][]tgFailure
+	notify    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTG запускает фейковый Telegram Bot API для бота с токеном token.
+func NewTG(token string) *TG {
+	s := &TG{
+		token:    token,
+		files:    make(map[string][]byte),
+		members:  make(map[[2]int64]string),
+		failures: make(map[string][]tgFailure),
+		notify:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL — base URL стенда.
+func (s *TG) URL() string { return s.srv.URL }
+
+// Close останавливает стенд, прерывая висящие long-poll запросы.
+func (s *TG) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.srv.Close()
+}
+
+// --- Входящие апдейты ---
+
+// PushUpdate добавляет апдейт в очередь getUpdates (update_id проставляется автоматически).
+func (s *TG) PushUpdate(update map[string]any) {
+	s.mu.Lock()
+	s.nextUpdID++
+	update["update_id"] = s.nextUpdID
+	s.updates = append(s.updates, update)
+	s.wakeLocked()
+	s.mu.Unlock()
+}
+
+// PushMessage добавляет входящее сообщение и возвращает его message_id.
+func (s *TG) PushMessage(chatID, userID int64, firstName, text string) int {
+	msg := s.newMessage(chatID, userID, firstName)
+	msg["text"] = text
+	s.PushUpdate(map[string]any{"message": msg})
+	return msg["message_id"].(int)
+}
+
+// PushPhoto добавляет входящее фото (файл доступен через getFile) и возвращает message_id.
+func (s *TG) PushPhoto(chatID, userID int64, firstName, fileID, caption string, data []byte) int {
+	s.AddFile(fileID, data)
+	msg := s.newMessage(chatID, userID, firstName)
+	msg["caption"] = caption
+	msg["photo"] = []map[string]any{{
+		"file_id":        fileID,
+		"file_unique_id": fileID,
+		"width":          100,
+		"height":         100,
+		"file_size":      len(data),
+	}}
+	s.PushUpdate(map[string]any{"message": msg})
+	return msg["message_id"].(int)
+}
+
+// PushEdit добавляет edited_message для ранее отправленного сообщения.
+func (s *TG) PushEdit(chatID int64, msgID int, userID int64, firstName, text string) {
+	msg := map[string]any{
+		"message_id": msgID,
+		"date":       time.Now().Unix(),
+		"edit_date":  time.Now().Unix(),
+		"chat":       tgChat(chatID),
+		"from":       map[string]any{"id": userID, "is_bot": false, "first_name": firstName},
+		"text":       text,
+	}
+	s.PushUpdate(map[string]any{"edited_message": msg})
+}
+
+func (s *TG) newMessage(chatID, userID int64, firstName string) map[string]any {
+	s.mu.Lock()
+	s.nextMsgID++
+	id := s.nextMsgID
+	s.mu.Unlock()
+	return map[string]any{
+		"message_id": id,
+		"date":       time.Now().Unix(),
+		"chat":       tgChat(chatID),
+		"from":       map[string]any{"id": userID, "is_bot": false, "first_name": firstName},
+	}
+}
+
+func tgChat(chatID int64) map[string]any {
+	typ := "supergroup"
+	if chatID > 0 {
+		typ = "private"
+	}
+	return map[string]any{"id": chatID, "type": typ, "title": fmt.Sprintf("Chat %d", chatID)}
+}
+
+// --- Настройка ---
+
+// AddFile регистрирует файл для getFile и скачивания.
+func (s *TG) AddFile(fileID string, data []byte) {
+	s.mu.Lock()
+	s.files[fileID] = data
+	s.mu.Unlock()
+}
+
+// SetChatMember задаёт статус участника для getChatMember ("creator", "administrator", "member"...).
+func (s *TG) SetChatMember(chatID, userID int64, status string) {
+	s.mu.Lock()
+	s.members[[2]int64{chatID, userID}] = status
+	s.mu.Unlock()
+}
+
+// FailNext заставляет следующий вызов method вернуть ошибку Bot API
+// (такой вызов не попадает в Requests).
+func (s *TG) FailNext(method string, code int, description string, retryAfter int) {
+	s.mu.Lock()
+	s.failures[method] = append(s.failures[method], tgFailure{code, description, retryAfter})
+	s.mu.Unlock()
+}
+
+// --- Проверки ---
+
+// Requests возвращает все запросы к method (пустой method — все запросы).
+func (s *TG) Requests(method string) []TGRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []TGRequest
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Await ждёт, пока к method придёт хотя бы n запросов.
+func (s *TG) Await(method string, n int, timeout time.Duration) ([]TGRequest, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		reqs := s.Requests(method)
+		if len(reqs) >= n {
+			return reqs, true
+		}
+		if time.Now().After(deadline) {
+			return reqs, false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// --- HTTP ---
+
+func (s *TG) wakeLocked() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *TG) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		s.mu.Lock()
+		data, ok := s.files[strings.TrimPrefix(r.URL.Path, "/files/")]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+		return
+	}
+
+	prefix := "/bot" + s.token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		tgReply(w, nil, &tgFailure{code: 401, description: "Unauthorized"})
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+	req := TGRequest{Method: method, Params: map[string]string{}, Files: map[string][]byte{}}
+	if err := r.ParseMultipartForm(64 << 20); err == nil {
+		for k, v := range r.MultipartForm.Value {
+			if len(v) > 0 {
+				req.Params[k] = v[0]
+			}
+		}
+		for k, fhs := range r.MultipartForm.File {
+			if f, err := fhs[0].Open(); err == nil {
+				req.Files[k], _ = io.ReadAll(f)
+				f.Close()
+			}
+		}
+	}
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r, req)
+		return
+	}
+
+	s.mu.Lock()
+	var fail *tgFailure
+	if q := s.failures[method]; len(q) > 0 {
+		fail = &q[0]
+		s.failures[method] = q[1:]
+	} else {
+		s.requests = append(s.requests, req)
+	}
+	s.mu.Unlock()
+	if fail != nil {
+		tgReply(w, nil, fail)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		tgReply(w, map[string]any{"id": 1, "is_bot": true, "first_name": "Bridge", "username": "test_bridge_bot"}, nil)
+	case "sendMessage", "sendPhoto", "sendVideo", "sendAudio", "sendDocument", "sendAnimation", "sendSticker", "sendVoice":
+		tgReply(w, s.sentMessage(req), nil)
+	case "sendMediaGroup":
+		var media []json.RawMessage
+		json.Unmarshal([]byte(req.Params["media"]), &media)
+		msgs := make([]map[string]any, 0, len(media))
+		for range media {
+			msgs = append(msgs, s.sentMessage(req))
+		}
+		tgReply(w, msgs, nil)
+	case "editMessageText", "editMessageMedia", "editMessageCaption":
+		msgID, _ := strconv.Atoi(req.Params["message_id"])
+		tgReply(w, map[string]any{"message_id": msgID, "date": time.Now().Unix(), "chat": tgChat(req.ChatID())}, nil)
+	case "getFile":
+		id := req.Params["file_id"]
+		s.mu.Lock()
+		data, ok := s.files[id]
+		s.mu.Unlock()
+		if !ok {
+			tgReply(w, nil, &tgFailure{code: 400, description: "Bad Request: invalid file_id"})
+			return
+		}
+		tgReply(w, map[string]any{"file_id": id, "file_unique_id": id, "file_size": len(data), "file_path": "files/" + id}, nil)
+	case "getChatMember":
+		userID, _ := strconv.ParseInt(req.Params["user_id"], 10, 64)
+		s.mu.Lock()
+		status, ok := s.members[[2]int64{req.ChatID(), userID}]
+		s.mu.Unlock()
+		if !ok {
+			status = "member"
+		}
+		tgReply(w, map[string]any{"status": status, "user": map[string]any{"id": userID, "is_bot": false, "first_name": "User"}}, nil)
+	case "getChat":
+		tgReply(w, tgChat(req.ChatID()), nil)
+	default:
+		tgReply(w, true, nil)
+	}
+}
+
+func (s *TG) sentMessage(req TGRequest) map[string]any {
+	s.mu.Lock()
+	s.nextMsgID++
+	id := s.nextMsgID
+	s.mu.Unlock()
+	return map[string]any{
+		"message_id": id,
+		"date":       time.Now().Unix(),
+		"chat":       tgChat(req.ChatID()),
+		"from":       map[string]any{"id": 1, "is_bot": true, "first_name": "Bridge"},
+		"text":       req.Params["text"],
+	}
+}
+
+func (s *TG) getUpdates(w http.ResponseWriter, r *http.Request, req TGRequest) {
+	offset, _ := strconv.Atoi(req.Params["offset"])
+	timeout, _ := strconv.Atoi(req.Params["timeout"])
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	for {
+		s.mu.Lock()
+		var out []map[string]any
+		for _, u := range s.updates {
+			if u["update_id"].(int) >= offset {
+				out = append(out, u)
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+		if len(out) > 0 || timeout == 0 {
+			if out == nil {
+				out = []map[string]any{}
+			}
+			tgReply(w, out, nil)
+			return
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			tgReply(w, []map[string]any{}, nil)
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func tgReply(w http.ResponseWriter, result any, fail *tgFailure) {
+	w.Header().Set("Content-Type", "application/json")
+	if fail != nil {
+		resp := map[string]any{"ok": false, "error_code": fail.code, "description": fail.description}
+		if fail.retryAfter > 0 {
+			resp["parameters"] = map[string]any{"retry_after": fail.retryAfter}
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // --- Custom types for TG adapter ---
@@ -61,6 +62,7 @@ type Entity struct {
 type TGMessage struct {
 	MessageID       int
 	MessageThreadID int
+	IsTopicMessage  bool // сообщение отправлено в топик форума
 	Chat            ChatInfo
 	From            *UserInfo
 	SenderChat      *ChatInfo
@@ -77,9 +79,14 @@ type TGMessage struct {
 	MediaGroupID    string
 	ReplyToMessage  *TGMessage
 	ForwardOriginChat *ChatInfo // replaces ForwardFromChat, from forward_origin
+	ForwardFrom     string // автор пересланного сообщения (пусто — не пересылка)
 	MigrateToChatID int64
+	EditDate        int64 // unix-время правки (0 — не редактировалось)
 	Entities        []Entity
 	CaptionEntities []Entity
+	Poll            *TGPoll
+	Location        *TGLocation // геопозиция или место (venue)
+	Contact         *TGContact
 }
 
 type TGCallback struct {
@@ -89,12 +96,78 @@ type TGCallback struct {
 	Data    string
 }
 
+// TGLocation — геопозиция; с Title — место (venue) с названием и адресом.
+type TGLocation struct {
+	Latitude   float64
+	Longitude  float64
+	LivePeriod int // трансляция геопозиции, секунд (0 — обычная геопозиция)
+	Title      string
+	Address    string
+}
+
+// TGContact — контакт: телефон обязателен, VCard — полная карточка (может быть пустой).
+type TGContact struct {
+	PhoneNumber string
+	FirstName   string
+	LastName    string
+	UserID      int64
+	VCard       string
+}
+
+// TGPoll — опрос: в сообщении (message.poll) и в апдейте poll с новыми счётчиками.
+// Апдейты poll Bot API присылает только для опросов, отправленных ботом, и для закрытых.
+type TGPoll struct {
+	ID       string
+	Question string
+	Options  []TGPollOption
+	Multiple bool // можно выбрать несколько вариантов
+	Closed   bool
+}
+
+type TGPollOption struct {
+	Text   string
+	Voters int
+}
+
+// TGReaction — пользователь изменил свои реакции на сообщение (message_reaction).
+// Реакции — эмодзи; custom emoji приходят как "⭐".
+type TGReaction struct {
+	Chat      ChatInfo
+	MessageID int
+	User      *UserInfo // nil, если реакция от имени чата
+	ActorChat *ChatInfo
+	Date      int64
+	Emoji     []string // реакции после изменения
+}
+
+// TGReactionCount — счётчики анонимных реакций на сообщение (message_reaction_count, каналы).
+type TGReactionCount struct {
+	Chat      ChatInfo
+	MessageID int
+	Date      int64
+	Counts    map[string]int // эмодзи → количество
+}
+
 type TGUpdate struct {
-	Message           *TGMessage
-	EditedMessage     *TGMessage
-	ChannelPost       *TGMessage
-	EditedChannelPost *TGMessage
-	CallbackQuery     *TGCallback
+	UpdateID             int64
+	Message              *TGMessage
+	EditedMessage        *TGMessage
+	ChannelPost          *TGMessage
+	EditedChannelPost    *TGMessage
+	CallbackQuery        *TGCallback
+	MessageReaction      *TGReaction
+	MessageReactionCount *TGReactionCount
+	Poll                 *TGPoll
+
+	// Checkpoint — служебный апдейт поллера (остальные поля пусты): все апдейты
+	// с ID меньше Checkpoint переданы listener'у, его можно сохранить как offset для
+	// рестарта, когда они доставлены. Ack listener закрывает после сохранения — до
+	// этого поллер не запрашивает следующую пачку (запрос подтверждает предыдущую).
+	Checkpoint int64
+	Ack        chan struct{} `json:"-"`
+	// InboxID — служебный апдейт webhook-режима (остальные поля пусты): следующий
+	// апдейт прочитан из записи inbox InboxID. Listener удаляет её, когда апдейт обработан.
+	InboxID int64 `json:"-"`
 }
 
 // SendOpts — optional parameters for send methods.
@@ -144,6 +217,8 @@ type TGError struct {
 	Code            int
 	Description     string
 	MigrateToChatID int64
+	Kind            ErrKind
+	RetryAfter      time.Duration // для ErrRateLimited — retry_after из ответа
 }
 
 func (e *TGError) Error() string {
@@ -175,6 +250,12 @@ type TGSender interface {
 	SendAudio(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error)
 	SendDocument(ctx context.Context, chatID int64, file FileArg, opts *SendOpts) (int, error)
 	SendMediaGroup(ctx context.Context, chatID int64, media []TGInputMedia, opts *SendOpts) ([]int, error)
+	// SendLocation отправляет геопозицию, а если задан loc.Title — место (venue).
+	// Подписи у них нет: из opts используются ThreadID и ReplyToID.
+	SendLocation(ctx context.Context, chatID int64, loc TGLocation, opts *SendOpts) (int, error)
+	SendContact(ctx context.Context, chatID int64, contact TGContact, opts *SendOpts) (int, error)
+	// SendPoll отправляет опрос (используются ThreadID и ReplyToID из opts).
+	SendPoll(ctx context.Context, chatID int64, question string, options []string, multiple bool, opts *SendOpts) (msgID int, pollID string, err error)
 
 	EditMessageText(ctx context.Context, chatID int64, msgID int, text string, opts *SendOpts) error
 	EditMessageMedia(ctx context.Context, chatID int64, msgID int, media TGInputMedia) error
@@ -190,8 +271,11 @@ type TGSender interface {
 
 	SetWebhook(ctx context.Context, url string) error
 	DeleteWebhook(ctx context.Context) error
-	StartWebhook(ctx context.Context, path string) <-chan TGUpdate
-	StartPolling(ctx context.Context) <-chan TGUpdate
+	// ParseUpdate разбирает тело webhook-запроса Telegram.
+	ParseUpdate(body []byte) (TGUpdate, error)
+	// StartPolling читает апдейты long polling'ом начиная с offset (0 — с первого
+	// неподтверждённого) и отдаёт их пачками, за каждой пачкой — TGUpdate{Checkpoint}.
+	StartPolling(ctx context.Context, offset int64) <-chan TGUpdate
 
 	BotUsername() string
 	BotToken() string
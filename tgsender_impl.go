@@ -3,10 +3,13 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -17,26 +20,18 @@ type tgBotSender struct {
 	token    string
 	username string
 	apiURL   string
-	updates  chan TGUpdate
+
+	pollClient *http.Client // для long polling (таймаут больше pollTimeout)
 }
 
 func NewTGBotSender(ctx context.Context, token, apiURL string) (*tgBotSender, error) {
 	s := &tgBotSender{
-		token:   token,
-		apiURL:  apiURL,
-		updates: make(chan TGUpdate, 100),
+		token:      token,
+		apiURL:     apiURL,
+		pollClient: &http.Client{Timeout: pollTimeout + 15*time.Second},
 	}
 
-	opts := []bot.Option{
-		bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
-			tgu := convertUpdate(update)
-			select {
-			case s.updates <- tgu:
-			default:
-				slog.Warn("TG update channel full, dropping update")
-			}
-		}),
-	}
+	var opts []bot.Option
 	if apiURL != "" {
 		opts = append(opts, bot.WithServerURL(apiURL))
 	}
@@ -63,19 +58,16 @@ func (s *tgBotSender) BotToken() string    { return s.token }
 
 // --- Updates ---
 
-func (s *tgBotSender) StartPolling(ctx context.Context) <-chan TGUpdate {
-	go s.b.Start(ctx)
-	return s.updates
-}
-
-func (s *tgBotSender) StartWebhook(ctx context.Context, path string) <-chan TGUpdate {
-	http.HandleFunc(path, s.b.WebhookHandler())
-	go s.b.StartWebhook(ctx) // start workers that dispatch updates to handlers
-	return s.updates
+func (s *tgBotSender) ParseUpdate(body []byte) (TGUpdate, error) {
+	var u models.Update
+	if err := json.Unmarshal(body, &u); err != nil {
+		return TGUpdate{}, fmt.Errorf("parse TG update: %w", err)
+	}
+	return convertUpdate(&u), nil
 }
 
 func (s *tgBotSender) SetWebhook(ctx context.Context, url string) error {
-	_, err := s.b.SetWebhook(ctx, &bot.SetWebhookParams{URL: url})
+	_, err := s.b.SetWebhook(ctx, &bot.SetWebhookParams{URL: url, AllowedUpdates: tgAllowedUpdates})
 	return wrapErr(err)
 }
 
@@ -179,6 +171,93 @@ func (s *tgBotSender) SendMediaGroup(ctx context.Context, chatID int64, media []
 	return ids, nil
 }
 
+func (s *tgBotSender) SendLocation(ctx context.Context, chatID int64, loc TGLocation, opts *SendOpts) (int, error) {
+	var threadID int
+	var reply *models.ReplyParameters
+	if opts != nil {
+		threadID = opts.ThreadID
+		if opts.ReplyToID != 0 {
+			reply = &models.ReplyParameters{MessageID: opts.ReplyToID}
+		}
+	}
+	var msg *models.Message
+	var err error
+	if loc.Title != "" {
+		msg, err = s.b.SendVenue(ctx, &bot.SendVenueParams{
+			ChatID:          chatID,
+			MessageThreadID: threadID,
+			Latitude:        loc.Latitude,
+			Longitude:       loc.Longitude,
+			Title:           loc.Title,
+			Address:         loc.Address,
+			ReplyParameters: reply,
+		})
+	} else {
+		msg, err = s.b.SendLocation(ctx, &bot.SendLocationParams{
+			ChatID:          chatID,
+			MessageThreadID: threadID,
+			Latitude:        loc.Latitude,
+			Longitude:       loc.Longitude,
+			ReplyParameters: reply,
+		})
+	}
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return msg.ID, nil
+}
+
+func (s *tgBotSender) SendContact(ctx context.Context, chatID int64, contact TGContact, opts *SendOpts) (int, error) {
+	p := &bot.SendContactParams{
+		ChatID:      chatID,
+		PhoneNumber: contact.PhoneNumber,
+		FirstName:   contact.FirstName,
+		LastName:    contact.LastName,
+		VCard:       contact.VCard,
+	}
+	if opts != nil {
+		if opts.ThreadID != 0 {
+			p.MessageThreadID = opts.ThreadID
+		}
+		if opts.ReplyToID != 0 {
+			p.ReplyParameters = &models.ReplyParameters{MessageID: opts.ReplyToID}
+		}
+	}
+	msg, err := s.b.SendContact(ctx, p)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return msg.ID, nil
+}
+
+func (s *tgBotSender) SendPoll(ctx context.Context, chatID int64, question string, options []string, multiple bool, opts *SendOpts) (int, string, error) {
+	p := &bot.SendPollParams{
+		ChatID:                chatID,
+		Question:              question,
+		AllowsMultipleAnswers: multiple,
+	}
+	for _, o := range options {
+		p.Options = append(p.Options, models.InputPollOption{Text: o})
+	}
+	if opts != nil {
+		if opts.ThreadID != 0 {
+			p.MessageThreadID = opts.ThreadID
+		}
+		if opts.ReplyToID != 0 {
+			p.ReplyParameters = &models.ReplyParameters{MessageID: opts.ReplyToID}
+		}
+	}
+	msg, err := s.b.SendPoll(ctx, p)
+	if err != nil {
+		return 0, "", wrapErr(err)
+	}
+	var pollID string
+	if msg.Poll != nil {
+		pollID = msg.Poll.ID
+	}
+	return msg.ID, pollID, nil
+}
+
 // --- Edit ---
 
 func (s *tgBotSender) EditMessageText(ctx context.Context, chatID int64, msgID int, text string, opts *SendOpts) error {
@@ -456,34 +535,120 @@ func wrapErr(err error) error {
 			Code:            400,
 			Description:     me.Message,
 			MigrateToChatID: int64(me.MigrateToChatID),
+			Kind:            ErrChatMigrated,
 		}
 	}
-	if errors.Is(err, bot.ErrorForbidden) {
-		return &TGError{Code: 403, Description: err.Error()}
-	}
-	if errors.Is(err, bot.ErrorBadRequest) {
-		return &TGError{Code: 400, Description: err.Error()}
-	}
-	if errors.Is(err, bot.ErrorNotFound) {
-		return &TGError{Code: 404, Description: err.Error()}
-	}
 	var tmr *bot.TooManyRequestsError
 	if errors.As(err, &tmr) {
-		return &TGError{Code: 429, Description: tmr.Error()}
+		return &TGError{
+			Code:        429,
+			Description: tmr.Error(),
+			Kind:        ErrRateLimited,
+			RetryAfter:  tgRetryAfter(tmr),
+		}
+	}
+	var code int
+	switch {
+	case errors.Is(err, bot.ErrorForbidden):
+		code = 403
+	case errors.Is(err, bot.ErrorBadRequest):
+		code = 400
+	case errors.Is(err, bot.ErrorNotFound):
+		code = 404
+	default:
+		return err
 	}
-	return err
+	return &TGError{Code: code, Description: err.Error(), Kind: classifyTGError(code, err.Error())}
 }
 
 // --- Update conversion ---
 
 func convertUpdate(u *models.Update) TGUpdate {
 	return TGUpdate{
-		Message:           convertMsg(u.Message),
-		EditedMessage:     convertMsg(u.EditedMessage),
-		ChannelPost:       convertMsg(u.ChannelPost),
-		EditedChannelPost: convertMsg(u.EditedChannelPost),
-		CallbackQuery:     convertCallback(u.CallbackQuery),
+		UpdateID:             u.ID,
+		Message:              convertMsg(u.Message),
+		EditedMessage:        convertMsg(u.EditedMessage),
+		ChannelPost:          convertMsg(u.ChannelPost),
+		EditedChannelPost:    convertMsg(u.EditedChannelPost),
+		CallbackQuery:        convertCallback(u.CallbackQuery),
+		MessageReaction:      convertReaction(u.MessageReaction),
+		MessageReactionCount: convertReactionCount(u.MessageReactionCount),
+		Poll:                 convertPoll(u.Poll),
+	}
+}
+
+// tgAllowedUpdates — апдейты, которые запрашиваются у Telegram. Реакции Bot API
+// присылает, только если они перечислены явно; poll — счётчики голосов опросов.
+var tgAllowedUpdates = []string{
+	models.AllowedUpdateMessage,
+	models.AllowedUpdateEditedMessage,
+	models.AllowedUpdateChannelPost,
+	models.AllowedUpdateEditedChannelPost,
+	models.AllowedUpdateCallbackQuery,
+	models.AllowedUpdateMessageReaction,
+	models.AllowedUpdateMessageReactionCount,
+	models.AllowedUpdatePoll,
+}
+
+// reactionEmoji — эмодзи реакции; custom emoji и платные реакции показываются как "⭐".
+func reactionEmoji(r models.ReactionType) string {
+	if r.Type == models.ReactionTypeTypeEmoji && r.ReactionTypeEmoji != nil {
+		return r.ReactionTypeEmoji.Emoji
+	}
+	return "⭐"
+}
+
+func convertReaction(r *models.MessageReactionUpdated) *TGReaction {
+	if r == nil {
+		return nil
+	}
+	out := &TGReaction{
+		Chat:      ChatInfo{ID: r.Chat.ID, Type: string(r.Chat.Type), Title: r.Chat.Title},
+		MessageID: r.MessageID,
+		Date:      int64(r.Date),
+	}
+	if r.User != nil {
+		out.User = &UserInfo{ID: r.User.ID, IsBot: r.User.IsBot, UserName: r.User.Username, FirstName: r.User.FirstName, LastName: r.User.LastName}
 	}
+	if r.ActorChat != nil {
+		out.ActorChat = &ChatInfo{ID: r.ActorChat.ID, Type: string(r.ActorChat.Type), Title: r.ActorChat.Title}
+	}
+	for _, rt := range r.NewReaction {
+		out.Emoji = append(out.Emoji, reactionEmoji(rt))
+	}
+	return out
+}
+
+func convertReactionCount(r *models.MessageReactionCountUpdated) *TGReactionCount {
+	if r == nil {
+		return nil
+	}
+	out := &TGReactionCount{
+		Chat:      ChatInfo{ID: r.Chat.ID, Type: string(r.Chat.Type), Title: r.Chat.Title},
+		MessageID: r.MessageID,
+		Date:      int64(r.Date),
+		Counts:    make(map[string]int),
+	}
+	for _, rc := range r.Reactions {
+		out.Counts[reactionEmoji(rc.Type)] += rc.TotalCount
+	}
+	return out
+}
+
+func convertPoll(p *models.Poll) *TGPoll {
+	if p == nil {
+		return nil
+	}
+	out := &TGPoll{
+		ID:       p.ID,
+		Question: p.Question,
+		Multiple: p.AllowsMultipleAnswers,
+		Closed:   p.IsClosed,
+	}
+	for _, o := range p.Options {
+		out.Options = append(out.Options, TGPollOption{Text: o.Text, Voters: o.VoterCount})
+	}
+	return out
 }
 
 func convertMsg(m *models.Message) *TGMessage {
@@ -493,6 +658,7 @@ func convertMsg(m *models.Message) *TGMessage {
 	msg := &TGMessage{
 		MessageID:       m.ID,
 		MessageThreadID: m.MessageThreadID,
+		IsTopicMessage:  m.IsTopicMessage,
 		Chat: ChatInfo{
 			ID:    m.Chat.ID,
 			Type:  string(m.Chat.Type),
@@ -502,6 +668,7 @@ func convertMsg(m *models.Message) *TGMessage {
 		Caption:         m.Caption,
 		MediaGroupID:    m.MediaGroupID,
 		MigrateToChatID: m.MigrateToChatID,
+		EditDate:        int64(m.EditDate),
 	}
 
 	if m.From != nil {
@@ -531,6 +698,7 @@ func convertMsg(m *models.Message) *TGMessage {
 			Title: ch.Title,
 		}
 	}
+	msg.ForwardFrom = forwardOriginName(m.ForwardOrigin)
 
 	// Photo
 	for _, p := range m.Photo {
@@ -562,6 +730,19 @@ func convertMsg(m *models.Message) *TGMessage {
 		msg.VideoNote = &FileInfo{FileID: m.VideoNote.FileID, FileSize: m.VideoNote.FileSize}
 	}
 
+	msg.Poll = convertPoll(m.Poll)
+
+	if m.Venue != nil {
+		v := m.Venue
+		msg.Location = &TGLocation{Latitude: v.Location.Latitude, Longitude: v.Location.Longitude, Title: v.Title, Address: v.Address}
+	} else if m.Location != nil {
+		msg.Location = &TGLocation{Latitude: m.Location.Latitude, Longitude: m.Location.Longitude, LivePeriod: m.Location.LivePeriod}
+	}
+	if m.Contact != nil {
+		c := m.Contact
+		msg.Contact = &TGContact{PhoneNumber: c.PhoneNumber, FirstName: c.FirstName, LastName: c.LastName, UserID: c.UserID, VCard: c.VCard}
+	}
+
 	if m.ReplyToMessage != nil {
 		msg.ReplyToMessage = convertMsg(m.ReplyToMessage)
 	}
@@ -576,6 +757,32 @@ func convertMsg(m *models.Message) *TGMessage {
 	return msg
 }
 
+// forwardOriginName — автор пересланного сообщения для подписи «Переслано от»:
+// пользователь, скрытый пользователь, чат или канал (с подписью автора, если есть).
+func forwardOriginName(o *models.MessageOrigin) string {
+	if o == nil {
+		return ""
+	}
+	withSignature := func(title string, signature *string) string {
+		if signature != nil && *signature != "" {
+			return title + " (" + *signature + ")"
+		}
+		return title
+	}
+	switch {
+	case o.MessageOriginUser != nil:
+		u := o.MessageOriginUser.SenderUser
+		return strings.TrimSpace(u.FirstName + " " + u.LastName)
+	case o.MessageOriginHiddenUser != nil:
+		return o.MessageOriginHiddenUser.SenderUserName
+	case o.MessageOriginChat != nil:
+		return withSignature(o.MessageOriginChat.SenderChat.Title, o.MessageOriginChat.AuthorSignature)
+	case o.MessageOriginChannel != nil:
+		return withSignature(o.MessageOriginChannel.Chat.Title, o.MessageOriginChannel.AuthorSignature)
+	}
+	return ""
+}
+
 func convertCallback(cb *models.CallbackQuery) *TGCallback {
 	if cb == nil {
 		return nil
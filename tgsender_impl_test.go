@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -342,6 +343,9 @@ func TestWrapErr_MigrateError(t *testing.T) {
 	if tgErr.MigrateToChatID != -1001234 {
 		t.Errorf("MigrateToChatID = %d", tgErr.MigrateToChatID)
 	}
+	if tgErr.Kind != ErrChatMigrated {
+		t.Errorf("Kind = %v, want chat_migrated", tgErr.Kind)
+	}
 }
 
 func TestWrapErr_Forbidden(t *testing.T) {
@@ -353,6 +357,9 @@ func TestWrapErr_Forbidden(t *testing.T) {
 	if tgErr.Code != 403 {
 		t.Errorf("Code = %d, want 403", tgErr.Code)
 	}
+	if tgErr.Kind != ErrPermanent {
+		t.Errorf("Kind = %v, want permanent", tgErr.Kind)
+	}
 }
 
 func TestWrapErr_BadRequest(t *testing.T) {
@@ -387,6 +394,9 @@ func TestWrapErr_TooManyRequests(t *testing.T) {
 	if tgErr.Code != 429 {
 		t.Errorf("Code = %d, want 429", tgErr.Code)
 	}
+	if tgErr.Kind != ErrRateLimited || tgErr.RetryAfter != 30*time.Second {
+		t.Errorf("Kind = %v, RetryAfter = %v; want rate_limited, 30s", tgErr.Kind, tgErr.RetryAfter)
+	}
 }
 
 func TestWrapErr_UnknownError(t *testing.T) {
@@ -588,3 +598,105 @@ func TestGetFileDirectURL_CustomAPI(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+// --- convertReaction ---
+
+func TestConvertReaction(t *testing.T) {
+	if convertReaction(nil) != nil || convertReactionCount(nil) != nil {
+		t.Fatal("nil reaction updates must convert to nil")
+	}
+	r := convertReaction(&models.MessageReactionUpdated{
+		Chat:      models.Chat{ID: -100, Type: "supergroup"},
+		MessageID: 7,
+		User:      &models.User{ID: 1, FirstName: "Ivan"},
+		Date:      1700000000,
+		NewReaction: []models.ReactionType{
+			{Type: models.ReactionTypeTypeEmoji, ReactionTypeEmoji: &models.ReactionTypeEmoji{Emoji: "👍"}},
+			{Type: models.ReactionTypeTypeCustomEmoji, ReactionTypeCustomEmoji: &models.ReactionTypeCustomEmoji{CustomEmojiID: "42"}},
+		},
+	})
+	if r.Chat.ID != -100 || r.MessageID != 7 || r.User == nil || r.User.ID != 1 || r.Date != 1700000000 {
+		t.Errorf("convertReaction = %+v", r)
+	}
+	if len(r.Emoji) != 2 || r.Emoji[0] != "👍" || r.Emoji[1] != "⭐" {
+		t.Errorf("Emoji = %q, want [👍 ⭐]", r.Emoji)
+	}
+
+	c := convertReactionCount(&models.MessageReactionCountUpdated{
+		Chat:      models.Chat{ID: -1001, Type: "channel"},
+		MessageID: 3,
+		Reactions: []models.ReactionCount{
+			{Type: models.ReactionType{Type: models.ReactionTypeTypeEmoji, ReactionTypeEmoji: &models.ReactionTypeEmoji{Emoji: "🔥"}}, TotalCount: 5},
+			{Type: models.ReactionType{Type: models.ReactionTypeTypePaid, ReactionTypePaid: &models.ReactionTypePaid{}}, TotalCount: 2},
+		},
+	})
+	if c.Counts["🔥"] != 5 || c.Counts["⭐"] != 2 {
+		t.Errorf("Counts = %v, want 🔥:5 ⭐:2", c.Counts)
+	}
+}
+
+func TestConvertPoll(t *testing.T) {
+	u := convertUpdate(&models.Update{
+		Message: &models.Message{ID: 7, Chat: models.Chat{ID: -100}, Poll: &models.Poll{
+			ID:                    "p1",
+			Question:              "Обед?",
+			Options:               []models.PollOption{{Text: "Пицца", VoterCount: 2}, {Text: "Суши"}},
+			AllowsMultipleAnswers: true,
+		}},
+	})
+	p := u.Message.Poll
+	if p == nil || p.ID != "p1" || p.Question != "Обед?" || !p.Multiple || p.Closed {
+		t.Fatalf("Message.Poll = %+v", p)
+	}
+	if len(p.Options) != 2 || p.Options[0] != (TGPollOption{Text: "Пицца", Voters: 2}) || p.Options[1].Text != "Суши" {
+		t.Errorf("Options = %+v", p.Options)
+	}
+
+	u = convertUpdate(&models.Update{Poll: &models.Poll{ID: "p1", IsClosed: true}})
+	if u.Poll == nil || u.Poll.ID != "p1" || !u.Poll.Closed || u.Message != nil {
+		t.Errorf("poll update = %+v, want closed p1", u)
+	}
+}
+
+func TestConvertMsg_LocationContact(t *testing.T) {
+	m := convertMsg(&models.Message{ID: 1, Location: &models.Location{Latitude: 55.75, Longitude: 37.62, LivePeriod: 900}})
+	if m.Location == nil || *m.Location != (TGLocation{Latitude: 55.75, Longitude: 37.62, LivePeriod: 900}) {
+		t.Errorf("Location = %+v", m.Location)
+	}
+
+	m = convertMsg(&models.Message{ID: 2,
+		Location: &models.Location{Latitude: 55.75, Longitude: 37.62},
+		Venue:    &models.Venue{Location: models.Location{Latitude: 55.75, Longitude: 37.62}, Title: "Кафе", Address: "Тверская, 1"},
+	})
+	if m.Location == nil || m.Location.Title != "Кафе" || m.Location.Address != "Тверская, 1" || m.Location.Latitude != 55.75 {
+		t.Errorf("venue Location = %+v", m.Location)
+	}
+
+	m = convertMsg(&models.Message{ID: 3, Contact: &models.Contact{PhoneNumber: "+7900", FirstName: "Olga", UserID: 5}})
+	if m.Contact == nil || *m.Contact != (TGContact{PhoneNumber: "+7900", FirstName: "Olga", UserID: 5}) || m.Location != nil {
+		t.Errorf("Contact = %+v", m.Contact)
+	}
+}
+
+func TestForwardOriginName(t *testing.T) {
+	sig := "Редакция"
+	tests := []struct {
+		name   string
+		origin *models.MessageOrigin
+		want   string
+	}{
+		{"none", nil, ""},
+		{"user", &models.MessageOrigin{MessageOriginUser: &models.MessageOriginUser{SenderUser: models.User{FirstName: "Anna", LastName: "K"}}}, "Anna K"},
+		{"hidden user", &models.MessageOrigin{MessageOriginHiddenUser: &models.MessageOriginHiddenUser{SenderUserName: "Аноним"}}, "Аноним"},
+		{"chat", &models.MessageOrigin{MessageOriginChat: &models.MessageOriginChat{SenderChat: models.Chat{Title: "Группа"}}}, "Группа"},
+		{"channel with signature", &models.MessageOrigin{MessageOriginChannel: &models.MessageOriginChannel{Chat: models.Chat{Title: "News"}, AuthorSignature: &sig}}, "News (Редакция)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertMsg(&models.Message{ID: 1, ForwardOrigin: tt.origin})
+			if got.ForwardFrom != tt.want {
+				t.Errorf("ForwardFrom = %q, want %q", got.ForwardFrom, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
-	"mime/multipart"
 	"net/http"
 	"strings"
 	"time"
@@ -41,7 +38,9 @@ func (b *Bridge) downloadURL(url string) ([]byte, error) {
 
 // sendTgMediaFromURL скачивает файл с URL и отправляет в TG как upload.
 // maxBytes=0 means no size limit. fileName overrides name extracted from URL.
-func (b *Bridge) sendTgMediaFromURL(ctx context.Context, tgChatID int64, mediaURL, mediaType, caption, parseMode string, replyToID, threadID int, maxBytes int64, fileName ...string) (int, error) {
+func (b *Bridge) sendTgMediaFromURL(ctx context.Context, tgChatID int64, mediaURL, mediaType, caption, parseMode string, replyToID, threadID int, maxBytes int64, fileName ...string) (msgID int, err error) {
+	start := time.Now()
+	defer func() { b.observeUpload("max2tg", start, err) }()
 	slog.Debug("sendTgMediaFromURL start", "url", mediaURL, "type", mediaType, "tgChat", tgChatID)
 	data, nameFromURL, err := b.downloadURLWithLimit(mediaURL, maxBytes)
 	if err == nil {
@@ -82,106 +81,10 @@ func (b *Bridge) sendTgMediaFromURL(ctx context.Context, tgChatID int64, mediaUR
 	}
 }
 
-// customUploadToMax — обход бага SDK: CDN возвращает XML вместо JSON
-func (b *Bridge) customUploadToMax(ctx context.Context, uploadType maxschemes.UploadType, reader io.Reader, fileName string) (*maxschemes.UploadedInfo, error) {
-	// 1. Получаем URL и token от MAX API
-	apiURL := fmt.Sprintf("https://platform-api.max.ru/uploads?type=%s&v=1.2.5", string(uploadType))
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Authorization", b.cfg.MaxToken)
-
-	resp, err := b.apiClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("get upload url: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("upload endpoint status: %d", resp.StatusCode)
-	}
-
-	endpointBody, _ := io.ReadAll(resp.Body)
-	slog.Debug("MAX upload endpoint response", "status", resp.StatusCode, "body", string(endpointBody))
-
-	var endpoint maxschemes.UploadEndpoint
-	if err := json.Unmarshal(endpointBody, &endpoint); err != nil {
-		return nil, fmt.Errorf("decode upload endpoint: %w", err)
-	}
-	slog.Debug("MAX upload endpoint", "url", endpoint.Url, "token", endpoint.Token)
-
-	// Для video/audio: token приходит сразу, но файл ВСЁ РАВНО нужно загрузить на CDN URL.
-	// Для file/image: token приходит после загрузки на CDN.
-	videoToken := endpoint.Token // сохраняем для video/audio
-
-	if endpoint.Url == "" && videoToken != "" {
-		// Нет URL для загрузки, но есть token — file/image (не video/audio)
-		slog.Debug("MAX upload ok (endpoint token, no CDN needed)")
-		return &maxschemes.UploadedInfo{Token: videoToken}, nil
-	}
-
-	if endpoint.Url == "" {
-		return nil, fmt.Errorf("upload endpoint returned empty URL and no token")
-	}
-
-	// 2. Загружаем файл на CDN (multipart)
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	part, err := writer.CreateFormFile("data", fileName)
-	if err != nil {
-		return nil, fmt.Errorf("create form file: %w", err)
-	}
-	if _, err := io.Copy(part, reader); err != nil {
-		return nil, fmt.Errorf("copy to form: %w", err)
-	}
-	writer.Close()
-
-	cdnReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, &buf)
-	if err != nil {
-		return nil, fmt.Errorf("create CDN request: %w", err)
-	}
-	cdnReq.Header.Set("Content-Type", writer.FormDataContentType())
-
-	cdnResp, err := b.httpClient.Do(cdnReq)
-	if err != nil {
-		return nil, fmt.Errorf("upload to CDN: %w", err)
-	}
-	defer cdnResp.Body.Close()
-
-	cdnBody, _ := io.ReadAll(cdnResp.Body)
-	slog.Debug("MAX CDN response", "status", cdnResp.StatusCode, "body", string(cdnBody))
-
-	// Проверяем ошибку запрещённого расширения
-	var apiErr struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	}
-	if json.Unmarshal(cdnBody, &apiErr) == nil && apiErr.Code == "upload.error" {
-		slog.Warn("MAX upload rejected", "code", apiErr.Code, "message", apiErr.Message, "file", fileName)
-		return nil, &ErrForbiddenExtension{Name: fileName}
-	}
-
-	// 3. Для video/audio: используем token из шага 1 (CDN возвращает только retval)
-	if videoToken != "" {
-		slog.Debug("MAX upload ok (video/audio token from endpoint)", "token", videoToken)
-		return &maxschemes.UploadedInfo{Token: videoToken}, nil
-	}
-
-	// Для file/image: парсим CDN ответ (fileId + token в camelCase)
-	var cdnResult struct {
-		FileID int64  `json:"fileId"`
-		Token  string `json:"token"`
-	}
-	if err := json.Unmarshal(cdnBody, &cdnResult); err == nil && cdnResult.Token != "" {
-		slog.Debug("MAX upload ok", "fileId", cdnResult.FileID)
-		return &maxschemes.UploadedInfo{Token: cdnResult.Token, FileID: cdnResult.FileID}, nil
-	}
-	return nil, fmt.Errorf("no token in CDN response: %s", string(cdnBody))
-}
-
 // uploadTgPhotoToMax скачивает фото из TG и загружает в MAX через SDK (возвращает PhotoTokens).
-func (b *Bridge) uploadTgPhotoToMax(ctx context.Context, fileID string) (*maxschemes.PhotoTokens, error) {
+func (b *Bridge) uploadTgPhotoToMax(ctx context.Context, fileID string) (tokens *maxschemes.PhotoTokens, err error) {
+	start := time.Now()
+	defer func() { b.observeUpload("tg2max_photo", start, err) }()
 	fileURL, err := b.tgFileURL(ctx, fileID)
 	if err != nil {
 		return nil, fmt.Errorf("tg getFileURL: %w", err)
@@ -198,11 +101,13 @@ func (b *Bridge) uploadTgPhotoToMax(ctx context.Context, fileID string) (*maxsch
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("tg download status: %d", resp.StatusCode)
 	}
-	return b.maxApi.Uploads.UploadPhotoFromReader(ctx, resp.Body)
+	return b.max.UploadPhotoFromReader(ctx, &countingReader{r: resp.Body, tenant: b.cfg.TenantID, direction: "tg2max"})
 }
 
 // uploadTgMediaToMax скачивает файл из TG и загружает в MAX
-func (b *Bridge) uploadTgMediaToMax(ctx context.Context, fileID string, uploadType maxschemes.UploadType, fileName string) (*maxschemes.UploadedInfo, error) {
+func (b *Bridge) uploadTgMediaToMax(ctx context.Context, fileID string, uploadType maxschemes.UploadType, fileName string) (info *maxschemes.UploadedInfo, err error) {
+	start := time.Now()
+	defer func() { b.observeUpload("tg2max_media", start, err) }()
 	fileURL, err := b.tgFileURL(ctx, fileID)
 	if err != nil {
 		return nil, fmt.Errorf("tg getFileURL: %w", err)
@@ -225,109 +130,16 @@ func (b *Bridge) uploadTgMediaToMax(ctx context.Context, fileID string, uploadTy
 
 	slog.Debug("TG file downloaded", "size", resp.ContentLength)
 
-	return b.customUploadToMax(ctx, uploadType, resp.Body, fileName)
-}
-
-// sendMaxDirect — отправка сообщения в MAX напрямую (обход SDK)
-func (b *Bridge) sendMaxDirect(ctx context.Context, chatID int64, text string, attType string, token string, replyTo string) (string, error) {
-	return b.sendMaxDirectFormatted(ctx, chatID, text, attType, token, replyTo, "")
+	return b.max.UploadMedia(ctx, uploadType, &countingReader{r: resp.Body, tenant: b.cfg.TenantID, direction: "tg2max"}, fileName)
 }
 
+// sendMaxDirectFormatted — отправка сообщения в MAX с одним загруженным вложением (по token).
 func (b *Bridge) sendMaxDirectFormatted(ctx context.Context, chatID int64, text string, attType string, token string, replyTo string, format string) (string, error) {
-	type attachment struct {
-		Type    string            `json:"type"`
-		Payload map[string]string `json:"payload"`
-	}
-	type msgBody struct {
-		Text        string       `json:"text,omitempty"`
-		Attachments []attachment `json:"attachments,omitempty"`
-		Format      string       `json:"format,omitempty"`
-		Link        *struct {
-			Type string `json:"type"`
-			Mid  string `json:"mid"`
-		} `json:"link,omitempty"`
-	}
-
-	body := msgBody{Text: text, Format: format}
-	if attType != "" && token != "" {
-		body.Attachments = []attachment{{
-			Type:    attType,
-			Payload: map[string]string{"token": token},
-		}}
-	}
-	if replyTo != "" {
-		body.Link = &struct {
-			Type string `json:"type"`
-			Mid  string `json:"mid"`
-		}{Type: "reply", Mid: replyTo}
-	}
-
-	data, err := json.Marshal(body)
-	if err != nil {
-		return "", err
-	}
-
-	url := fmt.Sprintf("https://platform-api.max.ru/messages?chat_id=%d&v=1.2.5", chatID)
-
-	// Пауза перед первой отправкой если есть вложение (MAX CDN нужно время на обработку)
+	m := &MaxMessage{ChatID: chatID, Text: text, Format: format, ReplyTo: replyTo}
 	if attType != "" && token != "" {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(3 * time.Second):
-		}
-	}
-
-	// Retry при attachment.not.ready (файл ещё обрабатывается)
-	for attempt := 0; attempt < 20; attempt++ {
-		if attempt > 0 {
-			delay := time.Duration(3+attempt*2) * time.Second
-			select {
-			case <-ctx.Done():
-				return "", ctx.Err()
-			case <-time.After(delay):
-			}
-			slog.Warn("MAX retry", "attempt", attempt+1, "maxAttempts", 20)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
-		if err != nil {
-			return "", err
-		}
-		req.Header.Set("Authorization", b.cfg.MaxToken)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := b.apiClient.Do(req)
-		if err != nil {
-			return "", err
-		}
-
-		respBody, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if resp.StatusCode == 200 {
-			var result struct {
-				Message struct {
-					Body struct {
-						Mid string `json:"mid"`
-					} `json:"body"`
-				} `json:"message"`
-			}
-			if err := json.Unmarshal(respBody, &result); err != nil {
-				return "", err
-			}
-			return result.Message.Body.Mid, nil
-		}
-
-		// Проверяем attachment.not.ready — ретраим
-		if resp.StatusCode == 400 && strings.Contains(string(respBody), "attachment.not.ready") {
-			slog.Warn("MAX attachment not ready, waiting")
-			continue
-		}
-
-		return "", fmt.Errorf("MAX API %d: %s", resp.StatusCode, string(respBody))
+		m.AddMedia(attType, token)
 	}
-	return "", fmt.Errorf("MAX attachment not ready after 10 retries")
+	return b.max.SendMessage(ctx, m)
 }
 
 // formatFileSize formats file size in human-readable form.
@@ -419,5 +231,6 @@ func (b *Bridge) downloadURLWithLimit(url string, maxBytes int64) ([]byte, strin
 		return nil, name, &ErrFileTooLarge{Size: int64(len(data)), Name: name}
 	}
 
+	metricMediaBytes.WithLabelValues(b.cfg.TenantID, "max2tg").Add(float64(len(data)))
 	return data, name, nil
 }